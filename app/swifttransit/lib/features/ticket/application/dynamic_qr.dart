@@ -0,0 +1,38 @@
+import 'dart:convert';
+import 'dart:typed_data';
+
+import 'package:crypto/crypto.dart';
+
+/// Rotating ticket codes, computed on the phone from the ticket's
+/// `dynamic_qr_secret` so they keep working offline. Must match
+/// `ticket.DynamicQR` in the backend.
+class DynamicQr {
+  static const stepSeconds = 30;
+  static const _digits = 8;
+
+  /// Returns `STD.<ticket id>.<code>` for the time step containing [now].
+  static String code(int ticketId, String secret, DateTime now) {
+    final key = base64Url.decode(base64Url.normalize(secret));
+    final step = now.millisecondsSinceEpoch ~/ 1000 ~/ stepSeconds;
+
+    // setUint64 is not available on the web
+    final msg = ByteData(8)
+      ..setUint32(0, step ~/ 0x100000000)
+      ..setUint32(4, step % 0x100000000);
+    final sum = Hmac(sha256, key).convert(msg.buffer.asUint8List()).bytes;
+
+    final offset = sum[sum.length - 1] & 0x0f;
+    final value =
+        ((sum[offset] & 0x7f) << 24) |
+        (sum[offset + 1] << 16) |
+        (sum[offset + 2] << 8) |
+        sum[offset + 3];
+    final digits = (value % 100000000).toString().padLeft(_digits, '0');
+    return 'STD.$ticketId.$digits';
+  }
+
+  /// Seconds until the code shown at [now] changes.
+  static int secondsLeft(DateTime now) {
+    return stepSeconds - (now.millisecondsSinceEpoch ~/ 1000) % stepSeconds;
+  }
+}
@@ -86,7 +86,16 @@ class LiveLocationProvider extends ChangeNotifier {
       _subscription = _channel!.stream.listen(
         (event) {
           try {
-            final data = event is String ? jsonDecode(event) : event;
+            final message = event is String ? jsonDecode(event) : event;
+            if (message is! Map<String, dynamic>) return;
+            // Messages are wrapped in a versioned envelope: {v, type, data}.
+            if (message['type'] == 'error') {
+              errorMessage = message['data']?['message']?.toString();
+              notifyListeners();
+              return;
+            }
+            if (message['type'] != 'location') return;
+            final data = message['data'];
             if (data is Map<String, dynamic>) {
               final update = LiveLocationUpdate.fromJson(data);
               busLocations[update.busId] = update;
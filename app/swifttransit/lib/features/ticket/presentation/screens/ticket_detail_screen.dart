@@ -1,9 +1,12 @@
+import 'dart:async';
+
 import 'package:flutter/material.dart';
 import 'package:google_fonts/google_fonts.dart';
 import 'package:provider/provider.dart';
 import 'package:swifttransit/core/colors.dart';
 import 'package:swifttransit/core/constants.dart';
 import 'package:swifttransit/features/dashboard/application/dashboard_provider.dart';
+import 'package:swifttransit/features/ticket/application/dynamic_qr.dart';
 
 class TicketDetailScreen extends StatefulWidget {
   const TicketDetailScreen({
@@ -170,11 +173,40 @@ class _TicketDetailScreenState extends State<TicketDetailScreen> {
   }
 }
 
-class _TicketCard extends StatelessWidget {
+class _TicketCard extends StatefulWidget {
   const _TicketCard({required this.ticket});
 
   final Map<String, dynamic> ticket;
 
+  @override
+  State<_TicketCard> createState() => _TicketCardState();
+}
+
+class _TicketCardState extends State<_TicketCard> {
+  Timer? _timer;
+
+  Map<String, dynamic> get ticket => widget.ticket;
+
+  String? get _dynamicSecret => ticket['dynamic_qr_secret'] as String?;
+
+  @override
+  void initState() {
+    super.initState();
+    // Redraw every second so the rotating code and countdown stay current
+    if (_dynamicSecret != null) {
+      _timer = Timer.periodic(
+        const Duration(seconds: 1),
+        (_) => setState(() {}),
+      );
+    }
+  }
+
+  @override
+  void dispose() {
+    _timer?.cancel();
+    super.dispose();
+  }
+
   @override
   Widget build(BuildContext context) {
     final ticketId = ticket['id'];
@@ -183,7 +215,13 @@ class _TicketCard extends StatelessWidget {
         '${ticket['start_destination']} → ${ticket['end_destination']}';
     final fare = ticket['fare'];
     final date = ticket['created_at'];
-    final qrData = ticket['qr_code'] ?? 'TICKET-$ticketId';
+    // A rotating code cannot be reused from a screenshot; fall back to the
+    // signed token, which buses can verify offline
+    final now = DateTime.now();
+    final dynamicSecret = _dynamicSecret;
+    final qrData = dynamicSecret != null
+        ? DynamicQr.code(ticketId as int, dynamicSecret, now)
+        : ticket['qr_token'] ?? ticket['qr_code'] ?? 'TICKET-$ticketId';
     final qrUrl =
         'https://api.qrserver.com/v1/create-qr-code/?size=150x150&data=$qrData';
     final status = ticket['cancelled_at'] != null
@@ -261,7 +299,9 @@ class _TicketCard extends StatelessWidget {
                 const Divider(height: 30),
                 const SizedBox(height: 10),
                 Text(
-                  'Scan to Verify',
+                  dynamicSecret != null
+                      ? 'Scan to Verify • refreshes in ${DynamicQr.secondsLeft(now)}s'
+                      : 'Scan to Verify',
                   style: GoogleFonts.poppins(color: Colors.grey, fontSize: 12),
                 ),
                 const SizedBox(height: 10),
@@ -269,6 +309,7 @@ class _TicketCard extends StatelessWidget {
                   qrUrl,
                   width: 150,
                   height: 150,
+                  gaplessPlayback: true,
                   loadingBuilder: (context, child, loadingProgress) {
                     if (loadingProgress == null) return child;
                     return SizedBox(
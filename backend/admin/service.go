@@ -40,6 +40,7 @@ type Service interface {
 
 	// Tickets
 	GetAllTickets(page, pageSize int) ([]domain.Ticket, int, error)
+	GetTicketHistory(ticketID int64) ([]domain.TicketEvent, error)
 
 	// Transactions
 	GetAllTransactions(page, pageSize int) ([]domain.Transaction, int, error)
@@ -67,6 +68,7 @@ func (s *service) Login(username, password string) (*domain.Admin, string, error
 		return nil, "", fmt.Errorf("invalid credentials")
 	}
 
+	admin.Role = domain.RoleAdmin
 	token, err := s.utilHandler.CreateJWT(admin)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to generate token: %w", err)
@@ -154,6 +156,10 @@ func (s *service) GetAllTickets(page, pageSize int) ([]domain.Ticket, int, error
 	return s.repo.GetAllTickets(pageSize, offset)
 }
 
+func (s *service) GetTicketHistory(ticketID int64) ([]domain.TicketEvent, error) {
+	return s.repo.GetTicketEvents(ticketID)
+}
+
 // Transactions
 func (s *service) GetAllTransactions(page, pageSize int) ([]domain.Transaction, int, error) {
 	offset := (page - 1) * pageSize
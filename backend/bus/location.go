@@ -0,0 +1,98 @@
+package bus
+
+import (
+	"fmt"
+	"swift_transit/domain"
+	"swift_transit/location"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Highest speed accepted from a bus, in km/h
+	maxBusSpeed = 150
+
+	// Device clocks may run slightly ahead of the server
+	maxClockSkew = time.Minute
+
+	// Oldest buffered point accepted from a device
+	maxPointAge = 7 * 24 * time.Hour
+)
+
+// AuthenticateDevice checks the credentials a tracker presents to the MQTT broker.
+func (svc *service) AuthenticateDevice(regNum, password string) (*domain.BusCredential, error) {
+	bus, err := svc.repo.GetBusByRegistrationNumber(regNum)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(bus.Password), []byte(password)); err != nil {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	return bus, nil
+}
+
+func (svc *service) GetByRegistrationNumber(regNum string) (*domain.BusCredential, error) {
+	return svc.repo.GetBusByRegistrationNumber(regNum)
+}
+
+// ValidateLocation checks a position reported by busID and fills in its
+// identity. routeIDs are the routes the bus may report on; the first one is
+// used when the update does not name a route.
+func (svc *service) ValidateLocation(busID int64, routeIDs []int64, update *location.LocationUpdate) error {
+	if update.BusID == 0 {
+		update.BusID = busID
+	}
+	if update.BusID != busID {
+		return fmt.Errorf("bus_id does not match the authenticated bus")
+	}
+
+	if len(routeIDs) == 0 {
+		return fmt.Errorf("bus has no route configured")
+	}
+	if update.RouteID == 0 {
+		update.RouteID = routeIDs[0]
+	}
+	allowed := false
+	for _, routeID := range routeIDs {
+		if routeID == update.RouteID {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("bus is not assigned to route %d", update.RouteID)
+	}
+
+	if update.Latitude < -90 || update.Latitude > 90 || update.Longitude < -180 || update.Longitude > 180 {
+		return fmt.Errorf("coordinates out of range")
+	}
+	// GPS modules without a fix report 0,0
+	if update.Latitude == 0 && update.Longitude == 0 {
+		return fmt.Errorf("missing GPS fix")
+	}
+	if update.Speed < 0 || update.Speed > maxBusSpeed {
+		return fmt.Errorf("invalid speed")
+	}
+
+	if !update.RecordedAt.IsZero() {
+		if update.RecordedAt.After(time.Now().Add(maxClockSkew)) {
+			return fmt.Errorf("recorded_at is in the future")
+		}
+		if time.Since(update.RecordedAt) > maxPointAge {
+			return fmt.Errorf("recorded_at is too old")
+		}
+	}
+
+	return nil
+}
+
+// RecordLocations stores validated positions in the location history and
+// returns how many were new.
+func (svc *service) RecordLocations(busID int64, updates []location.LocationUpdate) (int64, error) {
+	if len(updates) == 0 {
+		return 0, nil
+	}
+	return svc.repo.SaveLocations(busID, updates)
+}
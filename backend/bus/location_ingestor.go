@@ -0,0 +1,147 @@
+package bus
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/infra/mqtt"
+	"swift_transit/location"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// Trackers publish to buses/{registration}/location
+	locationTopic = "buses/+/location"
+
+	// How long a bus looked up from a topic is reused
+	busCacheTTL = 5 * time.Minute
+)
+
+// devicePosition is the JSON payload published by a tracker.
+type devicePosition struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Speed     float64 `json:"speed"`
+	RouteID   int64   `json:"route_id"`
+	Variant   string  `json:"variant"` // up or down, optional
+
+	// When the tracker took the reading; the receive time if omitted
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type cachedBus struct {
+	bus      *domain.BusCredential
+	loadedAt time.Time
+}
+
+// LocationIngestor feeds positions published by MQTT trackers into the hub.
+// Devices are authenticated by the broker (see the /mqtt/auth endpoints), which
+// only lets a bus publish to its own topic, so the topic identifies the bus.
+type LocationIngestor struct {
+	svc  Service
+	mqtt *mqtt.MQTT
+	hub  *location.Hub
+
+	mu    sync.Mutex
+	buses map[string]cachedBus
+}
+
+func NewLocationIngestor(svc Service, mqtt *mqtt.MQTT, hub *location.Hub) *LocationIngestor {
+	return &LocationIngestor{
+		svc:   svc,
+		mqtt:  mqtt,
+		hub:   hub,
+		buses: make(map[string]cachedBus),
+	}
+}
+
+func (i *LocationIngestor) Start() {
+	if err := i.mqtt.Subscribe(locationTopic, 0, i.handle); err != nil {
+		log.Printf("MQTT location ingestion disabled: %v", err)
+		return
+	}
+	log.Printf("Ingesting bus locations from MQTT topic %s", locationTopic)
+}
+
+func (i *LocationIngestor) handle(_ paho.Client, msg paho.Message) {
+	parts := strings.Split(msg.Topic(), "/")
+	if len(parts) != 3 || parts[1] == "" {
+		return
+	}
+	regNum := parts[1]
+
+	var pos devicePosition
+	if err := json.Unmarshal(msg.Payload(), &pos); err != nil {
+		log.Printf("invalid MQTT location payload from %s: %v", regNum, err)
+		return
+	}
+
+	bus, err := i.lookup(regNum)
+	if err != nil {
+		log.Printf("MQTT location from unknown bus %s: %v", regNum, err)
+		return
+	}
+
+	candidates := []int64{bus.RouteIdUp, bus.RouteIdDown}
+	switch strings.ToLower(pos.Variant) {
+	case "up":
+		candidates = []int64{bus.RouteIdUp}
+	case "down":
+		candidates = []int64{bus.RouteIdDown}
+	}
+	var routeIDs []int64
+	for _, routeID := range candidates {
+		if routeID != 0 {
+			routeIDs = append(routeIDs, routeID)
+		}
+	}
+
+	update := location.LocationUpdate{
+		BusID:     bus.Id,
+		RouteID:   pos.RouteID,
+		Latitude:  pos.Latitude,
+		Longitude: pos.Longitude,
+		Speed:     pos.Speed,
+
+		RecordedAt: pos.RecordedAt,
+	}
+	if err := i.svc.ValidateLocation(bus.Id, routeIDs, &update); err != nil {
+		log.Printf("rejected MQTT location from %s: %v", regNum, err)
+		return
+	}
+
+	// Stored like positions posted over HTTP, so tap stops and history see them
+	if update.RecordedAt.IsZero() {
+		update.RecordedAt = time.Now()
+	}
+	if _, err := i.svc.RecordLocations(bus.Id, []location.LocationUpdate{update}); err != nil {
+		log.Printf("failed to save MQTT location from %s: %v", regNum, err)
+		return
+	}
+
+	i.hub.BroadcastLocation(update)
+}
+
+func (i *LocationIngestor) lookup(regNum string) (*domain.BusCredential, error) {
+	i.mu.Lock()
+	cached, ok := i.buses[regNum]
+	i.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < busCacheTTL {
+		return cached.bus, nil
+	}
+
+	bus, err := i.svc.GetByRegistrationNumber(regNum)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	i.buses[regNum] = cachedBus{bus: bus, loadedAt: time.Now()}
+	i.mu.Unlock()
+	return bus, nil
+}
@@ -2,7 +2,7 @@ package bus
 
 import (
 	"swift_transit/domain"
-	"swift_transit/ticket"
+	"swift_transit/location"
 )
 
 type Service interface {
@@ -10,11 +10,15 @@ type Service interface {
 	Login(regNum, password string, variant string) (*BusLoginResult, error)
 	Register(regNum, password string, routeIdUp, routeIdDown int64) (*domain.BusCredential, error)
 	ValidateTicket(ticketID int64, routeID int64, busName string) error
-	CheckTicket(req ticket.CheckTicketRequest) (map[string]interface{}, error)
+	AuthenticateDevice(regNum, password string) (*domain.BusCredential, error)
+	GetByRegistrationNumber(regNum string) (*domain.BusCredential, error)
+	ValidateLocation(busID int64, routeIDs []int64, update *location.LocationUpdate) error
+	RecordLocations(busID int64, updates []location.LocationUpdate) (int64, error)
 }
 
 type BusRepo interface {
 	FindBus(start, end string) ([]domain.Bus, error)
 	GetBusByRegistrationNumber(regNum string) (*domain.BusCredential, error)
 	Create(busCred domain.BusCredential) (*domain.BusCredential, error)
+	SaveLocations(busID int64, updates []location.LocationUpdate) (int64, error)
 }
@@ -2,10 +2,10 @@ package bus
 
 import (
 	"fmt"
-	"math"
 	"strings"
 	"swift_transit/domain"
 	"swift_transit/ticket"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -34,7 +34,7 @@ func (svc *service) FindBus(start, end string) ([]domain.Bus, error) {
 		return nil, err
 	}
 	for i := range buses {
-		buses[i].Fare = math.Ceil(buses[i].Fare)
+		buses[i].Fare = buses[i].Fare.CeilTaka()
 	}
 	return buses, nil
 }
@@ -87,78 +87,39 @@ func (svc *service) Register(regNum, password string, routeIdUp, routeIdDown int
 
 func (svc *service) ValidateTicket(ticketID int64, routeID int64, RegistrationNumber string) error {
 	// 1. Get Ticket
-	ticket, err := svc.ticketRepo.Get(ticketID)
+	t, err := svc.ticketRepo.Get(ticketID)
 	if err != nil {
 		return err
 	}
 
-	if ticket.CancelledAt != nil {
+	switch ticket.State(t.Status) {
+	case ticket.StateCancelled, ticket.StateRefunded:
 		return fmt.Errorf("ticket has been cancelled")
-	}
-
-	if !ticket.PaidStatus {
+	case ticket.StatePendingPayment:
 		return fmt.Errorf("ticket is unpaid")
+	case ticket.StateExpired:
+		return fmt.Errorf("ticket has expired")
 	}
 
 	// 2. Check if ticket belongs to the route
-	if ticket.RouteId != routeID {
+	if t.RouteId != routeID {
 		return fmt.Errorf("ticket is not valid for this route")
 	}
 
-	// 3. Check if already checked
-	if ticket.Checked {
-		return fmt.Errorf("ticket already checked")
-	}
-
-	// 4. Update status
-	return svc.ticketRepo.ValidateTicket(ticketID, RegistrationNumber)
-}
-
-func (svc *service) CheckTicket(req ticket.CheckTicketRequest) (map[string]interface{}, error) {
-	t, err := svc.ticketRepo.GetByQRCode(req.QRCode)
-	if err != nil {
-		return nil, fmt.Errorf("ticket not found")
-	}
-
-	if t.CancelledAt != nil {
-		return nil, fmt.Errorf("ticket has been cancelled")
-	}
-	if !t.PaidStatus {
-		return nil, fmt.Errorf("ticket is unpaid")
-	}
-	if t.RouteId != req.RouteID {
-		return nil, fmt.Errorf("ticket is not valid for this route")
-	}
-	if t.Checked {
-		return nil, fmt.Errorf("ticket already checked")
-	}
-
-	destStop, err := svc.ticketRepo.GetStop(req.RouteID, t.EndDestination)
+	// 3. Mark it checked, unless it already is
+	moved, err := svc.ticketRepo.Transition(ticket.Transition{
+		TicketIDs:          []int64{ticketID},
+		To:                 ticket.StateChecked,
+		Actor:              ticket.ActorBus(RegistrationNumber),
+		Reason:             "validated by bus",
+		RegistrationNumber: RegistrationNumber,
+		CheckedAt:          time.Now(),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("invalid destination stop in ticket: %v", err)
-	}
-
-	response := map[string]interface{}{
-		"success": true,
-		"status":  "valid",
-		"ticket":  t,
-	}
-
-	if req.CurrentStoppage.Order > destStop.Order {
-		extraFare, err := svc.ticketRepo.CalculateFare(req.RouteID, t.EndDestination, req.CurrentStoppage.Name)
-		if err != nil {
-			return nil, fmt.Errorf("failed to calculate extra fare: %v", err)
-		}
-
-		response["status"] = "over_travel"
-		response["message"] = fmt.Sprintf("You have over-traveled. Please pay extra fare: %.2f", extraFare)
-		response["extra_fare"] = extraFare
+		return err
 	}
-
-	err = svc.ticketRepo.ValidateTicket(t.Id, req.RegistrationNumber)
-	if err != nil {
-		return nil, err
+	if len(moved) == 0 {
+		return fmt.Errorf("ticket already checked")
 	}
-
-	return response, nil
+	return nil
 }
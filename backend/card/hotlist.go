@@ -0,0 +1,87 @@
+package card
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Binary hotlist layout, all integers big-endian:
+//
+//	magic    4 bytes  "SHL1"
+//	flags    1 byte   bit 0 set for a full list
+//	version  8 bytes
+//	count    4 bytes
+//	entries  count times: op (1 byte, 1 add, 0 remove), uid length (1 byte), uid
+//
+// Entries are sorted by UID, so a reader can keep a full list as is and
+// binary search it.
+const hotlistMagic = "SHL1"
+
+const hotlistFlagFull = 1
+
+// HotlistEntry adds a card to a reader's hotlist, or with Blocked false
+// removes it.
+type HotlistEntry struct {
+	UID     string `json:"uid"`
+	Blocked bool   `json:"blocked"`
+}
+
+// Hotlist lists the cards bus readers must refuse while offline. A full
+// hotlist holds every refused card; a delta holds every card whose state
+// changed after the version it was requested with. Pass Version as since on
+// the next sync.
+type Hotlist struct {
+	Version int64          `json:"version"`
+	Full    bool           `json:"full"`
+	Entries []HotlistEntry `json:"entries"`
+}
+
+// Hotlist returns the full hotlist with since 0, otherwise the changes
+// after version since.
+func (s *service) Hotlist(since int64) (*Hotlist, error) {
+	changes, version, err := s.repo.GetHotlistChanges(since)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Hotlist{Version: version, Full: since == 0, Entries: []HotlistEntry{}}
+	for _, c := range changes {
+		blocked := Status(c.Status).Refused()
+		if h.Full && !blocked {
+			continue
+		}
+		h.Entries = append(h.Entries, HotlistEntry{UID: c.UID, Blocked: blocked})
+	}
+	sort.Slice(h.Entries, func(i, j int) bool { return h.Entries[i].UID < h.Entries[j].UID })
+	return h, nil
+}
+
+// MarshalBinary encodes the hotlist in the compact format readers load.
+func (h *Hotlist) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(hotlistMagic)
+
+	var flags byte
+	if h.Full {
+		flags |= hotlistFlagFull
+	}
+	buf.WriteByte(flags)
+	binary.Write(&buf, binary.BigEndian, uint64(h.Version))
+	binary.Write(&buf, binary.BigEndian, uint32(len(h.Entries)))
+
+	for _, e := range h.Entries {
+		if len(e.UID) > 255 {
+			return nil, fmt.Errorf("card uid %q is too long", e.UID)
+		}
+		var op byte
+		if e.Blocked {
+			op = 1
+		}
+		buf.WriteByte(op)
+		buf.WriteByte(byte(len(e.UID)))
+		buf.WriteString(e.UID)
+	}
+	return buf.Bytes(), nil
+}
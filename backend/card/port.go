@@ -0,0 +1,46 @@
+package card
+
+import "swift_transit/domain"
+
+// IssueItem binds a card from inventory to a user.
+type IssueItem struct {
+	UID    string `json:"uid"`
+	UserId int64  `json:"user_id"`
+}
+
+// IssueResult is the outcome of one item of a bulk issue.
+type IssueResult struct {
+	UID    string `json:"uid"`
+	UserId int64  `json:"user_id"`
+	Issued bool   `json:"issued"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Service interface {
+	AddInventory(uids []string, batch string) (int, error)
+	Issue(items []IssueItem, activate bool, actor string) []IssueResult
+	Replace(userID int64, newUID string, actor string) (*domain.Card, error)
+	SetStatus(uid string, to Status, actor, reason string) error
+	List(status string, limit, offset int) ([]domain.Card, int, error)
+	GetHistory(uid string) ([]domain.CardEvent, error)
+	GetCurrent(userID int64) (*domain.Card, error)
+	Activate(userID int64) error
+	SetBlocked(userID int64, blocked bool) error
+	ReportLost(userID int64) error
+	SetCompanions(userID int64, companions int) error
+	Hotlist(since int64) (*Hotlist, error)
+}
+
+type Repo interface {
+	AddInventory(uids []string, batch string, actor string) (int, error)
+	GetByUID(uid string) (*domain.Card, error)
+	GetCurrent(userID int64) (*domain.Card, error)
+	GetLatest(userID int64) (*domain.Card, error)
+	List(status string, limit, offset int) ([]domain.Card, int, error)
+	Bind(uid string, userID int64, to string, actor, reason string) (bool, error)
+	Transition(uid string, from []string, to string, actor, reason string) (bool, error)
+	Replace(old *domain.Card, oldTo string, newUID string, userID int64, actor, reason string) (bool, error)
+	GetEvents(cardID int64) ([]domain.CardEvent, error)
+	SetCompanions(cardID int64, companions int) error
+	GetHotlistChanges(since int64) ([]domain.CardHotlistChange, int64, error)
+}
@@ -0,0 +1,268 @@
+package card
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"swift_transit/domain"
+)
+
+// Status is the lifecycle state of a card.
+type Status string
+
+const (
+	StatusInventory Status = "inventory" // In stock, not yet given to anyone
+	StatusIssued    Status = "issued"    // Given to a user, waiting to be activated
+	StatusActive    Status = "active"
+	StatusBlocked   Status = "blocked" // Temporarily blocked by its holder or an admin
+	StatusLost      Status = "lost"
+	StatusRetired   Status = "retired" // Replaced or withdrawn for good
+)
+
+// Refused reports whether readers must refuse a card in this state. Retired
+// cards were handed back or withdrawn, so they are left off the hotlist.
+func (s Status) Refused() bool {
+	return s == StatusIssued || s == StatusBlocked || s == StatusLost
+}
+
+// transitions lists the states a card may move to from each state.
+var transitions = map[Status][]Status{
+	StatusInventory: {StatusIssued, StatusActive, StatusRetired},
+	StatusIssued:    {StatusActive, StatusLost, StatusRetired},
+	StatusActive:    {StatusBlocked, StatusLost, StatusRetired},
+	StatusBlocked:   {StatusActive, StatusLost, StatusRetired},
+	StatusLost:      {StatusRetired},
+}
+
+// allowedFrom returns the states a card may move to state to from.
+func allowedFrom(to Status) []string {
+	var from []string
+	for state, next := range transitions {
+		for _, n := range next {
+			if n == to {
+				from = append(from, string(state))
+			}
+		}
+	}
+	return from
+}
+
+// MaxCompanions is the most passengers a single tap can pay for besides the
+// card holder.
+const MaxCompanions = 5
+
+// Actors recorded in card events
+const (
+	ActorAdmin  = "admin"
+	ActorSystem = "system"
+)
+
+func ActorUser(id int64) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+type service struct {
+	repo Repo
+}
+
+func NewService(repo Repo) Service {
+	return &service{repo: repo}
+}
+
+// AddInventory stocks new cards. UIDs already known are skipped; it returns
+// how many cards were added.
+func (s *service) AddInventory(uids []string, batch string) (int, error) {
+	clean := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		uid = strings.TrimSpace(uid)
+		if uid == "" {
+			continue
+		}
+		if len(uid) > 32 {
+			return 0, fmt.Errorf("card uid %q is too long", uid)
+		}
+		clean = append(clean, uid)
+	}
+	if len(clean) == 0 {
+		return 0, fmt.Errorf("no card uids given")
+	}
+	return s.repo.AddInventory(clean, batch, ActorAdmin)
+}
+
+// Issue binds cards from inventory to users, issued or, with activate,
+// ready to use. Each item succeeds or fails on its own.
+func (s *service) Issue(items []IssueItem, activate bool, actor string) []IssueResult {
+	to := StatusIssued
+	if activate {
+		to = StatusActive
+	}
+
+	results := make([]IssueResult, 0, len(items))
+	for _, item := range items {
+		result := IssueResult{UID: item.UID, UserId: item.UserId}
+		if err := s.issue(item, to, actor); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Issued = true
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (s *service) issue(item IssueItem, to Status, actor string) error {
+	if item.UID == "" || item.UserId == 0 {
+		return fmt.Errorf("uid and user_id are required")
+	}
+	if _, err := s.repo.GetCurrent(item.UserId); err == nil {
+		return fmt.Errorf("user already has a card; replace it instead")
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	bound, err := s.repo.Bind(item.UID, item.UserId, string(to), actor, "issued")
+	if err != nil {
+		return err
+	}
+	if !bound {
+		return fmt.Errorf("card is not in inventory")
+	}
+	return nil
+}
+
+// Replace gives a user a new card from inventory in place of their current
+// or last lost card. The wallet and passes belong to the user, so they carry
+// over to the new card.
+func (s *service) Replace(userID int64, newUID string, actor string) (*domain.Card, error) {
+	old, err := s.repo.GetLatest(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if old != nil && old.Status == string(StatusRetired) {
+		old = nil
+	}
+
+	// A lost card stays lost; any other card is retired
+	oldTo := string(StatusRetired)
+	if old != nil && old.Status == string(StatusLost) {
+		oldTo = string(StatusLost)
+	}
+
+	replaced, err := s.repo.Replace(old, oldTo, newUID, userID, actor, "replacement")
+	if err != nil {
+		return nil, err
+	}
+	if !replaced {
+		return nil, fmt.Errorf("card is not in inventory, or the old card changed")
+	}
+	return s.repo.GetByUID(newUID)
+}
+
+// SetStatus moves a card to another state, if the lifecycle allows it.
+func (s *service) SetStatus(uid string, to Status, actor, reason string) error {
+	switch to {
+	case StatusActive, StatusBlocked, StatusLost, StatusRetired:
+	case StatusInventory, StatusIssued:
+		return fmt.Errorf("cards are issued with issue or replace")
+	default:
+		return fmt.Errorf("unknown card status %q", to)
+	}
+
+	c, err := s.repo.GetByUID(uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("card not found")
+	} else if err != nil {
+		return err
+	}
+	if c.UserId == nil && to != StatusRetired {
+		return fmt.Errorf("card is not issued")
+	}
+	return s.transition(c, to, actor, reason)
+}
+
+func (s *service) List(status string, limit, offset int) ([]domain.Card, int, error) {
+	return s.repo.List(status, limit, offset)
+}
+
+// GetHistory returns the state changes of a card, oldest first.
+func (s *service) GetHistory(uid string) ([]domain.CardEvent, error) {
+	c, err := s.repo.GetByUID(uid)
+	if err != nil {
+		return nil, fmt.Errorf("card not found")
+	}
+	return s.repo.GetEvents(c.Id)
+}
+
+// GetCurrent returns the card a user holds.
+func (s *service) GetCurrent(userID int64) (*domain.Card, error) {
+	c, err := s.repo.GetCurrent(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no card")
+	}
+	return c, err
+}
+
+// Activate starts a card issued to a user.
+func (s *service) Activate(userID int64) error {
+	c, err := s.GetCurrent(userID)
+	if err != nil {
+		return err
+	}
+	if c.Status != string(StatusIssued) {
+		return fmt.Errorf("card is %s", c.Status)
+	}
+	return s.transition(c, StatusActive, ActorUser(userID), "activated by holder")
+}
+
+// SetBlocked blocks or unblocks a user's card.
+func (s *service) SetBlocked(userID int64, blocked bool) error {
+	c, err := s.GetCurrent(userID)
+	if err != nil {
+		return err
+	}
+	to, reason := StatusActive, "unblocked by holder"
+	if blocked {
+		to, reason = StatusBlocked, "blocked by holder"
+	}
+	if c.Status == string(to) {
+		return nil
+	}
+	return s.transition(c, to, ActorUser(userID), reason)
+}
+
+// ReportLost blocks a user's card for good. Taps with it are refused from
+// then on; a replacement card keeps the user's balance and passes.
+func (s *service) ReportLost(userID int64) error {
+	c, err := s.GetCurrent(userID)
+	if err != nil {
+		return err
+	}
+	return s.transition(c, StatusLost, ActorUser(userID), "reported lost by holder")
+}
+
+// SetCompanions sets how many companions a tap with the user's card pays for
+// by default.
+func (s *service) SetCompanions(userID int64, companions int) error {
+	if companions < 0 || companions > MaxCompanions {
+		return fmt.Errorf("companions must be between 0 and %d", MaxCompanions)
+	}
+	c, err := s.GetCurrent(userID)
+	if err != nil {
+		return err
+	}
+	return s.repo.SetCompanions(c.Id, companions)
+}
+
+func (s *service) transition(c *domain.Card, to Status, actor, reason string) error {
+	from := allowedFrom(to)
+	moved, err := s.repo.Transition(c.UID, from, string(to), actor, reason)
+	if err != nil {
+		return err
+	}
+	if !moved {
+		return fmt.Errorf("card cannot move from %s to %s", c.Status, to)
+	}
+	return nil
+}
@@ -6,27 +6,38 @@ import (
 	"swift_transit/admin"
 	"swift_transit/bus"
 	"swift_transit/bus_owner"
+	"swift_transit/card"
 	"swift_transit/config"
 	"swift_transit/infra/db"
+	"swift_transit/infra/mqtt"
 	"swift_transit/infra/payment"
 	"swift_transit/infra/rabbitmq"
 	redisConf "swift_transit/infra/redis"
+	"swift_transit/ledger"
 	"swift_transit/location"
+	"swift_transit/pass"
+	"swift_transit/promo"
 	"swift_transit/repo"
 	"swift_transit/rest"
 	adminHandler "swift_transit/rest/handlers/admin"
 	busHandler "swift_transit/rest/handlers/bus"
 	busOwnerHandler "swift_transit/rest/handlers/bus_owner"
+	cardHandler "swift_transit/rest/handlers/card"
+	ledgerHandler "swift_transit/rest/handlers/ledger"
+	passHandler "swift_transit/rest/handlers/pass"
+	promoHandler "swift_transit/rest/handlers/promo"
 	routeHandler "swift_transit/rest/handlers/route"
 	ticketHandler "swift_transit/rest/handlers/ticket"
 	transactionHandler "swift_transit/rest/handlers/transaction"
 	userHandler "swift_transit/rest/handlers/user"
+	walletHandler "swift_transit/rest/handlers/wallet"
 	"swift_transit/rest/middlewares"
 	"swift_transit/route"
 	"swift_transit/ticket"
 	"swift_transit/transaction"
 	"swift_transit/user"
 	"swift_transit/utils"
+	"swift_transit/wallet"
 )
 
 func Start() {
@@ -54,6 +65,8 @@ func Start() {
 	routeRepo := repo.NewRouteRepo(dbCon, utilHandler)
 	busRepo := repo.NewBusRepo(dbCon, utilHandler)
 	ticketRepo := repo.NewTicketRepo(dbCon, utilHandler)
+	orderRepo := repo.NewOrderRepo(dbCon, utilHandler)
+	rfidTripRepo := repo.NewRFIDTripRepo(dbCon, utilHandler)
 
 	//domains
 	usrSvc := user.NewService(userRepo)
@@ -70,10 +83,39 @@ func Start() {
 
 	// Transaction
 	transactionRepo := repo.NewTransactionRepo(dbCon, utilHandler)
-	transactionSvc := transaction.NewService(transactionRepo, userRepo, sslCommerz, redisCon, cnf.PublicBaseURL)
+	unitOfWork := repo.NewUnitOfWork(dbCon)
+	transactionSvc := transaction.NewService(transactionRepo, sslCommerz, redisCon, cnf.PublicBaseURL)
 	transHandler := transactionHandler.NewHandler(transactionSvc, middlewareHandler, mngr, utilHandler)
 
-	ticketSvc := ticket.NewService(ticketRepo, userRepo, transactionRepo, redisCon, sslCommerz, rabbitMQ, ctx, cnf.PublicBaseURL)
+	// Passes
+	passRepo := repo.NewPassRepo(dbCon, utilHandler)
+	passUnitOfWork := repo.NewPassUnitOfWork(dbCon)
+	passSvc := pass.NewService(passRepo, passUnitOfWork, sslCommerz, cnf.PublicBaseURL)
+	passHdlr := passHandler.NewHandler(passSvc, middlewareHandler, mngr, utilHandler)
+
+	ticketKeyring, err := ticket.NewKeyring(cnf.TicketSigning.Keys, cnf.TicketSigning.ActiveKID, cnf.Secret, cnf.TicketSigning.DevKey)
+	if err != nil {
+		panic(err)
+	}
+	dynamicQRSecret := cnf.TicketQR.DynamicSecret
+	if dynamicQRSecret == "" {
+		dynamicQRSecret = cnf.Secret
+	}
+	ticketDynamicQR := ticket.NewDynamicQR(dynamicQRSecret)
+	ticketValidity, err := ticket.NewValidityPolicy(cnf.TicketValidity.Rules, cnf.TicketValidity.ServiceDayEnd)
+	if err != nil {
+		panic(err)
+	}
+	fareCaps, err := ticket.NewFareCapPolicy(cnf.FareCaps.Caps)
+	if err != nil {
+		panic(err)
+	}
+	// Promotions
+	promoRepo := repo.NewPromoRepo(dbCon, utilHandler)
+	promoSvc := promo.NewService(promoRepo)
+	promoHdlr := promoHandler.NewHandler(promoSvc, middlewareHandler, mngr, utilHandler)
+
+	ticketSvc := ticket.NewService(ticketRepo, orderRepo, rfidTripRepo, userRepo, transactionRepo, unitOfWork, redisCon, sslCommerz, rabbitMQ, ctx, cnf.PublicBaseURL, ticketKeyring, ticketDynamicQR, cnf.TicketQR.StaticFallback, ticketValidity, fareCaps, passSvc, promoSvc)
 
 	// Start Ticket Worker
 	// Start Ticket Worker
@@ -84,13 +126,33 @@ func Start() {
 	ticketCheckWorker := ticket.NewTicketCheckWorker(ticketSvc, ticketRepo, rabbitMQ)
 	go ticketCheckWorker.Start()
 
+	// Expire tickets past their validity window
+	ticketExpiryWorker := ticket.NewExpiryWorker(ticketSvc)
+	go ticketExpiryWorker.Start()
+
 	// WebSocket Hub
 	hub := location.NewHub()
+	hub.SetETAEstimator(location.NewETAEstimator(routeSvc))
 	go hub.Run()
 
 	userHdlr := userHandler.NewHandler(usrSvc, middlewareHandler, mngr, utilHandler, redisCon, ctx, hub)
-	routeHdlr := routeHandler.NewHandler(routeSvc, middlewareHandler, mngr, utilHandler)
-	busHdlr := busHandler.NewHandler(busSvc, ticketSvc, middlewareHandler, mngr, utilHandler, hub)
+	routeHdlr := routeHandler.NewHandler(routeSvc, middlewareHandler, mngr, utilHandler, hub)
+	// MQTT ingestion of bus tracker locations
+	if cnf.MQTT.BrokerURL != "" {
+		mqttCon, err := mqtt.NewConnection(cnf.MQTT.BrokerURL, cnf.MQTT.ClientID, cnf.MQTT.Username, cnf.MQTT.Password)
+		if err != nil {
+			fmt.Printf("MQTT location ingestion disabled: %v\n", err)
+		} else {
+			defer mqttCon.Close()
+			locationIngestor := bus.NewLocationIngestor(busSvc, mqttCon, hub)
+			go locationIngestor.Start()
+		}
+	}
+
+	cardRepo := repo.NewCardRepo(dbCon, utilHandler)
+	cardSvc := card.NewService(cardRepo)
+	cardHdlr := cardHandler.NewHandler(cardSvc, middlewareHandler, mngr, utilHandler)
+	busHdlr := busHandler.NewHandler(busSvc, ticketSvc, cardSvc, middlewareHandler, mngr, utilHandler, hub, cnf.MQTT)
 	ticketHdlr := ticketHandler.NewHandler(ticketSvc, middlewareHandler, mngr, utilHandler, cnf.PublicBaseURL)
 
 	busOwnerRepo := repo.NewBusOwnerRepo(dbCon.DB, utilHandler)
@@ -99,8 +161,29 @@ func Start() {
 
 	adminRepo := repo.NewAdminRepo(dbCon.DB)
 	adminSvc := admin.NewService(adminRepo, utilHandler)
-	adminHdlr := adminHandler.NewHandler(adminSvc, utilHandler, middlewareHandler, mngr)
+	adminHdlr := adminHandler.NewHandler(adminSvc, utilHandler, middlewareHandler, mngr, hub)
+
+	ledgerRepo := repo.NewLedgerRepo(dbCon, utilHandler)
+	ledgerSvc := ledger.NewService(ledgerRepo)
+	ledgerHdlr := ledgerHandler.NewHandler(ledgerSvc, middlewareHandler, mngr, utilHandler)
+	reconcileWorker, err := ledger.NewReconcileWorker(ledgerSvc, cnf.Ledger.ReconcileAt)
+	if err != nil {
+		panic(err)
+	}
+	go reconcileWorker.Start()
+
+	walletLimits, err := wallet.NewLimits(cnf.Wallet.TransferMax, cnf.Wallet.TransferDailyLimit)
+	if err != nil {
+		panic(err)
+	}
+	walletRepo := repo.NewWalletRepo(dbCon, utilHandler)
+	walletSvc := wallet.NewService(walletRepo, transactionRepo, ticketRepo, transactionSvc, redisCon, ctx, walletLimits)
+	walletHdlr := walletHandler.NewHandler(walletSvc, middlewareHandler, mngr, utilHandler)
+
+	// Email users whose balance falls below their alert threshold
+	balanceAlertWorker := wallet.NewAlertWorker(walletSvc)
+	go balanceAlertWorker.Start()
 
-	handler := rest.NewHandler(cnf, middlewareHandler, userHdlr, routeHdlr, busHdlr, ticketHdlr, transHandler, busOwnerHdlr, adminHdlr)
+	handler := rest.NewHandler(cnf, middlewareHandler, userHdlr, routeHdlr, busHdlr, ticketHdlr, transHandler, busOwnerHdlr, adminHdlr, passHdlr, cardHdlr, ledgerHdlr, walletHdlr, promoHdlr)
 	handler.Serve()
 }
@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -34,16 +36,87 @@ type RabbitMQConfig struct {
 	URL string
 }
 
+// MQTTConfig is used to ingest bus trackers' locations. Ingestion is
+// disabled when BrokerURL is empty. Username and Password are the backend's
+// own broker account, which is allowed to read every topic. The broker's auth
+// checks must carry AuthSecret in the X-MQTT-Auth-Secret header when it is
+// set, and otherwise come from an address in AuthAllowedIPs (loopback by
+// default).
+type MQTTConfig struct {
+	BrokerURL      string
+	ClientID       string
+	Username       string
+	Password       string
+	AuthSecret     string
+	AuthAllowedIPs []netip.Prefix
+}
+
+// TicketSigningConfig holds the Ed25519 keys ticket QR tokens are signed
+// with, as comma separated "kid:base64seed" pairs. Keys may only be empty
+// when DevKey is set, and a development key is then derived from the app
+// secret.
+type TicketSigningConfig struct {
+	Keys      string
+	ActiveKID string
+	DevKey    bool
+}
+
+// TicketQRConfig controls the QR codes passengers show. DynamicSecret
+// derives the per-ticket secrets of rotating in-app codes; the app secret is
+// used when it is empty. StaticFallback keeps static codes (PDF downloads and
+// signed tokens) usable alongside them.
+type TicketQRConfig struct {
+	DynamicSecret  string
+	StaticFallback bool
+}
+
+// TicketValidityConfig sets how long tickets can be used, by ticket type, as
+// comma separated "type:rule" pairs where rule is a duration or
+// "service_day". Types without a rule are valid for 4 hours. ServiceDayEnd
+// is the local "HH:MM" the service day ends at.
+type TicketValidityConfig struct {
+	Rules         string
+	ServiceDayEnd string
+}
+
+// FareCapConfig limits what RFID riders pay per day and per week, as comma
+// separated "category:period=amount" entries where category is a fare
+// category and period is daily or weekly. Unlisted caps do not apply.
+type FareCapConfig struct {
+	Caps string
+}
+
+// LedgerConfig sets the local "HH:MM" the nightly reconciliation of wallet
+// balances against the ledger runs at; 03:00 when empty.
+type LedgerConfig struct {
+	ReconcileAt string
+}
+
+// WalletConfig limits wallet-to-wallet transfers, in taka: TransferMax per
+// transfer and TransferDailyLimit per sender per day. Empty limits default
+// to 5000 and 10000.
+type WalletConfig struct {
+	TransferMax        string
+	TransferDailyLimit string
+}
+
 type Config struct {
-	Version       string
-	HttpPort      string
-	ServiceName   string
-	Secret        string
-	PublicBaseURL string
-	Db            DbConfig
-	RedisCnf      RedisConfig
-	SSLCommerz    SSLCommerzConfig
-	RabbitMQ      RabbitMQConfig
+	Version        string
+	HttpPort       string
+	ServiceName    string
+	Secret         string
+	PublicBaseURL  string
+	Db             DbConfig
+	RedisCnf       RedisConfig
+	SSLCommerz     SSLCommerzConfig
+	RabbitMQ       RabbitMQConfig
+	MQTT           MQTTConfig
+	TicketSigning  TicketSigningConfig
+	TicketQR       TicketQRConfig
+	TicketValidity TicketValidityConfig
+	FareCaps       FareCapConfig
+	Ledger         LedgerConfig
+	Wallet         WalletConfig
 }
 
 var configurations *Config
@@ -106,6 +179,41 @@ func loadConfig() {
 		publicBaseURL = fmt.Sprintf("http://localhost:%s", httpPort)
 	}
 
+	mqttClientID := os.Getenv("MQTT_CLIENT_ID")
+	if mqttClientID == "" {
+		mqttClientID = "swift-transit-backend"
+	}
+
+	mqttUsername := os.Getenv("MQTT_USERNAME")
+	mqttPassword := os.Getenv("MQTT_PASSWORD")
+	if mqttUsername != "" && mqttPassword == "" {
+		fmt.Println("MQTT_PASSWORD is required when MQTT_USERNAME is set")
+		os.Exit(1)
+	}
+	mqttAllowedIPs, err := parsePrefixes(os.Getenv("MQTT_AUTH_ALLOWED_IPS"))
+	if err != nil {
+		fmt.Println("Invalid MQTT_AUTH_ALLOWED_IPS value in .env")
+		os.Exit(1)
+	}
+
+	devSigningKey := false
+	if devKeyStr := os.Getenv("TICKET_SIGNING_DEV_KEY"); devKeyStr != "" {
+		devSigningKey, err = strconv.ParseBool(devKeyStr)
+		if err != nil {
+			fmt.Println("Invalid TICKET_SIGNING_DEV_KEY value in .env")
+			os.Exit(1)
+		}
+	}
+
+	staticQR := true
+	if staticQRStr := os.Getenv("TICKET_STATIC_QR"); staticQRStr != "" {
+		staticQR, err = strconv.ParseBool(staticQRStr)
+		if err != nil {
+			fmt.Println("Invalid TICKET_STATIC_QR value in .env")
+			os.Exit(1)
+		}
+	}
+
 	configurations = &Config{
 		Version:       version,
 		HttpPort:      httpPort,
@@ -133,7 +241,64 @@ func loadConfig() {
 		RabbitMQ: RabbitMQConfig{
 			URL: os.Getenv("RABBITMQ_URL"),
 		},
+		TicketSigning: TicketSigningConfig{
+			Keys:      os.Getenv("TICKET_SIGNING_KEYS"),
+			ActiveKID: os.Getenv("TICKET_SIGNING_KID"),
+			DevKey:    devSigningKey,
+		},
+		TicketQR: TicketQRConfig{
+			DynamicSecret:  os.Getenv("TICKET_DYNAMIC_QR_SECRET"),
+			StaticFallback: staticQR,
+		},
+		TicketValidity: TicketValidityConfig{
+			Rules:         os.Getenv("TICKET_VALIDITY"),
+			ServiceDayEnd: os.Getenv("TICKET_SERVICE_DAY_END"),
+		},
+		FareCaps: FareCapConfig{
+			Caps: os.Getenv("FARE_CAPS"),
+		},
+		Ledger: LedgerConfig{
+			ReconcileAt: os.Getenv("LEDGER_RECONCILE_AT"),
+		},
+		Wallet: WalletConfig{
+			TransferMax:        os.Getenv("WALLET_TRANSFER_MAX"),
+			TransferDailyLimit: os.Getenv("WALLET_TRANSFER_DAILY_LIMIT"),
+		},
+		MQTT: MQTTConfig{
+			BrokerURL:      os.Getenv("MQTT_BROKER_URL"),
+			ClientID:       mqttClientID,
+			Username:       mqttUsername,
+			Password:       mqttPassword,
+			AuthSecret:     os.Getenv("MQTT_AUTH_SECRET"),
+			AuthAllowedIPs: mqttAllowedIPs,
+		},
+	}
+}
+
+// parsePrefixes reads comma separated IP addresses and CIDR ranges, which
+// default to the loopback addresses.
+func parsePrefixes(s string) ([]netip.Prefix, error) {
+	if strings.TrimSpace(s) == "" {
+		s = "127.0.0.1/8,::1/128"
+	}
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
 	}
+	return prefixes, nil
 }
 
 func Load() *Config {
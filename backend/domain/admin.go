@@ -2,9 +2,14 @@ package domain
 
 import "time"
 
+// RoleAdmin marks the tokens of admins, so admin routes can tell them from
+// the tokens of passengers, buses and bus owners.
+const RoleAdmin = "admin"
+
 type Admin struct {
 	Id        int64     `json:"id"`
 	Username  string    `json:"username"`
 	Password  string    `json:"-"` // Never send password in JSON
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -1,7 +1,7 @@
 package domain
 
 type BusOwnerAnalytics struct {
-	TotalRevenue float64         `json:"total_revenue"`
+	TotalRevenue Money           `json:"total_revenue"`
 	TotalTickets int             `json:"total_tickets"`
 	Today        PeriodAnalytics `json:"today"`
 	Weekly       PeriodAnalytics `json:"weekly"`
@@ -9,12 +9,12 @@ type BusOwnerAnalytics struct {
 }
 
 type PeriodAnalytics struct {
-	Revenue float64 `json:"revenue"`
-	Tickets int     `json:"tickets"`
+	Revenue Money `json:"revenue"`
+	Tickets int   `json:"tickets"`
 }
 
 type BusAnalytics struct {
-	RegistrationNumber string  `json:"registration_number"`
-	Tickets            int     `json:"tickets"`
-	Revenue            float64 `json:"revenue"`
+	RegistrationNumber string `json:"registration_number"`
+	Tickets            int    `json:"tickets"`
+	Revenue            Money  `json:"revenue"`
 }
@@ -4,7 +4,7 @@ type Bus struct {
 	Id                int64       `json:"id" db:"id"`
 	Name              string      `json:"name" db:"name"`
 	LineStringGeoJSON *LineString `json:"linestring_geojson" db:"linestring_geojson"` // Not stored directly, used for geom insertion
-	Fare              float64     `json:"fare" db:"fare"`
+	Fare              Money       `json:"fare" db:"fare"`
 	Stops             []Stop      `json:"stops"`
 }
 
@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// Card is a physical RFID card.
+type Card struct {
+	Id         int64      `json:"id" db:"id"`
+	UID        string     `json:"uid" db:"uid"`
+	Status     string     `json:"status" db:"status"`
+	UserId     *int64     `json:"user_id,omitempty" db:"user_id"`
+	Batch      *string    `json:"batch,omitempty" db:"batch"`
+	ReplacedBy *int64     `json:"replaced_by,omitempty" db:"replaced_by"`
+	Companions int        `json:"companions" db:"companions"` // Passengers a tap pays for besides the holder, unless the reader says otherwise
+	IssuedAt   *time.Time `json:"issued_at,omitempty" db:"issued_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// CardEvent records one state change of a card.
+type CardEvent struct {
+	Id         int64  `json:"id" db:"id"`
+	CardId     int64  `json:"card_id" db:"card_id"`
+	FromStatus string `json:"from_status" db:"from_status"`
+	ToStatus   string `json:"to_status" db:"to_status"`
+	Actor      string `json:"actor" db:"actor"`
+	Reason     string `json:"reason" db:"reason"`
+	CreatedAt  string `json:"created_at" db:"created_at"`
+}
+
+// CardHotlistChange is the state of a card that readers must know about.
+type CardHotlistChange struct {
+	UID    string `db:"uid"`
+	Status string `db:"status"`
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInsufficientBalance is returned by a wallet debit larger than the
+// balance.
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// WalletPosting describes the ledger entry a wallet change is recorded
+// with. Account is the system account on the other side of the entry.
+type WalletPosting struct {
+	Account     string
+	Kind        string
+	Description string
+	Reference   string
+}
+
+// LedgerEntry is one balanced change to the ledger.
+type LedgerEntry struct {
+	Id          int64           `json:"id" db:"id"`
+	Kind        string          `json:"kind" db:"kind"`
+	Description string          `json:"description" db:"description"`
+	Reference   string          `json:"reference" db:"reference"`
+	Amount      Money           `json:"amount" db:"amount"` // The wallet's leg, when read for a wallet
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	Postings    []LedgerPosting `json:"postings"`
+}
+
+// LedgerPosting moves Amount into an account, or out of it when negative.
+type LedgerPosting struct {
+	Id          int64  `json:"id" db:"id"`
+	EntryId     int64  `json:"entry_id" db:"entry_id"`
+	AccountCode string `json:"account" db:"account_code"`
+	Amount      Money  `json:"amount" db:"amount"`
+}
+
+// WalletLedger is a page of a wallet's entries, newest first, with the
+// cached balance next to the one its postings add up to.
+type WalletLedger struct {
+	UserId        int64         `json:"user_id"`
+	Account       string        `json:"account"`
+	Balance       Money         `json:"balance"`
+	LedgerBalance Money         `json:"ledger_balance"`
+	Entries       []LedgerEntry `json:"entries"`
+	Total         int           `json:"total"`
+}
+
+// LedgerReconciliation is one run of the reconciliation job.
+type LedgerReconciliation struct {
+	Id                int64         `json:"id" db:"id"`
+	StartedAt         time.Time     `json:"started_at" db:"started_at"`
+	FinishedAt        time.Time     `json:"finished_at" db:"finished_at"`
+	WalletsChecked    int           `json:"wallets_checked" db:"wallets_checked"`
+	DriftedWallets    int           `json:"drifted_wallets" db:"drifted_wallets"`
+	UnbalancedEntries int           `json:"unbalanced_entries" db:"unbalanced_entries"`
+	Drifts            []LedgerDrift `json:"drifts,omitempty"`
+}
+
+// LedgerDrift flags a wallet whose cached balance differs from its postings.
+type LedgerDrift struct {
+	Id               int64 `json:"id" db:"id"`
+	ReconciliationId int64 `json:"reconciliation_id" db:"reconciliation_id"`
+	UserId           int64 `json:"user_id" db:"user_id"`
+	Balance          Money `json:"balance" db:"balance"`
+	LedgerBalance    Money `json:"ledger_balance" db:"ledger_balance"`
+	Drift            Money `json:"drift" db:"drift"`
+}
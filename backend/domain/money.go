@@ -0,0 +1,202 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in poisha, the hundredth of a taka. Amounts are kept as
+// integers so sums and comparisons are exact. Converting from a computed
+// float or a decimal with more than two places rounds half away from zero;
+// fares are then rounded up to a whole taka with CeilTaka.
+//
+// In JSON and SQL Money is a decimal number of taka, such as 12.50, so
+// clients and columns that used floats keep working. JSON input may also be
+// a string, e.g. "12.50".
+type Money int64
+
+const (
+	Poisha Money = 1
+	Taka   Money = 100
+)
+
+// MoneyFromFloat converts an amount of taka computed as a float, rounding
+// to the nearest poisha.
+func MoneyFromFloat(taka float64) Money {
+	return Money(math.Round(taka * 100))
+}
+
+// ParseMoney parses a decimal amount of taka such as "120", "12.5" or
+// "-0.25". Digits after the second decimal place are rounded.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	text := s
+	negative := false
+	switch {
+	case strings.HasPrefix(text, "-"):
+		negative = true
+		text = text[1:]
+	case strings.HasPrefix(text, "+"):
+		text = text[1:]
+	}
+
+	whole, frac, _ := strings.Cut(text, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	for _, digits := range []string{whole, frac} {
+		for _, c := range digits {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+	}
+
+	taka, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || taka > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	frac += "000"
+	poisha, _ := strconv.ParseInt(frac[:2], 10, 64)
+	if frac[2] >= '5' {
+		poisha++
+	}
+
+	m := Money(taka*100 + poisha)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// String formats the amount in taka with two decimals, e.g. "12.50".
+func (m Money) String() string {
+	sign := ""
+	abs := int64(m)
+	if abs < 0 {
+		sign = "-"
+		abs = -abs
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/100, abs%100)
+}
+
+// CeilTaka rounds the amount up to a whole taka.
+func (m Money) CeilTaka() Money {
+	rem := m % Taka
+	if rem > 0 {
+		return m - rem + Taka
+	}
+	return m - rem
+}
+
+// MulRatio returns the amount multiplied by num/den, rounded to the nearest
+// poisha. It is how shares of a fare, such as half fares and refunds, are
+// worked out.
+func (m Money) MulRatio(num, den int64) Money {
+	product := int64(m) * num
+	q, r := product/den, product%den
+	if 2*abs64(r) >= abs64(den) {
+		if (product < 0) != (den < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Money(q)
+}
+
+// Times returns the amount multiplied by n.
+func (m Money) Times(n int) Money {
+	return m * Money(n)
+}
+
+// MinMoney returns the smaller of a and b.
+func MinMoney(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// MaxMoney returns the larger of a and b.
+func MaxMoney(a, b Money) Money {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	return m.scanText(text)
+}
+
+// Value stores the amount as a decimal of taka.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads a NUMERIC, float or integer column holding taka.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.scanText(string(v))
+	case string:
+		return m.scanText(v)
+	case float64:
+		*m = MoneyFromFloat(v)
+	case float32:
+		*m = MoneyFromFloat(float64(v))
+	case int64:
+		*m = Money(v) * Taka
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanText(text string) error {
+	if strings.ContainsAny(text, "eE") {
+		// Exponent notation, as floats are sometimes written
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("invalid amount %q", text)
+		}
+		*m = MoneyFromFloat(f)
+		return nil
+	}
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
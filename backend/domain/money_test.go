@@ -0,0 +1,209 @@
+package domain
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "120", want: 12000},
+		{in: "12.5", want: 1250},
+		{in: "12.50", want: 1250},
+		{in: " 7 ", want: 700},
+		{in: "+3.1", want: 310},
+		{in: ".5", want: 50},
+		{in: "5.", want: 500},
+		{in: "0", want: 0},
+		{in: "-0.25", want: -25},
+		{in: "-12", want: -1200},
+
+		// Digits after the second decimal place round half away from zero
+		{in: "1.004", want: 100},
+		{in: "1.005", want: 101},
+		{in: "1.0049999", want: 100},
+		{in: "1.999", want: 200},
+		{in: "-1.005", want: -101},
+		{in: "-1.004", want: -100},
+
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "1,000", wantErr: true},
+		{in: "1e3", wantErr: true}, // Exponents are only accepted from JSON and SQL
+		{in: "99999999999999999999", wantErr: true},
+		{in: strconv.FormatInt(math.MaxInt64/100, 10), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q) returned %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		m        Money
+		num, den int64
+		want     Money
+	}{
+		{m: 1000, num: 3, den: 4, want: 750},
+		{m: 1001, num: 3, den: 4, want: 751}, // 750.75
+		{m: 1002, num: 3, den: 4, want: 752}, // 751.5, half away from zero
+		{m: 1, num: 1, den: 2, want: 1},
+		{m: 100, num: 1, den: 3, want: 33},
+		{m: 200, num: 1, den: 3, want: 67},
+		{m: 0, num: 3, den: 4, want: 0},
+		{m: 1250, num: 1, den: 1, want: 1250},
+
+		// Negative amounts and ratios round away from zero too
+		{m: -1, num: 1, den: 2, want: -1},
+		{m: -1001, num: 3, den: 4, want: -751},
+		{m: -1002, num: 3, den: 4, want: -752},
+		{m: 1, num: 1, den: -2, want: -1},
+		{m: -200, num: 1, den: -3, want: 67},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.MulRatio(tt.num, tt.den); got != tt.want {
+			t.Errorf("Money(%d).MulRatio(%d, %d) = %d, want %d", tt.m, tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestCeilTaka(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want Money
+	}{
+		{m: 0, want: 0},
+		{m: 1, want: 100},
+		{m: 99, want: 100},
+		{m: 100, want: 100},
+		{m: 1250, want: 1300},
+		{m: 1201, want: 1300},
+		{m: -50, want: 0},
+		{m: -150, want: -100},
+		{m: -200, want: -200},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.CeilTaka(); got != tt.want {
+			t.Errorf("Money(%d).CeilTaka() = %d, want %d", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Money
+		wantErr bool
+	}{
+		// lib/pq hands NUMERIC columns over as text in bytes
+		{name: "numeric", src: []byte("12.50"), want: 1250},
+		{name: "numeric with scale", src: []byte("12.500000"), want: 1250},
+		{name: "numeric whole", src: []byte("40"), want: 4000},
+		{name: "numeric negative", src: []byte("-0.75"), want: -75},
+		{name: "numeric rounded", src: []byte("1.005"), want: 101},
+		{name: "numeric exponent", src: []byte("-3E-1"), want: -30},
+		{name: "string", src: "0.01", want: 1},
+		{name: "string exponent", src: "1.5e2", want: 15000},
+		{name: "float", src: 19.99, want: 1999},
+		{name: "float rounded", src: 0.125, want: 13},
+		{name: "float negative", src: -2.5, want: -250},
+		{name: "float32", src: float32(2.5), want: 250},
+		{name: "integer", src: int64(7), want: 700},
+		{name: "null", src: nil, want: 0},
+
+		{name: "bool", src: true, wantErr: true},
+		{name: "text", src: []byte("abc"), wantErr: true},
+		{name: "bad exponent", src: "1e", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		m := Money(999) // Scan must overwrite what was there
+		err := m.Scan(tt.src)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: Scan(%v) = %d, want an error", tt.name, tt.src, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Scan(%v) returned %v", tt.name, tt.src, err)
+			continue
+		}
+		if m != tt.want {
+			t.Errorf("%s: Scan(%v) = %d, want %d", tt.name, tt.src, m, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: `12.5`, want: 1250},
+		{in: `12.50`, want: 1250},
+		{in: `120`, want: 12000},
+		{in: `-0.25`, want: -25},
+		{in: `0.125`, want: 13},
+		{in: `"12.50"`, want: 1250},
+		{in: `" 3 "`, want: 300},
+		{in: `"-1.005"`, want: -101},
+		{in: `1e2`, want: 10000},
+		{in: `1.5E1`, want: 1500},
+		{in: `"2.5e-1"`, want: 25},
+		{in: `null`, want: 0},
+
+		{in: `true`, wantErr: true},
+		{in: `"abc"`, wantErr: true},
+		{in: `""`, wantErr: true},
+		{in: `[1]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var body struct {
+			Amount Money `json:"amount"`
+		}
+		err := json.Unmarshal([]byte(`{"amount":`+tt.in+`}`), &body)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unmarshal %s = %d, want an error", tt.in, body.Amount)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unmarshal %s returned %v", tt.in, err)
+			continue
+		}
+		if body.Amount != tt.want {
+			t.Errorf("unmarshal %s = %d, want %d", tt.in, body.Amount, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package domain
+
+// Order is one ticket purchase. Each passenger in it is an item with its own
+// ticket.
+type Order struct {
+	Id               int64  `json:"id" db:"id"`
+	UserId           int64  `json:"user_id" db:"user_id"`
+	RouteId          int64  `json:"route_id" db:"route_id"`
+	BusName          string `json:"bus_name" db:"bus_name"`
+	StartDestination string `json:"start_destination" db:"start_destination"`
+	EndDestination   string `json:"end_destination" db:"end_destination"`
+	PaymentMethod    string `json:"payment_method" db:"payment_method"`
+	TotalFare        Money  `json:"total_fare" db:"total_fare"`
+	Discount         Money  `json:"discount" db:"discount"` // Promo discount, already taken off TotalFare
+	RefundedAmount   Money  `json:"refunded_amount" db:"refunded_amount"`
+	Status           string `json:"status" db:"status"`
+	BatchID          string `json:"batch_id" db:"batch_id"`
+	CreatedAt        string `json:"created_at" db:"created_at"`
+	UpdatedAt        string `json:"updated_at" db:"updated_at"`
+
+	Items           []OrderItem      `json:"items" db:"-"`
+	PaymentAttempts []PaymentAttempt `json:"payment_attempts" db:"-"`
+}
+
+type OrderItem struct {
+	Id             int64  `json:"id" db:"id"`
+	OrderId        int64  `json:"order_id" db:"order_id"`
+	TicketId       int64  `json:"ticket_id" db:"ticket_id"`
+	FareCategory   string `json:"fare_category" db:"fare_category"`
+	Fare           Money  `json:"fare" db:"fare"`
+	Discount       Money  `json:"discount" db:"discount"`
+	RefundedAmount Money  `json:"refunded_amount" db:"refunded_amount"`
+	TicketStatus   string `json:"ticket_status" db:"ticket_status"`
+
+	// Ticket to issue for the item when the order is created; not stored
+	Ticket *Ticket `json:"-" db:"-"`
+}
+
+// PaymentAttempt is one gateway session opened to pay for an order.
+type PaymentAttempt struct {
+	Id        int64  `json:"id" db:"id"`
+	OrderId   int64  `json:"order_id" db:"order_id"`
+	TranID    string `json:"tran_id" db:"tran_id"`
+	Gateway   string `json:"gateway" db:"gateway"`
+	Amount    Money  `json:"amount" db:"amount"`
+	Status    string `json:"status" db:"status"`
+	CreatedAt string `json:"created_at" db:"created_at"`
+	UpdatedAt string `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+// PassProduct is a pass passengers can buy, such as a day pass or a 30 day
+// pass, valid on a set of routes or on the buses of a set of owners.
+type PassProduct struct {
+	Id           int64   `json:"id" db:"id"`
+	Name         string  `json:"name" db:"name"`
+	DurationDays int     `json:"duration_days" db:"duration_days"`
+	Price        Money   `json:"price" db:"price"`
+	RouteIds     []int64 `json:"route_ids" db:"-"`
+	OwnerIds     []int64 `json:"owner_ids" db:"-"`
+	Active       bool    `json:"active" db:"active"`
+	CreatedAt    string  `json:"created_at" db:"created_at"`
+}
+
+// Pass is a pass bought by a passenger. Its validity starts when it is paid for.
+type Pass struct {
+	Id            int64      `json:"id" db:"id"`
+	UserId        int64      `json:"user_id" db:"user_id"`
+	ProductId     int64      `json:"product_id" db:"product_id"`
+	Price         Money      `json:"price" db:"price"`
+	QRCode        string     `json:"qr_code" db:"qr_code"`
+	PaymentMethod string     `json:"payment_method" db:"payment_method"`
+	TranID        *string    `json:"-" db:"tran_id"`
+	Status        string     `json:"status" db:"status"`
+	ValidFrom     *time.Time `json:"valid_from" db:"valid_from"`
+	ValidUntil    *time.Time `json:"valid_until" db:"valid_until"`
+	CreatedAt     string     `json:"created_at" db:"created_at"`
+
+	Product *PassProduct `json:"product,omitempty" db:"-"`
+}
+
+// PassRide is one ride taken on a pass.
+type PassRide struct {
+	Id                 int64  `json:"id" db:"id"`
+	PassId             int64  `json:"pass_id" db:"pass_id"`
+	UserId             int64  `json:"user_id" db:"user_id"`
+	RouteId            int64  `json:"route_id" db:"route_id"`
+	RegistrationNumber string `json:"registration_number" db:"registration_number"`
+	OwnerId            *int64 `json:"owner_id" db:"owner_id"`
+	Source             string `json:"source" db:"source"`
+	CreatedAt          string `json:"created_at" db:"created_at"`
+}
+
+// PassApportionment is the share of pass revenue earned by a bus owner,
+// splitting the price of each pass evenly over the rides taken on it.
+type PassApportionment struct {
+	OwnerId int64 `json:"owner_id" db:"owner_id"`
+	Rides   int   `json:"rides" db:"rides"`
+	Revenue Money `json:"revenue" db:"revenue"`
+}
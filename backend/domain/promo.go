@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// PromoCode is a discount passengers can apply when buying tickets. Percent
+// and Amount are set by Kind; nil limits mean no limit.
+type PromoCode struct {
+	Id            int64      `json:"id" db:"id"`
+	Code          string     `json:"code" db:"code"`
+	Description   string     `json:"description" db:"description"`
+	Kind          string     `json:"kind" db:"kind"`
+	Percent       *int       `json:"percent,omitempty" db:"percent"`
+	Amount        *Money     `json:"amount,omitempty" db:"amount"`
+	MaxDiscount   *Money     `json:"max_discount,omitempty" db:"max_discount"`
+	RouteIds      []int64    `json:"route_ids" db:"-"`
+	PerUserLimit  *int       `json:"per_user_limit,omitempty" db:"per_user_limit"`
+	UsageLimit    *int       `json:"usage_limit,omitempty" db:"usage_limit"`
+	TimesUsed     int        `json:"times_used" db:"times_used"`
+	Budget        *Money     `json:"budget,omitempty" db:"budget"`
+	DiscountGiven Money      `json:"discount_given" db:"discount_given"`
+	StartsAt      time.Time  `json:"starts_at" db:"starts_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	Active        bool       `json:"active" db:"active"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// PromoRedemption is a promo code used on an order.
+type PromoRedemption struct {
+	Id         int64      `json:"id" db:"id"`
+	PromoId    int64      `json:"promo_id" db:"promo_id"`
+	OrderId    int64      `json:"order_id" db:"order_id"`
+	UserId     int64      `json:"user_id" db:"user_id"`
+	Discount   Money      `json:"discount" db:"discount"`
+	Status     string     `json:"status" db:"status"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ReleasedAt *time.Time `json:"released_at,omitempty" db:"released_at"`
+}
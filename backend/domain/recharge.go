@@ -0,0 +1,47 @@
+package domain
+
+import "time"
+
+// RechargeProduct is an amount a wallet can be recharged by.
+type RechargeProduct struct {
+	Id        int64     `json:"id" db:"id"`
+	Amount    Money     `json:"amount" db:"amount"`
+	Active    bool      `json:"active" db:"active"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// RechargeLimit is the most a user may recharge per day. The limit without
+// a user is the default for users without their own.
+type RechargeLimit struct {
+	UserId     *int64    `json:"user_id,omitempty" db:"user_id"`
+	DailyLimit Money     `json:"daily_limit" db:"daily_limit"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RechargeCampaign gives a bonus on recharges of at least MinAmount started
+// between StartsAt and EndsAt. PerUserLimit caps how many bonuses one user
+// gets and Budget the total bonus paid out; nil means no cap.
+type RechargeCampaign struct {
+	Id           int64     `json:"id" db:"id"`
+	Name         string    `json:"name" db:"name"`
+	MinAmount    Money     `json:"min_amount" db:"min_amount"`
+	Bonus        Money     `json:"bonus" db:"bonus"`
+	StartsAt     time.Time `json:"starts_at" db:"starts_at"`
+	EndsAt       time.Time `json:"ends_at" db:"ends_at"`
+	PerUserLimit *int      `json:"per_user_limit,omitempty" db:"per_user_limit"`
+	Budget       *Money    `json:"budget,omitempty" db:"budget"`
+	BonusGiven   Money     `json:"bonus_given" db:"bonus_given"`
+	Active       bool      `json:"active" db:"active"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// Recharge is a completed gateway recharge and the bonus it earned.
+type Recharge struct {
+	Id         int64     `json:"id" db:"id"`
+	UserId     int64     `json:"user_id" db:"user_id"`
+	TranID     string    `json:"tran_id" db:"tran_id"`
+	Amount     Money     `json:"amount" db:"amount"`
+	Bonus      Money     `json:"bonus" db:"bonus"`
+	CampaignId *int64    `json:"campaign_id,omitempty" db:"campaign_id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
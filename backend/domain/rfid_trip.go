@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// RFIDTrip is a trip paid by RFID card under tap-on/tap-off. Its ticket
+// holds the reserved fare until the trip is settled.
+type RFIDTrip struct {
+	Id            int64      `json:"id" db:"id"`
+	UserId        int64      `json:"user_id" db:"user_id"`
+	TicketId      int64      `json:"ticket_id" db:"ticket_id"`
+	RouteId       int64      `json:"route_id" db:"route_id"`
+	BusName       string     `json:"bus_name" db:"bus_name"`
+	BoardingStop  string     `json:"boarding_stop" db:"boarding_stop"`
+	AlightingStop *string    `json:"alighting_stop,omitempty" db:"alighting_stop"`
+	ReservedFare  Money      `json:"reserved_fare" db:"reserved_fare"`
+	Fare          *Money     `json:"fare,omitempty" db:"fare"`
+	Status        string     `json:"status" db:"status"`
+	TappedOnAt    time.Time  `json:"tapped_on_at" db:"tapped_on_at"`
+	TappedOffAt   *time.Time `json:"tapped_off_at,omitempty" db:"tapped_off_at"`
+	PaidBy        *int64     `json:"paid_by,omitempty" db:"paid_by"` // Guardian whose wallet paid, when not the rider's
+}
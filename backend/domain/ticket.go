@@ -1,22 +1,49 @@
 package domain
 
+import "time"
+
 type Ticket struct {
-	Id                 int64   `json:"id" db:"id"`
-	UserId             int64   `json:"user_id" db:"user_id"`
-	RouteId            int64   `json:"route_id" db:"route_id"`
-	BusName            string  `json:"bus_name" db:"bus_name"`
-	StartDestination   string  `json:"start_destination" db:"start_destination"`
-	EndDestination     string  `json:"end_destination" db:"end_destination"`
-	Fare               float64 `json:"fare" db:"fare"`
-	PaidStatus         bool    `json:"paid_status" db:"paid_status"`
-	Checked            bool    `json:"checked" db:"checked"`
-	QRCode             string  `json:"qr_code" db:"qr_code"`
-	CreatedAt          string  `json:"created_at" db:"created_at"`
-	BatchID            string  `json:"batch_id" db:"batch_id"`
-	PaymentMethod      string  `json:"payment_method" db:"payment_method"`
-	PaymentReference   string  `json:"payment_reference" db:"payment_reference"`
-	PaymentUsed        bool    `json:"payment_used" db:"payment_used"`
-	PaymentStatus      string  `json:"payment_status" db:"payment_status"`
-	CancelledAt        *string `json:"cancelled_at,omitempty" db:"cancelled_at"`
-	RegistrationNumber *string `json:"registration_number" db:"registration_number"`
+	Id                 int64     `json:"id" db:"id"`
+	UserId             int64     `json:"user_id" db:"user_id"`
+	RouteId            int64     `json:"route_id" db:"route_id"`
+	BusName            string    `json:"bus_name" db:"bus_name"`
+	StartDestination   string    `json:"start_destination" db:"start_destination"`
+	EndDestination     string    `json:"end_destination" db:"end_destination"`
+	Fare               Money     `json:"fare" db:"fare"`
+	FullFare           *Money    `json:"full_fare,omitempty" db:"full_fare"` // Set when a fare cap reduced Fare
+	FareCap            *string   `json:"fare_cap,omitempty" db:"fare_cap"`
+	PaidStatus         bool      `json:"paid_status" db:"paid_status"`
+	Checked            bool      `json:"checked" db:"checked"`
+	QRCode             string    `json:"qr_code" db:"qr_code"`
+	CreatedAt          string    `json:"created_at" db:"created_at"`
+	BatchID            string    `json:"batch_id" db:"batch_id"`
+	OrderID            *int64    `json:"order_id,omitempty" db:"order_id"`
+	PaymentMethod      string    `json:"payment_method" db:"payment_method"`
+	PaymentReference   string    `json:"payment_reference" db:"payment_reference"`
+	PaymentUsed        bool      `json:"payment_used" db:"payment_used"`
+	PaymentStatus      string    `json:"payment_status" db:"payment_status"`
+	Status             string    `json:"status" db:"status"`
+	TicketType         string    `json:"ticket_type" db:"ticket_type"`
+	ValidFrom          time.Time `json:"valid_from" db:"valid_from"`
+	ValidUntil         time.Time `json:"valid_until" db:"valid_until"`
+	CancelledAt        *string   `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	RegistrationNumber *string   `json:"registration_number" db:"registration_number"`
+	CheckedAt          *string   `json:"checked_at,omitempty" db:"checked_at"`
+	UpdatedAt          string    `json:"updated_at" db:"updated_at"`
+
+	// Signed token to render in the QR instead of QRCode; not stored
+	QRToken string `json:"qr_token,omitempty" db:"-"`
+	// Secret the app derives rotating QR codes from; only sent to the owner
+	DynamicQRSecret string `json:"dynamic_qr_secret,omitempty" db:"-"`
+}
+
+// TicketEvent records one state change of a ticket.
+type TicketEvent struct {
+	Id         int64  `json:"id" db:"id"`
+	TicketId   int64  `json:"ticket_id" db:"ticket_id"`
+	FromStatus string `json:"from_status" db:"from_status"`
+	ToStatus   string `json:"to_status" db:"to_status"`
+	Actor      string `json:"actor" db:"actor"`
+	Reason     string `json:"reason" db:"reason"`
+	CreatedAt  string `json:"created_at" db:"created_at"`
 }
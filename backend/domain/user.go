@@ -9,7 +9,7 @@ type User struct {
 	Email        string  `json:"email" db:"email"`
 	Password     string  `json:"password" db:"password"`
 	IsStudent    bool    `json:"is_student" db:"is_student"`
-	Balance      float32 `json:"balance" db:"balance"`
+	Balance      Money   `json:"balance" db:"balance"`
 	RFID         *string `json:"rfid" db:"rfid"`
 	IsRFIDActive bool    `json:"is_rfid_active" db:"is_rfid_active"`
 }
@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// WalletTransfer is money a user sent from their wallet to another user's.
+type WalletTransfer struct {
+	Id              int64     `json:"id" db:"id"`
+	SenderId        int64     `json:"sender_id" db:"sender_id"`
+	SenderName      string    `json:"sender_name" db:"sender_name"`
+	RecipientId     int64     `json:"recipient_id" db:"recipient_id"`
+	RecipientName   string    `json:"recipient_name" db:"recipient_name"`
+	RecipientMobile string    `json:"recipient_mobile" db:"recipient_mobile"`
+	Amount          Money     `json:"amount" db:"amount"`
+	Note            string    `json:"note" db:"note"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// FamilyMember links a guardian to one of their dependents. SharedWallet
+// lets the dependent's RFID taps draw from the guardian's wallet.
+type FamilyMember struct {
+	Id              int64      `json:"id" db:"id"`
+	GuardianId      int64      `json:"guardian_id" db:"guardian_id"`
+	GuardianName    string     `json:"guardian_name" db:"guardian_name"`
+	DependentId     int64      `json:"dependent_id" db:"dependent_id"`
+	DependentName   string     `json:"dependent_name" db:"dependent_name"`
+	DependentMobile string     `json:"dependent_mobile" db:"dependent_mobile"`
+	Status          string     `json:"status" db:"status"`
+	SharedWallet    bool       `json:"shared_wallet" db:"shared_wallet"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	AcceptedAt      *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+}
+
+// BalanceAlert is a user's low-balance alert. When their wallet balance
+// falls below Threshold they are notified and, with AutoTopUpAmount set, a
+// recharge of that amount is started for them. TriggeredAt is when the alert
+// last fired, until the balance is back at or above the threshold.
+type BalanceAlert struct {
+	UserId          int64      `json:"user_id" db:"user_id"`
+	Threshold       Money      `json:"threshold" db:"threshold"`
+	AutoTopUpAmount *Money     `json:"auto_topup_amount,omitempty" db:"auto_topup_amount"`
+	TriggeredAt     *time.Time `json:"triggered_at,omitempty" db:"triggered_at"`
+	TopUpTranID     *string    `json:"topup_tran_id,omitempty" db:"topup_tran_id"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,49 @@
+package mqtt
+
+import (
+	"fmt"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+type MQTT struct {
+	Client paho.Client
+}
+
+func NewConnection(brokerURL, clientID, username, password string) (*MQTT, error) {
+	opts := paho.NewClientOptions().
+		AddBroker(brokerURL).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(30 * time.Second).
+		// Keep subscriptions across reconnects
+		SetCleanSession(false).
+		SetResumeSubs(true)
+
+	client := paho.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(10*time.Second) || token.Error() != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %v", token.Error())
+	}
+
+	return &MQTT{Client: client}, nil
+}
+
+// Subscribe registers handler for messages on topic, which may contain wildcards.
+func (m *MQTT) Subscribe(topic string, qos byte, handler paho.MessageHandler) error {
+	token := m.Client.Subscribe(topic, qos, handler)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+	}
+	return nil
+}
+
+func (m *MQTT) Close() {
+	if m.Client != nil {
+		m.Client.Disconnect(250)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"swift_transit/config"
+	"swift_transit/domain"
 )
 
 type SSLCommerz struct {
@@ -24,11 +25,11 @@ type InitResponse struct {
 	Gateway string `json:"GatewayPageURL"`
 }
 
-func (s *SSLCommerz) InitPayment(amount float64, tranID, successUrl, failUrl, cancelUrl string) (string, error) {
+func (s *SSLCommerz) InitPayment(amount domain.Money, tranID, successUrl, failUrl, cancelUrl string) (string, error) {
 	data := url.Values{}
 	data.Set("store_id", s.Config.StoreID)
 	data.Set("store_passwd", s.Config.StorePass)
-	data.Set("total_amount", fmt.Sprintf("%.2f", amount))
+	data.Set("total_amount", amount.String())
 	data.Set("currency", "BDT")
 	data.Set("tran_id", tranID)
 	data.Set("success_url", successUrl)
@@ -99,6 +100,16 @@ type ValidationResponse struct {
 	GwVersion       string `json:"gw_version"`
 }
 
+// PaidAmount parses the amount the gateway reports, so it can be compared
+// exactly with what was charged.
+func (r *ValidationResponse) PaidAmount() (domain.Money, error) {
+	amount, err := domain.ParseMoney(r.Amount)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount format from api: %w", err)
+	}
+	return amount, nil
+}
+
 func (s *SSLCommerz) ValidateTransaction(valID string) (*ValidationResponse, error) {
 	apiUrl := "https://sandbox.sslcommerz.com/validator/api/validationserverAPI.php"
 	if !s.Config.IsSandbox {
@@ -0,0 +1,22 @@
+package ledger
+
+import (
+	"time"
+
+	"swift_transit/domain"
+)
+
+type Service interface {
+	GetWalletLedger(userID int64, limit, offset int) (*domain.WalletLedger, error)
+	Reconcile(now time.Time) (*domain.LedgerReconciliation, error)
+	ListReconciliations(limit, offset int) ([]domain.LedgerReconciliation, int, error)
+	GetReconciliation(id int64) (*domain.LedgerReconciliation, error)
+}
+
+type Repo interface {
+	GetWalletBalances(userID int64) (balance domain.Money, ledgerBalance domain.Money, err error)
+	GetWalletEntries(userID int64, limit, offset int) ([]domain.LedgerEntry, int, error)
+	Reconcile(startedAt time.Time) (*domain.LedgerReconciliation, error)
+	ListReconciliations(limit, offset int) ([]domain.LedgerReconciliation, int, error)
+	GetReconciliation(id int64) (*domain.LedgerReconciliation, error)
+}
@@ -0,0 +1,87 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+)
+
+// System accounts on the other side of wallet entries
+const (
+	AccountGateway     = "gateway"     // Money paid in through the payment gateway
+	AccountFares       = "fares"       // Ticket and RFID fares
+	AccountPasses      = "passes"      // Pass sales
+	AccountAdjustments = "adjustments" // Opening balances and corrections by admins
+	AccountPromotions  = "promotions"  // Bonuses given by recharge campaigns
+)
+
+// Kinds of ledger entries
+const (
+	KindOpening    = "opening"
+	KindRecharge   = "recharge"
+	KindFare       = "fare"
+	KindRefund     = "refund"
+	KindPass       = "pass"
+	KindAdjustment = "adjustment"
+	KindTransfer   = "transfer" // Between two wallets, with no system account
+	KindBonus      = "bonus"    // Recharge campaign bonus, separate from the recharge it rewards
+)
+
+// WalletAccount is the ledger account code of a user's wallet.
+func WalletAccount(userID int64) string {
+	return fmt.Sprintf("wallet:%d", userID)
+}
+
+type service struct {
+	repo Repo
+}
+
+func NewService(repo Repo) Service {
+	return &service{repo: repo}
+}
+
+// GetWalletLedger returns a page of a user's wallet entries with the cached
+// and posted balances of the wallet.
+func (s *service) GetWalletLedger(userID int64, limit, offset int) (*domain.WalletLedger, error) {
+	balance, ledgerBalance, err := s.repo.GetWalletBalances(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries, total, err := s.repo.GetWalletEntries(userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.WalletLedger{
+		UserId:        userID,
+		Account:       WalletAccount(userID),
+		Balance:       balance,
+		LedgerBalance: ledgerBalance,
+		Entries:       entries,
+		Total:         total,
+	}, nil
+}
+
+// Reconcile checks every wallet's cached balance against its postings and
+// every entry for postings that do not sum to zero, and records the run with
+// the wallets that drifted.
+func (s *service) Reconcile(now time.Time) (*domain.LedgerReconciliation, error) {
+	return s.repo.Reconcile(now)
+}
+
+func (s *service) ListReconciliations(limit, offset int) ([]domain.LedgerReconciliation, int, error) {
+	return s.repo.ListReconciliations(limit, offset)
+}
+
+func (s *service) GetReconciliation(id int64) (*domain.LedgerReconciliation, error) {
+	run, err := s.repo.GetReconciliation(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("reconciliation not found")
+	}
+	return run, err
+}
@@ -0,0 +1,60 @@
+package ledger
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const defaultReconcileAt = "03:00"
+
+// ReconcileWorker reconciles the ledger once a day at a local time of day.
+type ReconcileWorker struct {
+	svc Service
+	at  time.Duration // Since local midnight
+}
+
+// NewReconcileWorker runs reconciliation daily at, a local "HH:MM"; 03:00
+// when empty.
+func NewReconcileWorker(svc Service, at string) (*ReconcileWorker, error) {
+	if at == "" {
+		at = defaultReconcileAt
+	}
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reconciliation time %q, want HH:MM", at)
+	}
+	return &ReconcileWorker{
+		svc: svc,
+		at:  time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute,
+	}, nil
+}
+
+func (w *ReconcileWorker) Start() {
+	for {
+		time.Sleep(time.Until(w.next(time.Now())))
+
+		run, err := w.svc.Reconcile(time.Now())
+		if err != nil {
+			log.Printf("Failed to reconcile ledger: %v", err)
+			continue
+		}
+		if run.DriftedWallets > 0 || run.UnbalancedEntries > 0 {
+			log.Printf("Ledger reconciliation %d: %d of %d wallet(s) drifted from their postings, %d unbalanced entries",
+				run.Id, run.DriftedWallets, run.WalletsChecked, run.UnbalancedEntries)
+		} else {
+			log.Printf("Ledger reconciliation %d: %d wallet(s) match their postings", run.Id, run.WalletsChecked)
+		}
+	}
+}
+
+// next returns the first run time after now.
+func (w *ReconcileWorker) next(now time.Time) time.Time {
+	local := now.In(time.Local)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+	next := midnight.Add(w.at)
+	if !next.After(local) {
+		next = midnight.AddDate(0, 0, 1).Add(w.at)
+	}
+	return next
+}
@@ -37,19 +37,19 @@ type Client struct {
 	// The websocket connection.
 	conn *websocket.Conn
 
-	// Buffered channel of outbound messages.
-	send chan LocationUpdate
+	// Hub subscription whose messages writePump writes to the connection.
+	stream *Stream
 
-	// Route ID the client is interested in
-	routeID int64
+	// Route used for published updates that omit route_id
+	defaultRouteID int64
 
-	// Whether this client is allowed to publish location updates
-	canPublish bool
+	// Checks updates this client publishes; nil when it may not publish
+	validate func(*LocationUpdate) error
 }
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.stream.Close()
 		c.conn.Close()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
@@ -64,21 +64,91 @@ func (c *Client) readPump() {
 			break
 		}
 
-		var update LocationUpdate
-		if err := json.Unmarshal(message, &update); err != nil {
-			log.Printf("invalid location payload: %v", err)
+		var envelope Envelope
+		if err := json.Unmarshal(message, &envelope); err != nil {
+			c.reply(errorEnvelope("", ErrBadRequest, "invalid message"))
+			continue
+		}
+
+		// Bus devices predating the envelope send a bare LocationUpdate
+		if envelope.Type == "" && c.validate != nil {
+			var update LocationUpdate
+			if err := json.Unmarshal(message, &update); err != nil {
+				log.Printf("invalid location payload: %v", err)
+				continue
+			}
+			c.publish(update)
 			continue
 		}
 
-		// Default to the subscribed route when the sender omits route_id
+		c.handle(envelope)
+	}
+}
+
+func (c *Client) handle(envelope Envelope) {
+	if envelope.Version != ProtocolVersion {
+		c.reply(errorEnvelope(envelope.ID, ErrUnsupportedVersion, "unsupported protocol version"))
+		return
+	}
+
+	switch envelope.Type {
+	case TypeSubscribe, TypeUnsubscribe:
+		routeIDs := envelope.RouteIDs
+		if envelope.RouteID != 0 {
+			routeIDs = append(routeIDs, envelope.RouteID)
+		}
+		if len(routeIDs) == 0 {
+			c.reply(errorEnvelope(envelope.ID, ErrBadRequest, "route_ids is required"))
+			return
+		}
+		if envelope.Type == TypeSubscribe {
+			c.hub.Subscribe(c.stream, envelope.ID, routeIDs)
+		} else {
+			c.hub.Unsubscribe(c.stream, envelope.ID, routeIDs)
+		}
+
+	case TypeLocation:
+		if c.validate == nil {
+			c.reply(errorEnvelope(envelope.ID, ErrForbidden, "this connection cannot publish locations"))
+			return
+		}
+		var update LocationUpdate
+		if err := json.Unmarshal(envelope.Data, &update); err != nil {
+			c.reply(errorEnvelope(envelope.ID, ErrBadRequest, "invalid location payload"))
+			return
+		}
 		if update.RouteID == 0 {
-			update.RouteID = c.routeID
+			update.RouteID = envelope.RouteID
 		}
+		c.publish(update)
 
-		c.hub.BroadcastLocation(update)
+	default:
+		c.reply(errorEnvelope(envelope.ID, ErrUnsupportedType, "unsupported message type"))
 	}
 }
 
+func (c *Client) publish(update LocationUpdate) {
+	// Default to the connection's route when the sender omits route_id
+	if update.RouteID == 0 {
+		update.RouteID = c.defaultRouteID
+	}
+	if update.RouteID == 0 {
+		c.reply(errorEnvelope("", ErrBadRequest, "route_id is required"))
+		return
+	}
+	if err := c.validate(&update); err != nil {
+		c.reply(errorEnvelope("", ErrBadRequest, err.Error()))
+		return
+	}
+
+	c.hub.BroadcastLocation(update)
+}
+
+// reply queues a message for this client only.
+func (c *Client) reply(envelope Envelope) {
+	c.stream.push(envelope)
+}
+
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
@@ -87,16 +157,21 @@ func (c *Client) writePump() {
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
+		case <-c.stream.Done():
+			// The hub unregistered the client.
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+
+		case <-c.stream.Ready():
+			for _, message := range c.stream.Drain() {
+				c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := c.conn.WriteJSON(message); err != nil {
+					return
+				}
+				c.stream.Delivered(1)
 			}
 
-			c.conn.WriteJSON(message)
-
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -106,14 +181,20 @@ func (c *Client) writePump() {
 	}
 }
 
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, routeID int64, canPublish bool) {
+// ServeWs upgrades the request and subscribes the connection to routeIDs.
+// The first route is used for published updates that omit route_id. The
+// connection may publish locations when validate is set, which checks each
+// update before it is broadcast.
+func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, routeIDs []int64, validate func(*LocationUpdate) error) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan LocationUpdate, 256), routeID: routeID, canPublish: canPublish}
-	client.hub.register <- client
+	client := &Client{hub: hub, conn: conn, stream: hub.Open(routeIDs), validate: validate}
+	if len(routeIDs) > 0 {
+		client.defaultRouteID = routeIDs[0]
+	}
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
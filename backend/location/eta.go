@@ -0,0 +1,122 @@
+package location
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"swift_transit/domain"
+)
+
+const (
+	// How long the stops of a route are cached
+	stopsCacheTTL = 10 * time.Minute
+
+	// Number of upcoming stops an ETA is published for
+	etaStopCount = 5
+
+	// Speed assumed when the bus is stopped or does not report one, in km/h
+	defaultSpeedKmh = 15.0
+
+	earthRadiusMeters = 6371000.0
+)
+
+// RouteSource loads a route with its stops. The route service satisfies it.
+type RouteSource interface {
+	FindByID(id int64) (*domain.Route, error)
+}
+
+type cachedStops struct {
+	stops    []domain.Stop
+	loadedAt time.Time
+}
+
+// ETAEstimator predicts arrival times at the next stops of a route from a bus
+// position. It assumes buses travel the stops in order and measures the
+// straight-line distance between consecutive stops.
+type ETAEstimator struct {
+	routes RouteSource
+
+	mu    sync.Mutex
+	cache map[int64]cachedStops
+}
+
+func NewETAEstimator(routes RouteSource) *ETAEstimator {
+	return &ETAEstimator{
+		routes: routes,
+		cache:  make(map[int64]cachedStops),
+	}
+}
+
+// Estimate returns ETAs for the stop nearest to the bus and the stops after it.
+func (e *ETAEstimator) Estimate(update LocationUpdate) []ETAUpdate {
+	stops := e.stops(update.RouteID)
+	if len(stops) == 0 {
+		return nil
+	}
+
+	nearest := 0
+	nearestDistance := math.MaxFloat64
+	for i, stop := range stops {
+		d := haversine(update.Latitude, update.Longitude, stop.Lat, stop.Lon)
+		if d < nearestDistance {
+			nearest, nearestDistance = i, d
+		}
+	}
+
+	speed := update.Speed
+	if speed <= 1 {
+		speed = defaultSpeedKmh
+	}
+	metersPerSecond := speed * 1000 / 3600
+
+	var etas []ETAUpdate
+	distance := nearestDistance
+	for i := nearest; i < len(stops) && len(etas) < etaStopCount; i++ {
+		if i > nearest {
+			distance += haversine(stops[i-1].Lat, stops[i-1].Lon, stops[i].Lat, stops[i].Lon)
+		}
+		etas = append(etas, ETAUpdate{
+			BusID:      update.BusID,
+			RouteID:    update.RouteID,
+			StopName:   stops[i].Name,
+			StopOrder:  stops[i].Order,
+			ETASeconds: int64(distance / metersPerSecond),
+		})
+	}
+	return etas
+}
+
+func (e *ETAEstimator) stops(routeID int64) []domain.Stop {
+	e.mu.Lock()
+	cached, ok := e.cache[routeID]
+	e.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < stopsCacheTTL {
+		return cached.stops
+	}
+
+	route, err := e.routes.FindByID(routeID)
+	if err != nil || route == nil {
+		// Keep serving stale stops rather than none
+		return cached.stops
+	}
+
+	stops := append([]domain.Stop{}, route.Stops...)
+	sort.Slice(stops, func(i, j int) bool { return stops[i].Order < stops[j].Order })
+
+	e.mu.Lock()
+	e.cache[routeID] = cachedStops{stops: stops, loadedAt: time.Now()}
+	e.mu.Unlock()
+	return stops
+}
+
+// haversine returns the distance in meters between two coordinates.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,103 @@
+package location
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of recent messages kept per route for resuming streams
+	historySize = 1024
+
+	// Latest positions older than this are left out of snapshots
+	snapshotMaxAge = 5 * time.Minute
+)
+
+// routeHistory numbers the messages published on one route and keeps the
+// most recent ones, so a reconnecting stream can resume from the last event
+// it saw.
+type routeHistory struct {
+	seq    uint64
+	ring   []Envelope
+	next   int
+	latest map[string]snapshotEntry
+}
+
+type snapshotEntry struct {
+	envelope Envelope
+	at       time.Time
+}
+
+type history struct {
+	mu     sync.Mutex
+	routes map[int64]*routeHistory
+}
+
+func newHistory() *history {
+	return &history{routes: make(map[int64]*routeHistory)}
+}
+
+// record assigns the next sequence number of the route to envelope and stores it.
+// Must be called with h.mu held.
+func (h *history) record(envelope *Envelope) {
+	rh, ok := h.routes[envelope.RouteID]
+	if !ok {
+		rh = &routeHistory{
+			ring:   make([]Envelope, 0, historySize),
+			latest: make(map[string]snapshotEntry),
+		}
+		h.routes[envelope.RouteID] = rh
+	}
+
+	rh.seq++
+	envelope.Seq = rh.seq
+
+	if len(rh.ring) < historySize {
+		rh.ring = append(rh.ring, *envelope)
+	} else {
+		rh.ring[rh.next] = *envelope
+		rh.next = (rh.next + 1) % historySize
+	}
+
+	if envelope.key != "" {
+		rh.latest[envelope.key] = snapshotEntry{envelope: *envelope, at: time.Now()}
+	}
+}
+
+// since returns the messages of a route published after lastSeq and true. If
+// lastSeq is zero or cannot be replayed, it returns a snapshot of the latest
+// position and ETA of every bus and false.
+func (h *history) since(routeID int64, lastSeq uint64) ([]Envelope, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rh, ok := h.routes[routeID]
+	if !ok {
+		return nil, false
+	}
+
+	// Ordered oldest first
+	ordered := append(append([]Envelope{}, rh.ring[rh.next:]...), rh.ring[:rh.next]...)
+
+	if lastSeq > 0 && lastSeq <= rh.seq && len(ordered) > 0 && ordered[0].Seq <= lastSeq+1 {
+		var missed []Envelope
+		for _, envelope := range ordered {
+			if envelope.Seq > lastSeq {
+				missed = append(missed, envelope)
+			}
+		}
+		return missed, true
+	}
+
+	var snapshot []Envelope
+	for key, entry := range rh.latest {
+		if time.Since(entry.at) > snapshotMaxAge {
+			delete(rh.latest, key)
+			continue
+		}
+		snapshot = append(snapshot, entry.envelope)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Seq < snapshot[j].Seq })
+	return snapshot, false
+}
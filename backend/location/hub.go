@@ -1,84 +1,303 @@
 package location
 
 import (
+	"fmt"
+	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Minimum time between two flushes to the same subscriber. Positions that
+// arrive in between are coalesced, so each subscriber gets at most one
+// position per bus per interval.
+const defaultSendInterval = 500 * time.Millisecond
+
 type LocationUpdate struct {
 	BusID     int64   `json:"bus_id"`
 	RouteID   int64   `json:"route_id"`
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 	Speed     float64 `json:"speed"`
+
+	// When the device took the reading; set to the receive time if omitted
+	RecordedAt time.Time `json:"recorded_at"`
 }
 
-type Hub struct {
-	// Registered clients (users) listening for updates on specific routes
-	clients map[*Client]bool
+// subscription is a request from a stream to change the routes it listens to
+type subscription struct {
+	stream    *Stream
+	id        string
+	routeIDs  []int64
+	subscribe bool
+}
 
-	// Inbound messages from buses
-	broadcast chan LocationUpdate
+type hubCounters struct {
+	published atomic.Uint64
+	delivered atomic.Uint64
+	coalesced atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// HubMetrics is a point-in-time snapshot of the hub.
+type HubMetrics struct {
+	Clients           int           `json:"clients"`
+	RouteClients      map[int64]int `json:"route_clients"`
+	Published         uint64        `json:"published"`
+	Delivered         uint64        `json:"delivered"`
+	Coalesced         uint64        `json:"coalesced"`
+	Dropped           uint64        `json:"dropped"`
+	MessagesPerSecond float64       `json:"messages_per_second"`
+}
+
+type Hub struct {
+	// Open streams and the routes each one is subscribed to
+	clients map[*Stream]map[int64]bool
 
-	// Register requests from clients
-	register chan *Client
+	// Map routeID to list of streams
+	routeClients map[int64]map[*Stream]bool
 
-	// Unregister requests from clients
-	unregister chan *Client
+	// Unregister requests from streams
+	unregister chan *Stream
 
-	// Map routeID to list of clients
-	routeClients map[int64]map[*Client]bool
+	// Subscribe / unsubscribe requests from streams
+	subscriptions chan subscription
 
+	// Guards clients and routeClients. Readers (broadcasts, metrics) take the
+	// read lock.
 	mu sync.RWMutex
+
+	// Sequence numbers and recent messages per route, for resuming streams
+	history *history
+
+	// Publishes ETAs derived from positions when set
+	estimator *ETAEstimator
+
+	// Time of the live position of each bus, so late points are not broadcast
+	liveMu sync.Mutex
+	live   map[int64]time.Time
+
+	sendInterval time.Duration
+	counters     hubCounters
+
+	// Delivered messages per second, sampled once a second by Run
+	rate atomic.Uint64
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		broadcast:    make(chan LocationUpdate),
-		register:     make(chan *Client),
-		unregister:   make(chan *Client),
-		clients:      make(map[*Client]bool),
-		routeClients: make(map[int64]map[*Client]bool),
+		unregister:    make(chan *Stream),
+		subscriptions: make(chan subscription),
+		clients:       make(map[*Stream]map[int64]bool),
+		routeClients:  make(map[int64]map[*Stream]bool),
+		history:       newHistory(),
+		live:          make(map[int64]time.Time),
+		sendInterval:  defaultSendInterval,
 	}
 }
 
+// SetETAEstimator makes the hub publish ETAs for every position it receives.
+// It must be called before Run.
+func (h *Hub) SetETAEstimator(estimator *ETAEstimator) {
+	h.estimator = estimator
+}
+
 func (h *Hub) Run() {
+	sampler := time.NewTicker(time.Second)
+	defer sampler.Stop()
+	lastDelivered := uint64(0)
+
 	for {
 		select {
-		case client := <-h.register:
+		case stream := <-h.unregister:
 			h.mu.Lock()
-			h.clients[client] = true
-			if _, ok := h.routeClients[client.routeID]; !ok {
-				h.routeClients[client.routeID] = make(map[*Client]bool)
-			}
-			h.routeClients[client.routeID][client] = true
+			h.removeStream(stream)
 			h.mu.Unlock()
 
-		case client := <-h.unregister:
+		case sub := <-h.subscriptions:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				delete(h.routeClients[client.routeID], client)
-				close(client.send)
-			}
+			reply := h.applySubscription(sub)
 			h.mu.Unlock()
+			sub.stream.push(reply)
+
+		case <-sampler.C:
+			delivered := h.counters.delivered.Load()
+			h.rate.Store(delivered - lastDelivered)
+			lastDelivered = delivered
+		}
+	}
+}
 
-		case update := <-h.broadcast:
-			h.mu.RLock()
-			clients := h.routeClients[update.RouteID]
-			for client := range clients {
-				select {
-				case client.send <- update:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-					delete(h.routeClients[update.RouteID], client)
-				}
+// applySubscription must be called with h.mu held for writing. It returns the
+// ack or error to send back to the client.
+func (h *Hub) applySubscription(sub subscription) Envelope {
+	routes, ok := h.clients[sub.stream]
+	if !ok {
+		return errorEnvelope(sub.id, ErrBadRequest, "connection is closed")
+	}
+
+	if sub.subscribe {
+		added := 0
+		for _, routeID := range sub.routeIDs {
+			if routeID <= 0 {
+				return errorEnvelope(sub.id, ErrBadRequest, fmt.Sprintf("invalid route id %d", routeID))
 			}
-			h.mu.RUnlock()
+			if !routes[routeID] {
+				added++
+			}
+		}
+		if len(routes)+added > maxSubscriptions {
+			return errorEnvelope(sub.id, ErrTooManySubscriptions, "too many route subscriptions")
+		}
+		for _, routeID := range sub.routeIDs {
+			h.addRoute(sub.stream, routeID)
+		}
+	} else {
+		for _, routeID := range sub.routeIDs {
+			h.removeRoute(sub.stream, routeID)
+		}
+	}
+
+	ack, err := newEnvelope(TypeAck, 0, Ack{Subscriptions: sortedRoutes(routes)})
+	if err != nil {
+		log.Printf("failed to build ack: %v", err)
+		return errorEnvelope(sub.id, ErrBadRequest, "failed to update subscriptions")
+	}
+	ack.ID = sub.id
+	return ack
+}
+
+func (h *Hub) addRoute(stream *Stream, routeID int64) {
+	h.clients[stream][routeID] = true
+	if _, ok := h.routeClients[routeID]; !ok {
+		h.routeClients[routeID] = make(map[*Stream]bool)
+	}
+	h.routeClients[routeID][stream] = true
+}
+
+func (h *Hub) removeRoute(stream *Stream, routeID int64) {
+	delete(h.clients[stream], routeID)
+	delete(h.routeClients[routeID], stream)
+	if len(h.routeClients[routeID]) == 0 {
+		delete(h.routeClients, routeID)
+	}
+}
+
+func (h *Hub) removeStream(stream *Stream) {
+	routes, ok := h.clients[stream]
+	if !ok {
+		return
+	}
+	for routeID := range routes {
+		h.removeRoute(stream, routeID)
+	}
+	delete(h.clients, stream)
+	stream.out.close()
+}
+
+// Subscribe adds routes to a stream's subscriptions; the stream receives an ack.
+func (h *Hub) Subscribe(stream *Stream, id string, routeIDs []int64) {
+	h.subscriptions <- subscription{stream: stream, id: id, routeIDs: routeIDs, subscribe: true}
+}
+
+// Unsubscribe removes routes from a stream's subscriptions; the stream receives an ack.
+func (h *Hub) Unsubscribe(stream *Stream, id string, routeIDs []int64) {
+	h.subscriptions <- subscription{stream: stream, id: id, routeIDs: routeIDs, subscribe: false}
+}
+
+// BroadcastLocation publishes a bus position and reports whether it became
+// the bus's live position. Readings older than the current live position
+// (e.g. points a device buffered while offline) are not broadcast.
+func (h *Hub) BroadcastLocation(update LocationUpdate) bool {
+	if update.RecordedAt.IsZero() {
+		update.RecordedAt = time.Now()
+	}
+
+	h.liveMu.Lock()
+	if last, ok := h.live[update.BusID]; ok && !update.RecordedAt.After(last) {
+		h.liveMu.Unlock()
+		return false
+	}
+	h.live[update.BusID] = update.RecordedAt
+	h.liveMu.Unlock()
+
+	h.publish(TypeLocation, update.RouteID, fmt.Sprintf("location:%d:%d", update.RouteID, update.BusID), update)
+
+	if h.estimator != nil {
+		for _, eta := range h.estimator.Estimate(update) {
+			h.BroadcastETA(eta)
 		}
 	}
+	return true
 }
 
-func (h *Hub) BroadcastLocation(update LocationUpdate) {
-	h.broadcast <- update
+func (h *Hub) BroadcastETA(eta ETAUpdate) {
+	h.publish(TypeETA, eta.RouteID, fmt.Sprintf("eta:%d:%d:%d", eta.RouteID, eta.BusID, eta.StopOrder), eta)
+}
+
+func (h *Hub) BroadcastAlert(alert Alert) {
+	h.publish(TypeAlert, alert.RouteID, "", alert)
+}
+
+// publish numbers a message and hands it to every subscriber of routeID. It
+// never blocks on a subscriber: messages are queued in each stream's outbox
+// and written by the stream's own goroutine.
+func (h *Hub) publish(msgType MessageType, routeID int64, key string, payload any) {
+	envelope, err := newEnvelope(msgType, routeID, payload)
+	if err != nil {
+		log.Printf("failed to encode %s message: %v", msgType, err)
+		return
+	}
+	envelope.key = key
+	h.counters.published.Add(1)
+
+	// Sequence numbers are assigned and fanned out under the same lock so
+	// every stream sees a route's messages in order.
+	h.history.mu.Lock()
+	defer h.history.mu.Unlock()
+	h.history.record(&envelope)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for stream := range h.routeClients[routeID] {
+		stream.push(envelope)
+	}
+}
+
+// Since returns the messages published on a route after lastSeq. When they
+// are no longer available (or lastSeq is zero) it returns a snapshot of the
+// latest position and ETA of each bus instead, and resumed is false.
+func (h *Hub) Since(routeID int64, lastSeq uint64) (messages []Envelope, resumed bool) {
+	return h.history.since(routeID, lastSeq)
+}
+
+// Metrics returns a snapshot of connected clients and message counters.
+func (h *Hub) Metrics() HubMetrics {
+	h.mu.RLock()
+	routeClients := make(map[int64]int, len(h.routeClients))
+	for routeID, clients := range h.routeClients {
+		routeClients[routeID] = len(clients)
+	}
+	clients := len(h.clients)
+	h.mu.RUnlock()
+
+	return HubMetrics{
+		Clients:           clients,
+		RouteClients:      routeClients,
+		Published:         h.counters.published.Load(),
+		Delivered:         h.counters.delivered.Load(),
+		Coalesced:         h.counters.coalesced.Load(),
+		Dropped:           h.counters.dropped.Load(),
+		MessagesPerSecond: float64(h.rate.Load()),
+	}
+}
+
+func sortedRoutes(routes map[int64]bool) []int64 {
+	ids := make([]int64, 0, len(routes))
+	for routeID := range routes {
+		ids = append(ids, routeID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
 }
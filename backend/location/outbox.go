@@ -0,0 +1,95 @@
+package location
+
+import "sync"
+
+// Maximum number of non-coalescable messages (acks, errors, alerts) held for
+// a subscriber. When exceeded the oldest message is dropped.
+const maxQueuedMessages = 64
+
+// outbox buffers the messages waiting to be written to one subscriber.
+//
+// Messages with a coalescing key (positions and ETAs) replace any pending
+// message with the same key, so a slow reader only ever receives the newest
+// position of each bus instead of being disconnected. Everything else is
+// queued in order, up to maxQueuedMessages.
+type outbox struct {
+	mu      sync.Mutex
+	latest  map[string]Envelope
+	order   []string
+	queue   []Envelope
+	closed  bool
+	notify  chan struct{}
+	done    chan struct{}
+	metrics *hubCounters
+}
+
+func newOutbox(metrics *hubCounters) *outbox {
+	return &outbox{
+		latest:  make(map[string]Envelope),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		metrics: metrics,
+	}
+}
+
+// push queues a message without blocking. It reports false if the outbox is closed.
+func (o *outbox) push(envelope Envelope) bool {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return false
+	}
+
+	if envelope.key != "" {
+		if _, ok := o.latest[envelope.key]; ok {
+			o.metrics.coalesced.Add(1)
+		} else {
+			o.order = append(o.order, envelope.key)
+		}
+		o.latest[envelope.key] = envelope
+	} else {
+		if len(o.queue) >= maxQueuedMessages {
+			o.queue = o.queue[1:]
+			o.metrics.dropped.Add(1)
+		}
+		o.queue = append(o.queue, envelope)
+	}
+	o.mu.Unlock()
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// drain returns every pending message, control messages first.
+func (o *outbox) drain() []Envelope {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.queue) == 0 && len(o.order) == 0 {
+		return nil
+	}
+
+	messages := make([]Envelope, 0, len(o.queue)+len(o.order))
+	messages = append(messages, o.queue...)
+	for _, key := range o.order {
+		messages = append(messages, o.latest[key])
+	}
+
+	o.queue = nil
+	o.order = nil
+	o.latest = make(map[string]Envelope)
+	return messages
+}
+
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	o.closed = true
+	close(o.done)
+}
@@ -0,0 +1,136 @@
+package location
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the version of the message envelope spoken on the
+// location socket. Clients must send it in the "v" field of every message.
+const ProtocolVersion = 1
+
+// Maximum number of routes a single connection may be subscribed to.
+const maxSubscriptions = 10
+
+type MessageType string
+
+const (
+	// Client -> server
+	TypeSubscribe   MessageType = "subscribe"
+	TypeUnsubscribe MessageType = "unsubscribe"
+
+	// Bus -> server and server -> client
+	TypeLocation MessageType = "location"
+
+	// Server -> client
+	TypeETA   MessageType = "eta"
+	TypeAlert MessageType = "alert"
+	TypeAck   MessageType = "ack"
+	TypeError MessageType = "error"
+)
+
+// Error codes sent in ErrorPayload.Code
+const (
+	ErrBadRequest           = "bad_request"
+	ErrUnsupportedVersion   = "unsupported_version"
+	ErrUnsupportedType      = "unsupported_type"
+	ErrForbidden            = "forbidden"
+	ErrTooManySubscriptions = "too_many_subscriptions"
+)
+
+// Envelope wraps every message exchanged over the location socket.
+//
+//	{"v":1,"type":"subscribe","id":"c1","route_ids":[3,7]}
+//	{"v":1,"type":"location","route_id":3,"data":{"bus_id":12,"latitude":23.8,"longitude":90.4,"speed":8.2}}
+//
+// ID is chosen by the client and echoed back in the matching ack or error.
+type Envelope struct {
+	Version  int             `json:"v"`
+	Type     MessageType     `json:"type"`
+	ID       string          `json:"id,omitempty"`
+	RouteID  int64           `json:"route_id,omitempty"`
+	RouteIDs []int64         `json:"route_ids,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+
+	// Per route sequence number of server messages, used to resume streams
+	Seq uint64 `json:"seq,omitempty"`
+
+	// Coalescing key; pending messages with the same key are replaced by newer ones
+	key string
+}
+
+type ETAUpdate struct {
+	BusID      int64  `json:"bus_id"`
+	RouteID    int64  `json:"route_id"`
+	StopName   string `json:"stop_name"`
+	StopOrder  int    `json:"stop_order"`
+	ETASeconds int64  `json:"eta_seconds"`
+}
+
+type Alert struct {
+	RouteID  int64  `json:"route_id"`
+	Severity string `json:"severity"` // info, warning, critical
+	Message  string `json:"message"`
+}
+
+// Ack confirms a subscribe/unsubscribe and carries the resulting subscriptions.
+type Ack struct {
+	Subscriptions []int64 `json:"subscriptions"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newEnvelope(msgType MessageType, routeID int64, payload any) (Envelope, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		Version: ProtocolVersion,
+		Type:    msgType,
+		RouteID: routeID,
+		Data:    data,
+	}, nil
+}
+
+func errorEnvelope(id, code, message string) Envelope {
+	env, _ := newEnvelope(TypeError, 0, ErrorPayload{Code: code, Message: message})
+	env.ID = id
+	return env
+}
+
+// RouteIDsFromQuery reads the initial subscriptions of a socket from the
+// "route_id" and comma separated "route_ids" query parameters.
+func RouteIDsFromQuery(q url.Values) ([]int64, error) {
+	var raw []string
+	if v := q.Get("route_id"); v != "" {
+		raw = append(raw, v)
+	}
+	if v := q.Get("route_ids"); v != "" {
+		raw = append(raw, strings.Split(v, ",")...)
+	}
+
+	seen := make(map[int64]bool)
+	var routeIDs []int64
+	for _, s := range raw {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid route id %q", s)
+		}
+		if !seen[id] {
+			seen[id] = true
+			routeIDs = append(routeIDs, id)
+		}
+	}
+
+	if len(routeIDs) > maxSubscriptions {
+		return nil, fmt.Errorf("at most %d routes can be subscribed", maxSubscriptions)
+	}
+	return routeIDs, nil
+}
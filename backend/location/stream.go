@@ -0,0 +1,70 @@
+package location
+
+import "time"
+
+// Stream is a subscription to the hub that is not tied to a transport. The
+// websocket client and the SSE handler both read from one.
+type Stream struct {
+	hub *Hub
+	out *outbox
+
+	// Minimum time between two drains
+	sendInterval time.Duration
+	lastDrain    time.Time
+}
+
+// Open registers a new stream subscribed to routeIDs. The caller must Close it.
+func (h *Hub) Open(routeIDs []int64) *Stream {
+	s := &Stream{
+		hub:          h,
+		out:          newOutbox(&h.counters),
+		sendInterval: h.sendInterval,
+	}
+
+	h.mu.Lock()
+	h.clients[s] = make(map[int64]bool)
+	for _, routeID := range routeIDs {
+		h.addRoute(s, routeID)
+	}
+	h.mu.Unlock()
+	return s
+}
+
+// Ready is signalled when messages are waiting to be drained.
+func (s *Stream) Ready() <-chan struct{} {
+	return s.out.notify
+}
+
+// Done is closed once the stream has been removed from the hub.
+func (s *Stream) Done() <-chan struct{} {
+	return s.out.done
+}
+
+// Drain returns the pending messages. It waits until the stream's send
+// interval has passed since the previous drain so that updates arriving in
+// the meantime are coalesced.
+func (s *Stream) Drain() []Envelope {
+	if wait := s.sendInterval - time.Since(s.lastDrain); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-s.out.done:
+			return nil
+		}
+	}
+	s.lastDrain = time.Now()
+	return s.out.drain()
+}
+
+// Delivered records that n drained messages were written to the peer.
+func (s *Stream) Delivered(n int) {
+	s.hub.counters.delivered.Add(uint64(n))
+}
+
+// Close removes the stream from the hub.
+func (s *Stream) Close() {
+	s.hub.unregister <- s
+}
+
+func (s *Stream) push(envelope Envelope) {
+	s.out.push(envelope)
+}
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS bus_location_history (
+    id          BIGSERIAL PRIMARY KEY,
+    bus_id      INT NOT NULL REFERENCES bus_credentials(id) ON DELETE CASCADE,
+    route_id    INT REFERENCES routes(id) ON DELETE SET NULL,
+    geom        geometry(Point, 4326) NOT NULL,
+    speed       REAL NOT NULL DEFAULT 0,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    -- A device resending a buffered point must not create a second row
+    UNIQUE (bus_id, recorded_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bus_location_history_route_time ON bus_location_history(route_id, recorded_at);
@@ -0,0 +1,5 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_tickets_route_updated;
+ALTER TABLE tickets
+    DROP COLUMN IF EXISTS checked_at,
+    DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE tickets
+    ADD COLUMN IF NOT EXISTS checked_at TIMESTAMP NULL,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- Bus manifests fetch the tickets of a route changed since their last sync
+CREATE INDEX IF NOT EXISTS idx_tickets_route_updated ON tickets(route_id, updated_at);
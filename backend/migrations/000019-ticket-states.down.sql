@@ -0,0 +1,3 @@
+-- +migrate Down
+DROP TABLE IF EXISTS ticket_events;
+ALTER TABLE tickets DROP COLUMN IF EXISTS status;
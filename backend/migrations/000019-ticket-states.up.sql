@@ -0,0 +1,24 @@
+-- +migrate Up
+ALTER TABLE tickets
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'pending_payment';
+
+-- Derive the state of existing tickets from the old flags
+UPDATE tickets SET status = CASE
+    WHEN cancelled_at IS NOT NULL AND paid_status AND payment_method = 'wallet' THEN 'refunded'
+    WHEN cancelled_at IS NOT NULL THEN 'cancelled'
+    WHEN checked THEN 'checked'
+    WHEN paid_status THEN 'paid'
+    ELSE 'pending_payment'
+END;
+
+CREATE TABLE IF NOT EXISTS ticket_events (
+    id          BIGSERIAL PRIMARY KEY,
+    ticket_id   INT NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    from_status VARCHAR(20) NOT NULL DEFAULT '', -- Empty for the creation event
+    to_status   VARCHAR(20) NOT NULL,
+    actor       VARCHAR(255) NOT NULL,
+    reason      TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_events_ticket ON ticket_events(ticket_id, id);
@@ -0,0 +1,5 @@
+-- +migrate Down
+ALTER TABLE tickets DROP COLUMN IF EXISTS order_id;
+DROP TABLE IF EXISTS payment_attempts;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
@@ -0,0 +1,81 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    route_id INT NOT NULL,
+    bus_name VARCHAR(255) NOT NULL,
+    start_destination VARCHAR(255) NOT NULL,
+    end_destination VARCHAR(255) NOT NULL,
+    payment_method VARCHAR(50) NOT NULL,
+    total_fare FLOAT NOT NULL,
+    refunded_amount FLOAT NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending_payment',
+    batch_id VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user ON orders(user_id);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    ticket_id INT NOT NULL UNIQUE REFERENCES tickets(id),
+    fare_category VARCHAR(20) NOT NULL DEFAULT 'adult',
+    fare FLOAT NOT NULL,
+    refunded_amount FLOAT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_order ON order_items(order_id);
+
+CREATE TABLE IF NOT EXISTS payment_attempts (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    tran_id VARCHAR(64) NOT NULL UNIQUE,
+    gateway VARCHAR(50) NOT NULL,
+    amount FLOAT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'initiated',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_attempts_order ON payment_attempts(order_id);
+
+ALTER TABLE tickets
+    ADD COLUMN IF NOT EXISTS order_id INT NULL REFERENCES orders(id);
+
+-- Turn each purchased batch into an order. RFID and over-travel tickets are
+-- not purchases and stay without one.
+INSERT INTO orders (user_id, route_id, bus_name, start_destination, end_destination, payment_method, total_fare, refunded_amount, status, batch_id, created_at)
+SELECT MIN(user_id), MIN(route_id), MIN(bus_name), MIN(start_destination), MIN(end_destination), MIN(payment_method),
+       SUM(fare),
+       -- Wallet refunds were 75% of the fare
+       SUM(CASE WHEN status = 'refunded' THEN fare * 0.75 ELSE 0 END),
+       CASE
+           WHEN bool_and(status = 'pending_payment') THEN 'pending_payment'
+           WHEN bool_and(status IN ('cancelled', 'refunded')) AND NOT bool_or(paid_status) THEN 'failed'
+           WHEN bool_and(status IN ('cancelled', 'refunded')) THEN 'cancelled'
+           WHEN bool_or(status IN ('cancelled', 'refunded')) THEN 'partially_cancelled'
+           ELSE 'paid'
+       END,
+       batch_id, MIN(created_at)
+FROM tickets
+WHERE batch_id <> '' AND payment_method NOT IN ('RFID', 'CASH')
+GROUP BY batch_id;
+
+UPDATE tickets t SET order_id = o.id FROM orders o WHERE o.batch_id = t.batch_id AND t.batch_id <> '';
+
+INSERT INTO order_items (order_id, ticket_id, fare, refunded_amount)
+SELECT order_id, id, fare, CASE WHEN status = 'refunded' THEN fare * 0.75 ELSE 0 END
+FROM tickets
+WHERE order_id IS NOT NULL;
+
+-- Gateway payments in flight were identified as TICKET-<first ticket id>-<batch prefix>
+INSERT INTO payment_attempts (order_id, tran_id, gateway, amount, status, created_at)
+SELECT o.id, 'TICKET-' || MIN(t.id) || '-' || LEFT(o.batch_id, 8), 'sslcommerz', o.total_fare,
+       CASE o.status WHEN 'pending_payment' THEN 'initiated' WHEN 'failed' THEN 'failed' ELSE 'paid' END,
+       o.created_at
+FROM orders o
+JOIN tickets t ON t.order_id = o.id
+WHERE o.payment_method <> 'wallet'
+GROUP BY o.id;
@@ -0,0 +1,6 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_tickets_status_valid_until;
+ALTER TABLE tickets
+    DROP COLUMN IF EXISTS valid_until,
+    DROP COLUMN IF EXISTS valid_from,
+    DROP COLUMN IF EXISTS ticket_type;
@@ -0,0 +1,14 @@
+-- +migrate Up
+ALTER TABLE tickets
+    ADD COLUMN IF NOT EXISTS ticket_type VARCHAR(20) NOT NULL DEFAULT 'single',
+    ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS valid_until TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP + INTERVAL '4 hours';
+
+-- Existing tickets were valid for 4 hours from purchase
+UPDATE tickets SET
+    ticket_type = CASE payment_method WHEN 'RFID' THEN 'rfid' WHEN 'CASH' THEN 'over_travel' ELSE 'single' END,
+    valid_from = created_at,
+    valid_until = created_at + INTERVAL '4 hours';
+
+-- Expired tickets are found by the expiry job
+CREATE INDEX IF NOT EXISTS idx_tickets_status_valid_until ON tickets(status, valid_until);
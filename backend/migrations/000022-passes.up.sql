@@ -0,0 +1,42 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS pass_products (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    duration_days INT NOT NULL,
+    price FLOAT NOT NULL,
+    -- A pass covers rides on any of these routes or on buses of any of these owners
+    route_ids INT[] NOT NULL DEFAULT '{}',
+    owner_ids INT[] NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS passes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    product_id INT NOT NULL REFERENCES pass_products(id),
+    price FLOAT NOT NULL,
+    qr_code VARCHAR(64) NOT NULL UNIQUE,
+    payment_method VARCHAR(50) NOT NULL,
+    tran_id VARCHAR(64) UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending_payment',
+    valid_from TIMESTAMP WITH TIME ZONE,
+    valid_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_passes_user ON passes(user_id, status);
+
+CREATE TABLE IF NOT EXISTS pass_rides (
+    id BIGSERIAL PRIMARY KEY,
+    pass_id INT NOT NULL REFERENCES passes(id),
+    user_id INT NOT NULL,
+    route_id INT NOT NULL,
+    registration_number VARCHAR(255) NOT NULL,
+    owner_id INT NULL REFERENCES bus_owners(id),
+    source VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pass_rides_pass ON pass_rides(pass_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_pass_rides_created ON pass_rides(created_at);
@@ -0,0 +1,5 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_tickets_user_type_valid_from;
+ALTER TABLE tickets
+    DROP COLUMN IF EXISTS fare_cap,
+    DROP COLUMN IF EXISTS full_fare;
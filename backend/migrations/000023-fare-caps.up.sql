@@ -0,0 +1,9 @@
+-- +migrate Up
+-- Fare caps applied to RFID trips: fare is what was charged, full_fare what
+-- the trip would have cost, and fare_cap the cap (daily or weekly) that cut it
+ALTER TABLE tickets
+    ADD COLUMN IF NOT EXISTS full_fare FLOAT NULL,
+    ADD COLUMN IF NOT EXISTS fare_cap VARCHAR(10) NULL;
+
+-- A rider's spend in the current cap periods is summed on every tap
+CREATE INDEX IF NOT EXISTS idx_tickets_user_type_valid_from ON tickets(user_id, ticket_type, valid_from);
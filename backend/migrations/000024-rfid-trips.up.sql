@@ -0,0 +1,22 @@
+-- +migrate Up
+-- An RFID trip starts with a tap-on, which reserves the fare to the end of
+-- the route, and is settled at tap-off with the fare actually travelled
+CREATE TABLE IF NOT EXISTS rfid_trips (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    ticket_id INT NOT NULL REFERENCES tickets(id),
+    route_id INT NOT NULL,
+    bus_name VARCHAR(255) NOT NULL,
+    boarding_stop TEXT NOT NULL,
+    alighting_stop TEXT NULL,
+    reserved_fare FLOAT NOT NULL,
+    fare FLOAT NULL,
+    -- open, completed, or unresolved when there was no tap-off
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    tapped_on_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    tapped_off_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+-- A rider has at most one open trip
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rfid_trips_open_user ON rfid_trips(user_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_rfid_trips_status ON rfid_trips(status, tapped_on_at);
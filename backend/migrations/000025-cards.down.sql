@@ -0,0 +1,5 @@
+-- +migrate Down
+-- users.rfid keeps its wider type, as UIDs stored since may not fit the old one
+DROP TABLE IF EXISTS card_hotlist_version;
+DROP TABLE IF EXISTS card_events;
+DROP TABLE IF EXISTS cards;
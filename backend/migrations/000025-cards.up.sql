@@ -0,0 +1,57 @@
+-- +migrate Up
+-- RFID cards, from stock in inventory until retired. users.rfid and
+-- users.is_rfid_active mirror the user's current card (issued, active or
+-- blocked) so taps keep resolving riders by card UID.
+CREATE TABLE IF NOT EXISTS cards (
+    id SERIAL PRIMARY KEY,
+    uid VARCHAR(32) NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'inventory',
+    user_id INT NULL REFERENCES users(id),
+    batch VARCHAR(64) NULL,
+    replaced_by INT NULL REFERENCES cards(id),
+    issued_at TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A user holds at most one current card
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cards_current_user ON cards(user_id) WHERE status IN ('issued', 'active', 'blocked');
+CREATE INDEX IF NOT EXISTS idx_cards_status ON cards(status, id);
+
+CREATE TABLE IF NOT EXISTS card_events (
+    id          BIGSERIAL PRIMARY KEY,
+    card_id     INT NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+    from_status VARCHAR(20) NOT NULL DEFAULT '', -- Empty for the creation event
+    to_status   VARCHAR(20) NOT NULL,
+    actor       VARCHAR(255) NOT NULL,
+    reason      TEXT NOT NULL DEFAULT '',
+    version     BIGINT NOT NULL, -- Hotlist version readers sync from
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_card_events_card ON card_events(card_id, id);
+CREATE INDEX IF NOT EXISTS idx_card_events_version ON card_events(version);
+
+-- Hotlist versions come from a single counter row. The card change that takes
+-- a version keeps the row locked until it commits, so versions become visible
+-- in order and a reader syncing from a version cannot miss an earlier change.
+CREATE TABLE IF NOT EXISTS card_hotlist_version (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    version BIGINT NOT NULL
+);
+
+ALTER TABLE users ALTER COLUMN rfid TYPE VARCHAR(32);
+
+-- Cards already bound to users
+INSERT INTO cards (uid, status, user_id, issued_at)
+SELECT rfid, CASE WHEN COALESCE(is_rfid_active, TRUE) THEN 'active' ELSE 'blocked' END, id, CURRENT_TIMESTAMP
+FROM users
+WHERE rfid IS NOT NULL
+ON CONFLICT (uid) DO NOTHING;
+
+INSERT INTO card_events (card_id, to_status, actor, reason, version)
+SELECT id, status, 'system', 'migrated from users.rfid', ROW_NUMBER() OVER (ORDER BY id) FROM cards;
+
+INSERT INTO card_hotlist_version (version)
+SELECT COALESCE(MAX(version), 0) FROM card_events
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,4 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_tickets_batch_id;
+
+ALTER TABLE cards DROP COLUMN IF EXISTS companions;
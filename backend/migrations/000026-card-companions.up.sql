@@ -0,0 +1,6 @@
+-- +migrate Up
+-- How many companions a tap with the card pays for when the reader does not
+-- say how many passengers are boarding
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS companions INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_tickets_batch_id ON tickets(batch_id);
@@ -0,0 +1,6 @@
+-- +migrate Down
+DROP TABLE IF EXISTS ledger_drifts;
+DROP TABLE IF EXISTS ledger_reconciliations;
+DROP TABLE IF EXISTS ledger_postings;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_accounts;
@@ -0,0 +1,78 @@
+-- +migrate Up
+-- Double-entry wallet ledger. Every change to a wallet is an entry with
+-- postings that sum to zero: the wallet's leg and the system account on the
+-- other side. users.balance caches the sum of a wallet's postings and is
+-- reconciled against it nightly.
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id         BIGSERIAL PRIMARY KEY,
+    code       VARCHAR(64) NOT NULL UNIQUE, -- wallet:<user id> or a system account
+    kind       VARCHAR(20) NOT NULL,        -- wallet or system
+    user_id    INT NULL UNIQUE REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id          BIGSERIAL PRIMARY KEY,
+    kind        VARCHAR(32) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    reference   VARCHAR(128) NOT NULL DEFAULT '', -- What the entry pays for, e.g. batch:<id> or a gateway tran_id
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS ledger_postings (
+    id         BIGSERIAL PRIMARY KEY,
+    entry_id   BIGINT NOT NULL REFERENCES ledger_entries(id) ON DELETE CASCADE,
+    account_id BIGINT NOT NULL REFERENCES ledger_accounts(id),
+    amount     NUMERIC(14, 2) NOT NULL -- Positive into the account, negative out of it
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_account ON ledger_postings(account_id, entry_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_entry ON ledger_postings(entry_id);
+
+CREATE TABLE IF NOT EXISTS ledger_reconciliations (
+    id                 BIGSERIAL PRIMARY KEY,
+    started_at         TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+    wallets_checked    INT NOT NULL DEFAULT 0,
+    drifted_wallets    INT NOT NULL DEFAULT 0,
+    unbalanced_entries INT NOT NULL DEFAULT 0
+);
+
+-- Wallets whose cached balance did not match their postings in a run
+CREATE TABLE IF NOT EXISTS ledger_drifts (
+    id                BIGSERIAL PRIMARY KEY,
+    reconciliation_id BIGINT NOT NULL REFERENCES ledger_reconciliations(id) ON DELETE CASCADE,
+    user_id           INT NOT NULL,
+    balance           NUMERIC(14, 2) NOT NULL,
+    ledger_balance    NUMERIC(14, 2) NOT NULL,
+    drift             NUMERIC(14, 2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_drifts_reconciliation ON ledger_drifts(reconciliation_id);
+
+INSERT INTO ledger_accounts (code, kind) VALUES
+    ('gateway', 'system'),
+    ('fares', 'system'),
+    ('passes', 'system'),
+    ('adjustments', 'system')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO ledger_accounts (code, kind, user_id)
+SELECT 'wallet:' || id, 'wallet', id FROM users
+ON CONFLICT (code) DO NOTHING;
+
+-- Existing balances open the ledger
+WITH opening AS (
+    INSERT INTO ledger_entries (kind, description, reference)
+    SELECT 'opening', 'Opening balance', 'user:' || id FROM users WHERE ROUND(COALESCE(balance, 0)::numeric, 2) <> 0
+    RETURNING id, reference
+)
+INSERT INTO ledger_postings (entry_id, account_id, amount)
+SELECT o.id, a.id, ROUND(u.balance::numeric, 2)
+FROM opening o
+JOIN users u ON 'user:' || u.id = o.reference
+JOIN ledger_accounts a ON a.user_id = u.id
+UNION ALL
+SELECT o.id, (SELECT id FROM ledger_accounts WHERE code = 'adjustments'), -ROUND(u.balance::numeric, 2)
+FROM opening o
+JOIN users u ON 'user:' || u.id = o.reference;
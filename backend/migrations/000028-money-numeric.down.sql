@@ -0,0 +1,26 @@
+-- +migrate Down
+ALTER TABLE rfid_trips
+    ALTER COLUMN fare TYPE FLOAT,
+    ALTER COLUMN reserved_fare TYPE FLOAT;
+
+ALTER TABLE passes ALTER COLUMN price TYPE FLOAT;
+
+ALTER TABLE pass_products ALTER COLUMN price TYPE FLOAT;
+
+ALTER TABLE payment_attempts ALTER COLUMN amount TYPE FLOAT;
+
+ALTER TABLE order_items
+    ALTER COLUMN refunded_amount TYPE FLOAT,
+    ALTER COLUMN fare TYPE FLOAT;
+
+ALTER TABLE orders
+    ALTER COLUMN refunded_amount TYPE FLOAT,
+    ALTER COLUMN total_fare TYPE FLOAT;
+
+ALTER TABLE transactions ALTER COLUMN amount TYPE FLOAT;
+
+ALTER TABLE tickets
+    ALTER COLUMN full_fare TYPE FLOAT,
+    ALTER COLUMN fare TYPE FLOAT;
+
+ALTER TABLE users ALTER COLUMN balance TYPE REAL;
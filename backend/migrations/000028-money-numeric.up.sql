@@ -0,0 +1,33 @@
+-- +migrate Up
+-- Money columns hold exact amounts with two decimals (poisha) instead of
+-- binary floats, matching domain.Money and the ledger tables
+ALTER TABLE users
+    ALTER COLUMN balance TYPE NUMERIC(14, 2) USING ROUND(balance::numeric, 2);
+
+ALTER TABLE tickets
+    ALTER COLUMN fare TYPE NUMERIC(14, 2) USING ROUND(fare::numeric, 2),
+    ALTER COLUMN full_fare TYPE NUMERIC(14, 2) USING ROUND(full_fare::numeric, 2);
+
+ALTER TABLE transactions
+    ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount::numeric, 2);
+
+ALTER TABLE orders
+    ALTER COLUMN total_fare TYPE NUMERIC(14, 2) USING ROUND(total_fare::numeric, 2),
+    ALTER COLUMN refunded_amount TYPE NUMERIC(14, 2) USING ROUND(refunded_amount::numeric, 2);
+
+ALTER TABLE order_items
+    ALTER COLUMN fare TYPE NUMERIC(14, 2) USING ROUND(fare::numeric, 2),
+    ALTER COLUMN refunded_amount TYPE NUMERIC(14, 2) USING ROUND(refunded_amount::numeric, 2);
+
+ALTER TABLE payment_attempts
+    ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount::numeric, 2);
+
+ALTER TABLE pass_products
+    ALTER COLUMN price TYPE NUMERIC(14, 2) USING ROUND(price::numeric, 2);
+
+ALTER TABLE passes
+    ALTER COLUMN price TYPE NUMERIC(14, 2) USING ROUND(price::numeric, 2);
+
+ALTER TABLE rfid_trips
+    ALTER COLUMN reserved_fare TYPE NUMERIC(14, 2) USING ROUND(reserved_fare::numeric, 2),
+    ALTER COLUMN fare TYPE NUMERIC(14, 2) USING ROUND(fare::numeric, 2);
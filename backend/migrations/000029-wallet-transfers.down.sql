@@ -0,0 +1,5 @@
+-- +migrate Down
+ALTER TABLE rfid_trips DROP COLUMN IF EXISTS paid_by;
+
+DROP TABLE IF EXISTS family_members;
+DROP TABLE IF EXISTS wallet_transfers;
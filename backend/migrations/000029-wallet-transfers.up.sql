@@ -0,0 +1,37 @@
+-- +migrate Up
+-- Money a user sent from their wallet to another user's, after confirming
+-- the transfer with an OTP
+CREATE TABLE IF NOT EXISTS wallet_transfers (
+    id           BIGSERIAL PRIMARY KEY,
+    sender_id    INT NOT NULL REFERENCES users(id),
+    recipient_id INT NOT NULL REFERENCES users(id),
+    amount       NUMERIC(14, 2) NOT NULL CHECK (amount > 0),
+    note         TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Daily limits sum what a sender sent today
+CREATE INDEX IF NOT EXISTS idx_wallet_transfers_sender ON wallet_transfers(sender_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_wallet_transfers_recipient ON wallet_transfers(recipient_id, created_at);
+
+-- Family groups: a guardian funds and sees the wallet and trips of their
+-- dependents, and may let a dependent's RFID taps draw from their own wallet
+CREATE TABLE IF NOT EXISTS family_members (
+    id            BIGSERIAL PRIMARY KEY,
+    guardian_id   INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    dependent_id  INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- invited until the dependent accepts, then active
+    status        VARCHAR(20) NOT NULL DEFAULT 'invited',
+    shared_wallet BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at    TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    accepted_at   TIMESTAMP WITH TIME ZONE NULL,
+    UNIQUE (guardian_id, dependent_id),
+    CHECK (guardian_id <> dependent_id)
+);
+
+-- A dependent has at most one guardian
+CREATE UNIQUE INDEX IF NOT EXISTS idx_family_members_active_dependent ON family_members(dependent_id) WHERE status = 'active';
+
+-- Wallet the reserved fare of a trip was taken from when it was not the
+-- rider's, so the tap-off refund goes back to it
+ALTER TABLE rfid_trips ADD COLUMN IF NOT EXISTS paid_by INT NULL REFERENCES users(id);
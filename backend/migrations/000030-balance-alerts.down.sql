@@ -0,0 +1,2 @@
+-- +migrate Down
+DROP TABLE IF EXISTS balance_alerts;
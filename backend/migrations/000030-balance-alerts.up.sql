@@ -0,0 +1,17 @@
+-- +migrate Up
+-- A user's low-balance alert: once their wallet balance falls below
+-- threshold they are emailed, and with an auto top-up amount a gateway
+-- recharge of that amount is started for them. The alert fires once per
+-- drop: triggered_at is set when it fires and cleared when the balance is
+-- back at or above the threshold.
+CREATE TABLE IF NOT EXISTS balance_alerts (
+    user_id           INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    threshold         NUMERIC(14, 2) NOT NULL CHECK (threshold > 0),
+    auto_topup_amount NUMERIC(14, 2) NULL CHECK (auto_topup_amount > 0),
+    triggered_at      TIMESTAMP WITH TIME ZONE NULL,
+    -- Recharge started by the last auto top-up
+    topup_tran_id     VARCHAR(100) NULL,
+    updated_at        TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_balance_alerts_pending ON balance_alerts(user_id) WHERE triggered_at IS NULL;
@@ -0,0 +1,7 @@
+-- +migrate Down
+DROP TABLE IF EXISTS recharges;
+DROP TABLE IF EXISTS recharge_campaigns;
+DROP TABLE IF EXISTS recharge_products;
+
+DELETE FROM ledger_accounts a
+WHERE a.code = 'promotions' AND NOT EXISTS (SELECT 1 FROM ledger_postings p WHERE p.account_id = a.id);
@@ -0,0 +1,49 @@
+-- +migrate Up
+-- Amounts a wallet can be recharged by, managed by admins
+CREATE TABLE IF NOT EXISTS recharge_products (
+    id         SERIAL PRIMARY KEY,
+    amount     NUMERIC(14, 2) NOT NULL UNIQUE CHECK (amount > 0),
+    active     BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO recharge_products (amount) VALUES (50), (100), (200), (300), (400), (500)
+ON CONFLICT (amount) DO NOTHING;
+
+-- Bonus campaigns, e.g. "recharge 500, get 25 free": a recharge of at least
+-- min_amount started between starts_at and ends_at earns bonus, at most
+-- per_user_limit times per user and until bonus_given reaches budget
+CREATE TABLE IF NOT EXISTS recharge_campaigns (
+    id             SERIAL PRIMARY KEY,
+    name           VARCHAR(255) NOT NULL,
+    min_amount     NUMERIC(14, 2) NOT NULL CHECK (min_amount > 0),
+    bonus          NUMERIC(14, 2) NOT NULL CHECK (bonus > 0),
+    starts_at      TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+    per_user_limit INT NULL CHECK (per_user_limit > 0),
+    budget         NUMERIC(14, 2) NULL CHECK (budget > 0),
+    bonus_given    NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    active         BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at)
+);
+
+-- Completed gateway recharges. A tran_id is credited once, however many
+-- times the gateway calls back.
+CREATE TABLE IF NOT EXISTS recharges (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     INT NOT NULL REFERENCES users(id),
+    tran_id     VARCHAR(64) NOT NULL UNIQUE,
+    amount      NUMERIC(14, 2) NOT NULL,
+    bonus       NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    campaign_id INT NULL REFERENCES recharge_campaigns(id),
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Daily limits sum what a user recharged today
+CREATE INDEX IF NOT EXISTS idx_recharges_user ON recharges(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_recharges_campaign ON recharges(campaign_id, user_id) WHERE campaign_id IS NOT NULL;
+
+-- Bonus credits are paid out of this account
+INSERT INTO ledger_accounts (code, kind) VALUES ('promotions', 'system')
+ON CONFLICT (code) DO NOTHING;
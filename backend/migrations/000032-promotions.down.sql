@@ -0,0 +1,6 @@
+-- +migrate Down
+ALTER TABLE order_items DROP COLUMN IF EXISTS discount;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount;
+
+DROP TABLE IF EXISTS promo_redemptions;
+DROP TABLE IF EXISTS promo_codes;
@@ -0,0 +1,45 @@
+-- +migrate Up
+-- Promo codes passengers can apply when buying tickets: percent off the
+-- order (up to max_discount), a fixed amount off, or a first_ride code that
+-- makes one ticket of a user's first purchase free. Discounts are taken
+-- from the fare, so they are not owner revenue, and are charged against
+-- budget when one is set.
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id             SERIAL PRIMARY KEY,
+    code           VARCHAR(40) NOT NULL UNIQUE, -- Upper case
+    description    TEXT NOT NULL DEFAULT '',
+    kind           VARCHAR(20) NOT NULL,
+    percent        INT NULL CHECK (percent BETWEEN 1 AND 100),
+    amount         NUMERIC(14, 2) NULL CHECK (amount > 0),
+    max_discount   NUMERIC(14, 2) NULL CHECK (max_discount > 0),
+    -- Routes the code is valid on; empty for every route
+    route_ids      INT[] NOT NULL DEFAULT '{}',
+    per_user_limit INT NULL CHECK (per_user_limit > 0),
+    usage_limit    INT NULL CHECK (usage_limit > 0),
+    times_used     INT NOT NULL DEFAULT 0,
+    budget         NUMERIC(14, 2) NULL CHECK (budget > 0),
+    discount_given NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    starts_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at     TIMESTAMP WITH TIME ZONE NULL,
+    active         BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One per order that used a code. A redemption is released, and stops
+-- counting towards limits and the budget, when the order's payment fails.
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id          BIGSERIAL PRIMARY KEY,
+    promo_id    INT NOT NULL REFERENCES promo_codes(id),
+    order_id    INT NOT NULL UNIQUE REFERENCES orders(id),
+    user_id     INT NOT NULL REFERENCES users(id),
+    discount    NUMERIC(14, 2) NOT NULL,
+    status      VARCHAR(20) NOT NULL DEFAULT 'applied', -- applied or released
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_promo_redemptions_user ON promo_redemptions(promo_id, user_id) WHERE status = 'applied';
+
+-- Discount taken off the order and each of its items; fares are what was paid
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount NUMERIC(14, 2) NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS discount NUMERIC(14, 2) NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+-- +migrate Up
+-- The most a user may recharge per day. The row without a user is the
+-- default; a row for a user overrides it.
+CREATE TABLE IF NOT EXISTS recharge_limits (
+    id          SERIAL PRIMARY KEY,
+    user_id     INT NULL REFERENCES users(id) ON DELETE CASCADE,
+    daily_limit NUMERIC(14, 2) NOT NULL CHECK (daily_limit > 0),
+    updated_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recharge_limits_user ON recharge_limits((COALESCE(user_id, 0)));
+
+INSERT INTO recharge_limits (user_id, daily_limit) VALUES (NULL, 5000)
+ON CONFLICT ((COALESCE(user_id, 0))) DO NOTHING;
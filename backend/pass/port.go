@@ -0,0 +1,75 @@
+package pass
+
+import (
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/model"
+)
+
+type BuyRequest struct {
+	UserId        int64  `json:"-"` // Extracted from JWT
+	ProductId     int64  `json:"product_id"`
+	PaymentMethod string `json:"payment_method"` // "wallet" or "gateway"
+}
+
+type BuyResponse struct {
+	Pass       *domain.Pass `json:"pass"`
+	PaymentURL string       `json:"payment_url,omitempty"`
+	Message    string       `json:"message"`
+}
+
+// RideRequest asks to ride on a pass. A QR scan names the pass; an RFID tap
+// names the passenger, whose passes are searched for one covering the ride.
+type RideRequest struct {
+	QRCode             string
+	UserId             int64
+	RouteId            int64
+	RegistrationNumber string
+	Source             string
+}
+
+type RideResult struct {
+	Status RideStatus
+	Pass   *domain.Pass
+}
+
+type Service interface {
+	ListProducts() ([]domain.PassProduct, error)
+	ListAllProducts() ([]domain.PassProduct, error)
+	CreateProduct(p domain.PassProduct) (*domain.PassProduct, error)
+	Buy(req BuyRequest) (*BuyResponse, error)
+	CompletePayment(tranID, valID string) (*domain.Pass, error)
+	CancelPayment(tranID string) error
+	GetByUser(userID int64) ([]domain.Pass, error)
+	Ride(req RideRequest) (*RideResult, error)
+	Apportionment(from, to time.Time) ([]domain.PassApportionment, error)
+}
+
+type Repo interface {
+	ListProducts(activeOnly bool) ([]domain.PassProduct, error)
+	GetProduct(id int64) (*domain.PassProduct, error)
+	CreateProduct(p domain.PassProduct) (*domain.PassProduct, error)
+	Create(p domain.Pass) (*domain.Pass, error)
+	GetByQRCode(qrCode string) (*domain.Pass, error)
+	GetByTranID(tranID string) (*domain.Pass, error)
+	GetByUser(userID int64) ([]domain.Pass, error)
+	Cancel(id int64) (bool, error)
+	GetBusOwner(registrationNumber string) (*int64, error)
+	RecordRide(ride domain.PassRide, since time.Time) (*domain.PassRide, error)
+	Apportionment(from, to time.Time) ([]domain.PassApportionment, error)
+}
+
+// UnitOfWork runs fn in one database transaction: a payment, the pass it pays
+// for and its statement entry commit together, or not at all.
+type UnitOfWork interface {
+	Do(fn func(tx Tx) error) error
+}
+
+// Tx holds the writes that must commit together with a pass purchase.
+type Tx interface {
+	DeductBalance(userID int64, amount domain.Money, posting domain.WalletPosting) error
+	CreatePass(p *domain.Pass) error
+	ActivatePass(id int64, from, until time.Time) (bool, error)
+	CreateTransaction(t model.Transaction) error
+}
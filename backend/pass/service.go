@@ -0,0 +1,342 @@
+package pass
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/infra/payment"
+	"swift_transit/ledger"
+	"swift_transit/model"
+
+	"github.com/google/uuid"
+)
+
+// Pass states
+const (
+	StatusPendingPayment = "pending_payment"
+	StatusActive         = "active"
+	StatusCancelled      = "cancelled"
+)
+
+// Prefix of pass QR codes, which tells them apart from tickets
+const qrPrefix = "PASS-"
+
+// A pass scanned again on the same bus within this window is the same ride.
+// A QR scan on another bus within it is refused, so a copied code cannot be
+// used on two buses at once.
+const repeatScanWindow = 5 * time.Minute
+
+// Where a ride was validated
+const (
+	SourceQR   = "qr"
+	SourceRFID = "rfid"
+)
+
+// RideStatus is the outcome of riding on a pass.
+type RideStatus string
+
+const (
+	RideValid       RideStatus = "valid"
+	RideRepeat      RideStatus = "repeat" // Already recorded for this bus moments ago
+	RideInUse       RideStatus = "in_use" // Scanned on another bus moments ago
+	RideNotFound    RideStatus = "not_found"
+	RideUnpaid      RideStatus = "unpaid"
+	RideCancelled   RideStatus = "cancelled"
+	RideNotValidNow RideStatus = "not_valid_now" // Before or after the validity window
+	RideOutOfScope  RideStatus = "out_of_scope"  // Not valid on this route or bus
+)
+
+// IsPassQR reports whether a scanned QR holds a pass rather than a ticket.
+func IsPassQR(qr string) bool {
+	return strings.HasPrefix(qr, qrPrefix)
+}
+
+type service struct {
+	repo          Repo
+	uow           UnitOfWork
+	sslCommerz    *payment.SSLCommerz
+	publicBaseURL string
+}
+
+func NewService(repo Repo, uow UnitOfWork, sslCommerz *payment.SSLCommerz, publicBaseURL string) Service {
+	return &service{
+		repo:          repo,
+		uow:           uow,
+		sslCommerz:    sslCommerz,
+		publicBaseURL: strings.TrimRight(publicBaseURL, "/"),
+	}
+}
+
+func (s *service) ListProducts() ([]domain.PassProduct, error) {
+	return s.repo.ListProducts(true)
+}
+
+func (s *service) ListAllProducts() ([]domain.PassProduct, error) {
+	return s.repo.ListProducts(false)
+}
+
+func (s *service) CreateProduct(p domain.PassProduct) (*domain.PassProduct, error) {
+	if p.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if p.DurationDays < 1 {
+		return nil, fmt.Errorf("duration_days must be at least 1")
+	}
+	if p.Price <= 0 {
+		return nil, fmt.Errorf("price must be positive")
+	}
+	if len(p.RouteIds) == 0 && len(p.OwnerIds) == 0 {
+		return nil, fmt.Errorf("a pass must cover at least one route or owner")
+	}
+	p.Active = true
+	return s.repo.CreateProduct(p)
+}
+
+// Buy sells a pass. Wallet purchases are active at once; gateway purchases
+// once the payment completes.
+func (s *service) Buy(req BuyRequest) (*BuyResponse, error) {
+	product, err := s.repo.GetProduct(req.ProductId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !product.Active) {
+		return nil, fmt.Errorf("pass not available")
+	} else if err != nil {
+		return nil, err
+	}
+
+	p := domain.Pass{
+		UserId:        req.UserId,
+		ProductId:     product.Id,
+		Price:         product.Price,
+		QRCode:        qrPrefix + uuid.New().String(),
+		PaymentMethod: req.PaymentMethod,
+		Status:        StatusPendingPayment,
+	}
+
+	if req.PaymentMethod == "wallet" {
+		from := time.Now()
+		until := from.AddDate(0, 0, product.DurationDays)
+		p.Status = StatusActive
+		p.ValidFrom, p.ValidUntil = &from, &until
+
+		err := s.uow.Do(func(tx Tx) error {
+			err := tx.DeductBalance(req.UserId, product.Price, domain.WalletPosting{
+				Account:     ledger.AccountPasses,
+				Kind:        ledger.KindPass,
+				Description: fmt.Sprintf("Pass Purchase - %s", product.Name),
+				Reference:   p.QRCode,
+			})
+			if errors.Is(err, domain.ErrInsufficientBalance) {
+				return err
+			} else if err != nil {
+				return fmt.Errorf("failed to deduct balance: %w", err)
+			}
+			if err := tx.CreatePass(&p); err != nil {
+				return err
+			}
+			return tx.CreateTransaction(purchaseTransaction(&p, product, "Swift Balance"))
+		})
+		if err != nil {
+			return nil, err
+		}
+		p.Product = product
+		return &BuyResponse{Pass: &p, Message: "Pass active"}, nil
+	}
+
+	tranID := fmt.Sprintf("PASS-%d-%s", req.UserId, uuid.NewString()[:8])
+	p.TranID = &tranID
+	created, err := s.repo.Create(p)
+	if err != nil {
+		return nil, err
+	}
+
+	successURL := fmt.Sprintf("%s/passes/payment/success?tran_id=%s", s.publicBaseURL, tranID)
+	failURL := fmt.Sprintf("%s/passes/payment/fail?tran_id=%s", s.publicBaseURL, tranID)
+	cancelURL := fmt.Sprintf("%s/passes/payment/cancel?tran_id=%s", s.publicBaseURL, tranID)
+	gatewayURL, err := s.sslCommerz.InitPayment(product.Price, tranID, successURL, failURL, cancelURL)
+	if err != nil {
+		s.repo.Cancel(created.Id)
+		return nil, fmt.Errorf("gateway init failed: %w", err)
+	}
+
+	created.Product = product
+	return &BuyResponse{Pass: created, PaymentURL: gatewayURL, Message: "Ready"}, nil
+}
+
+// CompletePayment validates a gateway payment and activates its pass.
+func (s *service) CompletePayment(tranID, valID string) (*domain.Pass, error) {
+	p, err := s.repo.GetByTranID(tranID)
+	if err != nil {
+		return nil, fmt.Errorf("payment not found")
+	}
+	if p.Status == StatusActive {
+		return p, nil
+	}
+
+	resp, err := s.sslCommerz.ValidateTransaction(valID)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	if resp.Status != "VALID" && resp.Status != "VALIDATED" {
+		return nil, fmt.Errorf("invalid transaction status: %s", resp.Status)
+	}
+	if resp.TranID != "" && resp.TranID != tranID {
+		return nil, fmt.Errorf("transaction mismatch")
+	}
+	amount, err := resp.PaidAmount()
+	if err != nil {
+		return nil, err
+	}
+	if amount != p.Price {
+		return nil, fmt.Errorf("amount mismatch: expected %s, got %s", p.Price, amount)
+	}
+
+	product, err := s.repo.GetProduct(p.ProductId)
+	if err != nil {
+		return nil, err
+	}
+	from := time.Now()
+	until := from.AddDate(0, 0, product.DurationDays)
+	err = s.uow.Do(func(tx Tx) error {
+		activated, err := tx.ActivatePass(p.Id, from, until)
+		if err != nil {
+			return err
+		}
+		if !activated {
+			return fmt.Errorf("payment link already used")
+		}
+		return tx.CreateTransaction(purchaseTransaction(p, product, "Online"))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.Status = StatusActive
+	p.ValidFrom, p.ValidUntil = &from, &until
+	p.Product = product
+	return p, nil
+}
+
+// CancelPayment cancels a pass whose payment failed or was abandoned at the
+// gateway. The fail and cancel links carry no proof, so a payment validated
+// later still activates the pass.
+func (s *service) CancelPayment(tranID string) error {
+	p, err := s.repo.GetByTranID(tranID)
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.Cancel(p.Id)
+	return err
+}
+
+// GetByUser returns the passes of a user, newest first.
+func (s *service) GetByUser(userID int64) ([]domain.Pass, error) {
+	return s.repo.GetByUser(userID)
+}
+
+// Ride validates a ride on a pass and records it. Rides are free to the
+// passenger; they are recorded to apportion pass revenue to bus owners.
+func (s *service) Ride(req RideRequest) (*RideResult, error) {
+	ownerID, err := s.repo.GetBusOwner(req.RegistrationNumber)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	now := time.Now()
+	var p *domain.Pass
+	if req.QRCode != "" {
+		p, err = s.repo.GetByQRCode(req.QRCode)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &RideResult{Status: RideNotFound}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if status := rideStatus(p, req.RouteId, ownerID, now); status != RideValid {
+			return &RideResult{Status: status, Pass: p}, nil
+		}
+	} else {
+		passes, err := s.repo.GetByUser(req.UserId)
+		if err != nil {
+			return nil, err
+		}
+		for i := range passes {
+			if rideStatus(&passes[i], req.RouteId, ownerID, now) == RideValid {
+				p = &passes[i]
+				break
+			}
+		}
+		if p == nil {
+			return &RideResult{Status: RideNotFound}, nil
+		}
+	}
+
+	recent, err := s.repo.RecordRide(domain.PassRide{
+		PassId:             p.Id,
+		UserId:             p.UserId,
+		RouteId:            req.RouteId,
+		RegistrationNumber: req.RegistrationNumber,
+		OwnerId:            ownerID,
+		Source:             req.Source,
+	}, now.Add(-repeatScanWindow))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case recent == nil:
+		return &RideResult{Status: RideValid, Pass: p}, nil
+	case recent.RegistrationNumber == req.RegistrationNumber:
+		return &RideResult{Status: RideRepeat, Pass: p}, nil
+	default:
+		return &RideResult{Status: RideInUse, Pass: p}, nil
+	}
+}
+
+// Apportionment splits pass revenue between bus owners by the rides taken
+// on their buses between from and to.
+func (s *service) Apportionment(from, to time.Time) ([]domain.PassApportionment, error) {
+	return s.repo.Apportionment(from, to)
+}
+
+// rideStatus reports whether p can be used at now on a route and a bus of
+// ownerID. p must have its product loaded.
+func rideStatus(p *domain.Pass, routeID int64, ownerID *int64, now time.Time) RideStatus {
+	switch p.Status {
+	case StatusPendingPayment:
+		return RideUnpaid
+	case StatusCancelled:
+		return RideCancelled
+	}
+	if p.ValidFrom == nil || p.ValidUntil == nil || now.Before(*p.ValidFrom) || !now.Before(*p.ValidUntil) {
+		return RideNotValidNow
+	}
+	if p.Product == nil {
+		return RideOutOfScope
+	}
+	for _, id := range p.Product.RouteIds {
+		if id == routeID {
+			return RideValid
+		}
+	}
+	if ownerID != nil {
+		for _, id := range p.Product.OwnerIds {
+			if id == *ownerID {
+				return RideValid
+			}
+		}
+	}
+	return RideOutOfScope
+}
+
+// purchaseTransaction is the statement entry of a pass purchase.
+func purchaseTransaction(p *domain.Pass, product *domain.PassProduct, method string) model.Transaction {
+	return model.Transaction{
+		UserID:        int(p.UserId),
+		Amount:        p.Price,
+		Type:          "purchase",
+		Description:   fmt.Sprintf("Pass Purchase - %s", product.Name),
+		PaymentMethod: method,
+		CreatedAt:     time.Now(),
+	}
+}
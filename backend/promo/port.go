@@ -0,0 +1,44 @@
+package promo
+
+import (
+	"swift_transit/domain"
+)
+
+// QuoteRequest asks what a promo code takes off a purchase. Fares are the
+// fares of its passengers, in order.
+type QuoteRequest struct {
+	Code    string
+	UserId  int64
+	RouteId int64
+	Fares   []domain.Money
+}
+
+// Quote is the discount a promo code gives a purchase. Discounts holds the
+// share of Discount taken off each fare, in the order of the request.
+type Quote struct {
+	PromoId   int64
+	Code      string
+	Discount  domain.Money
+	Discounts []domain.Money
+}
+
+type Service interface {
+	Quote(req QuoteRequest) (*Quote, error)
+	ReleaseOrder(orderID int64) error
+
+	ListPromos() ([]domain.PromoCode, error)
+	CreatePromo(p domain.PromoCode) (*domain.PromoCode, error)
+	SetPromoActive(id int64, active bool) (*domain.PromoCode, error)
+	ListRedemptions(promoID int64, limit, offset int) ([]domain.PromoRedemption, int, error)
+}
+
+type Repo interface {
+	GetByCode(code string) (*domain.PromoCode, error)
+	List() ([]domain.PromoCode, error)
+	Create(p domain.PromoCode) (*domain.PromoCode, error)
+	SetActive(id int64, active bool) (*domain.PromoCode, error)
+	CountUserRedemptions(promoID, userID int64) (int, error)
+	HasPaidTicket(userID int64) (bool, error)
+	ReleaseOrder(orderID int64) (bool, error)
+	ListRedemptions(promoID int64, limit, offset int) ([]domain.PromoRedemption, int, error)
+}
@@ -0,0 +1,250 @@
+package promo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"swift_transit/domain"
+)
+
+// Kinds of promo codes
+const (
+	KindPercent   = "percent"    // Percent off the order, up to MaxDiscount
+	KindFixed     = "fixed"      // Amount off the order
+	KindFirstRide = "first_ride" // One ticket free on a user's first purchase
+)
+
+// Redemption states
+const (
+	RedemptionApplied  = "applied"
+	RedemptionReleased = "released" // The order's payment failed
+)
+
+var codePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,40}$`)
+
+// NormalizeCode returns a code as it is stored, trimmed and upper case.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+type service struct {
+	repo Repo
+}
+
+func NewService(repo Repo) Service {
+	return &service{repo: repo}
+}
+
+// Quote checks that a user can apply a code to a purchase on a route and
+// works out its discount. Limits and the budget are checked again, under a
+// lock, when the order is created.
+func (s *service) Quote(req QuoteRequest) (*Quote, error) {
+	p, err := s.repo.GetByCode(NormalizeCode(req.Code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("invalid promo code")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(p.RouteIds) > 0 && !containsID(p.RouteIds, req.RouteId) {
+		return nil, fmt.Errorf("promo code %s is not valid on this route", p.Code)
+	}
+	if p.Kind == KindFirstRide {
+		paid, err := s.repo.HasPaidTicket(req.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if paid {
+			return nil, fmt.Errorf("promo code %s is only valid on your first ride", p.Code)
+		}
+	}
+	used, err := s.repo.CountUserRedemptions(p.Id, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	discounts := Discounts(p, req.Fares)
+	var total domain.Money
+	for _, d := range discounts {
+		total += d
+	}
+	if err := CheckRedemption(p, used, total, time.Now()); err != nil {
+		return nil, err
+	}
+	return &Quote{PromoId: p.Id, Code: p.Code, Discount: total, Discounts: discounts}, nil
+}
+
+// CheckRedemption reports why a user who already used a code used times
+// cannot take discount off an order with it now, or nil if they can.
+func CheckRedemption(p *domain.PromoCode, used int, discount domain.Money, now time.Time) error {
+	switch {
+	case !p.Active:
+		return fmt.Errorf("promo code %s is no longer active", p.Code)
+	case now.Before(p.StartsAt):
+		return fmt.Errorf("promo code %s is not valid yet", p.Code)
+	case p.ExpiresAt != nil && !now.Before(*p.ExpiresAt):
+		return fmt.Errorf("promo code %s has expired", p.Code)
+	case p.UsageLimit != nil && p.TimesUsed >= *p.UsageLimit:
+		return fmt.Errorf("promo code %s has been fully redeemed", p.Code)
+	case used >= perUserLimit(p):
+		return fmt.Errorf("you have already used promo code %s", p.Code)
+	case p.Budget != nil && p.DiscountGiven+discount > *p.Budget:
+		return fmt.Errorf("promo code %s has been fully redeemed", p.Code)
+	case discount <= 0:
+		return fmt.Errorf("promo code %s gives no discount on this purchase", p.Code)
+	}
+	return nil
+}
+
+// perUserLimit is how many orders one user can apply a code to. First-ride
+// codes apply once.
+func perUserLimit(p *domain.PromoCode) int {
+	limit := math.MaxInt
+	if p.PerUserLimit != nil {
+		limit = *p.PerUserLimit
+	}
+	if p.Kind == KindFirstRide {
+		limit = 1
+	}
+	return limit
+}
+
+// Discounts returns what a code takes off each fare of a purchase. Order
+// discounts are split over the fares in proportion to them, to the poisha.
+func Discounts(p *domain.PromoCode, fares []domain.Money) []domain.Money {
+	discounts := make([]domain.Money, len(fares))
+	if len(fares) == 0 {
+		return discounts
+	}
+	var total domain.Money
+	for _, f := range fares {
+		total += f
+	}
+
+	var discount domain.Money
+	switch p.Kind {
+	case KindPercent:
+		if p.Percent != nil {
+			discount = total.MulRatio(int64(*p.Percent), 100)
+		}
+		if p.MaxDiscount != nil {
+			discount = domain.MinMoney(discount, *p.MaxDiscount)
+		}
+	case KindFixed:
+		if p.Amount != nil {
+			discount = domain.MinMoney(*p.Amount, total)
+		}
+	case KindFirstRide:
+		discounts[0] = fares[0]
+		return discounts
+	}
+	return split(discount, fares, total)
+}
+
+// split shares discount out over fares in proportion to them. Poisha left
+// over from rounding down go to the first fares with room for them.
+func split(discount domain.Money, fares []domain.Money, total domain.Money) []domain.Money {
+	shares := make([]domain.Money, len(fares))
+	if discount <= 0 || total <= 0 {
+		return shares
+	}
+	left := discount
+	for i, f := range fares {
+		shares[i] = domain.Money(int64(discount) * int64(f) / int64(total))
+		left -= shares[i]
+	}
+	for i := range shares {
+		if left == 0 {
+			break
+		}
+		room := domain.MinMoney(fares[i]-shares[i], left)
+		shares[i] += room
+		left -= room
+	}
+	return shares
+}
+
+// ReleaseOrder gives back the code used on an order that was never paid or
+// was cancelled, so it counts towards no limit or budget.
+func (s *service) ReleaseOrder(orderID int64) error {
+	_, err := s.repo.ReleaseOrder(orderID)
+	return err
+}
+
+func (s *service) ListPromos() ([]domain.PromoCode, error) {
+	return s.repo.List()
+}
+
+func (s *service) CreatePromo(p domain.PromoCode) (*domain.PromoCode, error) {
+	p.Code = NormalizeCode(p.Code)
+	if !codePattern.MatchString(p.Code) {
+		return nil, fmt.Errorf("code must be 3 to 40 letters, digits, dashes or underscores")
+	}
+
+	switch p.Kind {
+	case KindPercent:
+		if p.Percent == nil || *p.Percent < 1 || *p.Percent > 100 {
+			return nil, fmt.Errorf("percent must be between 1 and 100")
+		}
+		p.Amount = nil
+	case KindFixed:
+		if p.Amount == nil || *p.Amount <= 0 {
+			return nil, fmt.Errorf("amount must be positive")
+		}
+		p.Percent, p.MaxDiscount = nil, nil
+	case KindFirstRide:
+		p.Percent, p.Amount, p.MaxDiscount = nil, nil, nil
+	default:
+		return nil, fmt.Errorf("kind must be %s, %s or %s", KindPercent, KindFixed, KindFirstRide)
+	}
+
+	switch {
+	case p.MaxDiscount != nil && *p.MaxDiscount <= 0:
+		return nil, fmt.Errorf("max_discount must be positive")
+	case p.PerUserLimit != nil && *p.PerUserLimit < 1:
+		return nil, fmt.Errorf("per_user_limit must be at least 1")
+	case p.UsageLimit != nil && *p.UsageLimit < 1:
+		return nil, fmt.Errorf("usage_limit must be at least 1")
+	case p.Budget != nil && *p.Budget <= 0:
+		return nil, fmt.Errorf("budget must be positive")
+	}
+	if p.StartsAt.IsZero() {
+		p.StartsAt = time.Now()
+	}
+	if p.ExpiresAt != nil && !p.ExpiresAt.After(p.StartsAt) {
+		return nil, fmt.Errorf("expires_at must be after starts_at")
+	}
+
+	created, err := s.repo.Create(p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("promo code %s already exists", p.Code)
+	}
+	return created, err
+}
+
+// SetPromoActive withdraws a code, or offers it again.
+func (s *service) SetPromoActive(id int64, active bool) (*domain.PromoCode, error) {
+	p, err := s.repo.SetActive(id, active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("promo code not found")
+	}
+	return p, err
+}
+
+func (s *service) ListRedemptions(promoID int64, limit, offset int) ([]domain.PromoRedemption, int, error) {
+	return s.repo.ListRedemptions(promoID, limit, offset)
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
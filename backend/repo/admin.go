@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"swift_transit/domain"
+	"swift_transit/ledger"
 
+	"github.com/jmoiron/sqlx"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -37,6 +39,7 @@ type AdminRepo interface {
 
 	// Tickets
 	GetAllTickets(limit, offset int) ([]domain.Ticket, int, error)
+	GetTicketEvents(ticketID int64) ([]domain.TicketEvent, error)
 
 	// Transactions
 	GetAllTransactions(limit, offset int) ([]domain.Transaction, int, error)
@@ -105,14 +108,36 @@ func (r *adminRepo) GetUserByID(id int64) (*domain.User, error) {
 	return &user, nil
 }
 
+// UpdateUser saves a user's profile. A changed balance is posted to the
+// ledger as an adjustment for the difference.
 func (r *adminRepo) UpdateUser(user domain.User) error {
-	query := `UPDATE users SET name = $1, mobile = $2, nid = $3, email = $4, is_student = $5, balance = $6 
-	          WHERE id = $7`
-	_, err := r.db.Exec(query, user.Name, user.Mobile, user.NID, user.Email, user.IsStudent, user.Balance, user.Id)
+	tx, err := sqlx.NewDb(r.db, "postgres").Beginx()
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
-	return nil
+	defer tx.Rollback()
+
+	var balance domain.Money
+	query := `UPDATE users SET name = $1, mobile = $2, nid = $3, email = $4, is_student = $5
+	          WHERE id = $6
+	          RETURNING balance`
+	err = tx.Get(&balance, query, user.Name, user.Mobile, user.NID, user.Email, user.IsStudent, user.Id)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if diff := user.Balance - balance; diff != 0 {
+		err := postWalletChange(tx, user.Id, diff, domain.WalletPosting{
+			Account:     ledger.AccountAdjustments,
+			Kind:        ledger.KindAdjustment,
+			Description: "Balance adjusted by admin",
+			Reference:   fmt.Sprintf("user:%d", user.Id),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to adjust balance: %w", err)
+		}
+	}
+	return tx.Commit()
 }
 
 func (r *adminRepo) DeleteUser(id int64) error {
@@ -153,10 +178,16 @@ func (r *adminRepo) GetDashboardStats() (map[string]interface{}, error) {
 	r.db.QueryRow(`SELECT COUNT(*) FROM tickets`).Scan(&totalTickets)
 	stats["total_tickets"] = totalTickets
 
-	// Total revenue
-	var totalRevenue float64
-	r.db.QueryRow(`SELECT COALESCE(SUM(fare), 0) FROM tickets WHERE payment_status = 'paid'`).Scan(&totalRevenue)
+	// Total revenue, counting fares before promo discounts as owners do
+	var totalRevenue, totalDiscounts domain.Money
+	r.db.QueryRow(`
+		SELECT COALESCE(SUM(t.fare + COALESCE(oi.discount, 0)), 0), COALESCE(SUM(oi.discount), 0)
+		FROM tickets t
+		LEFT JOIN order_items oi ON oi.ticket_id = t.id
+		WHERE t.payment_status = 'paid'
+	`).Scan(&totalRevenue, &totalDiscounts)
 	stats["total_revenue"] = totalRevenue
+	stats["total_promo_discounts"] = totalDiscounts
 
 	// Today's tickets
 	var todayTickets int
@@ -164,8 +195,13 @@ func (r *adminRepo) GetDashboardStats() (map[string]interface{}, error) {
 	stats["today_tickets"] = todayTickets
 
 	// Today's revenue
-	var todayRevenue float64
-	r.db.QueryRow(`SELECT COALESCE(SUM(fare), 0) FROM tickets WHERE payment_status = 'paid' AND created_at >= CURRENT_DATE`).Scan(&todayRevenue)
+	var todayRevenue domain.Money
+	r.db.QueryRow(`
+		SELECT COALESCE(SUM(t.fare + COALESCE(oi.discount, 0)), 0)
+		FROM tickets t
+		LEFT JOIN order_items oi ON oi.ticket_id = t.id
+		WHERE t.payment_status = 'paid' AND t.created_at >= CURRENT_DATE
+	`).Scan(&todayRevenue)
 	stats["today_revenue"] = todayRevenue
 
 	return stats, nil
@@ -316,7 +352,7 @@ func (r *adminRepo) GetAllTickets(limit, offset int) ([]domain.Ticket, int, erro
 	r.db.QueryRow(`SELECT COUNT(*) FROM tickets`).Scan(&total)
 
 	query := `SELECT id, user_id, route_id, registration_number, start_destination, end_destination, 
-	          fare, payment_status, created_at FROM tickets ORDER BY id DESC LIMIT $1 OFFSET $2`
+	          fare, payment_status, status, created_at FROM tickets ORDER BY id DESC LIMIT $1 OFFSET $2`
 	rows, err := r.db.Query(query, limit, offset)
 	if err != nil {
 		return nil, 0, err
@@ -327,12 +363,30 @@ func (r *adminRepo) GetAllTickets(limit, offset int) ([]domain.Ticket, int, erro
 	for rows.Next() {
 		var ticket domain.Ticket
 		rows.Scan(&ticket.Id, &ticket.UserId, &ticket.RouteId, &ticket.RegistrationNumber,
-			&ticket.StartDestination, &ticket.EndDestination, &ticket.Fare, &ticket.PaymentStatus, &ticket.CreatedAt)
+			&ticket.StartDestination, &ticket.EndDestination, &ticket.Fare, &ticket.PaymentStatus, &ticket.Status, &ticket.CreatedAt)
 		tickets = append(tickets, ticket)
 	}
 	return tickets, total, nil
 }
 
+func (r *adminRepo) GetTicketEvents(ticketID int64) ([]domain.TicketEvent, error) {
+	query := `SELECT id, ticket_id, from_status, to_status, actor, reason, created_at
+	          FROM ticket_events WHERE ticket_id = $1 ORDER BY id`
+	rows, err := r.db.Query(query, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []domain.TicketEvent{}
+	for rows.Next() {
+		var event domain.TicketEvent
+		rows.Scan(&event.Id, &event.TicketId, &event.FromStatus, &event.ToStatus, &event.Actor, &event.Reason, &event.CreatedAt)
+		events = append(events, event)
+	}
+	return events, nil
+}
+
 // Transactions
 func (r *adminRepo) GetAllTransactions(limit, offset int) ([]domain.Transaction, int, error) {
 	var total int
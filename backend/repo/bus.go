@@ -3,6 +3,7 @@ package repo
 import (
 	"swift_transit/bus"
 	"swift_transit/domain"
+	"swift_transit/location"
 	"swift_transit/utils"
 
 	"github.com/jmoiron/sqlx"
@@ -110,3 +111,42 @@ func (r *busRepo) CreateCredential(busCred domain.BusCredential) error {
 	_, err := r.Create(busCred)
 	return err
 }
+
+// SaveLocations stores positions in the location history. Points already
+// stored for the same bus and timestamp are skipped; it returns how many
+// rows were inserted.
+func (r *busRepo) SaveLocations(busID int64, updates []location.LocationUpdate) (int64, error) {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Preparex(`
+		INSERT INTO bus_location_history (bus_id, route_id, geom, speed, recorded_at)
+		VALUES ($1, $2, ST_SetSRID(ST_MakePoint($3, $4), 4326), $5, $6)
+		ON CONFLICT (bus_id, recorded_at) DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var inserted int64
+	for _, update := range updates {
+		res, err := stmt.Exec(busID, update.RouteID, update.Longitude, update.Latitude, update.Speed, update.RecordedAt)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		inserted += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
@@ -79,19 +79,22 @@ func (r *busOwnerRepo) GetBusesByOwner(ownerId int64) ([]domain.BusCredential, e
 	return buses, nil
 }
 
+// Owners earn a ticket's fare before any promo discount, which is the
+// platform's cost, so revenue adds back order_items.discount.
 func (r *busOwnerRepo) GetAnalytics(ownerId int64) (*domain.BusOwnerAnalytics, error) {
 	query := `
 		SELECT 
-			COALESCE(SUM(t.fare), 0) as total_revenue,
+			COALESCE(SUM(t.fare + COALESCE(oi.discount, 0)), 0) as total_revenue,
 			COUNT(t.id) as total_tickets,
-			COALESCE(SUM(CASE WHEN t.created_at >= CURRENT_DATE THEN t.fare ELSE 0 END), 0) as today_revenue,
+			COALESCE(SUM(CASE WHEN t.created_at >= CURRENT_DATE THEN t.fare + COALESCE(oi.discount, 0) ELSE 0 END), 0) as today_revenue,
 			COUNT(CASE WHEN t.created_at >= CURRENT_DATE THEN 1 END) as today_tickets,
-			COALESCE(SUM(CASE WHEN t.created_at >= DATE_TRUNC('week', CURRENT_DATE) THEN t.fare ELSE 0 END), 0) as weekly_revenue,
+			COALESCE(SUM(CASE WHEN t.created_at >= DATE_TRUNC('week', CURRENT_DATE) THEN t.fare + COALESCE(oi.discount, 0) ELSE 0 END), 0) as weekly_revenue,
 			COUNT(CASE WHEN t.created_at >= DATE_TRUNC('week', CURRENT_DATE) THEN 1 END) as weekly_tickets,
-			COALESCE(SUM(CASE WHEN t.created_at >= DATE_TRUNC('month', CURRENT_DATE) THEN t.fare ELSE 0 END), 0) as monthly_revenue,
+			COALESCE(SUM(CASE WHEN t.created_at >= DATE_TRUNC('month', CURRENT_DATE) THEN t.fare + COALESCE(oi.discount, 0) ELSE 0 END), 0) as monthly_revenue,
 			COUNT(CASE WHEN t.created_at >= DATE_TRUNC('month', CURRENT_DATE) THEN 1 END) as monthly_tickets
 		FROM tickets t
 		JOIN bus_credentials b ON t.registration_number = b.registration_number
+		LEFT JOIN order_items oi ON oi.ticket_id = t.id
 		WHERE b.owner_id = $1 AND t.payment_status = 'paid'
 	`
 
@@ -118,9 +121,10 @@ func (r *busOwnerRepo) GetPerBusAnalytics(ownerId int64) ([]domain.BusAnalytics,
 		SELECT 
 			b.registration_number,
 			COUNT(t.id) as tickets,
-			COALESCE(SUM(t.fare), 0) as revenue
+			COALESCE(SUM(t.fare + COALESCE(oi.discount, 0)), 0) as revenue
 		FROM bus_credentials b
 		LEFT JOIN tickets t ON t.registration_number = b.registration_number AND t.payment_status = 'paid'
+		LEFT JOIN order_items oi ON oi.ticket_id = t.id
 		WHERE b.owner_id = $1
 		GROUP BY b.registration_number
 		ORDER BY revenue DESC
@@ -0,0 +1,309 @@
+package repo
+
+import (
+	"swift_transit/card"
+	"swift_transit/domain"
+	"swift_transit/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type CardRepo interface {
+	card.Repo
+}
+
+type cardRepo struct {
+	dbCon       *sqlx.DB
+	utilHandler *utils.Handler
+}
+
+func NewCardRepo(dbcon *sqlx.DB, utilHandler *utils.Handler) CardRepo {
+	return &cardRepo{
+		dbCon:       dbcon,
+		utilHandler: utilHandler,
+	}
+}
+
+// AddInventory stocks cards, skipping UIDs already known, and returns how
+// many were added.
+func (r *cardRepo) AddInventory(uids []string, batch string, actor string) (int, error) {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	query := `
+                INSERT INTO cards (uid, status, batch)
+                SELECT u, 'inventory', NULLIF($2, '') FROM unnest($1::text[]) AS u
+                ON CONFLICT (uid) DO NOTHING
+                RETURNING id
+        `
+	if err := tx.Select(&ids, query, pq.Array(uids), batch); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := insertCardEvent(tx, id, "", "inventory", actor, "stocked"); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+func (r *cardRepo) GetByUID(uid string) (*domain.Card, error) {
+	var c domain.Card
+	if err := r.dbCon.Get(&c, `SELECT * FROM cards WHERE uid = $1`, uid); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCurrent returns the card a user holds: issued, active or blocked.
+func (r *cardRepo) GetCurrent(userID int64) (*domain.Card, error) {
+	var c domain.Card
+	query := `SELECT * FROM cards WHERE user_id = $1 AND status IN ('issued', 'active', 'blocked')`
+	if err := r.dbCon.Get(&c, query, userID); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetLatest returns the card most recently issued to a user, whatever its state.
+func (r *cardRepo) GetLatest(userID int64) (*domain.Card, error) {
+	var c domain.Card
+	query := `SELECT * FROM cards WHERE user_id = $1 ORDER BY issued_at DESC NULLS LAST, id DESC LIMIT 1`
+	if err := r.dbCon.Get(&c, query, userID); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *cardRepo) List(status string, limit, offset int) ([]domain.Card, int, error) {
+	var total int
+	if err := r.dbCon.Get(&total, `SELECT COUNT(*) FROM cards WHERE $1 = '' OR status = $1`, status); err != nil {
+		return nil, 0, err
+	}
+
+	cards := []domain.Card{}
+	query := `SELECT * FROM cards WHERE $1 = '' OR status = $1 ORDER BY id DESC LIMIT $2 OFFSET $3`
+	if err := r.dbCon.Select(&cards, query, status, limit, offset); err != nil {
+		return nil, 0, err
+	}
+	return cards, total, nil
+}
+
+// Bind gives a card in inventory to a user. It reports false when the card
+// is not in inventory.
+func (r *cardRepo) Bind(uid string, userID int64, to string, actor, reason string) (bool, error) {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	bound, err := bindCard(tx, uid, userID, to, actor, reason)
+	if err != nil || !bound {
+		return false, err
+	}
+	if err := syncUserCard(tx, userID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Transition moves a card in one of the from states to state to. It reports
+// false when the card was in another state.
+func (r *cardRepo) Transition(uid string, from []string, to string, actor, reason string) (bool, error) {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var moved struct {
+		Id     int64  `db:"id"`
+		UserId *int64 `db:"user_id"`
+		From   string `db:"from_status"`
+	}
+	query := `
+                UPDATE cards c SET status = $2, updated_at = CURRENT_TIMESTAMP
+                FROM (SELECT id, status FROM cards WHERE uid = $1 FOR UPDATE) old
+                WHERE c.id = old.id AND old.status = ANY($3::text[])
+                RETURNING c.id, c.user_id, old.status AS from_status
+        `
+	rows, err := tx.Queryx(query, uid, to, pq.Array(from))
+	if err != nil {
+		return false, err
+	}
+	found := rows.Next()
+	if found {
+		err = rows.StructScan(&moved)
+	}
+	rows.Close()
+	if err != nil || !found {
+		return false, err
+	}
+
+	if err := insertCardEvent(tx, moved.Id, moved.From, to, actor, reason); err != nil {
+		return false, err
+	}
+	if moved.UserId != nil {
+		if err := syncUserCard(tx, *moved.UserId); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// Replace binds a new card from inventory to a user as active and, if the
+// user had a card, moves it to oldTo and links it to the new one. It reports
+// false when the new card is not in inventory or the old card changed.
+func (r *cardRepo) Replace(old *domain.Card, oldTo string, newUID string, userID int64, actor, reason string) (bool, error) {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Retire the old card first, so the user holds one current card at a time
+	if old != nil {
+		res, err := tx.Exec(`
+                        UPDATE cards SET status = $3, updated_at = CURRENT_TIMESTAMP
+                        WHERE id = $1 AND status = $2
+                `, old.Id, old.Status, oldTo)
+		if err != nil {
+			return false, err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return false, err
+		}
+	}
+
+	bound, err := bindCard(tx, newUID, userID, "active", actor, reason)
+	if err != nil || !bound {
+		return false, err
+	}
+	if old != nil {
+		// Recorded after the new card is locked, as events take the hotlist version lock
+		if old.Status != oldTo {
+			if err := insertCardEvent(tx, old.Id, old.Status, oldTo, actor, reason); err != nil {
+				return false, err
+			}
+		}
+		_, err := tx.Exec(`UPDATE cards SET replaced_by = (SELECT id FROM cards WHERE uid = $2) WHERE id = $1`, old.Id, newUID)
+		if err != nil {
+			return false, err
+		}
+		// The holder's companion default carries over to the new card
+		_, err = tx.Exec(`UPDATE cards SET companions = $2 WHERE uid = $1`, newUID, old.Companions)
+		if err != nil {
+			return false, err
+		}
+	}
+	if err := syncUserCard(tx, userID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *cardRepo) SetCompanions(cardID int64, companions int) error {
+	_, err := r.dbCon.Exec(`UPDATE cards SET companions = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, cardID, companions)
+	return err
+}
+
+// GetEvents returns the state changes of a card, oldest first.
+func (r *cardRepo) GetEvents(cardID int64) ([]domain.CardEvent, error) {
+	events := []domain.CardEvent{}
+	query := `
+                SELECT id, card_id, from_status, to_status, actor, reason, created_at
+                FROM card_events
+                WHERE card_id = $1
+                ORDER BY id
+        `
+	if err := r.dbCon.Select(&events, query, cardID); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetHotlistChanges returns the current state of issued cards: with since 0
+// those that must be refused, otherwise every card changed after version
+// since. It also returns the version to sync from next. Versions are handed
+// out in commit order, so every change up to that version is included.
+func (r *cardRepo) GetHotlistChanges(since int64) ([]domain.CardHotlistChange, int64, error) {
+	// Read the version first, so changes made meanwhile are sent again rather than missed
+	var version int64
+	if err := r.dbCon.Get(&version, `SELECT version FROM card_hotlist_version`); err != nil {
+		return nil, 0, err
+	}
+
+	changes := []domain.CardHotlistChange{}
+	var err error
+	if since == 0 {
+		err = r.dbCon.Select(&changes, `SELECT uid, status FROM cards WHERE user_id IS NOT NULL AND status IN ('issued', 'blocked', 'lost')`)
+	} else {
+		query := `
+                        SELECT c.uid, c.status FROM cards c
+                        WHERE c.user_id IS NOT NULL AND EXISTS (
+                                SELECT 1 FROM card_events e WHERE e.card_id = c.id AND e.version > $1
+                        )
+                `
+		err = r.dbCon.Select(&changes, query, since)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return changes, version, nil
+}
+
+func bindCard(tx *sqlx.Tx, uid string, userID int64, to string, actor, reason string) (bool, error) {
+	var id int64
+	rows, err := tx.Query(`
+                UPDATE cards SET status = $3, user_id = $2, issued_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+                WHERE uid = $1 AND status = 'inventory'
+                RETURNING id
+        `, uid, userID, to)
+	if err != nil {
+		return false, err
+	}
+	found := rows.Next()
+	if found {
+		err = rows.Scan(&id)
+	}
+	rows.Close()
+	if err != nil || !found {
+		return false, err
+	}
+	return true, insertCardEvent(tx, id, "inventory", to, actor, reason)
+}
+
+// syncUserCard mirrors a user's current card into users.rfid and
+// users.is_rfid_active, which taps resolve riders by.
+func syncUserCard(tx *sqlx.Tx, userID int64) error {
+	_, err := tx.Exec(`
+                UPDATE users SET
+                        rfid = (SELECT uid FROM cards WHERE user_id = $1 AND status IN ('issued', 'active', 'blocked')),
+                        is_rfid_active = EXISTS (SELECT 1 FROM cards WHERE user_id = $1 AND status = 'active')
+                WHERE id = $1
+        `, userID)
+	return err
+}
+
+// insertCardEvent records a state change and stamps it with the next hotlist
+// version. The version row stays locked until tx commits, so it should be the
+// last lock a card change takes.
+func insertCardEvent(tx *sqlx.Tx, cardID int64, from, to, actor, reason string) error {
+	query := `
+                WITH v AS (UPDATE card_hotlist_version SET version = version + 1 RETURNING version)
+                INSERT INTO card_events (card_id, from_status, to_status, actor, reason, version)
+                SELECT $1, $2, $3, $4, $5, v.version FROM v
+        `
+	_, err := tx.Exec(query, cardID, from, to, actor, reason)
+	return err
+}
@@ -0,0 +1,283 @@
+package repo
+
+import (
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/ledger"
+	"swift_transit/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type LedgerRepo interface {
+	ledger.Repo
+}
+
+type ledgerRepo struct {
+	dbCon       *sqlx.DB
+	utilHandler *utils.Handler
+}
+
+func NewLedgerRepo(dbcon *sqlx.DB, utilHandler *utils.Handler) LedgerRepo {
+	return &ledgerRepo{
+		dbCon:       dbcon,
+		utilHandler: utilHandler,
+	}
+}
+
+// GetWalletBalances returns a user's cached balance and the sum of the
+// postings to their wallet.
+func (r *ledgerRepo) GetWalletBalances(userID int64) (domain.Money, domain.Money, error) {
+	var b struct {
+		Balance       domain.Money `db:"balance"`
+		LedgerBalance domain.Money `db:"ledger_balance"`
+	}
+	query := `
+                SELECT COALESCE(u.balance, 0) AS balance,
+                        COALESCE((SELECT SUM(p.amount) FROM ledger_postings p JOIN ledger_accounts a ON a.id = p.account_id WHERE a.user_id = u.id), 0) AS ledger_balance
+                FROM users u WHERE u.id = $1
+        `
+	if err := r.dbCon.Get(&b, query, userID); err != nil {
+		return 0, 0, err
+	}
+	return b.Balance, b.LedgerBalance, nil
+}
+
+// GetWalletEntries returns a page of the entries posted to a user's wallet,
+// newest first, each with all of its postings.
+func (r *ledgerRepo) GetWalletEntries(userID int64, limit, offset int) ([]domain.LedgerEntry, int, error) {
+	var total int
+	countQuery := `
+                SELECT COUNT(*) FROM ledger_postings p
+                JOIN ledger_accounts a ON a.id = p.account_id
+                WHERE a.user_id = $1
+        `
+	if err := r.dbCon.Get(&total, countQuery, userID); err != nil {
+		return nil, 0, err
+	}
+
+	entries := []domain.LedgerEntry{}
+	query := `
+                SELECT e.id, e.kind, e.description, e.reference, p.amount, e.created_at
+                FROM ledger_postings p
+                JOIN ledger_accounts a ON a.id = p.account_id
+                JOIN ledger_entries e ON e.id = p.entry_id
+                WHERE a.user_id = $1
+                ORDER BY e.id DESC
+                LIMIT $2 OFFSET $3
+        `
+	if err := r.dbCon.Select(&entries, query, userID, limit, offset); err != nil {
+		return nil, 0, err
+	}
+	if len(entries) == 0 {
+		return entries, total, nil
+	}
+
+	ids := make([]int64, len(entries))
+	byID := make(map[int64]*domain.LedgerEntry, len(entries))
+	for i := range entries {
+		ids[i] = entries[i].Id
+		entries[i].Postings = []domain.LedgerPosting{}
+		byID[entries[i].Id] = &entries[i]
+	}
+	var postings []domain.LedgerPosting
+	postingQuery := `
+                SELECT p.id, p.entry_id, a.code AS account_code, p.amount
+                FROM ledger_postings p
+                JOIN ledger_accounts a ON a.id = p.account_id
+                WHERE p.entry_id = ANY($1)
+                ORDER BY p.id
+        `
+	if err := r.dbCon.Select(&postings, postingQuery, pq.Array(ids)); err != nil {
+		return nil, 0, err
+	}
+	for _, p := range postings {
+		e := byID[p.EntryId]
+		e.Postings = append(e.Postings, p)
+	}
+	return entries, total, nil
+}
+
+// Reconcile records a reconciliation run: every wallet whose cached balance
+// differs from its postings is flagged as drifted, and entries whose postings
+// do not sum to zero are counted.
+func (r *ledgerRepo) Reconcile(startedAt time.Time) (*domain.LedgerReconciliation, error) {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	run := domain.LedgerReconciliation{StartedAt: startedAt}
+	if err := tx.Get(&run.WalletsChecked, `SELECT COUNT(*) FROM users`); err != nil {
+		return nil, err
+	}
+	unbalancedQuery := `
+                SELECT COUNT(*) FROM (
+                        SELECT entry_id FROM ledger_postings GROUP BY entry_id HAVING SUM(amount) <> 0
+                ) unbalanced
+        `
+	if err := tx.Get(&run.UnbalancedEntries, unbalancedQuery); err != nil {
+		return nil, err
+	}
+
+	err = tx.Get(&run.Id, `
+                INSERT INTO ledger_reconciliations (started_at, finished_at, wallets_checked, unbalanced_entries)
+                VALUES ($1, CURRENT_TIMESTAMP, $2, $3)
+                RETURNING id
+        `, startedAt, run.WalletsChecked, run.UnbalancedEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	driftQuery := `
+                INSERT INTO ledger_drifts (reconciliation_id, user_id, balance, ledger_balance, drift)
+                SELECT $1, w.id, w.balance, w.ledger_balance, w.balance - w.ledger_balance
+                FROM (
+                        SELECT u.id, COALESCE(u.balance, 0) AS balance, COALESCE(SUM(p.amount), 0) AS ledger_balance
+                        FROM users u
+                        LEFT JOIN ledger_accounts a ON a.user_id = u.id
+                        LEFT JOIN ledger_postings p ON p.account_id = a.id
+                        GROUP BY u.id
+                ) w
+                WHERE w.balance <> w.ledger_balance
+                RETURNING id, reconciliation_id, user_id, balance, ledger_balance, drift
+        `
+	run.Drifts = []domain.LedgerDrift{}
+	if err := tx.Select(&run.Drifts, driftQuery, run.Id); err != nil {
+		return nil, err
+	}
+	run.DriftedWallets = len(run.Drifts)
+
+	err = tx.Get(&run.FinishedAt, `
+                UPDATE ledger_reconciliations SET drifted_wallets = $2, finished_at = CURRENT_TIMESTAMP
+                WHERE id = $1
+                RETURNING finished_at
+        `, run.Id, run.DriftedWallets)
+	if err != nil {
+		return nil, err
+	}
+	return &run, tx.Commit()
+}
+
+func (r *ledgerRepo) ListReconciliations(limit, offset int) ([]domain.LedgerReconciliation, int, error) {
+	var total int
+	if err := r.dbCon.Get(&total, `SELECT COUNT(*) FROM ledger_reconciliations`); err != nil {
+		return nil, 0, err
+	}
+	runs := []domain.LedgerReconciliation{}
+	query := `SELECT * FROM ledger_reconciliations ORDER BY id DESC LIMIT $1 OFFSET $2`
+	if err := r.dbCon.Select(&runs, query, limit, offset); err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// GetReconciliation returns a reconciliation run with the wallets it flagged.
+func (r *ledgerRepo) GetReconciliation(id int64) (*domain.LedgerReconciliation, error) {
+	var run domain.LedgerReconciliation
+	if err := r.dbCon.Get(&run, `SELECT * FROM ledger_reconciliations WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	run.Drifts = []domain.LedgerDrift{}
+	query := `SELECT * FROM ledger_drifts WHERE reconciliation_id = $1 ORDER BY ABS(drift) DESC, user_id`
+	if err := r.dbCon.Select(&run.Drifts, query, id); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// postWalletChange moves amount into a user's wallet, or out of it when
+// negative, from the system account the posting names. Both legs of the
+// entry are written, and the user's cached balance is updated with them.
+func postWalletChange(tx *sqlx.Tx, userID int64, amount domain.Money, p domain.WalletPosting) error {
+	walletID, err := walletAccountID(tx, userID)
+	if err != nil {
+		return err
+	}
+	entryID, err := insertLedgerEntry(tx, p.Kind, p.Description, p.Reference)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`
+                INSERT INTO ledger_postings (entry_id, account_id, amount)
+                SELECT $1, $2, $3::numeric
+                UNION ALL
+                SELECT $1, id, -$3::numeric FROM ledger_accounts WHERE code = $4 AND kind = 'system'
+        `, entryID, walletID, amount, p.Account)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 2 {
+		return fmt.Errorf("unknown ledger account %q", p.Account)
+	}
+
+	_, err = tx.Exec(`UPDATE users SET balance = balance + $1 WHERE id = $2`, amount, userID)
+	return err
+}
+
+// postWalletTransfer moves amount from one user's wallet to another's as a
+// single entry, updating both cached balances. The posting's Account is not
+// used.
+func postWalletTransfer(tx *sqlx.Tx, senderID, recipientID int64, amount domain.Money, p domain.WalletPosting) error {
+	senderWallet, err := walletAccountID(tx, senderID)
+	if err != nil {
+		return err
+	}
+	recipientWallet, err := walletAccountID(tx, recipientID)
+	if err != nil {
+		return err
+	}
+	entryID, err := insertLedgerEntry(tx, p.Kind, p.Description, p.Reference)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+                INSERT INTO ledger_postings (entry_id, account_id, amount)
+                VALUES ($1, $2, -$4::numeric), ($1, $3, $4::numeric)
+        `, entryID, senderWallet, recipientWallet, amount)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+                UPDATE users SET balance = balance + CASE WHEN id = $1 THEN -$3::numeric ELSE $3::numeric END
+                WHERE id IN ($1, $2)
+        `, senderID, recipientID, amount)
+	return err
+}
+
+// walletAccountID returns the ledger account of a user's wallet, opening it
+// on first use.
+func walletAccountID(tx *sqlx.Tx, userID int64) (int64, error) {
+	var walletID int64
+	walletQuery := `
+                WITH created AS (
+                        INSERT INTO ledger_accounts (code, kind, user_id) VALUES ($1, 'wallet', $2)
+                        ON CONFLICT (code) DO NOTHING
+                        RETURNING id
+                )
+                SELECT id FROM created
+                UNION ALL
+                SELECT id FROM ledger_accounts WHERE code = $1
+                LIMIT 1
+        `
+	err := tx.Get(&walletID, walletQuery, ledger.WalletAccount(userID), userID)
+	return walletID, err
+}
+
+func insertLedgerEntry(tx *sqlx.Tx, kind, description, reference string) (int64, error) {
+	var entryID int64
+	err := tx.Get(&entryID, `
+                INSERT INTO ledger_entries (kind, description, reference) VALUES ($1, $2, $3)
+                RETURNING id
+        `, kind, description, reference)
+	return entryID, err
+}
@@ -0,0 +1,162 @@
+package repo
+
+import (
+	"swift_transit/domain"
+	"swift_transit/ticket"
+	"swift_transit/utils"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type OrderRepo interface {
+	ticket.OrderRepo
+}
+
+type orderRepo struct {
+	dbCon       *sqlx.DB
+	utilHandler *utils.Handler
+}
+
+func NewOrderRepo(dbcon *sqlx.DB, utilHandler *utils.Handler) OrderRepo {
+	return &orderRepo{
+		dbCon:       dbcon,
+		utilHandler: utilHandler,
+	}
+}
+
+// insertOrder stores o together with the ticket of each item, so a purchase
+// is never left half written, and sets their IDs.
+func insertOrder(tx *sqlx.Tx, o *domain.Order, actor, reason string) error {
+	query := `
+                INSERT INTO orders (user_id, route_id, bus_name, start_destination, end_destination, payment_method, total_fare, discount, status, batch_id)
+                VALUES (:user_id, :route_id, :bus_name, :start_destination, :end_destination, :payment_method, :total_fare, :discount, :status, :batch_id)
+                RETURNING id, created_at, updated_at
+        `
+	rows, err := tx.NamedQuery(query, o)
+	if err != nil {
+		return err
+	}
+	if rows.Next() {
+		if err := rows.Scan(&o.Id, &o.CreatedAt, &o.UpdatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+
+	for i := range o.Items {
+		item := &o.Items[i]
+		item.OrderId = o.Id
+		if item.Ticket != nil {
+			item.Ticket.OrderID = &o.Id
+			if err := insertTicket(tx, item.Ticket, actor, reason); err != nil {
+				return err
+			}
+			item.TicketId = item.Ticket.Id
+			item.TicketStatus = item.Ticket.Status
+		}
+
+		query := `
+                        INSERT INTO order_items (order_id, ticket_id, fare_category, fare, discount)
+                        VALUES ($1, $2, $3, $4, $5)
+                        RETURNING id
+                `
+		if err := tx.Get(&item.Id, query, item.OrderId, item.TicketId, item.FareCategory, item.Fare, item.Discount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns an order with its items and payment attempts.
+func (r *orderRepo) Get(id int64) (*domain.Order, error) {
+	var o domain.Order
+	if err := r.dbCon.Get(&o, `SELECT * FROM orders WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+
+	o.Items = []domain.OrderItem{}
+	query := `
+                SELECT i.id, i.order_id, i.ticket_id, i.fare_category, i.fare, i.discount, i.refunded_amount, t.status AS ticket_status
+                FROM order_items i
+                JOIN tickets t ON t.id = i.ticket_id
+                WHERE i.order_id = $1
+                ORDER BY i.id
+        `
+	if err := r.dbCon.Select(&o.Items, query, id); err != nil {
+		return nil, err
+	}
+
+	o.PaymentAttempts = []domain.PaymentAttempt{}
+	query = `SELECT * FROM payment_attempts WHERE order_id = $1 ORDER BY id`
+	if err := r.dbCon.Select(&o.PaymentAttempts, query, id); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (r *orderRepo) UpdateStatus(id int64, status string) error {
+	return updateOrderStatus(r.dbCon, id, status)
+}
+
+func updateOrderStatus(db sqlx.Execer, id int64, status string) error {
+	query := `UPDATE orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	_, err := db.Exec(query, status, id)
+	return err
+}
+
+func (r *orderRepo) CreatePaymentAttempt(a domain.PaymentAttempt) (*domain.PaymentAttempt, error) {
+	query := `
+                INSERT INTO payment_attempts (order_id, tran_id, gateway, amount, status)
+                VALUES (:order_id, :tran_id, :gateway, :amount, :status)
+                RETURNING id, created_at, updated_at
+        `
+	rows, err := r.dbCon.NamedQuery(query, a)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(&a.Id, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+	}
+	return &a, nil
+}
+
+func (r *orderRepo) GetPaymentAttempt(tranID string) (*domain.PaymentAttempt, error) {
+	var a domain.PaymentAttempt
+	if err := r.dbCon.Get(&a, `SELECT * FROM payment_attempts WHERE tran_id = $1`, tranID); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SettlePaymentAttempt sets the outcome of an attempt that is still open. It
+// reports false if the attempt was already settled.
+func (r *orderRepo) SettlePaymentAttempt(tranID, status string) (bool, error) {
+	return settlePaymentAttempt(r.dbCon, tranID, status)
+}
+
+func settlePaymentAttempt(db sqlx.Execer, tranID, status string) (bool, error) {
+	query := `
+                UPDATE payment_attempts
+                SET status = $1, updated_at = CURRENT_TIMESTAMP
+                WHERE tran_id = $2 AND status = 'initiated'
+        `
+	res, err := db.Exec(query, status, tranID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// addOrderRefund records an amount refunded for one ticket of an order.
+func addOrderRefund(db sqlx.Execer, orderID, ticketID int64, amount domain.Money) error {
+	if _, err := db.Exec(`UPDATE order_items SET refunded_amount = refunded_amount + $1 WHERE order_id = $2 AND ticket_id = $3`, amount, orderID, ticketID); err != nil {
+		return err
+	}
+	_, err := db.Exec(`UPDATE orders SET refunded_amount = refunded_amount + $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, amount, orderID)
+	return err
+}
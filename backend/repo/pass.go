@@ -0,0 +1,258 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/pass"
+	"swift_transit/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type PassRepo interface {
+	pass.Repo
+}
+
+type passRepo struct {
+	dbCon       *sqlx.DB
+	utilHandler *utils.Handler
+}
+
+func NewPassRepo(dbcon *sqlx.DB, utilHandler *utils.Handler) PassRepo {
+	return &passRepo{
+		dbCon:       dbcon,
+		utilHandler: utilHandler,
+	}
+}
+
+const passProductColumns = `id, name, duration_days, price, route_ids, owner_ids, active, created_at`
+
+func scanPassProduct(row interface{ Scan(...any) error }) (*domain.PassProduct, error) {
+	var p domain.PassProduct
+	err := row.Scan(&p.Id, &p.Name, &p.DurationDays, &p.Price, pq.Array(&p.RouteIds), pq.Array(&p.OwnerIds), &p.Active, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *passRepo) ListProducts(activeOnly bool) ([]domain.PassProduct, error) {
+	query := `SELECT ` + passProductColumns + ` FROM pass_products WHERE active OR NOT $1 ORDER BY price`
+	rows, err := r.dbCon.Query(query, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []domain.PassProduct{}
+	for rows.Next() {
+		p, err := scanPassProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, *p)
+	}
+	return products, rows.Err()
+}
+
+func (r *passRepo) GetProduct(id int64) (*domain.PassProduct, error) {
+	return scanPassProduct(r.dbCon.QueryRow(`SELECT `+passProductColumns+` FROM pass_products WHERE id = $1`, id))
+}
+
+func (r *passRepo) CreateProduct(p domain.PassProduct) (*domain.PassProduct, error) {
+	query := `
+                INSERT INTO pass_products (name, duration_days, price, route_ids, owner_ids, active)
+                VALUES ($1, $2, $3, $4::int[], $5::int[], $6)
+                RETURNING id, created_at
+        `
+	if p.RouteIds == nil {
+		p.RouteIds = []int64{}
+	}
+	if p.OwnerIds == nil {
+		p.OwnerIds = []int64{}
+	}
+	err := r.dbCon.QueryRow(query, p.Name, p.DurationDays, p.Price, pq.Array(p.RouteIds), pq.Array(p.OwnerIds), p.Active).Scan(&p.Id, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *passRepo) Create(p domain.Pass) (*domain.Pass, error) {
+	if err := insertPass(r.dbCon, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// insertPass stores p and sets its ID and creation time.
+func insertPass(db sqlx.Ext, p *domain.Pass) error {
+	query := `
+                INSERT INTO passes (user_id, product_id, price, qr_code, payment_method, tran_id, status, valid_from, valid_until)
+                VALUES (:user_id, :product_id, :price, :qr_code, :payment_method, :tran_id, :status, :valid_from, :valid_until)
+                RETURNING id, created_at
+        `
+	rows, err := sqlx.NamedQuery(db, query, p)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return rows.Scan(&p.Id, &p.CreatedAt)
+	}
+	return rows.Err()
+}
+
+func (r *passRepo) GetByQRCode(qrCode string) (*domain.Pass, error) {
+	var p domain.Pass
+	if err := r.dbCon.Get(&p, `SELECT * FROM passes WHERE qr_code = $1`, qrCode); err != nil {
+		return nil, err
+	}
+	return r.withProduct(&p)
+}
+
+func (r *passRepo) GetByTranID(tranID string) (*domain.Pass, error) {
+	var p domain.Pass
+	if err := r.dbCon.Get(&p, `SELECT * FROM passes WHERE tran_id = $1`, tranID); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetByUser returns the passes of a user with their products, newest first.
+func (r *passRepo) GetByUser(userID int64) ([]domain.Pass, error) {
+	passes := []domain.Pass{}
+	if err := r.dbCon.Select(&passes, `SELECT * FROM passes WHERE user_id = $1 ORDER BY created_at DESC`, userID); err != nil {
+		return nil, err
+	}
+
+	products := make(map[int64]*domain.PassProduct)
+	for i := range passes {
+		product, ok := products[passes[i].ProductId]
+		if !ok {
+			var err error
+			product, err = r.GetProduct(passes[i].ProductId)
+			if err != nil {
+				return nil, err
+			}
+			products[product.Id] = product
+		}
+		passes[i].Product = product
+	}
+	return passes, nil
+}
+
+func (r *passRepo) withProduct(p *domain.Pass) (*domain.Pass, error) {
+	product, err := r.GetProduct(p.ProductId)
+	if err != nil {
+		return nil, err
+	}
+	p.Product = product
+	return p, nil
+}
+
+// activatePass starts the validity of a pass once its payment is validated.
+// Passes are only cancelled while awaiting payment, from the gateway's fail
+// and cancel links, so a cancelled pass is activated too: its payment went
+// through after all. It reports false when the pass is already active.
+func activatePass(db sqlx.Execer, id int64, from, until time.Time) (bool, error) {
+	res, err := db.Exec(`
+                UPDATE passes SET status = 'active', valid_from = $2, valid_until = $3
+                WHERE id = $1 AND status IN ('pending_payment', 'cancelled')
+        `, id, from, until)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Cancel cancels a pass awaiting payment. It reports false when the pass is
+// no longer awaiting payment.
+func (r *passRepo) Cancel(id int64) (bool, error) {
+	res, err := r.dbCon.Exec(`UPDATE passes SET status = 'cancelled' WHERE id = $1 AND status = 'pending_payment'`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetBusOwner returns the owner of a bus, or nil for buses without one.
+func (r *passRepo) GetBusOwner(registrationNumber string) (*int64, error) {
+	var ownerID sql.NullInt64
+	err := r.dbCon.Get(&ownerID, `SELECT owner_id FROM bus_credentials WHERE registration_number = $1 LIMIT 1`, registrationNumber)
+	if err != nil {
+		return nil, err
+	}
+	if !ownerID.Valid {
+		return nil, nil
+	}
+	return &ownerID.Int64, nil
+}
+
+// RecordRide records a ride unless the pass was ridden since a time. It
+// returns the blocking ride: one on the same bus, or a QR scan on another bus
+// when ride is a QR scan too. The pass is locked meanwhile, so concurrent
+// scans on two buses cannot both be recorded.
+func (r *passRepo) RecordRide(ride domain.PassRide, since time.Time) (*domain.PassRide, error) {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM passes WHERE id = $1 FOR UPDATE`, ride.PassId); err != nil {
+		return nil, err
+	}
+
+	var recent domain.PassRide
+	err = tx.Get(&recent, `
+                SELECT * FROM pass_rides
+                WHERE pass_id = $1 AND created_at >= $2
+                  AND (registration_number = $3 OR ($4 = 'qr' AND source = 'qr'))
+                ORDER BY created_at DESC
+                LIMIT 1
+        `, ride.PassId, since, ride.RegistrationNumber, ride.Source)
+	if err == nil {
+		return &recent, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	_, err = tx.NamedExec(`
+                INSERT INTO pass_rides (pass_id, user_id, route_id, registration_number, owner_id, source)
+                VALUES (:pass_id, :user_id, :route_id, :registration_number, :owner_id, :source)
+        `, ride)
+	if err != nil {
+		return nil, err
+	}
+	return nil, tx.Commit()
+}
+
+// Apportionment gives each ride an equal share of its pass's price and sums
+// the shares of the rides taken between from and to by bus owner. Rides on
+// buses without an owner are left out.
+func (r *passRepo) Apportionment(from, to time.Time) ([]domain.PassApportionment, error) {
+	query := `
+                WITH ride_counts AS (
+                        SELECT pass_id, COUNT(*) AS rides FROM pass_rides GROUP BY pass_id
+                )
+                SELECT pr.owner_id, COUNT(*) AS rides, ROUND(SUM(p.price / rc.rides)::numeric, 2)::float AS revenue
+                FROM pass_rides pr
+                JOIN passes p ON p.id = pr.pass_id
+                JOIN ride_counts rc ON rc.pass_id = pr.pass_id
+                WHERE pr.owner_id IS NOT NULL AND pr.created_at >= $1 AND pr.created_at < $2
+                GROUP BY pr.owner_id
+                ORDER BY revenue DESC
+        `
+	shares := []domain.PassApportionment{}
+	if err := r.dbCon.Select(&shares, query, from, to); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
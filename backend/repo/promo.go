@@ -0,0 +1,215 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/promo"
+	"swift_transit/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type PromoRepo interface {
+	promo.Repo
+}
+
+type promoRepo struct {
+	dbCon       *sqlx.DB
+	utilHandler *utils.Handler
+}
+
+func NewPromoRepo(dbcon *sqlx.DB, utilHandler *utils.Handler) PromoRepo {
+	return &promoRepo{
+		dbCon:       dbcon,
+		utilHandler: utilHandler,
+	}
+}
+
+const promoColumns = `id, code, description, kind, percent, amount, max_discount, route_ids, per_user_limit, usage_limit,
+                times_used, budget, discount_given, starts_at, expires_at, active, created_at`
+
+func scanPromo(row interface{ Scan(...any) error }) (*domain.PromoCode, error) {
+	var p domain.PromoCode
+	err := row.Scan(&p.Id, &p.Code, &p.Description, &p.Kind, &p.Percent, &p.Amount, &p.MaxDiscount, pq.Array(&p.RouteIds),
+		&p.PerUserLimit, &p.UsageLimit, &p.TimesUsed, &p.Budget, &p.DiscountGiven, &p.StartsAt, &p.ExpiresAt, &p.Active, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if p.RouteIds == nil {
+		p.RouteIds = []int64{}
+	}
+	return &p, nil
+}
+
+func (r *promoRepo) GetByCode(code string) (*domain.PromoCode, error) {
+	return scanPromo(r.dbCon.QueryRow(`SELECT `+promoColumns+` FROM promo_codes WHERE code = $1`, code))
+}
+
+// List returns every promo code, newest first.
+func (r *promoRepo) List() ([]domain.PromoCode, error) {
+	rows, err := r.dbCon.Query(`SELECT ` + promoColumns + ` FROM promo_codes ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promos := []domain.PromoCode{}
+	for rows.Next() {
+		p, err := scanPromo(rows)
+		if err != nil {
+			return nil, err
+		}
+		promos = append(promos, *p)
+	}
+	return promos, rows.Err()
+}
+
+// Create stores a promo code. It returns sql.ErrNoRows when the code is
+// taken.
+func (r *promoRepo) Create(p domain.PromoCode) (*domain.PromoCode, error) {
+	if p.RouteIds == nil {
+		p.RouteIds = []int64{}
+	}
+	query := `
+                INSERT INTO promo_codes (code, description, kind, percent, amount, max_discount, route_ids, per_user_limit,
+                        usage_limit, budget, starts_at, expires_at, active)
+                VALUES ($1, $2, $3, $4, $5, $6, $7::int[], $8, $9, $10, $11, $12, $13)
+                ON CONFLICT (code) DO NOTHING
+                RETURNING ` + promoColumns
+	return scanPromo(r.dbCon.QueryRow(query, p.Code, p.Description, p.Kind, p.Percent, p.Amount, p.MaxDiscount, pq.Array(p.RouteIds),
+		p.PerUserLimit, p.UsageLimit, p.Budget, p.StartsAt, p.ExpiresAt, p.Active))
+}
+
+func (r *promoRepo) SetActive(id int64, active bool) (*domain.PromoCode, error) {
+	return scanPromo(r.dbCon.QueryRow(`UPDATE promo_codes SET active = $2 WHERE id = $1 RETURNING `+promoColumns, id, active))
+}
+
+const countUserRedemptionsQuery = `SELECT COUNT(*) FROM promo_redemptions WHERE promo_id = $1 AND user_id = $2 AND status = 'applied'`
+
+// CountUserRedemptions returns how many orders a user applied a code to,
+// not counting released ones.
+func (r *promoRepo) CountUserRedemptions(promoID, userID int64) (int, error) {
+	var count int
+	err := r.dbCon.Get(&count, countUserRedemptionsQuery, promoID, userID)
+	return count, err
+}
+
+// HasPaidTicket reports whether a user has ever paid for a ticket, for any
+// fare and by any means.
+func (r *promoRepo) HasPaidTicket(userID int64) (bool, error) {
+	var paid bool
+	err := r.dbCon.Get(&paid, `SELECT EXISTS (SELECT 1 FROM tickets WHERE user_id = $1 AND paid_status)`, userID)
+	return paid, err
+}
+
+// firstRideUsedQuery reports whether a user paid for a ticket outside an
+// order, or applied a first-ride code to another order not yet released.
+const firstRideUsedQuery = `
+        SELECT EXISTS (
+                SELECT 1 FROM tickets WHERE user_id = $1 AND paid_status AND order_id IS DISTINCT FROM $2
+        ) OR EXISTS (
+                SELECT 1 FROM promo_redemptions r JOIN promo_codes c ON c.id = r.promo_id
+                WHERE r.user_id = $1 AND r.order_id <> $2 AND r.status = 'applied' AND c.kind = 'first_ride'
+        )
+`
+
+// ReleaseOrder releases the redemption of an order and gives its use and
+// discount back to the code. It reports false when the order used no code or
+// was released before.
+func (r *promoRepo) ReleaseOrder(orderID int64) (bool, error) {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var redemption domain.PromoRedemption
+	err = tx.Get(&redemption, `
+                UPDATE promo_redemptions SET status = 'released', released_at = CURRENT_TIMESTAMP
+                WHERE order_id = $1 AND status = 'applied'
+                RETURNING *
+        `, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+                UPDATE promo_codes SET times_used = times_used - 1, discount_given = discount_given - $2
+                WHERE id = $1
+        `, redemption.PromoId, redemption.Discount)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ListRedemptions returns a page of the orders a code was used on, newest
+// first.
+func (r *promoRepo) ListRedemptions(promoID int64, limit, offset int) ([]domain.PromoRedemption, int, error) {
+	var total int
+	if err := r.dbCon.Get(&total, `SELECT COUNT(*) FROM promo_redemptions WHERE promo_id = $1`, promoID); err != nil {
+		return nil, 0, err
+	}
+
+	redemptions := []domain.PromoRedemption{}
+	query := `SELECT * FROM promo_redemptions WHERE promo_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3`
+	if err := r.dbCon.Select(&redemptions, query, promoID, limit, offset); err != nil {
+		return nil, 0, err
+	}
+	return redemptions, total, nil
+}
+
+// insertPromoRedemption records that an order used a code, checking the
+// code's limits and budget again with it locked so concurrent orders cannot
+// exceed them. First-ride codes also lock the user, so two orders cannot
+// both be their first.
+func insertPromoRedemption(tx *sqlx.Tx, red *domain.PromoRedemption) error {
+	// The user is locked before the code, as wallet purchases lock the
+	// user first to debit them
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, red.UserId); err != nil {
+		return err
+	}
+	p, err := scanPromo(tx.QueryRow(`SELECT `+promoColumns+` FROM promo_codes WHERE id = $1 FOR UPDATE`, red.PromoId))
+	if err != nil {
+		return err
+	}
+	if p.Kind == promo.KindFirstRide {
+		var ridden bool
+		if err := tx.Get(&ridden, firstRideUsedQuery, red.UserId, red.OrderId); err != nil {
+			return err
+		}
+		if ridden {
+			return fmt.Errorf("promo code %s is only valid on your first ride", p.Code)
+		}
+	}
+	var used int
+	if err := tx.Get(&used, countUserRedemptionsQuery, red.PromoId, red.UserId); err != nil {
+		return err
+	}
+	if err := promo.CheckRedemption(p, used, red.Discount, time.Now()); err != nil {
+		return err
+	}
+
+	red.Status = promo.RedemptionApplied
+	err = tx.QueryRowx(`
+                INSERT INTO promo_redemptions (promo_id, order_id, user_id, discount, status)
+                VALUES ($1, $2, $3, $4, $5)
+                RETURNING id, created_at
+        `, red.PromoId, red.OrderId, red.UserId, red.Discount, red.Status).Scan(&red.Id, &red.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record promo redemption: %w", err)
+	}
+
+	_, err = tx.Exec(`
+                UPDATE promo_codes SET times_used = times_used + 1, discount_given = discount_given + $2
+                WHERE id = $1
+        `, red.PromoId, red.Discount)
+	return err
+}
@@ -0,0 +1,296 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/ledger"
+	"swift_transit/model"
+)
+
+const rechargeProductColumns = `id, amount, active, created_at`
+
+// ListRechargeProducts returns the recharge products, smallest first.
+func (r *TransactionRepo) ListRechargeProducts(activeOnly bool) ([]domain.RechargeProduct, error) {
+	products := []domain.RechargeProduct{}
+	query := `SELECT ` + rechargeProductColumns + ` FROM recharge_products WHERE active OR NOT $1 ORDER BY amount`
+	if err := r.db.Select(&products, query, activeOnly); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GetActiveRechargeProduct returns the active product for an amount.
+func (r *TransactionRepo) GetActiveRechargeProduct(amount domain.Money) (*domain.RechargeProduct, error) {
+	var product domain.RechargeProduct
+	query := `SELECT ` + rechargeProductColumns + ` FROM recharge_products WHERE amount = $1 AND active`
+	if err := r.db.Get(&product, query, amount); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// CreateRechargeProduct adds a product for an amount, or reactivates the
+// existing one.
+func (r *TransactionRepo) CreateRechargeProduct(amount domain.Money) (*domain.RechargeProduct, error) {
+	var product domain.RechargeProduct
+	err := r.db.Get(&product, `
+                INSERT INTO recharge_products (amount) VALUES ($1)
+                ON CONFLICT (amount) DO UPDATE SET active = TRUE
+                RETURNING `+rechargeProductColumns, amount)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *TransactionRepo) SetRechargeProductActive(id int64, active bool) (*domain.RechargeProduct, error) {
+	var product domain.RechargeProduct
+	query := `UPDATE recharge_products SET active = $2 WHERE id = $1 RETURNING ` + rechargeProductColumns
+	if err := r.db.Get(&product, query, id, active); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+const rechargeLimitColumns = `user_id, daily_limit, updated_at`
+
+// ListRechargeLimits returns the default daily recharge limit followed by
+// the limits of users who have their own.
+func (r *TransactionRepo) ListRechargeLimits() ([]domain.RechargeLimit, error) {
+	limits := []domain.RechargeLimit{}
+	query := `SELECT ` + rechargeLimitColumns + ` FROM recharge_limits ORDER BY user_id NULLS FIRST`
+	if err := r.db.Select(&limits, query); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// GetRechargeLimit returns a user's daily recharge limit: their own, or
+// the default.
+func (r *TransactionRepo) GetRechargeLimit(userID int64) (domain.Money, error) {
+	var limit domain.Money
+	query := `
+                SELECT daily_limit FROM recharge_limits
+                WHERE user_id = $1 OR user_id IS NULL
+                ORDER BY user_id NULLS LAST LIMIT 1
+        `
+	err := r.db.Get(&limit, query, userID)
+	return limit, err
+}
+
+// GetDefaultRechargeLimit returns the daily recharge limit of users without
+// their own.
+func (r *TransactionRepo) GetDefaultRechargeLimit() (domain.Money, error) {
+	var limit domain.Money
+	err := r.db.Get(&limit, `SELECT daily_limit FROM recharge_limits WHERE user_id IS NULL`)
+	return limit, err
+}
+
+// SetRechargeLimit sets a user's daily recharge limit, or with a nil user
+// the default. It returns sql.ErrNoRows when the user does not exist.
+func (r *TransactionRepo) SetRechargeLimit(userID *int64, limit domain.Money) (*domain.RechargeLimit, error) {
+	var set domain.RechargeLimit
+	err := r.db.Get(&set, `
+                INSERT INTO recharge_limits (user_id, daily_limit)
+                SELECT $1, $2 WHERE $1::INT IS NULL OR EXISTS (SELECT 1 FROM users WHERE id = $1)
+                ON CONFLICT ((COALESCE(user_id, 0))) DO UPDATE SET daily_limit = $2, updated_at = CURRENT_TIMESTAMP
+                RETURNING `+rechargeLimitColumns, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// DeleteRechargeLimit puts a user back on the default daily recharge limit.
+// It returns sql.ErrNoRows when the user had no limit of their own.
+func (r *TransactionRepo) DeleteRechargeLimit(userID int64) error {
+	res, err := r.db.Exec(`DELETE FROM recharge_limits WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const rechargeCampaignColumns = `id, name, min_amount, bonus, starts_at, ends_at, per_user_limit, budget, bonus_given, active, created_at`
+
+// ListRechargeCampaigns returns every campaign, newest first.
+func (r *TransactionRepo) ListRechargeCampaigns() ([]domain.RechargeCampaign, error) {
+	campaigns := []domain.RechargeCampaign{}
+	query := `SELECT ` + rechargeCampaignColumns + ` FROM recharge_campaigns ORDER BY id DESC`
+	if err := r.db.Select(&campaigns, query); err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+// ActiveRechargeCampaigns returns the campaigns running at a time whose
+// budget is not spent, largest bonus first.
+func (r *TransactionRepo) ActiveRechargeCampaigns(at time.Time) ([]domain.RechargeCampaign, error) {
+	campaigns := []domain.RechargeCampaign{}
+	query := `
+                SELECT ` + rechargeCampaignColumns + ` FROM recharge_campaigns
+                WHERE active AND starts_at <= $1 AND ends_at > $1
+                AND (budget IS NULL OR bonus_given + bonus <= budget)
+                ORDER BY bonus DESC, id
+        `
+	if err := r.db.Select(&campaigns, query, at); err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+func (r *TransactionRepo) CreateRechargeCampaign(c domain.RechargeCampaign) (*domain.RechargeCampaign, error) {
+	var campaign domain.RechargeCampaign
+	err := r.db.Get(&campaign, `
+                INSERT INTO recharge_campaigns (name, min_amount, bonus, starts_at, ends_at, per_user_limit, budget, active)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+                RETURNING `+rechargeCampaignColumns,
+		c.Name, c.MinAmount, c.Bonus, c.StartsAt, c.EndsAt, c.PerUserLimit, c.Budget, c.Active)
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func (r *TransactionRepo) SetRechargeCampaignActive(id int64, active bool) (*domain.RechargeCampaign, error) {
+	var campaign domain.RechargeCampaign
+	query := `UPDATE recharge_campaigns SET active = $2 WHERE id = $1 RETURNING ` + rechargeCampaignColumns
+	if err := r.db.Get(&campaign, query, id, active); err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// SumRecharged returns what a user recharged since a time.
+func (r *TransactionRepo) SumRecharged(userID int64, since time.Time) (domain.Money, error) {
+	var sum domain.Money
+	query := `SELECT COALESCE(SUM(amount), 0) FROM recharges WHERE user_id = $1 AND created_at >= $2`
+	err := r.db.Get(&sum, query, userID, since)
+	return sum, err
+}
+
+// CompleteRecharge credits a paid recharge to the user's wallet, with the
+// bonus of the best campaign it qualifies for as a separate ledger entry,
+// and adds both to their statement. The campaign is judged by when the
+// recharge was started. It reports false, with the earlier recharge, when
+// tranID was already credited.
+func (r *TransactionRepo) CompleteRecharge(userID int64, tranID string, amount domain.Money, startedAt time.Time) (*domain.Recharge, bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	recharge := domain.Recharge{UserId: userID, TranID: tranID, Amount: amount}
+	err = tx.QueryRowx(`
+                INSERT INTO recharges (user_id, tran_id, amount) VALUES ($1, $2, $3)
+                ON CONFLICT (tran_id) DO NOTHING
+                RETURNING id, created_at
+        `, userID, tranID, amount).Scan(&recharge.Id, &recharge.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		var done domain.Recharge
+		if err := r.db.Get(&done, `SELECT * FROM recharges WHERE tran_id = $1`, tranID); err != nil {
+			return nil, false, err
+		}
+		return &done, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	err = creditBalance(tx, userID, amount, domain.WalletPosting{
+		Account:     ledger.AccountGateway,
+		Kind:        ledger.KindRecharge,
+		Description: "Wallet recharge",
+		Reference:   tranID,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	err = insertTransaction(tx, model.Transaction{
+		UserID:        int(userID),
+		Amount:        amount,
+		Type:          "credit",
+		Description:   "Wallet recharge",
+		PaymentMethod: "SSLCommerz",
+		CreatedAt:     recharge.CreatedAt,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Campaigns stay locked until commit, so budgets and per-user limits hold
+	// under concurrent recharges
+	var campaigns []domain.RechargeCampaign
+	err = tx.Select(&campaigns, `
+                SELECT `+rechargeCampaignColumns+` FROM recharge_campaigns
+                WHERE active AND starts_at <= $1 AND ends_at > $1 AND min_amount <= $2
+                ORDER BY bonus DESC, id
+                FOR UPDATE
+        `, startedAt, amount)
+	if err != nil {
+		return nil, false, err
+	}
+	var campaign *domain.RechargeCampaign
+	for i := range campaigns {
+		c := &campaigns[i]
+		if c.Budget != nil && c.BonusGiven+c.Bonus > *c.Budget {
+			continue
+		}
+		if c.PerUserLimit != nil {
+			var used int
+			err := tx.Get(&used, `SELECT COUNT(*) FROM recharges WHERE campaign_id = $1 AND user_id = $2`, c.Id, userID)
+			if err != nil {
+				return nil, false, err
+			}
+			if used >= *c.PerUserLimit {
+				continue
+			}
+		}
+		campaign = c
+		break
+	}
+	if campaign == nil {
+		return &recharge, true, tx.Commit()
+	}
+
+	recharge.Bonus = campaign.Bonus
+	recharge.CampaignId = &campaign.Id
+	if _, err := tx.Exec(`UPDATE recharges SET bonus = $2, campaign_id = $3 WHERE id = $1`, recharge.Id, recharge.Bonus, campaign.Id); err != nil {
+		return nil, false, err
+	}
+	if _, err := tx.Exec(`UPDATE recharge_campaigns SET bonus_given = bonus_given + $2 WHERE id = $1`, campaign.Id, campaign.Bonus); err != nil {
+		return nil, false, err
+	}
+
+	description := fmt.Sprintf("Recharge bonus (%s)", campaign.Name)
+	err = creditBalance(tx, userID, campaign.Bonus, domain.WalletPosting{
+		Account:     ledger.AccountPromotions,
+		Kind:        ledger.KindBonus,
+		Description: description,
+		Reference:   tranID,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	err = insertTransaction(tx, model.Transaction{
+		UserID:        int(userID),
+		Amount:        campaign.Bonus,
+		Type:          "credit",
+		Description:   description,
+		PaymentMethod: "Promotion",
+		CreatedAt:     recharge.CreatedAt,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &recharge, true, tx.Commit()
+}
@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/ticket"
+	"swift_transit/utils"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type RFIDTripRepo interface {
+	ticket.RFIDTripRepo
+}
+
+type rfidTripRepo struct {
+	dbCon       *sqlx.DB
+	utilHandler *utils.Handler
+}
+
+func NewRFIDTripRepo(dbcon *sqlx.DB, utilHandler *utils.Handler) RFIDTripRepo {
+	return &rfidTripRepo{
+		dbCon:       dbcon,
+		utilHandler: utilHandler,
+	}
+}
+
+func (r *rfidTripRepo) GetOpen(userID int64) (*domain.RFIDTrip, error) {
+	var trip domain.RFIDTrip
+	if err := r.dbCon.Get(&trip, `SELECT * FROM rfid_trips WHERE user_id = $1 AND status = 'open'`, userID); err != nil {
+		return nil, err
+	}
+	return &trip, nil
+}
+
+// Resolve closes open trips without a tap-off at their reserved fare: the
+// trip given by id, or with id 0 every trip whose ticket stopped being
+// valid before now. It returns how many trips it closed.
+func (r *rfidTripRepo) Resolve(id int64, now time.Time) (int, error) {
+	res, err := r.dbCon.Exec(`
+                UPDATE rfid_trips rt SET status = 'unresolved', fare = rt.reserved_fare
+                FROM tickets t
+                WHERE t.id = rt.ticket_id AND rt.status = 'open'
+                AND (rt.id = $1 OR ($1 = 0 AND t.valid_until <= $2))
+        `, id, now)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// GetBusPosition returns the last position a bus reported since a time.
+func (r *rfidTripRepo) GetBusPosition(registrationNumber string, since time.Time) (float64, float64, error) {
+	var pos struct {
+		Lon float64 `db:"lon"`
+		Lat float64 `db:"lat"`
+	}
+	query := `
+                SELECT ST_X(h.geom) AS lon, ST_Y(h.geom) AS lat
+                FROM bus_location_history h
+                JOIN bus_credentials b ON b.id = h.bus_id
+                WHERE b.registration_number = $1 AND h.recorded_at >= $2
+                ORDER BY h.recorded_at DESC
+                LIMIT 1
+        `
+	if err := r.dbCon.Get(&pos, query, registrationNumber, since); err != nil {
+		return 0, 0, err
+	}
+	return pos.Lon, pos.Lat, nil
+}
+
+// GetNearestStop returns the stop of a route closest to a position,
+// preferring a stop whose area contains it.
+func (r *rfidTripRepo) GetNearestStop(routeID int64, lon, lat float64) (*domain.Stop, error) {
+	var stop domain.Stop
+	query := `
+                SELECT id, route_id, name, stop_order,
+                        ST_X(geom::geometry) AS lon, ST_Y(geom::geometry) AS lat,
+                        COALESCE(ST_AsGeoJSON(area_geom), '') AS area_geom
+                FROM stops
+                WHERE route_id = $1
+                ORDER BY
+                        COALESCE(ST_Contains(area_geom, ST_SetSRID(ST_MakePoint($2, $3), 4326)), FALSE) DESC,
+                        ST_Distance(geom::geography, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography)
+                LIMIT 1
+        `
+	if err := r.dbCon.Get(&stop, query, routeID, lon, lat); err != nil {
+		return nil, err
+	}
+	return &stop, nil
+}
+
+// GetLastStop returns the final stop of a route.
+func (r *rfidTripRepo) GetLastStop(routeID int64) (*domain.Stop, error) {
+	var stop domain.Stop
+	query := `
+                SELECT id, route_id, name, stop_order,
+                        ST_X(geom::geometry) AS lon, ST_Y(geom::geometry) AS lat,
+                        COALESCE(ST_AsGeoJSON(area_geom), '') AS area_geom
+                FROM stops
+                WHERE route_id = $1
+                ORDER BY stop_order DESC
+                LIMIT 1
+        `
+	if err := r.dbCon.Get(&stop, query, routeID); err != nil {
+		return nil, err
+	}
+	return &stop, nil
+}
+
+// insertRFIDTrip stores a trip at tap-on together with the ticket holding
+// its reserved fare, setting their IDs.
+func insertRFIDTrip(tx *sqlx.Tx, trip *domain.RFIDTrip, t *domain.Ticket, actor, reason string) error {
+	if err := insertTicket(tx, t, actor, reason); err != nil {
+		return err
+	}
+	trip.TicketId = t.Id
+
+	query := `
+                INSERT INTO rfid_trips (user_id, ticket_id, route_id, bus_name, boarding_stop, reserved_fare, status, tapped_on_at, paid_by)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+                RETURNING id
+        `
+	return tx.Get(&trip.Id, query, trip.UserId, trip.TicketId, trip.RouteId, trip.BusName, trip.BoardingStop, trip.ReservedFare, trip.Status, trip.TappedOnAt, trip.PaidBy)
+}
+
+// completeRFIDTrip settles an open trip at tap-off and sets its ticket's
+// fare and destination. It reports false when the trip was no longer open.
+func completeRFIDTrip(tx *sqlx.Tx, trip domain.RFIDTrip, t domain.Ticket) (bool, error) {
+	res, err := tx.Exec(`
+                UPDATE rfid_trips SET status = 'completed', alighting_stop = $2, fare = $3, tapped_off_at = $4
+                WHERE id = $1 AND status = 'open'
+        `, trip.Id, trip.AlightingStop, trip.Fare, trip.TappedOffAt)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+                UPDATE tickets SET end_destination = $2, fare = $3, full_fare = $4, fare_cap = $5, updated_at = CURRENT_TIMESTAMP
+                WHERE id = $1
+        `, t.Id, t.EndDestination, t.Fare, t.FullFare, t.FareCap)
+	return err == nil, err
+}
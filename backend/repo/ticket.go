@@ -8,14 +8,14 @@ import (
 	"swift_transit/utils"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type TicketRepo interface {
 	ticket.TicketRepo
 	GetByUserID(userId int64, limit, offset int) ([]domain.Ticket, int, error)
 	CountActiveTicketsByRoute(userId int64, routeId int64) (int, error)
-	UpdateBatchPaymentStatus(batchID string, paid bool, status string, markUsed bool) error
-	CancelTicket(id int64, cancelledAt time.Time, status string) error
+	UpdateOrderPaymentStatus(orderID int64, status string, markUsed bool) error
 }
 
 type ticketRepo struct {
@@ -30,38 +30,45 @@ func NewTicketRepo(dbcon *sqlx.DB, utilHandler *utils.Handler) TicketRepo {
 	}
 }
 
-func (r *ticketRepo) Create(ticket domain.Ticket) (*domain.Ticket, error) {
-	query := `
-                INSERT INTO tickets (user_id, route_id, bus_name, start_destination, end_destination, fare, paid_status, checked, qr_code, created_at, batch_id, payment_method, payment_reference, payment_used, payment_status, cancelled_at, registration_number)
-                VALUES (:user_id, :route_id, :bus_name, :start_destination, :end_destination, :fare, :paid_status, :checked, :qr_code, :created_at, :batch_id, :payment_method, :payment_reference, :payment_used, :payment_status, :cancelled_at, :registration_number)
-                RETURNING id
-        `
-	rows, err := r.dbCon.NamedQuery(query, ticket)
+// Create stores a new ticket in its initial state and records its creation
+// as the first ticket event.
+func (r *ticketRepo) Create(t domain.Ticket, actor, reason string) (*domain.Ticket, error) {
+	tx, err := r.dbCon.Beginx()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	if rows.Next() {
-		err = rows.Scan(&ticket.Id)
-		if err != nil {
-			return nil, err
-		}
+	if err := insertTicket(tx, &t, actor, reason); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	return &ticket, nil
+	return &t, nil
 }
 
-func (r *ticketRepo) UpdateStatus(id int64, status bool) error {
+// insertTicket stores t, setting its ID, along with its creation event.
+func insertTicket(tx *sqlx.Tx, t *domain.Ticket, actor, reason string) error {
 	query := `
-                UPDATE tickets
-                SET paid_status = $1,
-                    payment_status = CASE WHEN $1 THEN 'paid' ELSE payment_status END,
-                    payment_used = CASE WHEN $1 THEN TRUE ELSE payment_used END
-                WHERE batch_id = (SELECT batch_id FROM tickets WHERE id = $2)
+                INSERT INTO tickets (user_id, route_id, bus_name, start_destination, end_destination, fare, full_fare, fare_cap, paid_status, checked, qr_code, created_at, batch_id, order_id, payment_method, payment_reference, payment_used, payment_status, cancelled_at, registration_number, status, ticket_type, valid_from, valid_until)
+                VALUES (:user_id, :route_id, :bus_name, :start_destination, :end_destination, :fare, :full_fare, :fare_cap, :paid_status, :checked, :qr_code, :created_at, :batch_id, :order_id, :payment_method, :payment_reference, :payment_used, :payment_status, :cancelled_at, :registration_number, :status, :ticket_type, :valid_from, :valid_until)
+                RETURNING id
         `
-	_, err := r.dbCon.Exec(query, status, id)
-	return err
+	rows, err := tx.NamedQuery(query, t)
+	if err != nil {
+		return err
+	}
+	if rows.Next() {
+		if err := rows.Scan(&t.Id); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+
+	return insertTicketEvent(tx, t.Id, "", t.Status, actor, reason)
 }
 
 func (r *ticketRepo) Get(id int64) (*domain.Ticket, error) {
@@ -74,8 +81,8 @@ func (r *ticketRepo) Get(id int64) (*domain.Ticket, error) {
 	return &ticket, nil
 }
 
-func (r *ticketRepo) CalculateFare(routeId int64, start, end string) (float64, error) {
-	var fare float64
+func (r *ticketRepo) CalculateFare(routeId int64, start, end string) (domain.Money, error) {
+	var fare domain.Money
 	query := `
 		SELECT 
 			GREATEST(10, (ST_Length(
@@ -121,8 +128,8 @@ func (r *ticketRepo) CountActiveTicketsByRoute(userId int64, routeId int64) (int
                 FROM tickets
                 WHERE user_id = $1
                   AND route_id = $2
-                  AND cancelled_at IS NULL
-                  AND checked = FALSE
+                  AND status IN ('pending_payment', 'paid')
+                  AND valid_until > CURRENT_TIMESTAMP
         `
 	if err := r.dbCon.Get(&count, query, userId, routeId); err != nil {
 		return 0, err
@@ -130,41 +137,209 @@ func (r *ticketRepo) CountActiveTicketsByRoute(userId int64, routeId int64) (int
 	return count, nil
 }
 
-func (r *ticketRepo) UpdateBatchPaymentStatus(batchID string, paid bool, status string, markUsed bool) error {
+// UpdateOrderPaymentStatus records the gateway's payment result on the
+// tickets of an order. Ticket states are changed separately through Transition.
+func (r *ticketRepo) UpdateOrderPaymentStatus(orderID int64, status string, markUsed bool) error {
+	return updateOrderPaymentStatus(r.dbCon, orderID, status, markUsed)
+}
+
+func updateOrderPaymentStatus(db sqlx.Execer, orderID int64, status string, markUsed bool) error {
 	query := `
                 UPDATE tickets
-                SET paid_status = $1,
-                    payment_status = $2,
-                    payment_used = CASE WHEN $3 THEN TRUE ELSE payment_used END,
-                    cancelled_at = CASE WHEN $1 = FALSE THEN COALESCE(cancelled_at, NOW()) ELSE cancelled_at END
-                WHERE batch_id = $4
+                SET payment_status = $1,
+                    payment_used = CASE WHEN $2 THEN TRUE ELSE payment_used END,
+                    updated_at = CURRENT_TIMESTAMP
+                WHERE order_id = $3
         `
-	_, err := r.dbCon.Exec(query, paid, status, markUsed, batchID)
+	_, err := db.Exec(query, status, markUsed, orderID)
 	return err
 }
 
-func (r *ticketRepo) CancelTicket(id int64, cancelledAt time.Time, status string) error {
+// Transition moves the selected tickets to t.To and records an event for
+// each. Only tickets in a state allowed to move to t.To are changed, so two
+// concurrent transitions of a ticket cannot both succeed. It returns the IDs
+// of the tickets that moved.
+func (r *ticketRepo) Transition(t ticket.Transition) ([]int64, error) {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids, err := transitionTickets(tx, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// transitionTickets applies t within tx.
+func transitionTickets(tx *sqlx.Tx, t ticket.Transition) ([]int64, error) {
+	from := []string{}
+	for _, state := range t.MovableFrom() {
+		from = append(from, string(state))
+	}
+
+	var registrationNumber *string
+	if t.RegistrationNumber != "" {
+		registrationNumber = &t.RegistrationNumber
+	}
+	var checkedAt *time.Time
+	if !t.CheckedAt.IsZero() {
+		checkedAt = &t.CheckedAt
+	}
+
+	// The old flags are kept in step with the state for existing readers
 	query := `
-                UPDATE tickets
-                SET cancelled_at = $1,
-                    payment_status = $2
-                WHERE id = $3
+                UPDATE tickets t
+                SET status = $1::varchar,
+                    paid_status = CASE WHEN $1::varchar = 'paid' THEN TRUE ELSE t.paid_status END,
+                    payment_status = CASE
+                        WHEN $1::varchar = 'paid' THEN 'paid'
+                        WHEN $1::varchar = 'cancelled' AND t.payment_status = 'paid' THEN 'cancelled'
+                        ELSE t.payment_status
+                    END,
+                    checked = CASE WHEN $1::varchar IN ('checked', 'over_travel_due') THEN TRUE ELSE t.checked END,
+                    cancelled_at = CASE WHEN $1::varchar = 'cancelled' THEN COALESCE(t.cancelled_at, CURRENT_TIMESTAMP) ELSE t.cancelled_at END,
+                    registration_number = COALESCE($2, t.registration_number),
+                    checked_at = COALESCE($3::timestamptz, t.checked_at),
+                    updated_at = CURRENT_TIMESTAMP
+                FROM (
+                    SELECT id, status FROM tickets
+                    WHERE (id = ANY($4::bigint[]) OR order_id = $5::int)
+                      AND status = ANY($6::text[])
+                    FOR UPDATE
+                ) old
+                WHERE t.id = old.id
+                RETURNING t.id, old.status
         `
-	_, err := r.dbCon.Exec(query, cancelledAt, status, id)
-	return err
+	rows, err := tx.Query(query, string(t.To), registrationNumber, checkedAt, pq.Array(t.TicketIDs), t.OrderID, pq.Array(from))
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	var fromStates []string
+	for rows.Next() {
+		var id int64
+		var fromState string
+		if err := rows.Scan(&id, &fromState); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		fromStates = append(fromStates, fromState)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, id := range ids {
+		if err := insertTicketEvent(tx, id, fromStates[i], string(t.To), t.Actor, t.Reason); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
 }
 
-func (r *ticketRepo) ValidateTicket(id int64, registrationNumber string) error {
-	query := `UPDATE tickets SET checked = TRUE, registration_number = $2 WHERE id = $1`
-	_, err := r.dbCon.Exec(query, id, registrationNumber)
+func insertTicketEvent(tx *sqlx.Tx, ticketID int64, from, to, actor, reason string) error {
+	query := `
+                INSERT INTO ticket_events (ticket_id, from_status, to_status, actor, reason)
+                VALUES ($1, $2, $3, $4, $5)
+        `
+	_, err := tx.Exec(query, ticketID, from, to, actor, reason)
 	return err
 }
 
-func (r *ticketRepo) GetBatchCount(batchID string) (int, error) {
-	var count int
-	query := `SELECT COUNT(*) FROM tickets WHERE batch_id = $1`
-	err := r.dbCon.Get(&count, query, batchID)
-	return count, err
+// GetEvents returns the state changes of a ticket, oldest first.
+func (r *ticketRepo) GetEvents(ticketID int64) ([]domain.TicketEvent, error) {
+	events := []domain.TicketEvent{}
+	query := `
+                SELECT id, ticket_id, from_status, to_status, actor, reason, created_at
+                FROM ticket_events
+                WHERE ticket_id = $1
+                ORDER BY id
+        `
+	if err := r.dbCon.Select(&events, query, ticketID); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// IsCheckedBy reports whether a ticket was used by the given bus at checkedAt,
+// which lets a bus re-upload a scan that was already recorded.
+func (r *ticketRepo) IsCheckedBy(id int64, registrationNumber string, checkedAt time.Time) (bool, error) {
+	var ok bool
+	query := `
+                SELECT EXISTS (
+                    SELECT 1 FROM tickets
+                    WHERE id = $1 AND registration_number = $2 AND checked_at = $3::timestamptz
+                )
+        `
+	err := r.dbCon.Get(&ok, query, id, registrationNumber, checkedAt)
+	return ok, err
+}
+
+// GetRouteTicketChanges returns the tickets of a route that are still within
+// their validity window, only those updated after since when it is set, and
+// the database time the result is current as of.
+func (r *ticketRepo) GetRouteTicketChanges(routeID int64, since *time.Time) ([]domain.Ticket, time.Time, error) {
+	var asOf time.Time
+	if err := r.dbCon.Get(&asOf, `SELECT LOCALTIMESTAMP`); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	query := `
+                SELECT * FROM tickets
+                WHERE route_id = $1
+                  AND valid_until > CURRENT_TIMESTAMP
+        `
+	args := []interface{}{routeID}
+	if since != nil {
+		query += ` AND updated_at > $2::timestamp`
+		args = append(args, *since)
+	}
+	query += ` ORDER BY updated_at, id`
+
+	tickets := []domain.Ticket{}
+	if err := r.dbCon.Select(&tickets, query, args...); err != nil {
+		return nil, time.Time{}, err
+	}
+	return tickets, asOf, nil
+}
+
+// GetExpiredTicketIDs returns up to limit tickets whose validity ended
+// before now while they were still unpaid or unused.
+func (r *ticketRepo) GetExpiredTicketIDs(now time.Time, limit int) ([]int64, error) {
+	ids := []int64{}
+	query := `
+                SELECT id FROM tickets
+                WHERE status IN ('pending_payment', 'paid')
+                  AND valid_until <= $1
+                ORDER BY valid_until
+                LIMIT $2
+        `
+	if err := r.dbCon.Select(&ids, query, now, limit); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetUnpaidOrderIDs returns the orders of the given tickets that were never
+// paid.
+func (r *ticketRepo) GetUnpaidOrderIDs(ticketIDs []int64) ([]int64, error) {
+	ids := []int64{}
+	query := `
+                SELECT DISTINCT order_id FROM tickets
+                WHERE id = ANY($1::bigint[]) AND order_id IS NOT NULL AND NOT paid_status
+        `
+	if err := r.dbCon.Select(&ids, query, pq.Array(ticketIDs)); err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
 
 func (r *ticketRepo) GetStop(routeId int64, stopName string) (*domain.Stop, error) {
@@ -198,6 +373,25 @@ func (r *ticketRepo) GetByQRCode(qrCode string) (*domain.Ticket, error) {
 	return &ticket, nil
 }
 
+// SumFares returns what a user was charged for tickets of a type issued
+// since a time, leaving out cancelled and refunded ones and excludeTicketID.
+func (r *ticketRepo) SumFares(userID int64, ticketType string, since time.Time, excludeTicketID int64) (domain.Money, error) {
+	return sumFares(r.dbCon, userID, ticketType, since, excludeTicketID)
+}
+
+func sumFares(db sqlx.Queryer, userID int64, ticketType string, since time.Time, excludeTicketID int64) (domain.Money, error) {
+	var total domain.Money
+	query := `
+		SELECT COALESCE(SUM(fare), 0) FROM tickets
+		WHERE user_id = $1 AND ticket_type = $2 AND valid_from >= $3
+		AND status NOT IN ('cancelled', 'refunded') AND id <> $4
+	`
+	if err := sqlx.Get(db, &total, query, userID, ticketType, since, excludeTicketID); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
 func (r *ticketRepo) GetLatestTicket(userId int64, routeId int64) (*domain.Ticket, error) {
 	var ticket domain.Ticket
 	query := `
@@ -212,3 +406,26 @@ func (r *ticketRepo) GetLatestTicket(userId int64, routeId int64) (*domain.Ticke
 	}
 	return &ticket, nil
 }
+
+// GetBatch returns the tickets issued together under batchID, in issue order.
+func (r *ticketRepo) GetBatch(batchID string) ([]domain.Ticket, error) {
+	tickets := []domain.Ticket{}
+	if err := r.dbCon.Select(&tickets, `SELECT * FROM tickets WHERE batch_id = $1 ORDER BY id`, batchID); err != nil {
+		return nil, err
+	}
+	return tickets, nil
+}
+
+// GetCardCompanions returns the default companion count of the current card
+// with uid, or 0 when there is none.
+func (r *ticketRepo) GetCardCompanions(uid string) (int, error) {
+	var companions int
+	query := `
+		SELECT COALESCE(MAX(companions), 0) FROM cards
+		WHERE uid = $1 AND status IN ('issued', 'active', 'blocked')
+	`
+	if err := r.dbCon.Get(&companions, query, uid); err != nil {
+		return 0, err
+	}
+	return companions, nil
+}
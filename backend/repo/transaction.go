@@ -21,8 +21,13 @@ func NewTransactionRepo(db *sqlx.DB, handler *utils.Handler) *TransactionRepo {
 }
 
 func (r *TransactionRepo) Create(t model.Transaction) error {
+	return insertTransaction(r.db, t)
+}
+
+// insertTransaction adds an entry to a user's wallet statement.
+func insertTransaction(db sqlx.Ext, t model.Transaction) error {
 	query := `INSERT INTO transactions (user_id, amount, type, description, payment_method, created_at) VALUES (:user_id, :amount, :type, :description, :payment_method, :created_at)`
-	_, err := r.db.NamedExec(query, t)
+	_, err := sqlx.NamedExec(db, query, t)
 	return err
 }
 
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/model"
+	"swift_transit/pass"
+	"swift_transit/ticket"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// UnitOfWork runs wallet debits and the records they pay for in one
+// database transaction.
+type UnitOfWork interface {
+	ticket.UnitOfWork
+}
+
+type unitOfWork struct {
+	dbCon *sqlx.DB
+}
+
+func NewUnitOfWork(dbcon *sqlx.DB) UnitOfWork {
+	return &unitOfWork{dbCon: dbcon}
+}
+
+// Do commits what fn wrote if fn returns nil, and rolls it back otherwise.
+func (u *unitOfWork) Do(fn func(tx ticket.Tx) error) error {
+	return inTxScope(u.dbCon, func(t *txScope) error { return fn(t) })
+}
+
+// PassUnitOfWork runs wallet pass purchases in one database transaction.
+type PassUnitOfWork interface {
+	pass.UnitOfWork
+}
+
+type passUnitOfWork struct {
+	dbCon *sqlx.DB
+}
+
+func NewPassUnitOfWork(dbcon *sqlx.DB) PassUnitOfWork {
+	return &passUnitOfWork{dbCon: dbcon}
+}
+
+// Do commits what fn wrote if fn returns nil, and rolls it back otherwise.
+func (u *passUnitOfWork) Do(fn func(tx pass.Tx) error) error {
+	return inTxScope(u.dbCon, func(t *txScope) error { return fn(t) })
+}
+
+func inTxScope(db *sqlx.DB, fn func(t *txScope) error) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&txScope{tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// txScope writes through the transaction of a unit of work, using the same
+// statements as the user, ticket, order, trip, pass and transaction repos.
+type txScope struct {
+	tx *sqlx.Tx
+}
+
+func (t *txScope) LockUser(userID int64) (*domain.User, error) {
+	return lockUser(t.tx, userID)
+}
+
+func (t *txScope) SumFares(userID int64, ticketType string, since time.Time, excludeTicketID int64) (domain.Money, error) {
+	return sumFares(t.tx, userID, ticketType, since, excludeTicketID)
+}
+
+func (t *txScope) DeductBalance(userID int64, amount domain.Money, posting domain.WalletPosting) error {
+	return deductBalance(t.tx, userID, amount, posting)
+}
+
+func (t *txScope) CreditBalance(userID int64, amount domain.Money, posting domain.WalletPosting) error {
+	return creditBalance(t.tx, userID, amount, posting)
+}
+
+func (t *txScope) CreateTicket(tk *domain.Ticket, actor, reason string) error {
+	return insertTicket(t.tx, tk, actor, reason)
+}
+
+func (t *txScope) CreateOrder(o *domain.Order, actor, reason string) error {
+	return insertOrder(t.tx, o, actor, reason)
+}
+
+func (t *txScope) CreateRFIDTrip(trip *domain.RFIDTrip, tk *domain.Ticket, actor, reason string) error {
+	return insertRFIDTrip(t.tx, trip, tk, actor, reason)
+}
+
+func (t *txScope) CompleteRFIDTrip(trip domain.RFIDTrip, tk domain.Ticket) (bool, error) {
+	return completeRFIDTrip(t.tx, trip, tk)
+}
+
+func (t *txScope) CreateTransaction(tr model.Transaction) error {
+	return insertTransaction(t.tx, tr)
+}
+
+func (t *txScope) Transition(tr ticket.Transition) ([]int64, error) {
+	return transitionTickets(t.tx, tr)
+}
+
+func (t *txScope) SettlePaymentAttempt(tranID, status string) (bool, error) {
+	return settlePaymentAttempt(t.tx, tranID, status)
+}
+
+func (t *txScope) UpdateOrderStatus(orderID int64, status string) error {
+	return updateOrderStatus(t.tx, orderID, status)
+}
+
+func (t *txScope) UpdateOrderPaymentStatus(orderID int64, status string, markUsed bool) error {
+	return updateOrderPaymentStatus(t.tx, orderID, status, markUsed)
+}
+
+func (t *txScope) RedeemPromo(r *domain.PromoRedemption) error {
+	return insertPromoRedemption(t.tx, r)
+}
+
+func (t *txScope) AddOrderRefund(orderID, ticketID int64, amount domain.Money) error {
+	return addOrderRefund(t.tx, orderID, ticketID, amount)
+}
+
+func (t *txScope) CreatePass(p *domain.Pass) error {
+	return insertPass(t.tx, p)
+}
+
+func (t *txScope) ActivatePass(id int64, from, until time.Time) (bool, error) {
+	return activatePass(t.tx, id, from, until)
+}
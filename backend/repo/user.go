@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"swift_transit/domain"
+	"swift_transit/ledger"
 	"swift_transit/user"
 	"swift_transit/utils"
 
@@ -67,14 +68,21 @@ func (r *userRepo) Create(user domain.User) (*domain.User, error) {
 		return nil, err
 	}
 
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The wallet starts empty; the opening balance is posted to the ledger
 	query := `
 		INSERT INTO users (name, mobile, nid, email, password, is_student, balance)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		VALUES ($1, $2, $3, $4, $5, $6, 0)
 		RETURNING id, name, mobile, nid, email, is_student, balance, rfid, is_rfid_active
 	`
 
 	createdUser := domain.User{}
-	err = r.dbCon.Get(
+	err = tx.Get(
 		&createdUser,
 		query,
 		user.Name,
@@ -83,12 +91,27 @@ func (r *userRepo) Create(user domain.User) (*domain.User, error) {
 		user.Email,
 		string(hashedPassword),
 		user.IsStudent,
-		user.Balance,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if user.Balance != 0 {
+		err := creditBalance(tx, createdUser.Id, user.Balance, domain.WalletPosting{
+			Account:     ledger.AccountAdjustments,
+			Kind:        ledger.KindOpening,
+			Description: "Opening balance",
+			Reference:   fmt.Sprintf("user:%d", createdUser.Id),
+		})
+		if err != nil {
+			return nil, err
+		}
+		createdUser.Balance = user.Balance
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return &createdUser, nil
 }
 
@@ -116,34 +139,60 @@ func (r *userRepo) Find(mobile, password string) (*domain.User, error) {
 	return &user, nil
 }
 
-func (r *userRepo) DeductBalance(id int64, amount float64) error {
+func (r *userRepo) DeductBalance(id int64, amount domain.Money, posting domain.WalletPosting) error {
 	tx, err := r.dbCon.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	var balance float64
-	err = tx.Get(&balance, "SELECT balance FROM users WHERE id = $1 FOR UPDATE", id)
+	if err := deductBalance(tx, id, amount, posting); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *userRepo) CreditBalance(id int64, amount domain.Money, posting domain.WalletPosting) error {
+	tx, err := r.dbCon.Beginx()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if balance < amount {
-		return fmt.Errorf("insufficient balance")
+	if err := creditBalance(tx, id, amount, posting); err != nil {
+		return err
 	}
+	return tx.Commit()
+}
+
+// lockUser reads a user, keeping the row locked until tx ends.
+func lockUser(tx *sqlx.Tx, id int64) (*domain.User, error) {
+	user := domain.User{}
+	query := `SELECT id, name, mobile, nid, email, is_student, balance, rfid, is_rfid_active FROM users WHERE id = $1 FOR UPDATE`
+	if err := tx.Get(&user, query, id); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
 
-	_, err = tx.Exec("UPDATE users SET balance = balance - $1 WHERE id = $2", amount, id)
+// deductBalance takes amount from a user's wallet, failing if the balance
+// does not cover it. The user row stays locked until tx ends.
+func deductBalance(tx *sqlx.Tx, id int64, amount domain.Money, posting domain.WalletPosting) error {
+	var balance domain.Money
+	err := tx.Get(&balance, "SELECT balance FROM users WHERE id = $1 FOR UPDATE", id)
 	if err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	if balance < amount {
+		return domain.ErrInsufficientBalance
+	}
+
+	return postWalletChange(tx, id, -amount, posting)
 }
 
-func (r *userRepo) CreditBalance(id int64, amount float64) error {
-	_, err := r.dbCon.Exec("UPDATE users SET balance = balance + $1 WHERE id = $2", amount, id)
-	return err
+func creditBalance(tx *sqlx.Tx, id int64, amount domain.Money, posting domain.WalletPosting) error {
+	return postWalletChange(tx, id, amount, posting)
 }
 
 func (r *userRepo) UpdatePassword(email, newPassword string) error {
@@ -227,7 +276,17 @@ func (r *userRepo) FindByRFID(rfid string) (*domain.User, error) {
 	return &user, nil
 }
 
-func (r *userRepo) ToggleRFIDStatus(userID int64, active bool) error {
-	_, err := r.dbCon.Exec("UPDATE users SET is_rfid_active = $1 WHERE id = $2", active, userID)
-	return err
+// GetSharedGuardian returns the guardian whose wallet a dependent's RFID
+// taps may draw from, or sql.ErrNoRows when there is none.
+func (r *userRepo) GetSharedGuardian(dependentID int64) (*domain.User, error) {
+	user := domain.User{}
+	query := `
+		SELECT u.id, u.name, u.mobile, u.email, u.is_student, u.balance FROM users u
+		JOIN family_members f ON f.guardian_id = u.id
+		WHERE f.dependent_id = $1 AND f.status = 'active' AND f.shared_wallet
+	`
+	if err := r.dbCon.Get(&user, query, dependentID); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
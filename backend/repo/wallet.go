@@ -0,0 +1,329 @@
+package repo
+
+import (
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/ledger"
+	"swift_transit/model"
+	"swift_transit/utils"
+	"swift_transit/wallet"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type WalletRepo interface {
+	wallet.Repo
+}
+
+type walletRepo struct {
+	dbCon       *sqlx.DB
+	utilHandler *utils.Handler
+}
+
+func NewWalletRepo(dbcon *sqlx.DB, utilHandler *utils.Handler) WalletRepo {
+	return &walletRepo{
+		dbCon:       dbcon,
+		utilHandler: utilHandler,
+	}
+}
+
+func (r *walletRepo) GetUser(id int64) (*domain.User, error) {
+	var user domain.User
+	query := `SELECT id, name, mobile, email, is_student, balance FROM users WHERE id = $1`
+	if err := r.dbCon.Get(&user, query, id); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *walletRepo) FindUserByMobile(mobile string) (*domain.User, error) {
+	var user domain.User
+	query := `SELECT id, name, mobile, email, is_student, balance FROM users WHERE mobile = $1`
+	if err := r.dbCon.Get(&user, query, mobile); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Transfer moves t.Amount from the sender's wallet to the recipient's as one
+// ledger entry, records it, and adds it to both statements. It fails when
+// the sender's balance does not cover it or it would take them past
+// dailyLimit for what they sent since a time. Both users stay locked until
+// it commits, so concurrent transfers cannot overspend.
+func (r *walletRepo) Transfer(t *domain.WalletTransfer, dailyLimit domain.Money, since time.Time) error {
+	tx, err := r.dbCon.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var users []domain.User
+	lockQuery := `SELECT id, name, mobile, balance FROM users WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`
+	if err := tx.Select(&users, lockQuery, t.SenderId, t.RecipientId); err != nil {
+		return err
+	}
+	var sender, recipient *domain.User
+	for i := range users {
+		switch users[i].Id {
+		case t.SenderId:
+			sender = &users[i]
+		case t.RecipientId:
+			recipient = &users[i]
+		}
+	}
+	if sender == nil || recipient == nil {
+		return fmt.Errorf("user not found")
+	}
+	if sender.Balance < t.Amount {
+		return fmt.Errorf("insufficient balance")
+	}
+
+	var sent domain.Money
+	if err := tx.Get(&sent, sumSentQuery, t.SenderId, since); err != nil {
+		return err
+	}
+	if sent+t.Amount > dailyLimit {
+		return fmt.Errorf("daily transfer limit of %s reached", dailyLimit)
+	}
+
+	err = tx.QueryRowx(`
+                INSERT INTO wallet_transfers (sender_id, recipient_id, amount, note)
+                VALUES ($1, $2, $3, $4)
+                RETURNING id, created_at
+        `, t.SenderId, t.RecipientId, t.Amount, t.Note).Scan(&t.Id, &t.CreatedAt)
+	if err != nil {
+		return err
+	}
+	t.SenderName = sender.Name
+	t.RecipientName = recipient.Name
+	t.RecipientMobile = recipient.Mobile
+
+	err = postWalletTransfer(tx, t.SenderId, t.RecipientId, t.Amount, domain.WalletPosting{
+		Kind:        ledger.KindTransfer,
+		Description: fmt.Sprintf("Transfer from %s to %s", sender.Name, recipient.Name),
+		Reference:   fmt.Sprintf("transfer:%d", t.Id),
+	})
+	if err != nil {
+		return err
+	}
+
+	statement := []model.Transaction{
+		{
+			UserID:        int(t.SenderId),
+			Amount:        t.Amount,
+			Type:          "debit",
+			Description:   fmt.Sprintf("Transfer to %s (%s)", recipient.Name, recipient.Mobile),
+			PaymentMethod: "Transfer",
+			CreatedAt:     t.CreatedAt,
+		},
+		{
+			UserID:        int(t.RecipientId),
+			Amount:        t.Amount,
+			Type:          "credit",
+			Description:   fmt.Sprintf("Transfer from %s (%s)", sender.Name, sender.Mobile),
+			PaymentMethod: "Transfer",
+			CreatedAt:     t.CreatedAt,
+		},
+	}
+	for _, entry := range statement {
+		if err := insertTransaction(tx, entry); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const sumSentQuery = `SELECT COALESCE(SUM(amount), 0) FROM wallet_transfers WHERE sender_id = $1 AND created_at >= $2`
+
+// SumSent returns what a user sent to other wallets since a time.
+func (r *walletRepo) SumSent(senderID int64, since time.Time) (domain.Money, error) {
+	var sent domain.Money
+	err := r.dbCon.Get(&sent, sumSentQuery, senderID, since)
+	return sent, err
+}
+
+// ListTransfers returns a page of the transfers a user sent or received,
+// newest first.
+func (r *walletRepo) ListTransfers(userID int64, limit, offset int) ([]domain.WalletTransfer, int, error) {
+	var total int
+	if err := r.dbCon.Get(&total, `SELECT COUNT(*) FROM wallet_transfers WHERE sender_id = $1 OR recipient_id = $1`, userID); err != nil {
+		return nil, 0, err
+	}
+
+	transfers := []domain.WalletTransfer{}
+	query := `
+                SELECT t.id, t.sender_id, s.name AS sender_name, t.recipient_id, r.name AS recipient_name,
+                        r.mobile AS recipient_mobile, t.amount, t.note, t.created_at
+                FROM wallet_transfers t
+                JOIN users s ON s.id = t.sender_id
+                JOIN users r ON r.id = t.recipient_id
+                WHERE t.sender_id = $1 OR t.recipient_id = $1
+                ORDER BY t.id DESC
+                LIMIT $2 OFFSET $3
+        `
+	if err := r.dbCon.Select(&transfers, query, userID, limit, offset); err != nil {
+		return nil, 0, err
+	}
+	return transfers, total, nil
+}
+
+const memberQuery = `
+                SELECT f.id, f.guardian_id, g.name AS guardian_name, f.dependent_id, d.name AS dependent_name,
+                        d.mobile AS dependent_mobile, f.status, f.shared_wallet, f.created_at, f.accepted_at
+                FROM family_members f
+                JOIN users g ON g.id = f.guardian_id
+                JOIN users d ON d.id = f.dependent_id
+        `
+
+// CreateMember invites a dependent to a guardian's family. It returns
+// sql.ErrNoRows when the guardian already invited them.
+func (r *walletRepo) CreateMember(guardianID, dependentID int64) (*domain.FamilyMember, error) {
+	var id int64
+	err := r.dbCon.Get(&id, `
+                INSERT INTO family_members (guardian_id, dependent_id) VALUES ($1, $2)
+                ON CONFLICT (guardian_id, dependent_id) DO NOTHING
+                RETURNING id
+        `, guardianID, dependentID)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetMember(id)
+}
+
+func (r *walletRepo) GetMember(id int64) (*domain.FamilyMember, error) {
+	var member domain.FamilyMember
+	if err := r.dbCon.Get(&member, memberQuery+` WHERE f.id = $1`, id); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *walletRepo) GetActiveMember(guardianID, dependentID int64) (*domain.FamilyMember, error) {
+	var member domain.FamilyMember
+	query := memberQuery + ` WHERE f.guardian_id = $1 AND f.dependent_id = $2 AND f.status = 'active'`
+	if err := r.dbCon.Get(&member, query, guardianID, dependentID); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// ListMembers returns the family links a user is on either side of.
+func (r *walletRepo) ListMembers(userID int64) ([]domain.FamilyMember, error) {
+	members := []domain.FamilyMember{}
+	query := memberQuery + ` WHERE f.guardian_id = $1 OR f.dependent_id = $1 ORDER BY f.id`
+	if err := r.dbCon.Select(&members, query, userID); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *walletRepo) CountDependents(guardianID int64) (int, error) {
+	var count int
+	err := r.dbCon.Get(&count, `SELECT COUNT(*) FROM family_members WHERE guardian_id = $1`, guardianID)
+	return count, err
+}
+
+// ActivateMember accepts an invite. It reports false when the dependent
+// already has an active guardian.
+func (r *walletRepo) ActivateMember(id int64) (bool, error) {
+	res, err := r.dbCon.Exec(`
+                UPDATE family_members f SET status = 'active', accepted_at = CURRENT_TIMESTAMP
+                WHERE f.id = $1 AND f.status = 'invited'
+                AND NOT EXISTS (SELECT 1 FROM family_members a WHERE a.dependent_id = f.dependent_id AND a.status = 'active')
+        `, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *walletRepo) DeleteMember(id int64) error {
+	_, err := r.dbCon.Exec(`DELETE FROM family_members WHERE id = $1`, id)
+	return err
+}
+
+func (r *walletRepo) SetSharedWallet(id int64, shared bool) error {
+	_, err := r.dbCon.Exec(`UPDATE family_members SET shared_wallet = $2 WHERE id = $1`, id, shared)
+	return err
+}
+
+const balanceAlertColumns = `user_id, threshold, auto_topup_amount, triggered_at, topup_tran_id, updated_at`
+
+func (r *walletRepo) GetBalanceAlert(userID int64) (*domain.BalanceAlert, error) {
+	var alert domain.BalanceAlert
+	query := `SELECT ` + balanceAlertColumns + ` FROM balance_alerts WHERE user_id = $1`
+	if err := r.dbCon.Get(&alert, query, userID); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// UpsertBalanceAlert sets a user's alert and re-arms it.
+func (r *walletRepo) UpsertBalanceAlert(userID int64, threshold domain.Money, autoTopUp *domain.Money) (*domain.BalanceAlert, error) {
+	var alert domain.BalanceAlert
+	err := r.dbCon.Get(&alert, `
+                INSERT INTO balance_alerts (user_id, threshold, auto_topup_amount)
+                VALUES ($1, $2, $3)
+                ON CONFLICT (user_id) DO UPDATE SET
+                        threshold = EXCLUDED.threshold,
+                        auto_topup_amount = EXCLUDED.auto_topup_amount,
+                        triggered_at = NULL,
+                        topup_tran_id = NULL,
+                        updated_at = CURRENT_TIMESTAMP
+                RETURNING `+balanceAlertColumns, userID, threshold, autoTopUp)
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func (r *walletRepo) DeleteBalanceAlert(userID int64) error {
+	_, err := r.dbCon.Exec(`DELETE FROM balance_alerts WHERE user_id = $1`, userID)
+	return err
+}
+
+// ResetBalanceAlerts re-arms the alerts of users whose balance is back at or
+// above their threshold.
+func (r *walletRepo) ResetBalanceAlerts() (int, error) {
+	res, err := r.dbCon.Exec(`
+                UPDATE balance_alerts a SET triggered_at = NULL, topup_tran_id = NULL
+                FROM users u
+                WHERE u.id = a.user_id AND a.triggered_at IS NOT NULL AND u.balance >= a.threshold
+        `)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// ClaimLowBalances marks as fired, and returns, up to limit armed alerts of
+// users whose balance is below their threshold. Rows claimed by a concurrent
+// run are skipped.
+func (r *walletRepo) ClaimLowBalances(now time.Time, limit int) ([]wallet.LowBalance, error) {
+	users := []wallet.LowBalance{}
+	query := `
+                UPDATE balance_alerts a SET triggered_at = $1
+                FROM users u
+                WHERE u.id = a.user_id AND a.triggered_at IS NULL AND a.user_id IN (
+                        SELECT b.user_id FROM balance_alerts b
+                        JOIN users bu ON bu.id = b.user_id
+                        WHERE b.triggered_at IS NULL AND bu.balance < b.threshold
+                        LIMIT $2
+                        FOR UPDATE OF b SKIP LOCKED
+                )
+                RETURNING a.user_id, u.name, u.email, u.balance, a.threshold, a.auto_topup_amount
+        `
+	if err := r.dbCon.Select(&users, query, now, limit); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *walletRepo) SetTopUpTranID(userID int64, tranID string) error {
+	_, err := r.dbCon.Exec(`UPDATE balance_alerts SET topup_tran_id = $2 WHERE user_id = $1`, userID, tranID)
+	return err
+}
@@ -5,10 +5,15 @@ import (
 	"swift_transit/rest/handlers/admin"
 	"swift_transit/rest/handlers/bus"
 	"swift_transit/rest/handlers/bus_owner"
+	"swift_transit/rest/handlers/card"
+	"swift_transit/rest/handlers/ledger"
+	"swift_transit/rest/handlers/pass"
+	"swift_transit/rest/handlers/promo"
 	"swift_transit/rest/handlers/route"
 	"swift_transit/rest/handlers/ticket"
 	"swift_transit/rest/handlers/transaction"
 	"swift_transit/rest/handlers/user"
+	"swift_transit/rest/handlers/wallet"
 	"swift_transit/rest/middlewares"
 )
 
@@ -22,9 +27,14 @@ type Handler struct {
 	transactionHandler *transaction.Handler
 	busOwnerHandler    *bus_owner.Handler
 	adminHandler       *admin.Handler
+	passHandler        *pass.Handler
+	cardHandler        *card.Handler
+	ledgerHandler      *ledger.Handler
+	walletHandler      *wallet.Handler
+	promoHandler       *promo.Handler
 }
 
-func NewHandler(cnf *config.Config, mdlw *middlewares.Handler, userHandler *user.Handler, routeHandler *route.Handler, busHandler *bus.Handler, ticketHandler *ticket.Handler, transactionHandler *transaction.Handler, busOwnerHandler *bus_owner.Handler, adminHandler *admin.Handler) *Handler {
+func NewHandler(cnf *config.Config, mdlw *middlewares.Handler, userHandler *user.Handler, routeHandler *route.Handler, busHandler *bus.Handler, ticketHandler *ticket.Handler, transactionHandler *transaction.Handler, busOwnerHandler *bus_owner.Handler, adminHandler *admin.Handler, passHandler *pass.Handler, cardHandler *card.Handler, ledgerHandler *ledger.Handler, walletHandler *wallet.Handler, promoHandler *promo.Handler) *Handler {
 	return &Handler{
 		cnf:                cnf,
 		mdlw:               mdlw,
@@ -35,5 +45,10 @@ func NewHandler(cnf *config.Config, mdlw *middlewares.Handler, userHandler *user
 		transactionHandler: transactionHandler,
 		busOwnerHandler:    busOwnerHandler,
 		adminHandler:       adminHandler,
+		passHandler:        passHandler,
+		cardHandler:        cardHandler,
+		ledgerHandler:      ledgerHandler,
+		walletHandler:      walletHandler,
+		promoHandler:       promoHandler,
 	}
 }
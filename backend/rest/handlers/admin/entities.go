@@ -220,6 +220,23 @@ func (h *Handler) GetAllTickets(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusOK)
 }
 
+func (h *Handler) GetTicketHistory(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.svc.GetTicketHistory(id)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.utilHandler.SendData(w, events, http.StatusOK)
+}
+
 // Transactions
 func (h *Handler) GetAllTransactions(w http.ResponseWriter, r *http.Request) {
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
@@ -2,6 +2,7 @@ package admin
 
 import (
 	"swift_transit/admin"
+	"swift_transit/location"
 	"swift_transit/rest/middlewares"
 	"swift_transit/utils"
 )
@@ -11,13 +12,15 @@ type Handler struct {
 	utilHandler       *utils.Handler
 	middlewareHandler *middlewares.Handler
 	mngr              *middlewares.Manager
+	hub               *location.Hub
 }
 
-func NewHandler(svc admin.Service, utilHandler *utils.Handler, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager) *Handler {
+func NewHandler(svc admin.Service, utilHandler *utils.Handler, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, hub *location.Hub) *Handler {
 	return &Handler{
 		svc:               svc,
 		utilHandler:       utilHandler,
 		middlewareHandler: middlewareHandler,
 		mngr:              mngr,
+		hub:               hub,
 	}
 }
@@ -0,0 +1,9 @@
+package admin
+
+import (
+	"net/http"
+)
+
+func (h *Handler) GetRealtimeMetrics(w http.ResponseWriter, r *http.Request) {
+	h.utilHandler.SendData(w, h.hub.Metrics(), http.StatusOK)
+}
@@ -10,6 +10,9 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// Dashboard
 	mux.Handle("GET /admin/dashboard/stats", h.mngr.With(http.HandlerFunc(h.GetDashboardStats), h.middlewareHandler.Authenticate))
 
+	// Realtime
+	mux.Handle("GET /admin/realtime/metrics", h.mngr.With(http.HandlerFunc(h.GetRealtimeMetrics), h.middlewareHandler.Authenticate))
+
 	// Users
 	mux.Handle("GET /admin/users", h.mngr.With(http.HandlerFunc(h.GetAllUsers), h.middlewareHandler.Authenticate))
 	mux.Handle("GET /admin/users/{id}", h.mngr.With(http.HandlerFunc(h.GetUserByID), h.middlewareHandler.Authenticate))
@@ -33,6 +36,7 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 
 	// Tickets
 	mux.Handle("GET /admin/tickets", h.mngr.With(http.HandlerFunc(h.GetAllTickets), h.middlewareHandler.Authenticate))
+	mux.Handle("GET /admin/tickets/{id}/history", h.mngr.With(http.HandlerFunc(h.GetTicketHistory), h.middlewareHandler.Authenticate))
 
 	// Transactions
 	mux.Handle("GET /admin/transactions", h.mngr.With(http.HandlerFunc(h.GetAllTransactions), h.middlewareHandler.Authenticate))
@@ -28,10 +28,10 @@ func (h *Handler) CheckTicket(w http.ResponseWriter, r *http.Request) {
 	req.BusName = busData.RegistrationNumber
 	req.RegistrationNumber = busData.RegistrationNumber
 
-	result, err := h.svc.CheckTicket(req)
+	// Rejections come back as a status in the result; errors are internal failures
+	result, err := h.ticketService.CheckTicket(req)
 	if err != nil {
-		// Return JSON error even for bad requests so frontend can parse "message"
-		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		h.utilHandler.SendError(w, "Failed to check ticket", http.StatusInternalServerError)
 		return
 	}
 
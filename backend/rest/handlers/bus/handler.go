@@ -1,6 +1,8 @@
 package bus
 
 import (
+	"swift_transit/card"
+	"swift_transit/config"
 	"swift_transit/location" // Added import for location package
 	"swift_transit/rest/middlewares"
 	"swift_transit/ticket"
@@ -28,20 +30,24 @@ type AuthResponse struct {
 type Handler struct {
 	svc               Service
 	ticketService     ticket.Service
+	cardService       card.Service
 	middlewareHandler *middlewares.Handler
 	mngr              *middlewares.Manager
 	utilHandler       *utils.Handler
 	hub               *location.Hub // Added Hub field
+	mqttCnf           config.MQTTConfig
 }
 
-func NewHandler(svc Service, ticketService ticket.Service, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, utilHandler *utils.Handler, hub *location.Hub) *Handler {
+func NewHandler(svc Service, ticketService ticket.Service, cardService card.Service, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, utilHandler *utils.Handler, hub *location.Hub, mqttCnf config.MQTTConfig) *Handler {
 	return &Handler{
 		svc:               svc,
 		ticketService:     ticketService,
+		cardService:       cardService,
 		middlewareHandler: middlewareHandler,
 		mngr:              mngr,
 		utilHandler:       utilHandler,
 		hub:               hub, // Initialized Hub field
+		mqttCnf:           mqttCnf,
 	}
 }
 
@@ -0,0 +1,50 @@
+package bus
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Hotlist lets a bus reader download the RFID cards it must refuse while
+// offline. Without since it gets every refused card; with the version of a
+// previous hotlist it gets the cards that changed since. Readers asking for
+// application/octet-stream, or passing format=binary, get the compact
+// binary encoding instead of JSON.
+func (h *Handler) Hotlist(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.BusFromContext(r); err != nil {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var since int64
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			h.utilHandler.SendError(w, "since must be the version of a previous hotlist", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	hotlist, err := h.cardService.Hotlist(since)
+	if err != nil {
+		h.utilHandler.SendError(w, "Failed to build hotlist", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "binary" || strings.Contains(r.Header.Get("Accept"), "application/octet-stream") {
+		data, err := hotlist.MarshalBinary()
+		if err != nil {
+			h.utilHandler.SendError(w, "Failed to encode hotlist", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Hotlist-Version", strconv.FormatInt(hotlist.Version, 10))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+
+	h.utilHandler.SendData(w, hotlist, http.StatusOK)
+}
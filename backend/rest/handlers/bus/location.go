@@ -2,28 +2,52 @@ package bus
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
-	"strconv"
+	"sort"
 	"swift_transit/location"
+	"time"
 )
 
+// LocationSocket streams positions of the routes in the query. Connections
+// that present a bus token may also publish their own position, on the route
+// of their session; every update goes through the same validation as
+// POST /bus/location.
 func (h *Handler) LocationSocket(w http.ResponseWriter, r *http.Request) {
-	// Bus connects to this endpoint to send location updates
-	// We expect route_id in query params
-	routeIDStr := r.URL.Query().Get("route_id")
-	if routeIDStr == "" {
-		h.utilHandler.SendError(w, "route_id is required", http.StatusBadRequest)
+	if r.Header.Get("Authorization") != "" {
+		h.middlewareHandler.Authenticate(http.HandlerFunc(h.busLocationSocket)).ServeHTTP(w, r)
 		return
 	}
 
-	routeID, err := strconv.ParseInt(routeIDStr, 10, 64)
+	routeIDs, err := location.RouteIDsFromQuery(r.URL.Query())
 	if err != nil {
-		h.utilHandler.SendError(w, "invalid route_id", http.StatusBadRequest)
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(routeIDs) == 0 {
+		h.utilHandler.SendError(w, "route_id is required", http.StatusBadRequest)
 		return
 	}
 
 	// Upgrade to WebSocket
-	location.ServeWs(h.hub, w, r, routeID, true)
+	location.ServeWs(h.hub, w, r, routeIDs, nil)
+}
+
+func (h *Handler) busLocationSocket(w http.ResponseWriter, r *http.Request) {
+	busData, err := h.BusFromContext(r)
+	if err != nil || busData.Id == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if busData.RouteId == 0 {
+		h.utilHandler.SendError(w, "bus has no route configured", http.StatusBadRequest)
+		return
+	}
+
+	routeIDs := []int64{busData.RouteId}
+	location.ServeWs(h.hub, w, r, routeIDs, func(update *location.LocationUpdate) error {
+		return h.svc.ValidateLocation(busData.Id, routeIDs, update)
+	})
 }
 
 func (h *Handler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
@@ -39,12 +63,103 @@ func (h *Handler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Basic validation
-	if update.BusID == 0 {
-		update.BusID = busData.Id
-	}
+	// The route always comes from the bus session
 	update.RouteID = busData.RouteId
+	if err := h.svc.ValidateLocation(busData.Id, []int64{busData.RouteId}, &update); err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if update.RecordedAt.IsZero() {
+		update.RecordedAt = time.Now()
+	}
+	if _, err := h.svc.RecordLocations(busData.Id, []location.LocationUpdate{update}); err != nil {
+		h.utilHandler.SendError(w, "Failed to save location", http.StatusInternalServerError)
+		return
+	}
 
 	h.hub.BroadcastLocation(update)
 	h.utilHandler.SendData(w, "Location updated", http.StatusOK)
 }
+
+// Maximum number of points accepted in one batch upload
+const maxBatchPoints = 500
+
+type LocationBatchRequest struct {
+	// Points buffered by the device, each with its recorded_at
+	Points []location.LocationUpdate `json:"points"`
+}
+
+type LocationBatchResponse struct {
+	Accepted    int64 `json:"accepted"`
+	Duplicates  int64 `json:"duplicates"`
+	Rejected    int   `json:"rejected"`
+	LiveUpdated bool  `json:"live_updated"`
+}
+
+// UpdateLocationBatch stores positions a bus buffered while offline. All
+// points go to the location history; only the newest one is broadcast, and
+// only if it is newer than the bus's current live position.
+func (h *Handler) UpdateLocationBatch(w http.ResponseWriter, r *http.Request) {
+	var req LocationBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Points) == 0 {
+		h.utilHandler.SendError(w, "points is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Points) > maxBatchPoints {
+		h.utilHandler.SendError(w, fmt.Sprintf("at most %d points can be uploaded at once", maxBatchPoints), http.StatusBadRequest)
+		return
+	}
+
+	busData, err := h.BusFromContext(r)
+	if err != nil {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var resp LocationBatchResponse
+
+	// Validate and deduplicate by timestamp; a repeated point replaces the earlier one
+	byTime := make(map[int64]location.LocationUpdate)
+	for _, point := range req.Points {
+		if point.RecordedAt.IsZero() {
+			resp.Rejected++
+			continue
+		}
+		point.RouteID = busData.RouteId
+		if err := h.svc.ValidateLocation(busData.Id, []int64{busData.RouteId}, &point); err != nil {
+			resp.Rejected++
+			continue
+		}
+		key := point.RecordedAt.UnixNano()
+		if _, ok := byTime[key]; ok {
+			resp.Duplicates++
+		}
+		byTime[key] = point
+	}
+
+	points := make([]location.LocationUpdate, 0, len(byTime))
+	for _, point := range byTime {
+		points = append(points, point)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].RecordedAt.Before(points[j].RecordedAt) })
+
+	inserted, err := h.svc.RecordLocations(busData.Id, points)
+	if err != nil {
+		h.utilHandler.SendError(w, "Failed to save locations", http.StatusInternalServerError)
+		return
+	}
+	resp.Accepted = inserted
+	resp.Duplicates += int64(len(points)) - inserted
+
+	if len(points) > 0 {
+		resp.LiveUpdated = h.hub.BroadcastLocation(points[len(points)-1])
+	}
+
+	h.utilHandler.SendData(w, resp, http.StatusOK)
+}
@@ -0,0 +1,134 @@
+package bus
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// Access levels sent by the broker in ACL checks
+const (
+	mqttAccessRead      = 1
+	mqttAccessWrite     = 2
+	mqttAccessSubscribe = 4
+)
+
+// MQTTAuthRequest is the body the broker's HTTP auth plugin (e.g.
+// mosquitto-go-auth with http_params_mode=json) posts for every check. The
+// broker treats 200 as allow and any other status as deny.
+type MQTTAuthRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	ClientID string `json:"clientid"`
+	Topic    string `json:"topic"`
+	Acc      int    `json:"acc"`
+}
+
+// MQTTAuth authenticates a broker connection. Trackers log in with their bus
+// registration number and password from bus_credentials.
+func (h *Handler) MQTTAuth(w http.ResponseWriter, r *http.Request) {
+	var req MQTTAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if h.isBackendUser(req.Username) {
+		if subtle.ConstantTimeCompare([]byte(req.Password), []byte(h.mqttCnf.Password)) != 1 {
+			h.utilHandler.SendError(w, "Invalid credentials", http.StatusForbidden)
+			return
+		}
+		h.utilHandler.SendData(w, "ok", http.StatusOK)
+		return
+	}
+
+	if _, err := h.svc.AuthenticateDevice(req.Username, req.Password); err != nil {
+		h.utilHandler.SendError(w, "Invalid credentials", http.StatusForbidden)
+		return
+	}
+	h.utilHandler.SendData(w, "ok", http.StatusOK)
+}
+
+// MQTTSuperuser grants the backend's own account access to every topic.
+func (h *Handler) MQTTSuperuser(w http.ResponseWriter, r *http.Request) {
+	var req MQTTAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !h.isBackendUser(req.Username) {
+		h.utilHandler.SendError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	h.utilHandler.SendData(w, "ok", http.StatusOK)
+}
+
+// MQTTACL lets a tracker publish to its own location topic and nothing else.
+func (h *Handler) MQTTACL(w http.ResponseWriter, r *http.Request) {
+	var req MQTTAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if h.isBackendUser(req.Username) {
+		h.utilHandler.SendData(w, "ok", http.StatusOK)
+		return
+	}
+
+	if req.Username == "" || req.Acc != mqttAccessWrite || req.Topic != "buses/"+req.Username+"/location" {
+		h.utilHandler.SendError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	h.utilHandler.SendData(w, "ok", http.StatusOK)
+}
+
+// brokerOnly lets only the MQTT broker reach its auth endpoints: requests
+// must carry the shared secret when one is configured, and otherwise come
+// from an allowed address. Without it anyone could probe bus passwords.
+func (h *Handler) brokerOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.mqttCnf.AuthSecret != "" {
+			secret := r.Header.Get("X-MQTT-Auth-Secret")
+			if subtle.ConstantTimeCompare([]byte(secret), []byte(h.mqttCnf.AuthSecret)) != 1 {
+				h.utilHandler.SendError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !h.fromAllowedIP(r) {
+			h.utilHandler.SendError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// fromAllowedIP reports whether the request's peer address, not any
+// forwarded-for header, is in the broker allow-list.
+func (h *Handler) fromAllowedIP(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range h.mqttCnf.AuthAllowedIPs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) isBackendUser(username string) bool {
+	return h.mqttCnf.Username != "" && username == h.mqttCnf.Username
+}
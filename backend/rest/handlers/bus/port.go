@@ -3,7 +3,7 @@ package bus
 import (
 	"swift_transit/bus" // Added import
 	"swift_transit/domain"
-	"swift_transit/ticket"
+	"swift_transit/location"
 )
 
 type Service interface {
@@ -11,5 +11,7 @@ type Service interface {
 	Login(regNum, password string, variant string) (*bus.BusLoginResult, error)
 	Register(regNum, password string, routeIdUp, routeIdDown int64) (*domain.BusCredential, error)
 	ValidateTicket(ticketID int64, routeID int64, busName string) error
-	CheckTicket(req ticket.CheckTicketRequest) (map[string]interface{}, error)
+	AuthenticateDevice(regNum, password string) (*domain.BusCredential, error)
+	ValidateLocation(busID int64, routeIDs []int64, update *location.LocationUpdate) error
+	RecordLocations(busID int64, updates []location.LocationUpdate) (int64, error)
 }
@@ -10,6 +10,15 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("POST /bus/auth/register", h.mngr.With(http.HandlerFunc(h.Register)))
 	mux.Handle("POST /bus/validate", h.mngr.With(http.HandlerFunc(h.ValidateTicket), h.middlewareHandler.Authenticate))
 	mux.Handle("POST /bus/check-ticket", h.mngr.With(http.HandlerFunc(h.CheckTicket), h.middlewareHandler.Authenticate))
+	mux.Handle("GET /bus/manifest", h.mngr.With(http.HandlerFunc(h.Manifest), h.middlewareHandler.Authenticate))
+	mux.Handle("GET /bus/hotlist", h.mngr.With(http.HandlerFunc(h.Hotlist), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /bus/scans/sync", h.mngr.With(http.HandlerFunc(h.SyncScans), h.middlewareHandler.Authenticate))
 	mux.Handle("GET /ws/location", http.HandlerFunc(h.LocationSocket))
 	mux.Handle("POST /bus/location", h.mngr.With(http.HandlerFunc(h.UpdateLocation), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /bus/location/batch", h.mngr.With(http.HandlerFunc(h.UpdateLocationBatch), h.middlewareHandler.Authenticate))
+
+	// Called by the MQTT broker's HTTP auth plugin
+	mux.Handle("POST /mqtt/auth", h.mngr.With(http.HandlerFunc(h.MQTTAuth), h.brokerOnly))
+	mux.Handle("POST /mqtt/superuser", h.mngr.With(http.HandlerFunc(h.MQTTSuperuser), h.brokerOnly))
+	mux.Handle("POST /mqtt/acl", h.mngr.With(http.HandlerFunc(h.MQTTACL), h.brokerOnly))
 }
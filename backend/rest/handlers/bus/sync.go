@@ -0,0 +1,78 @@
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"swift_transit/ticket"
+	"time"
+)
+
+// Maximum number of scans accepted in one sync
+const maxSyncScans = 500
+
+// Manifest lets a bus download the tickets of its route for offline
+// validation. Without since it gets every valid ticket; with the cursor of a
+// previous manifest it gets the tickets that changed since, including
+// revocations.
+func (h *Handler) Manifest(w http.ResponseWriter, r *http.Request) {
+	busData, err := h.BusFromContext(r)
+	if err != nil {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var since *time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			h.utilHandler.SendError(w, "since must be the cursor of a previous manifest", http.StatusBadRequest)
+			return
+		}
+		since = &parsed
+	}
+
+	manifest, err := h.ticketService.Manifest(busData.RouteId, since)
+	if err != nil {
+		h.utilHandler.SendError(w, "Failed to build manifest", http.StatusInternalServerError)
+		return
+	}
+
+	h.utilHandler.SendData(w, manifest, http.StatusOK)
+}
+
+// SyncScans records tickets a bus scanned while offline. Scans that could not
+// be recorded, such as a ticket used on another bus first, are returned as
+// conflicts by their position in the upload.
+func (h *Handler) SyncScans(w http.ResponseWriter, r *http.Request) {
+	var req ticket.ScanSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Scans) == 0 {
+		h.utilHandler.SendError(w, "scans is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scans) > maxSyncScans {
+		h.utilHandler.SendError(w, fmt.Sprintf("at most %d scans can be uploaded at once", maxSyncScans), http.StatusBadRequest)
+		return
+	}
+
+	busData, err := h.BusFromContext(r)
+	if err != nil {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	req.RouteID = busData.RouteId
+	req.BusName = busData.RegistrationNumber
+
+	result, err := h.ticketService.SyncScans(req)
+	if err != nil {
+		h.utilHandler.SendError(w, "Failed to sync scans", http.StatusInternalServerError)
+		return
+	}
+
+	h.utilHandler.SendData(w, result, http.StatusOK)
+}
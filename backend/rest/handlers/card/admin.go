@@ -0,0 +1,138 @@
+package card
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"swift_transit/card"
+)
+
+type addInventoryRequest struct {
+	UIDs  []string `json:"uids"`
+	Batch string   `json:"batch"`
+}
+
+type issueRequest struct {
+	Cards    []card.IssueItem `json:"cards"`
+	Activate bool             `json:"activate"`
+}
+
+type replaceRequest struct {
+	UserId int64  `json:"user_id"`
+	UID    string `json:"uid"` // New card, from inventory
+}
+
+type setStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+func (h *Handler) ListCards(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	cards, total, err := h.svc.List(r.URL.Query().Get("status"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.utilHandler.SendData(w, map[string]interface{}{
+		"cards":       cards,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + pageSize - 1) / pageSize,
+	}, http.StatusOK)
+}
+
+func (h *Handler) AddInventory(w http.ResponseWriter, r *http.Request) {
+	var req addInventoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	added, err := h.svc.AddInventory(req.UIDs, req.Batch)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]int{"added": added, "skipped": len(req.UIDs) - added}, http.StatusCreated)
+}
+
+func (h *Handler) IssueCards(w http.ResponseWriter, r *http.Request) {
+	var req issueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Cards) == 0 {
+		h.utilHandler.SendError(w, "cards are required", http.StatusBadRequest)
+		return
+	}
+
+	results := h.svc.Issue(req.Cards, req.Activate, card.ActorAdmin)
+	issued := 0
+	for _, result := range results {
+		if result.Issued {
+			issued++
+		}
+	}
+	h.utilHandler.SendData(w, map[string]interface{}{
+		"issued":  issued,
+		"results": results,
+	}, http.StatusOK)
+}
+
+func (h *Handler) ReplaceCard(w http.ResponseWriter, r *http.Request) {
+	var req replaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserId == 0 || req.UID == "" {
+		h.utilHandler.SendError(w, "user_id and uid are required", http.StatusBadRequest)
+		return
+	}
+
+	c, err := h.svc.Replace(req.UserId, req.UID, card.ActorAdmin)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, c, http.StatusOK)
+}
+
+func (h *Handler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	var req setStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.SetStatus(r.PathValue("uid"), card.Status(req.Status), card.ActorAdmin, req.Reason); err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "card not found" {
+			status = http.StatusNotFound
+		}
+		h.utilHandler.SendError(w, err.Error(), status)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]string{"message": "Card status updated"}, http.StatusOK)
+}
+
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	events, err := h.svc.GetHistory(r.PathValue("uid"))
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.utilHandler.SendData(w, events, http.StatusOK)
+}
@@ -0,0 +1,41 @@
+package card
+
+import (
+	"net/http"
+	"swift_transit/card"
+	"swift_transit/rest/middlewares"
+	"swift_transit/utils"
+)
+
+type Handler struct {
+	svc               card.Service
+	middlewareHandler *middlewares.Handler
+	mngr              *middlewares.Manager
+	utilHandler       *utils.Handler
+}
+
+func NewHandler(svc card.Service, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, utilHandler *utils.Handler) *Handler {
+	return &Handler{
+		svc:               svc,
+		middlewareHandler: middlewareHandler,
+		mngr:              mngr,
+		utilHandler:       utilHandler,
+	}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	// Card holders
+	mux.Handle("GET /user/card", h.mngr.With(http.HandlerFunc(h.GetCard), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /user/card/activate", h.mngr.With(http.HandlerFunc(h.ActivateCard), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /user/card/lost", h.mngr.With(http.HandlerFunc(h.ReportLost), h.middlewareHandler.Authenticate))
+	mux.Handle("PUT /user/card/companions", h.mngr.With(http.HandlerFunc(h.SetCompanions), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /user/rfid/toggle", h.mngr.With(http.HandlerFunc(h.ToggleRFIDStatus), h.middlewareHandler.Authenticate))
+
+	// Admin
+	mux.Handle("GET /admin/cards", h.mngr.With(http.HandlerFunc(h.ListCards), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("POST /admin/cards", h.mngr.With(http.HandlerFunc(h.AddInventory), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("POST /admin/cards/issue", h.mngr.With(http.HandlerFunc(h.IssueCards), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("POST /admin/cards/replace", h.mngr.With(http.HandlerFunc(h.ReplaceCard), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("PUT /admin/cards/{uid}/status", h.mngr.With(http.HandlerFunc(h.SetStatus), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("GET /admin/cards/{uid}/history", h.mngr.With(http.HandlerFunc(h.GetHistory), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+}
@@ -0,0 +1,96 @@
+package card
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type toggleRFIDRequest struct {
+	Active bool `json:"active"`
+}
+
+type companionsRequest struct {
+	Companions int `json:"companions"`
+}
+
+func (h *Handler) GetCard(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	c, err := h.svc.GetCurrent(userID)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.utilHandler.SendData(w, c, http.StatusOK)
+}
+
+func (h *Handler) ActivateCard(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.svc.Activate(userID); err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]string{"message": "Card activated"}, http.StatusOK)
+}
+
+func (h *Handler) ReportLost(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.svc.ReportLost(userID); err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]string{"message": "Card blocked as lost. Your balance and passes move to your replacement card."}, http.StatusOK)
+}
+
+// SetCompanions sets how many companions a tap with the user's card pays for
+// when the reader does not ask for a passenger count.
+func (h *Handler) SetCompanions(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req companionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.SetCompanions(userID, req.Companions); err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]int{"companions": req.Companions}, http.StatusOK)
+}
+
+// ToggleRFIDStatus blocks or unblocks the user's card.
+func (h *Handler) ToggleRFIDStatus(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	var req toggleRFIDRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.SetBlocked(userID, !req.Active); err != nil {
+		http.Error(w, "Failed to update RFID status: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "RFID status updated"})
+}
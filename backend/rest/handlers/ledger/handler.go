@@ -0,0 +1,46 @@
+package ledger
+
+import (
+	"net/http"
+	"strconv"
+	"swift_transit/ledger"
+	"swift_transit/rest/middlewares"
+	"swift_transit/utils"
+)
+
+type Handler struct {
+	svc               ledger.Service
+	middlewareHandler *middlewares.Handler
+	mngr              *middlewares.Manager
+	utilHandler       *utils.Handler
+}
+
+func NewHandler(svc ledger.Service, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, utilHandler *utils.Handler) *Handler {
+	return &Handler{
+		svc:               svc,
+		middlewareHandler: middlewareHandler,
+		mngr:              mngr,
+		utilHandler:       utilHandler,
+	}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	// Admin
+	mux.Handle("GET /admin/wallets/{id}/ledger", h.mngr.With(http.HandlerFunc(h.GetWalletLedger), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("GET /admin/ledger/reconciliations", h.mngr.With(http.HandlerFunc(h.ListReconciliations), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("GET /admin/ledger/reconciliations/{id}", h.mngr.With(http.HandlerFunc(h.GetReconciliation), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("POST /admin/ledger/reconcile", h.mngr.With(http.HandlerFunc(h.Reconcile), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+}
+
+// pagination reads page and page_size, defaulting to the first page of 20.
+func pagination(r *http.Request) (int, int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
@@ -0,0 +1,51 @@
+package ledger
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (h *Handler) ListReconciliations(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := pagination(r)
+
+	runs, total, err := h.svc.ListReconciliations(pageSize, (page-1)*pageSize)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.utilHandler.SendData(w, map[string]interface{}{
+		"reconciliations": runs,
+		"total":           total,
+		"page":            page,
+		"page_size":       pageSize,
+		"total_pages":     (total + pageSize - 1) / pageSize,
+	}, http.StatusOK)
+}
+
+// GetReconciliation returns a reconciliation run with the wallets it flagged.
+func (h *Handler) GetReconciliation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid reconciliation ID", http.StatusBadRequest)
+		return
+	}
+
+	run, err := h.svc.GetReconciliation(id)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.utilHandler.SendData(w, run, http.StatusOK)
+}
+
+// Reconcile runs a reconciliation now, without waiting for the nightly job.
+func (h *Handler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	run, err := h.svc.Reconcile(time.Now())
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, run, http.StatusOK)
+}
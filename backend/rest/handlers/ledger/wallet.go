@@ -0,0 +1,29 @@
+package ledger
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// GetWalletLedger lists the entries posted to a user's wallet, newest first.
+func (h *Handler) GetWalletLedger(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	page, pageSize := pagination(r)
+
+	wallet, err := h.svc.GetWalletLedger(userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h.utilHandler.SendData(w, map[string]interface{}{
+		"wallet":      wallet,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (wallet.Total + pageSize - 1) / pageSize,
+	}, http.StatusOK)
+}
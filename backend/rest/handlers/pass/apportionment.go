@@ -0,0 +1,42 @@
+package pass
+
+import (
+	"net/http"
+	"time"
+)
+
+// GetApportionment splits pass revenue between bus owners. from and to are
+// dates (YYYY-MM-DD), to inclusive; the default is the current month so far.
+func (h *Handler) GetApportionment(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := now
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			h.utilHandler.SendError(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			h.utilHandler.SendError(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+
+	shares, err := h.svc.Apportionment(from, to)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]interface{}{
+		"from":   from,
+		"to":     to,
+		"owners": shares,
+	}, http.StatusOK)
+}
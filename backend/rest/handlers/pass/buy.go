@@ -0,0 +1,47 @@
+package pass
+
+import (
+	"encoding/json"
+	"net/http"
+	"swift_transit/pass"
+)
+
+func (h *Handler) Buy(w http.ResponseWriter, r *http.Request) {
+	var req pass.BuyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.UserId = h.userID(r)
+	if req.UserId == 0 {
+		h.utilHandler.SendError(w, "Invalid user data in token", http.StatusUnauthorized)
+		return
+	}
+	if req.PaymentMethod != "wallet" && req.PaymentMethod != "gateway" {
+		h.utilHandler.SendError(w, "payment_method must be wallet or gateway", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.svc.Buy(req)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, resp, http.StatusOK)
+}
+
+func (h *Handler) GetPasses(w http.ResponseWriter, r *http.Request) {
+	userId := h.userID(r)
+	if userId == 0 {
+		h.utilHandler.SendError(w, "Invalid user data in token", http.StatusUnauthorized)
+		return
+	}
+
+	passes, err := h.svc.GetByUser(userId)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, passes, http.StatusOK)
+}
@@ -0,0 +1,51 @@
+package pass
+
+import (
+	"net/http"
+	"swift_transit/pass"
+	"swift_transit/rest/middlewares"
+	"swift_transit/utils"
+)
+
+type Handler struct {
+	svc               pass.Service
+	middlewareHandler *middlewares.Handler
+	mngr              *middlewares.Manager
+	utilHandler       *utils.Handler
+}
+
+func NewHandler(svc pass.Service, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, utilHandler *utils.Handler) *Handler {
+	return &Handler{
+		svc:               svc,
+		middlewareHandler: middlewareHandler,
+		mngr:              mngr,
+		utilHandler:       utilHandler,
+	}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("GET /passes/products", h.mngr.With(http.HandlerFunc(h.ListProducts)))
+	mux.Handle("POST /passes/buy", h.mngr.With(http.HandlerFunc(h.Buy), h.middlewareHandler.Authenticate))
+	mux.Handle("GET /passes", h.mngr.With(http.HandlerFunc(h.GetPasses), h.middlewareHandler.Authenticate))
+	mux.Handle("/passes/payment/success", http.HandlerFunc(h.PaymentSuccess))
+	mux.Handle("/passes/payment/fail", http.HandlerFunc(h.PaymentFail))
+	mux.Handle("/passes/payment/cancel", http.HandlerFunc(h.PaymentCancel))
+
+	// Admin
+	mux.Handle("GET /admin/pass-products", h.mngr.With(http.HandlerFunc(h.ListAllProducts), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("POST /admin/pass-products", h.mngr.With(http.HandlerFunc(h.CreateProduct), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("GET /admin/passes/apportionment", h.mngr.With(http.HandlerFunc(h.GetApportionment), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+}
+
+func (h *Handler) userID(r *http.Request) int64 {
+	var userId int64
+	switch v := h.utilHandler.GetUserFromContext(r.Context()).(type) {
+	case float64:
+		userId = int64(v)
+	case map[string]interface{}:
+		if id, ok := v["id"].(float64); ok {
+			userId = int64(id)
+		}
+	}
+	return userId
+}
@@ -0,0 +1,40 @@
+package pass
+
+import (
+	"encoding/json"
+	"net/http"
+	"swift_transit/domain"
+)
+
+func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := h.svc.ListProducts()
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, products, http.StatusOK)
+}
+
+func (h *Handler) ListAllProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := h.svc.ListAllProducts()
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, products, http.StatusOK)
+}
+
+func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	var product domain.PassProduct
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.svc.CreateProduct(product)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, created, http.StatusCreated)
+}
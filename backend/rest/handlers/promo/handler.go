@@ -0,0 +1,46 @@
+package promo
+
+import (
+	"net/http"
+	"strconv"
+	"swift_transit/promo"
+	"swift_transit/rest/middlewares"
+	"swift_transit/utils"
+)
+
+type Handler struct {
+	svc               promo.Service
+	middlewareHandler *middlewares.Handler
+	mngr              *middlewares.Manager
+	utilHandler       *utils.Handler
+}
+
+func NewHandler(svc promo.Service, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, utilHandler *utils.Handler) *Handler {
+	return &Handler{
+		svc:               svc,
+		middlewareHandler: middlewareHandler,
+		mngr:              mngr,
+		utilHandler:       utilHandler,
+	}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	// Admin
+	mux.Handle("GET /admin/promos", h.mngr.With(http.HandlerFunc(h.ListPromos), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("POST /admin/promos", h.mngr.With(http.HandlerFunc(h.CreatePromo), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("PUT /admin/promos/{id}", h.mngr.With(http.HandlerFunc(h.SetPromoActive), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("GET /admin/promos/{id}/redemptions", h.mngr.With(http.HandlerFunc(h.ListRedemptions), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+}
+
+// pagination reads page and page_size, defaulting to the first page of 20.
+func pagination(r *http.Request) (int, int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
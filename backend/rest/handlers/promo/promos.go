@@ -0,0 +1,80 @@
+package promo
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"swift_transit/domain"
+)
+
+type activeRequest struct {
+	Active bool `json:"active"`
+}
+
+func (h *Handler) ListPromos(w http.ResponseWriter, r *http.Request) {
+	promos, err := h.svc.ListPromos()
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, promos, http.StatusOK)
+}
+
+func (h *Handler) CreatePromo(w http.ResponseWriter, r *http.Request) {
+	p := domain.PromoCode{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.svc.CreatePromo(p)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, created, http.StatusCreated)
+}
+
+// SetPromoActive withdraws a promo code, or offers it again.
+func (h *Handler) SetPromoActive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid promo ID", http.StatusBadRequest)
+		return
+	}
+	var req activeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.svc.SetPromoActive(id, req.Active)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, p, http.StatusOK)
+}
+
+// ListRedemptions lists the orders a promo code was used on, newest first.
+func (h *Handler) ListRedemptions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid promo ID", http.StatusBadRequest)
+		return
+	}
+	page, pageSize := pagination(r)
+
+	redemptions, total, err := h.svc.ListRedemptions(id, pageSize, (page-1)*pageSize)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]interface{}{
+		"redemptions": redemptions,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + pageSize - 1) / pageSize,
+	}, http.StatusOK)
+}
@@ -1,6 +1,7 @@
 package route
 
 import (
+	"swift_transit/location"
 	"swift_transit/rest/middlewares"
 	"swift_transit/utils"
 )
@@ -10,13 +11,15 @@ type Handler struct {
 	middlewareHandler *middlewares.Handler
 	mngr              *middlewares.Manager
 	utilHandler       *utils.Handler
+	hub               *location.Hub
 }
 
-func NewHandler(svc Service, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, utilHandler *utils.Handler) *Handler {
+func NewHandler(svc Service, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, utilHandler *utils.Handler, hub *location.Hub) *Handler {
 	return &Handler{
 		svc:               svc,
 		middlewareHandler: middlewareHandler,
 		mngr:              mngr,
 		utilHandler:       utilHandler,
+		hub:               hub,
 	}
 }
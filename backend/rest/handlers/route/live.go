@@ -0,0 +1,120 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"swift_transit/location"
+)
+
+// Comment lines sent while idle so proxies keep the connection open
+const sseKeepAlive = 15 * time.Second
+
+// SSE event names for each hub message type
+var sseEvents = map[location.MessageType]string{
+	location.TypeLocation: "position",
+	location.TypeETA:      "eta",
+	location.TypeAlert:    "alert",
+}
+
+// Live streams the positions and ETAs of a route's buses as Server-Sent
+// Events. Event IDs are the route's sequence numbers; a client reconnecting
+// with Last-Event-ID (or ?last_event_id=) receives the events it missed, or
+// the latest position of every bus if they are no longer available.
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	id := h.utilHandler.GetID(r)
+	if id == 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.svc.FindByID(id); err != nil {
+		http.Error(w, "route not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastSeq uint64
+	if lastEventID != "" {
+		seq, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastSeq = seq
+	}
+
+	// Subscribe before reading the backlog so nothing published in between
+	// is lost; duplicates are skipped by sequence number below.
+	stream := h.hub.Open([]int64{id})
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(messages []location.Envelope) error {
+		written := 0
+		for _, message := range messages {
+			event, ok := sseEvents[message.Type]
+			if !ok || message.Seq <= lastSeq {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", message.Seq, event, message.Data); err != nil {
+				return err
+			}
+			// Snapshots are not contiguous, so only move forward
+			lastSeq = message.Seq
+			written++
+		}
+		flusher.Flush()
+		stream.Delivered(written)
+		return nil
+	}
+
+	backlog, resumed := h.hub.Since(id, lastSeq)
+	if !resumed {
+		// Sequence numbers restart with the server; start over from the snapshot
+		lastSeq = 0
+	}
+	if err := write(backlog); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-stream.Done():
+			return
+
+		case <-stream.Ready():
+			if err := write(stream.Drain()); err != nil {
+				return
+			}
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
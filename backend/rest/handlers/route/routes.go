@@ -7,4 +7,5 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("GET /route/search", h.mngr.With(http.HandlerFunc(h.SearchRoute)))
 	mux.Handle("GET /route/stops", h.mngr.With(http.HandlerFunc(h.SearchStops)))
 	mux.Handle("GET /route/{id}", h.mngr.With(http.HandlerFunc(h.GetByID)))
+	mux.Handle("GET /route/{id}/live", h.mngr.With(http.HandlerFunc(h.Live)))
 }
@@ -0,0 +1,28 @@
+package ticket
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// readerBus is the bus a card reader logged in as.
+type readerBus struct {
+	RegistrationNumber string
+	RouteID            int64
+}
+
+// busFromContext reads the bus from a bus token. Passenger tokens carry no
+// registration number and are refused.
+func (h *Handler) busFromContext(r *http.Request) (*readerBus, error) {
+	data, ok := h.utilHandler.GetUserFromContext(r.Context()).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("missing auth context")
+	}
+
+	reg, _ := data["registration_number"].(string)
+	routeID, _ := data["route_id"].(float64)
+	if reg == "" || routeID <= 0 {
+		return nil, fmt.Errorf("not a bus token")
+	}
+	return &readerBus{RegistrationNumber: reg, RouteID: int64(routeID)}, nil
+}
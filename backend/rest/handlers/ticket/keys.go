@@ -0,0 +1,10 @@
+package ticket
+
+import "net/http"
+
+// GetSigningKeys publishes the public keys bus devices use to verify ticket
+// QR tokens offline. Devices should refresh them periodically to pick up
+// rotated keys.
+func (h *Handler) GetSigningKeys(w http.ResponseWriter, r *http.Request) {
+	h.utilHandler.SendData(w, map[string]any{"keys": h.svc.PublicKeys()}, http.StatusOK)
+}
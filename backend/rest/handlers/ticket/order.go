@@ -0,0 +1,50 @@
+package ticket
+
+import (
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userData := h.utilHandler.GetUserFromContext(r.Context())
+	if userData == nil {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var userId int64
+	switch v := userData.(type) {
+	case float64:
+		userId = int64(v)
+	case map[string]interface{}:
+		if id, ok := v["id"].(float64); ok {
+			userId = int64(id)
+		}
+	}
+
+	if userId == 0 {
+		h.utilHandler.SendError(w, "Invalid user data in token", http.StatusUnauthorized)
+		return
+	}
+
+	orderID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.svc.GetOrder(userId, orderID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err.Error() {
+		case "order not found":
+			status = http.StatusNotFound
+		case "unauthorized":
+			status = http.StatusForbidden
+		}
+		h.utilHandler.SendError(w, err.Error(), status)
+		return
+	}
+
+	h.utilHandler.SendData(w, order, http.StatusOK)
+}
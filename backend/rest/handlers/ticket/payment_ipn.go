@@ -3,7 +3,8 @@ package ticket
 import (
 	"log"
 	"net/http"
-	"strconv"
+
+	"swift_transit/domain"
 )
 
 func (h *Handler) PaymentIPN(w http.ResponseWriter, r *http.Request) {
@@ -39,7 +40,7 @@ func (h *Handler) PaymentIPN(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	amount, err := strconv.ParseFloat(amountStr, 64)
+	amount, err := domain.ParseMoney(amountStr)
 	if err != nil {
 		log.Printf("Invalid amount in IPN: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
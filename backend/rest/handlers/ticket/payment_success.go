@@ -3,28 +3,34 @@ package ticket
 import (
 	"fmt"
 	"net/http"
-	"strconv"
 )
 
 func (h *Handler) PaymentSuccess(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	if idStr == "" {
-		h.utilHandler.SendError(w, map[string]string{"error": "missing id parameter"}, http.StatusBadRequest)
+	if err := r.ParseForm(); err != nil {
+		h.utilHandler.SendError(w, map[string]string{"error": "invalid request"}, http.StatusBadRequest)
 		return
 	}
 
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		h.utilHandler.SendError(w, map[string]string{"error": "invalid id parameter"}, http.StatusBadRequest)
+	// The gateway posts val_id to the success URL; the order is only paid once
+	// the gateway confirms it
+	tranID := r.FormValue("tran_id")
+	valID := r.FormValue("val_id")
+	if tranID == "" || valID == "" {
+		h.utilHandler.SendError(w, map[string]string{"error": "missing tran_id or val_id parameter"}, http.StatusBadRequest)
 		return
 	}
 
-	_, err = h.svc.HandlePaymentResult(int64(id), "paid")
+	order, err := h.svc.CompletePayment(tranID, valID)
 	if err != nil {
-		h.utilHandler.SendError(w, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+		h.utilHandler.SendError(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
 		return
 	}
 
+	var id int64
+	if len(order.Items) > 0 {
+		id = order.Items[0].TicketId
+	}
+
 	w.Header().Set("Content-Type", "text/html")
 	fmt.Fprintf(w, `
 		<html>
@@ -7,15 +7,20 @@ import (
 
 type Service interface {
 	BuyTicket(req ticket.BuyTicketRequest) (*ticket.BuyTicketResponse, error)
-	UpdatePaymentStatus(id int64) error
-	HandlePaymentResult(id int64, status string) (bool, error)
+	HandlePaymentResult(tranID string, status string) (*domain.Order, error)
+	CompletePayment(tranID, valID string) (*domain.Order, error)
+	GetOrder(userID int64, orderID int64) (*domain.Order, error)
 	GetTicketStatus(trackingID string) (*ticket.BuyTicketResponse, error)
 	DownloadTicket(id int64) ([]byte, error)
-	ValidatePayment(valID string, tranID string, amount float64) (bool, error)
+	ValidatePayment(valID string, tranID string, amount domain.Money) (bool, error)
 	GetByUserID(userId int64, limit, offset int) ([]domain.Ticket, int, error)
 	ValidateTicket(id int64) error
 	GetPaymentStatus(ticketID int64) (string, error)
-	CancelTicket(userID int64, ticketID int64) (float64, error)
+	CancelTicket(userID int64, ticketID int64) (domain.Money, error)
+	GetHistory(userID int64, ticketID int64) ([]domain.TicketEvent, error)
 	ProcessRFIDPayment(req ticket.RFIDPaymentRequest) (*ticket.RFIDPaymentResponse, error)
+	TapOn(req ticket.RFIDTapRequest) (*ticket.RFIDPaymentResponse, error)
+	TapOff(req ticket.RFIDTapRequest) (*ticket.RFIDPaymentResponse, error)
 	CreateOverTravelTicket(originalTicketID int64, currentStop string, paymentCollected bool) (*domain.Ticket, error)
+	PublicKeys() []ticket.PublicKey
 }
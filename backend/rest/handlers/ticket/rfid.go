@@ -22,3 +22,38 @@ func (h *Handler) ProcessRFIDPayment(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+func (h *Handler) TapOn(w http.ResponseWriter, r *http.Request) {
+	h.tap(w, r, h.svc.TapOn)
+}
+
+func (h *Handler) TapOff(w http.ResponseWriter, r *http.Request) {
+	h.tap(w, r, h.svc.TapOff)
+}
+
+// tap handles a tap from a bus's card reader. The bus and route are taken
+// from the reader's token, never from the request body.
+func (h *Handler) tap(w http.ResponseWriter, r *http.Request, process func(ticket.RFIDTapRequest) (*ticket.RFIDPaymentResponse, error)) {
+	bus, err := h.busFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ticket.RFIDTapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.RouteID = bus.RouteID
+	req.BusName = bus.RegistrationNumber
+
+	resp, err := process(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -10,8 +10,13 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("POST /ticket/payment/ipn", http.HandlerFunc(h.PaymentIPN)) // IPN usually comes from server, maybe no auth middleware needed or verify IP
 	mux.Handle("GET /ticket/download", h.mngr.With(http.HandlerFunc(h.DownloadTicket)))
 	mux.Handle("GET /ticket/status", h.mngr.With(http.HandlerFunc(h.GetTicketStatus)))
+	mux.Handle("GET /ticket/keys", h.mngr.With(http.HandlerFunc(h.GetSigningKeys)))
 	mux.Handle("GET /ticket", h.mngr.With(http.HandlerFunc(h.GetTickets), h.middlewareHandler.Authenticate))
 	mux.Handle("POST /ticket/cancel/{id}", h.mngr.With(http.HandlerFunc(h.CancelTicket), h.middlewareHandler.Authenticate))
+	mux.Handle("GET /ticket/{id}/history", h.mngr.With(http.HandlerFunc(h.GetHistory), h.middlewareHandler.Authenticate))
+	mux.Handle("GET /orders/{id}", h.mngr.With(http.HandlerFunc(h.GetOrder), h.middlewareHandler.Authenticate))
 	mux.Handle("POST /ticket/rfid-payment", http.HandlerFunc(h.ProcessRFIDPayment)) // No auth for now, or bus auth?
+	mux.Handle("POST /ticket/rfid/tap-on", h.mngr.With(http.HandlerFunc(h.TapOn), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /ticket/rfid/tap-off", h.mngr.With(http.HandlerFunc(h.TapOff), h.middlewareHandler.Authenticate))
 	mux.Handle("POST /ticket/over-travel", http.HandlerFunc(h.CreateOverTravelTicket))
 }
@@ -29,4 +29,17 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("/wallet/recharge/success", http.HandlerFunc(h.RechargeSuccess))
 	mux.Handle("/wallet/recharge/fail", http.HandlerFunc(h.RechargeFail))
 	mux.Handle("/wallet/recharge/cancel", http.HandlerFunc(h.RechargeCancel))
+	mux.Handle("GET /wallet/recharge/products", http.HandlerFunc(h.ListRechargeOffers))
+
+	// Admin
+	mux.Handle("GET /admin/recharge-products", h.mngr.With(http.HandlerFunc(h.ListRechargeProducts), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("POST /admin/recharge-products", h.mngr.With(http.HandlerFunc(h.CreateRechargeProduct), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("PUT /admin/recharge-products/{id}", h.mngr.With(http.HandlerFunc(h.SetRechargeProductActive), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("GET /admin/recharge-campaigns", h.mngr.With(http.HandlerFunc(h.ListCampaigns), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("POST /admin/recharge-campaigns", h.mngr.With(http.HandlerFunc(h.CreateCampaign), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("PUT /admin/recharge-campaigns/{id}", h.mngr.With(http.HandlerFunc(h.SetCampaignActive), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("GET /admin/recharge-limits", h.mngr.With(http.HandlerFunc(h.ListRechargeLimits), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("PUT /admin/recharge-limits", h.mngr.With(http.HandlerFunc(h.SetDefaultRechargeLimit), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("PUT /admin/recharge-limits/{user_id}", h.mngr.With(http.HandlerFunc(h.SetUserRechargeLimit), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
+	mux.Handle("DELETE /admin/recharge-limits/{user_id}", h.mngr.With(http.HandlerFunc(h.RemoveUserRechargeLimit), h.middlewareHandler.RequireAdmin, h.middlewareHandler.Authenticate))
 }
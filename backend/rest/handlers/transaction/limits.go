@@ -0,0 +1,71 @@
+package transaction
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"swift_transit/domain"
+)
+
+type rechargeLimitRequest struct {
+	DailyLimit domain.Money `json:"daily_limit"`
+}
+
+// ListRechargeLimits lists the default daily recharge limit and the users
+// who have their own.
+func (h *Handler) ListRechargeLimits(w http.ResponseWriter, r *http.Request) {
+	limits, err := h.svc.ListRechargeLimits()
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, limits, http.StatusOK)
+}
+
+// SetDefaultRechargeLimit sets the daily recharge limit of users without
+// their own.
+func (h *Handler) SetDefaultRechargeLimit(w http.ResponseWriter, r *http.Request) {
+	h.setRechargeLimit(w, r, nil)
+}
+
+// SetUserRechargeLimit gives a user a daily recharge limit of their own.
+func (h *Handler) SetUserRechargeLimit(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	h.setRechargeLimit(w, r, &userID)
+}
+
+func (h *Handler) setRechargeLimit(w http.ResponseWriter, r *http.Request, userID *int64) {
+	var req rechargeLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := h.svc.SetRechargeLimit(userID, req.DailyLimit)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, limit, http.StatusOK)
+}
+
+// RemoveUserRechargeLimit puts a user back on the default daily recharge
+// limit.
+func (h *Handler) RemoveUserRechargeLimit(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.RemoveRechargeLimit(userID); err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]string{"message": "Recharge limit removed"}, http.StatusOK)
+}
@@ -0,0 +1,114 @@
+package transaction
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"swift_transit/domain"
+)
+
+type activeRequest struct {
+	Active bool `json:"active"`
+}
+
+// ListRechargeOffers lists the amounts a wallet can be recharged by, with
+// the bonus each earns now.
+func (h *Handler) ListRechargeOffers(w http.ResponseWriter, r *http.Request) {
+	offers, err := h.svc.ListRechargeOffers()
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, offers, http.StatusOK)
+}
+
+func (h *Handler) ListRechargeProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := h.svc.ListRechargeProducts()
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, products, http.StatusOK)
+}
+
+func (h *Handler) CreateRechargeProduct(w http.ResponseWriter, r *http.Request) {
+	var req rechargeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.svc.CreateRechargeProduct(req.Amount)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, product, http.StatusCreated)
+}
+
+// SetRechargeProductActive withdraws a recharge product, or offers it again.
+func (h *Handler) SetRechargeProductActive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	var req activeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.svc.SetRechargeProductActive(id, req.Active)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, product, http.StatusOK)
+}
+
+func (h *Handler) ListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := h.svc.ListCampaigns()
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, campaigns, http.StatusOK)
+}
+
+func (h *Handler) CreateCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign := domain.RechargeCampaign{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&campaign); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.svc.CreateCampaign(campaign)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, created, http.StatusCreated)
+}
+
+// SetCampaignActive pauses or resumes a recharge campaign.
+func (h *Handler) SetCampaignActive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid campaign ID", http.StatusBadRequest)
+		return
+	}
+	var req activeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	campaign, err := h.svc.SetCampaignActive(id, req.Active)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, campaign, http.StatusOK)
+}
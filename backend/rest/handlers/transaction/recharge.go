@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"swift_transit/domain"
 )
 
 type rechargeRequest struct {
-	Amount float64 `json:"amount"`
+	Amount domain.Money `json:"amount"`
 }
 
 type rechargeResponse struct {
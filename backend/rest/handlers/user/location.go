@@ -2,24 +2,19 @@ package user
 
 import (
 	"net/http"
-	"strconv"
 	"swift_transit/location"
 )
 
 func (h *Handler) LocationSocket(w http.ResponseWriter, r *http.Request) {
-	// User connects to this endpoint to receive location updates for a specific route
-	routeIDStr := r.URL.Query().Get("route_id")
-	if routeIDStr == "" {
-		h.utilHandler.SendError(w, "route_id is required", http.StatusBadRequest)
-		return
-	}
-
-	routeID, err := strconv.ParseInt(routeIDStr, 10, 64)
+	// User connects to this endpoint to receive location updates.
+	// route_id / route_ids are optional; more routes can be subscribed later
+	// over the socket without reconnecting.
+	routeIDs, err := location.RouteIDsFromQuery(r.URL.Query())
 	if err != nil {
-		h.utilHandler.SendError(w, "invalid route_id", http.StatusBadRequest)
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Upgrade to WebSocket
-	location.ServeWs(h.hub, w, r, routeID, false)
+	location.ServeWs(h.hub, w, r, routeIDs, nil)
 }
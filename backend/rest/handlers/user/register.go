@@ -10,13 +10,13 @@ import (
 )
 
 type RegisterRequest struct {
-	Name      string  `json:"name"`
-	Mobile    string  `json:"mobile"`
-	NID       string  `json:"nid"`
-	Email     string  `json:"email"`
-	Password  string  `json:"password"`
-	IsStudent bool    `json:"is_student"`
-	Balance   float32 `json:"balance"`
+	Name      string       `json:"name"`
+	Mobile    string       `json:"mobile"`
+	NID       string       `json:"nid"`
+	Email     string       `json:"email"`
+	Password  string       `json:"password"`
+	IsStudent bool         `json:"is_student"`
+	Balance   domain.Money `json:"balance"`
 }
 
 type VerifySignupRequest struct {
@@ -10,10 +10,6 @@ type RFIDStatusResponse struct {
 	IsActive bool   `json:"is_active"`
 }
 
-type ToggleRFIDRequest struct {
-	Active bool `json:"active"`
-}
-
 func (h *Handler) GetRFIDStatus(w http.ResponseWriter, r *http.Request) {
 	userID := h.utilHandler.GetUserIDFromContext(r.Context())
 	user, err := h.svc.GetWithPassword(userID) // Using GetWithPassword as it returns the full user struct including RFID
@@ -35,20 +31,3 @@ func (h *Handler) GetRFIDStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
-
-func (h *Handler) ToggleRFIDStatus(w http.ResponseWriter, r *http.Request) {
-	userID := h.utilHandler.GetUserIDFromContext(r.Context())
-	var req ToggleRFIDRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	if err := h.svc.ToggleRFIDStatus(userID, req.Active); err != nil {
-		http.Error(w, "Failed to update RFID status", http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "RFID status updated"})
-}
@@ -0,0 +1,64 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"swift_transit/wallet"
+)
+
+func (h *Handler) GetBalanceAlert(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	alert, err := h.svc.GetBalanceAlert(userID)
+	if errors.Is(err, wallet.ErrNoBalanceAlert) {
+		h.utilHandler.SendError(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, alert, http.StatusOK)
+}
+
+// SetBalanceAlert sets the threshold below which the caller is notified of
+// a low balance, and optionally an amount to top up by.
+func (h *Handler) SetBalanceAlert(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req wallet.BalanceAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.UserId = userID
+
+	alert, err := h.svc.SetBalanceAlert(req)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, alert, http.StatusOK)
+}
+
+func (h *Handler) DeleteBalanceAlert(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.svc.DeleteBalanceAlert(userID); err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]string{"message": "Balance alert removed"}, http.StatusOK)
+}
@@ -0,0 +1,202 @@
+package wallet
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"swift_transit/domain"
+)
+
+type inviteRequest struct {
+	Mobile string `json:"mobile"`
+}
+
+type sharedWalletRequest struct {
+	Shared bool `json:"shared"`
+}
+
+type fundRequest struct {
+	Amount domain.Money `json:"amount"`
+	Note   string       `json:"note"`
+}
+
+func (h *Handler) GetFamily(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	family, err := h.svc.GetFamily(userID)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, family, http.StatusOK)
+}
+
+// Invite asks the user with a mobile number to become a dependent of the
+// caller.
+func (h *Handler) Invite(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req inviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Mobile == "" {
+		h.utilHandler.SendError(w, "mobile is required", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.svc.Invite(userID, req.Mobile)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, member, http.StatusCreated)
+}
+
+func (h *Handler) Accept(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	memberID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid family member ID", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.svc.Accept(userID, memberID)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, member, http.StatusOK)
+}
+
+// Leave removes a family link, or declines an invite, from either side.
+func (h *Handler) Leave(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	memberID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid family member ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.Leave(userID, memberID); err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]string{"message": "Removed from family"}, http.StatusOK)
+}
+
+// SetSharedWallet lets a dependent's RFID taps draw from the guardian's
+// wallet, or stops it.
+func (h *Handler) SetSharedWallet(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	memberID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid family member ID", http.StatusBadRequest)
+		return
+	}
+
+	var req sharedWalletRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.svc.SetSharedWallet(userID, memberID, req.Shared)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, member, http.StatusOK)
+}
+
+func (h *Handler) GetDependentWallet(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	dependentID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid dependent ID", http.StatusBadRequest)
+		return
+	}
+
+	wallet, err := h.svc.GetDependentWallet(userID, dependentID)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.utilHandler.SendData(w, wallet, http.StatusOK)
+}
+
+func (h *Handler) GetDependentTrips(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	dependentID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid dependent ID", http.StatusBadRequest)
+		return
+	}
+	page, pageSize := pagination(r)
+
+	tickets, total, err := h.svc.GetDependentTrips(userID, dependentID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]interface{}{
+		"tickets":     tickets,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + pageSize - 1) / pageSize,
+	}, http.StatusOK)
+}
+
+// FundDependent starts a transfer to a dependent, confirmed with an OTP
+// like any other transfer.
+func (h *Handler) FundDependent(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	dependentID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.utilHandler.SendError(w, "Invalid dependent ID", http.StatusBadRequest)
+		return
+	}
+
+	var req fundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	pending, err := h.svc.FundDependent(userID, dependentID, req.Amount, req.Note)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, pending, http.StatusOK)
+}
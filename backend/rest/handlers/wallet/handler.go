@@ -0,0 +1,60 @@
+package wallet
+
+import (
+	"net/http"
+	"strconv"
+	"swift_transit/rest/middlewares"
+	"swift_transit/utils"
+	"swift_transit/wallet"
+)
+
+type Handler struct {
+	svc               wallet.Service
+	middlewareHandler *middlewares.Handler
+	mngr              *middlewares.Manager
+	utilHandler       *utils.Handler
+}
+
+func NewHandler(svc wallet.Service, middlewareHandler *middlewares.Handler, mngr *middlewares.Manager, utilHandler *utils.Handler) *Handler {
+	return &Handler{
+		svc:               svc,
+		middlewareHandler: middlewareHandler,
+		mngr:              mngr,
+		utilHandler:       utilHandler,
+	}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	// Transfers
+	mux.Handle("POST /wallet/transfers", h.mngr.With(http.HandlerFunc(h.InitTransfer), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /wallet/transfers/{id}/confirm", h.mngr.With(http.HandlerFunc(h.ConfirmTransfer), h.middlewareHandler.Authenticate))
+	mux.Handle("GET /wallet/transfers", h.mngr.With(http.HandlerFunc(h.ListTransfers), h.middlewareHandler.Authenticate))
+
+	// Family
+	mux.Handle("GET /wallet/family", h.mngr.With(http.HandlerFunc(h.GetFamily), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /wallet/family/invites", h.mngr.With(http.HandlerFunc(h.Invite), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /wallet/family/{id}/accept", h.mngr.With(http.HandlerFunc(h.Accept), h.middlewareHandler.Authenticate))
+	mux.Handle("DELETE /wallet/family/{id}", h.mngr.With(http.HandlerFunc(h.Leave), h.middlewareHandler.Authenticate))
+	mux.Handle("PUT /wallet/family/{id}/shared-wallet", h.mngr.With(http.HandlerFunc(h.SetSharedWallet), h.middlewareHandler.Authenticate))
+	mux.Handle("GET /wallet/family/dependents/{id}", h.mngr.With(http.HandlerFunc(h.GetDependentWallet), h.middlewareHandler.Authenticate))
+	mux.Handle("GET /wallet/family/dependents/{id}/trips", h.mngr.With(http.HandlerFunc(h.GetDependentTrips), h.middlewareHandler.Authenticate))
+	mux.Handle("POST /wallet/family/dependents/{id}/fund", h.mngr.With(http.HandlerFunc(h.FundDependent), h.middlewareHandler.Authenticate))
+
+	// Low-balance alerts
+	mux.Handle("GET /wallet/alerts", h.mngr.With(http.HandlerFunc(h.GetBalanceAlert), h.middlewareHandler.Authenticate))
+	mux.Handle("PUT /wallet/alerts", h.mngr.With(http.HandlerFunc(h.SetBalanceAlert), h.middlewareHandler.Authenticate))
+	mux.Handle("DELETE /wallet/alerts", h.mngr.With(http.HandlerFunc(h.DeleteBalanceAlert), h.middlewareHandler.Authenticate))
+}
+
+// pagination reads page and page_size, defaulting to the first page of 20.
+func pagination(r *http.Request) (int, int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
@@ -0,0 +1,83 @@
+package wallet
+
+import (
+	"encoding/json"
+	"net/http"
+	"swift_transit/wallet"
+)
+
+type confirmTransferRequest struct {
+	OTP string `json:"otp"`
+}
+
+// InitTransfer starts a transfer to the user with a mobile number and
+// emails the sender the OTP that confirms it.
+func (h *Handler) InitTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req wallet.TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.utilHandler.SendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.SenderId = userID
+	req.RecipientId = 0
+
+	pending, err := h.svc.InitTransfer(req)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, pending, http.StatusOK)
+}
+
+func (h *Handler) ConfirmTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req confirmTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OTP == "" {
+		h.utilHandler.SendError(w, "otp is required", http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := h.svc.ConfirmTransfer(userID, r.PathValue("id"), req.OTP)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]interface{}{
+		"message":  "Transfer complete",
+		"transfer": transfer,
+	}, http.StatusOK)
+}
+
+// ListTransfers lists the transfers the user sent or received, newest first.
+func (h *Handler) ListTransfers(w http.ResponseWriter, r *http.Request) {
+	userID := h.utilHandler.GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		h.utilHandler.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	page, pageSize := pagination(r)
+
+	transfers, total, err := h.svc.ListTransfers(userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		h.utilHandler.SendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.utilHandler.SendData(w, map[string]interface{}{
+		"transfers":   transfers,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + pageSize - 1) / pageSize,
+	}, http.StatusOK)
+}
@@ -0,0 +1,20 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"swift_transit/domain"
+)
+
+// RequireAdmin lets through only requests made with an admin token. It must
+// run after Authenticate.
+func (h *Handler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := h.utilHandler.GetUserFromContext(r.Context()).(map[string]any)
+		if role, _ := data["role"].(string); role != domain.RoleAdmin {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -11,7 +11,7 @@ func (h *Handler) Cors(next http.Handler) http.Handler {
 		// Allow all origins (you can restrict to specific domains)
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Last-Event-ID")
 		w.Header().Set("Content-Type", "application/json")
 
 		// Handle preflight request
@@ -10,4 +10,4 @@ func NewHandler(utilHandler *utils.Handler) *Handler {
 	return &Handler{
 		utilHandler: utilHandler,
 	}
-}
\ No newline at end of file
+}
@@ -30,9 +30,9 @@ func (mngr *Manager) WrapMux(handler http.Handler) http.Handler {
 	return h
 }
 
-func (mngr *Manager) With(handler http.Handler,middlewares ...Middleware) http.Handler {
+func (mngr *Manager) With(handler http.Handler, middlewares ...Middleware) http.Handler {
 	h := handler
-	for _,middleware := range middlewares{
+	for _, middleware := range middlewares {
 		h = middleware(h)
 	}
 	return h
@@ -15,6 +15,11 @@ func (h *Handler) Serve() {
 	h.transactionHandler.RegisterRoutes(mux)
 	h.busOwnerHandler.RegisterRoutes(mux)
 	h.adminHandler.RegisterRoutes(mux)
+	h.passHandler.RegisterRoutes(mux)
+	h.cardHandler.RegisterRoutes(mux)
+	h.ledgerHandler.RegisterRoutes(mux)
+	h.walletHandler.RegisterRoutes(mux)
+	h.promoHandler.RegisterRoutes(mux)
 	mngr := h.mdlw.NewManager()
 	mngr.Use(h.mdlw.Logger, h.mdlw.Cors)
 	wrappedMux := mngr.WrapMux(mux)
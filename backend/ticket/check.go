@@ -0,0 +1,268 @@
+package ticket
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/pass"
+
+	"github.com/go-redis/redis/v8"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// CheckStatus is the outcome of a ticket check. Clients can rely on these
+// values; only CheckValid and CheckOverTravel mark the ticket as used.
+type CheckStatus string
+
+const (
+	CheckValid        CheckStatus = "valid"         // Ticket accepted
+	CheckOverTravel   CheckStatus = "over_travel"   // Accepted, but the passenger rode past their stop and owes ExtraFare
+	CheckAlreadyUsed  CheckStatus = "already_used"  // Ticket was used before, possibly by a concurrent scan
+	CheckInvalidRoute CheckStatus = "invalid_route" // Ticket is for another route
+	CheckCancelled    CheckStatus = "cancelled"     // Ticket was cancelled or its payment failed
+	CheckUnpaid       CheckStatus = "unpaid"        // Payment has not completed
+	CheckExpired      CheckStatus = "expired"       // Ticket was not used while it was valid
+	CheckNotFound     CheckStatus = "not_found"     // No ticket has this QR code
+	CheckInvalid      CheckStatus = "invalid"       // QR could not be verified, e.g. bad signature or expired code
+)
+
+// CheckedTicket identifies the ticket a check was made against.
+type CheckedTicket struct {
+	ID               int64  `json:"id"`
+	RouteID          int64  `json:"route_id"`
+	StartDestination string `json:"start_destination"`
+	EndDestination   string `json:"end_destination"`
+}
+
+type CheckTicketResult struct {
+	Success         bool           `json:"success"`
+	Status          CheckStatus    `json:"status"`
+	Message         string         `json:"message"`
+	Ticket          *CheckedTicket `json:"ticket,omitempty"`
+	Pass            *CheckedPass   `json:"pass,omitempty"`
+	ExtraFare       domain.Money   `json:"extra_fare,omitempty"`
+	CurrentStoppage string         `json:"current_stoppage,omitempty"`
+}
+
+// ticketSnapshot is what is cached under ticket_valid:<qr_code> while a paid
+// ticket can be used.
+type ticketSnapshot struct {
+	TicketID         int64  `json:"ticket_id"`
+	RouteID          int64  `json:"route_id"`
+	StartDestination string `json:"start_destination"`
+	EndDestination   string `json:"end_destination"`
+	UserID           int64  `json:"user_id"`
+	CreatedAt        string `json:"created_at"`
+	Checked          bool   `json:"checked"`
+}
+
+// CheckTicket validates a scanned ticket and marks it as used. The ticket is
+// read from Redis, falling back to Postgres when it is not cached, and the
+// usage is recorded with a conditional update so that of two concurrent scans
+// only one succeeds.
+func (s *service) CheckTicket(req CheckTicketRequest) (*CheckTicketResult, error) {
+	if pass.IsPassQR(req.QRCode) {
+		return s.checkPass(req)
+	}
+
+	qrCode, err := s.ResolveQR(req.QRCode)
+	if err != nil {
+		return &CheckTicketResult{Status: CheckInvalid, Message: err.Error()}, nil
+	}
+
+	snap, status, err := s.loadSnapshot(qrCode)
+	if err != nil {
+		return nil, err
+	}
+	if snap == nil {
+		return &CheckTicketResult{Status: status, Message: checkMessages[status]}, nil
+	}
+
+	result := &CheckTicketResult{
+		Ticket: &CheckedTicket{
+			ID:               snap.TicketID,
+			RouteID:          snap.RouteID,
+			StartDestination: snap.StartDestination,
+			EndDestination:   snap.EndDestination,
+		},
+	}
+
+	if snap.RouteID != req.RouteID {
+		result.Status = CheckInvalidRoute
+		result.Message = checkMessages[CheckInvalidRoute]
+		return result, nil
+	}
+	if snap.Checked {
+		result.Status = CheckAlreadyUsed
+		result.Message = checkMessages[CheckAlreadyUsed]
+		return result, nil
+	}
+
+	// Work out over-travel before marking, so a failure leaves the ticket usable
+	destStop, err := s.repo.GetStop(req.RouteID, snap.EndDestination)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify destination stop: %w", err)
+	}
+	var extraFare domain.Money
+	if req.CurrentStoppage.Order > destStop.Order {
+		extraFare, err = s.repo.CalculateFare(req.RouteID, snap.EndDestination, req.CurrentStoppage.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate extra fare: %w", err)
+		}
+	}
+
+	to := StateChecked
+	if extraFare > 0 {
+		to = StateOverTravelDue
+	}
+
+	// Postgres keeps microseconds; truncating lets the check event replay as the same check
+	checkedAt := time.Now().Truncate(time.Microsecond)
+	moved, err := s.repo.Transition(Transition{
+		TicketIDs:          []int64{snap.TicketID},
+		To:                 to,
+		Actor:              ActorBus(req.RegistrationNumber),
+		Reason:             "checked at " + req.CurrentStoppage.Name,
+		RegistrationNumber: req.RegistrationNumber,
+		CheckedAt:          checkedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(moved) == 0 {
+		// Someone else changed the ticket first; report what it is now
+		s.redis.Del(s.ctx, fmt.Sprintf("ticket_valid:%s", qrCode))
+		t, err := s.repo.Get(snap.TicketID)
+		if err != nil {
+			return nil, err
+		}
+		result.Status = stateCheckStatus(State(t.Status))
+		result.Message = checkMessages[result.Status]
+		return result, nil
+	}
+	s.markCheckedInCache(qrCode)
+
+	s.publishCheck(CheckEvent{
+		TicketID:        snap.TicketID,
+		QRCode:          qrCode,
+		RouteID:         req.RouteID,
+		CurrentStoppage: req.CurrentStoppage.Name,
+		CheckedAt:       checkedAt,
+		BusName:         req.RegistrationNumber,
+	})
+
+	result.Success = true
+	if extraFare > 0 {
+		result.Status = CheckOverTravel
+		result.Message = fmt.Sprintf("Over-travel detected. Pay extra: %s", extraFare)
+		result.ExtraFare = extraFare
+		result.CurrentStoppage = req.CurrentStoppage.Name
+		return result, nil
+	}
+	result.Status = CheckValid
+	result.Message = checkMessages[CheckValid]
+	return result, nil
+}
+
+var checkMessages = map[CheckStatus]string{
+	CheckValid:        "Ticket Valid",
+	CheckAlreadyUsed:  "Ticket already used",
+	CheckInvalidRoute: "Ticket is not for this route",
+	CheckCancelled:    "Ticket has been cancelled",
+	CheckUnpaid:       "Ticket is unpaid",
+	CheckExpired:      "Ticket has expired",
+	CheckNotFound:     "Ticket not found",
+}
+
+// loadSnapshot returns the cached state of a ticket, loading and caching it
+// from Postgres on a miss. When the ticket cannot be used at all it returns a
+// nil snapshot and the reason.
+func (s *service) loadSnapshot(qrCode string) (*ticketSnapshot, CheckStatus, error) {
+	key := fmt.Sprintf("ticket_valid:%s", qrCode)
+
+	val, err := s.redis.Get(s.ctx, key).Result()
+	if err == nil {
+		var snap ticketSnapshot
+		if err := json.Unmarshal([]byte(val), &snap); err == nil {
+			return &snap, "", nil
+		}
+	} else if err != redis.Nil {
+		return nil, "", err
+	}
+
+	t, err := s.repo.GetByQRCode(qrCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, CheckNotFound, nil
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	state := State(t.Status)
+	switch state {
+	case StatePaid, StateChecked, StateOverTravelDue:
+	default:
+		return nil, stateCheckStatus(state), nil
+	}
+	// The expiry job may not have run yet
+	if state == StatePaid && !time.Now().Before(t.ValidUntil) {
+		return nil, CheckExpired, nil
+	}
+	return s.cacheTicket(t), "", nil
+}
+
+// cacheTicket caches the snapshot of a usable ticket until the ticket
+// expires, and returns it.
+func (s *service) cacheTicket(t *domain.Ticket) *ticketSnapshot {
+	state := State(t.Status)
+	snap := &ticketSnapshot{
+		TicketID:         t.Id,
+		RouteID:          t.RouteId,
+		StartDestination: t.StartDestination,
+		EndDestination:   t.EndDestination,
+		UserID:           t.UserId,
+		CreatedAt:        t.CreatedAt,
+		Checked:          state == StateChecked || state == StateOverTravelDue,
+	}
+	if ttl := time.Until(t.ValidUntil); ttl > 0 {
+		snapJSON, _ := json.Marshal(snap)
+		s.redis.Set(s.ctx, fmt.Sprintf("ticket_valid:%s", t.QRCode), snapJSON, ttl)
+	}
+	return snap
+}
+
+// stateCheckStatus is the check outcome for a ticket in a state that cannot
+// be checked.
+func stateCheckStatus(state State) CheckStatus {
+	switch state {
+	case StatePendingPayment:
+		return CheckUnpaid
+	case StateCancelled, StateRefunded:
+		return CheckCancelled
+	case StateExpired:
+		return CheckExpired
+	default:
+		return CheckAlreadyUsed
+	}
+}
+
+// publishCheck hands a recorded check to the check worker for follow-up work.
+func (s *service) publishCheck(event CheckEvent) {
+	eventJSON, _ := json.Marshal(event)
+
+	q, err := s.rabbitMQ.DeclareQueue("ticket_check_queue")
+	if err == nil {
+		s.rabbitMQ.Channel.Publish(
+			"",     // exchange
+			q.Name, // routing key
+			false,  // mandatory
+			false,  // immediate
+			amqp.Publishing{
+				ContentType: "application/json",
+				Body:        eventJSON,
+			})
+	}
+}
@@ -59,7 +59,7 @@ func (w *TicketCheckWorker) Start() {
 		for d := range msgs {
 			log.Printf("Received a check event: %s", d.Body)
 
-			var event map[string]interface{}
+			var event CheckEvent
 			err := json.Unmarshal(d.Body, &event)
 			if err != nil {
 				log.Printf("Error decoding JSON: %s", err)
@@ -74,23 +74,22 @@ func (w *TicketCheckWorker) Start() {
 	<-forever
 }
 
-func (w *TicketCheckWorker) ProcessCheck(event map[string]interface{}) {
-	ticketID := int64(event["ticket_id"].(float64))
-	// currentStoppage := event["current_stoppage"].(string)
-
-	busName, _ := event["bus_name"].(string)
-
-	// 1. Update Ticket Status in DB
-	// We need a method in repo to mark as checked.
-	// Reusing ValidateTicket or creating a new one.
-	// ValidateTicket in repo updates `checked` to true.
-	if err := w.repo.ValidateTicket(ticketID, busName); err != nil {
+// ProcessCheck records a live ticket check. Offline scans uploaded by buses
+// are recorded through the same Service.RecordCheck.
+func (w *TicketCheckWorker) ProcessCheck(event CheckEvent) {
+	conflict, err := w.svc.RecordCheck(event)
+	if err != nil {
 		log.Printf("Failed to update ticket status in DB: %v", err)
+		return
+	}
+	if conflict != nil {
+		log.Printf("Ticket %d check at %s not recorded: %s", event.TicketID, event.CurrentStoppage, conflict.Message)
+		return
 	}
 
-	// 2. Extra Fare Logic (Placeholder)
+	// Extra Fare Logic (Placeholder)
 	// Compare currentStoppage with ticket.EndDestination
 	// If different/further, calculate extra fare.
 	// For now, just log it.
-	log.Printf("Ticket %d checked at %s", ticketID, event["current_stoppage"])
+	log.Printf("Ticket %d checked at %s", event.TicketID, event.CurrentStoppage)
 }
@@ -0,0 +1,104 @@
+package ticket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"swift_transit/domain"
+)
+
+// Prefix of rotating in-app ticket codes
+const dynamicQRPrefix = "STD"
+
+const (
+	// A dynamic code changes every step
+	dynamicQRStep = 30 * time.Second
+
+	// Codes from this many steps before or after the current one are
+	// accepted, to tolerate clock drift between phone and server
+	dynamicQRSkew = 1
+
+	dynamicQRDigits = 8
+)
+
+// DynamicQR derives the codes the app shows instead of a static QR, so a
+// screenshot of a ticket stops working within a minute. Each ticket has its
+// own secret, derived from the server secret, that the app turns into a code
+// for the current time step:
+//
+//	STD.<ticket id>.<code>
+//
+// where code is the last 8 decimal digits of an RFC 4226 style truncation of
+// HMAC-SHA256(secret, big-endian uint64 of unix time / 30).
+type DynamicQR struct {
+	master []byte
+}
+
+func NewDynamicQR(secret string) *DynamicQR {
+	return &DynamicQR{master: []byte("ticket-dynamic-qr:" + secret)}
+}
+
+// Secret returns the per-ticket secret given to the ticket's owner,
+// base64url encoded without padding.
+func (d *DynamicQR) Secret(t *domain.Ticket) string {
+	return base64.RawURLEncoding.EncodeToString(d.secret(t))
+}
+
+func (d *DynamicQR) secret(t *domain.Ticket) []byte {
+	mac := hmac.New(sha256.New, d.master)
+	fmt.Fprintf(mac, "%d:%s", t.Id, t.QRCode)
+	return mac.Sum(nil)
+}
+
+// Verify reports whether code, the last part of a scanned dynamic QR, is
+// the ticket's code at now or within the skew tolerance.
+func (d *DynamicQR) Verify(t *domain.Ticket, code string, now time.Time) bool {
+	secret := d.secret(t)
+	step := dynamicStep(now)
+	for i := int64(-dynamicQRSkew); i <= dynamicQRSkew; i++ {
+		if hmac.Equal([]byte(dynamicCode(secret, step+i)), []byte(code)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDynamicQR splits a scanned dynamic QR into its ticket ID and code.
+func ParseDynamicQR(scanned string) (int64, string, error) {
+	parts := strings.Split(scanned, ".")
+	if len(parts) != 3 || parts[0] != dynamicQRPrefix || len(parts[2]) != dynamicQRDigits {
+		return 0, "", fmt.Errorf("malformed ticket code")
+	}
+	ticketID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed ticket code")
+	}
+	return ticketID, parts[2], nil
+}
+
+// IsDynamicQR reports whether a scanned QR holds a rotating in-app code.
+func IsDynamicQR(qr string) bool {
+	return strings.HasPrefix(qr, dynamicQRPrefix+".")
+}
+
+func dynamicStep(t time.Time) int64 {
+	return t.Unix() / int64(dynamicQRStep/time.Second)
+}
+
+func dynamicCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", dynamicQRDigits, value%100000000)
+}
@@ -0,0 +1,93 @@
+package ticket
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	expiryInterval  = time.Minute
+	expiryBatchSize = 500
+)
+
+// ExpireTickets moves tickets whose validity ended before now, unused or
+// still unpaid, to expired. That frees their per-route purchase slots, and
+// the promo codes of orders never paid. It returns how many tickets expired.
+func (s *service) ExpireTickets(now time.Time) (int, error) {
+	expired := 0
+	for {
+		ids, err := s.repo.GetExpiredTicketIDs(now, expiryBatchSize)
+		if err != nil {
+			return expired, err
+		}
+		if len(ids) == 0 {
+			return expired, nil
+		}
+
+		moved, err := s.repo.Transition(Transition{
+			TicketIDs: ids,
+			To:        StateExpired,
+			Actor:     ActorSystem,
+			Reason:    "validity ended",
+		})
+		if err != nil {
+			return expired, err
+		}
+		expired += len(moved)
+		s.releaseUnpaidOrders(moved)
+
+		if len(ids) < expiryBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// releaseUnpaidOrders gives back the promo codes of orders whose tickets
+// expired before they were paid.
+func (s *service) releaseUnpaidOrders(ticketIDs []int64) {
+	if len(ticketIDs) == 0 {
+		return
+	}
+	orderIDs, err := s.repo.GetUnpaidOrderIDs(ticketIDs)
+	if err != nil {
+		log.Printf("failed to find unpaid orders of expired tickets: %v", err)
+		return
+	}
+	for _, orderID := range orderIDs {
+		if err := s.promos.ReleaseOrder(orderID); err != nil {
+			log.Printf("failed to release promo code of order %d: %v", orderID, err)
+		}
+	}
+}
+
+// ExpiryWorker periodically expires tickets past their validity window and
+// closes RFID trips never tapped off. Running it on several instances is
+// safe, as each ticket expires once and each trip closes once.
+type ExpiryWorker struct {
+	svc Service
+}
+
+func NewExpiryWorker(svc Service) *ExpiryWorker {
+	return &ExpiryWorker{svc: svc}
+}
+
+func (w *ExpiryWorker) Start() {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := w.svc.ExpireTickets(time.Now())
+		if err != nil {
+			log.Printf("Failed to expire tickets: %v", err)
+		} else if n > 0 {
+			log.Printf("Expired %d ticket(s)", n)
+		}
+		n, err = w.svc.ResolveRFIDTrips(time.Now())
+		if err != nil {
+			log.Printf("Failed to resolve RFID trips: %v", err)
+		} else if n > 0 {
+			log.Printf("Closed %d RFID trip(s) without tap-off", n)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,213 @@
+package ticket
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/model"
+	"swift_transit/pass"
+	"swift_transit/user"
+)
+
+// fakeUnitOfWork runs fn against one fakeTx and keeps its writes only when
+// fn succeeds, as a database transaction would.
+type fakeUnitOfWork struct {
+	tx *fakeTx
+}
+
+func (u *fakeUnitOfWork) Do(fn func(tx Tx) error) error {
+	staged := u.tx.clone()
+	if err := fn(staged); err != nil {
+		return err
+	}
+	*u.tx = *staged
+	return nil
+}
+
+// fakeTx stands in for the database. Methods a test does not set up panic
+// through the embedded nil Tx.
+type fakeTx struct {
+	Tx
+
+	users        map[int64]*domain.User
+	capSpent     domain.Money // What SumFares reports
+	settle       bool         // Whether the payment attempt is still open
+	paidTickets  []int64      // Tickets a transition to paid moves
+	orderStatus  map[int64]string
+	tickets      []domain.Ticket
+	transactions []model.Transaction
+}
+
+func newFakeTx() *fakeTx {
+	return &fakeTx{users: map[int64]*domain.User{}, orderStatus: map[int64]string{}}
+}
+
+func (t *fakeTx) clone() *fakeTx {
+	c := *t
+	c.users = map[int64]*domain.User{}
+	for id, u := range t.users {
+		copied := *u
+		c.users[id] = &copied
+	}
+	c.orderStatus = map[int64]string{}
+	for id, status := range t.orderStatus {
+		c.orderStatus[id] = status
+	}
+	c.tickets = append([]domain.Ticket(nil), t.tickets...)
+	c.transactions = append([]model.Transaction(nil), t.transactions...)
+	return &c
+}
+
+func (t *fakeTx) LockUser(userID int64) (*domain.User, error) {
+	u, ok := t.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("user %d not found", userID)
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (t *fakeTx) SumFares(userID int64, ticketType string, since time.Time, excludeTicketID int64) (domain.Money, error) {
+	return t.capSpent, nil
+}
+
+func (t *fakeTx) DeductBalance(userID int64, amount domain.Money, posting domain.WalletPosting) error {
+	u, ok := t.users[userID]
+	if !ok || u.Balance < amount {
+		return domain.ErrInsufficientBalance
+	}
+	u.Balance -= amount
+	return nil
+}
+
+func (t *fakeTx) CreditBalance(userID int64, amount domain.Money, posting domain.WalletPosting) error {
+	u, ok := t.users[userID]
+	if !ok {
+		return fmt.Errorf("user %d not found", userID)
+	}
+	u.Balance += amount
+	return nil
+}
+
+func (t *fakeTx) CreateTicket(tk *domain.Ticket, actor, reason string) error {
+	tk.Id = int64(len(t.tickets) + 1)
+	t.tickets = append(t.tickets, *tk)
+	return nil
+}
+
+func (t *fakeTx) CreateTransaction(tr model.Transaction) error {
+	t.transactions = append(t.transactions, tr)
+	return nil
+}
+
+func (t *fakeTx) SettlePaymentAttempt(tranID, status string) (bool, error) {
+	settled := t.settle
+	t.settle = false
+	return settled, nil
+}
+
+func (t *fakeTx) Transition(tr Transition) ([]int64, error) {
+	if tr.To == StatePaid {
+		return t.paidTickets, nil
+	}
+	return tr.TicketIDs, nil
+}
+
+func (t *fakeTx) UpdateOrderStatus(orderID int64, status string) error {
+	t.orderStatus[orderID] = status
+	return nil
+}
+
+func (t *fakeTx) UpdateOrderPaymentStatus(orderID int64, status string, markUsed bool) error {
+	return nil
+}
+
+type fakeOrders struct {
+	OrderRepo
+
+	order   *domain.Order
+	attempt *domain.PaymentAttempt
+}
+
+func (o *fakeOrders) Get(id int64) (*domain.Order, error) {
+	return o.order, nil
+}
+
+func (o *fakeOrders) GetPaymentAttempt(tranID string) (*domain.PaymentAttempt, error) {
+	return o.attempt, nil
+}
+
+// fakeTickets finds no tickets, so nothing is cached and no tap is taken
+// for a repeat.
+type fakeTickets struct {
+	TicketRepo
+
+	fare       domain.Money
+	companions int
+}
+
+func (r *fakeTickets) Get(id int64) (*domain.Ticket, error) {
+	return nil, fmt.Errorf("ticket %d not found", id)
+}
+
+func (r *fakeTickets) GetLatestTicket(userId int64, routeId int64) (*domain.Ticket, error) {
+	return nil, nil
+}
+
+func (r *fakeTickets) CalculateFare(routeId int64, start, end string) (domain.Money, error) {
+	return r.fare, nil
+}
+
+func (r *fakeTickets) GetCardCompanions(uid string) (int, error) {
+	return r.companions, nil
+}
+
+type fakeUsers struct {
+	user.UserRepo
+
+	riders    map[string]*domain.User
+	guardians map[int64]*domain.User
+}
+
+func (u *fakeUsers) FindByRFID(rfid string) (*domain.User, error) {
+	rider, ok := u.riders[rfid]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *rider
+	return &copied, nil
+}
+
+func (u *fakeUsers) GetSharedGuardian(dependentID int64) (*domain.User, error) {
+	guardian, ok := u.guardians[dependentID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *guardian
+	return &copied, nil
+}
+
+// fakePasses covers every ride of the users holding a pass.
+type fakePasses struct {
+	holders map[int64]*domain.Pass
+}
+
+func (p *fakePasses) Ride(req pass.RideRequest) (*pass.RideResult, error) {
+	if held, ok := p.holders[req.UserId]; ok {
+		return &pass.RideResult{Status: pass.RideValid, Pass: held}, nil
+	}
+	return &pass.RideResult{Status: pass.RideNotFound}, nil
+}
+
+type fakePromos struct {
+	PromoService
+
+	released []int64
+}
+
+func (p *fakePromos) ReleaseOrder(orderID int64) error {
+	p.released = append(p.released, orderID)
+	return nil
+}
@@ -0,0 +1,126 @@
+package ticket
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"swift_transit/domain"
+)
+
+// Fare cap periods
+const (
+	CapDaily  = "daily"  // From local midnight
+	CapWeekly = "weekly" // From local midnight on Monday
+)
+
+// FareCapPolicy limits what a rider is charged for RFID trips in a day and
+// in a week, by fare category.
+type FareCapPolicy struct {
+	caps map[FareCategory]map[string]domain.Money
+}
+
+// FareCap is the outcome of capping one trip.
+type FareCap struct {
+	Charge   domain.Money // What the rider pays
+	FullFare domain.Money
+	Period   string // Cap that reduced the fare, or "" when it was not reduced
+}
+
+// NewFareCapPolicy parses caps given as comma separated "category:period=amount"
+// entries, such as "adult:daily=120,adult:weekly=600". Categories without a
+// cap for a period are not capped in that period.
+func NewFareCapPolicy(spec string) (*FareCapPolicy, error) {
+	p := &FareCapPolicy{caps: make(map[FareCategory]map[string]domain.Money)}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		category, rest, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid fare cap entry %q", entry)
+		}
+		period, value, ok := strings.Cut(rest, "=")
+		if !ok || (period != CapDaily && period != CapWeekly) {
+			return nil, fmt.Errorf("invalid fare cap entry %q, want category:daily=amount or category:weekly=amount", entry)
+		}
+		if _, ok := fareShares[FareCategory(category)]; !ok {
+			return nil, fmt.Errorf("unknown fare category %q in fare caps", category)
+		}
+		amount, err := domain.ParseMoney(value)
+		if err != nil || amount < 0 {
+			return nil, fmt.Errorf("invalid fare cap amount %q", value)
+		}
+		if p.caps[FareCategory(category)] == nil {
+			p.caps[FareCategory(category)] = make(map[string]domain.Money)
+		}
+		p.caps[FareCategory(category)][period] = amount
+	}
+
+	return p, nil
+}
+
+// PeriodStart returns when the cap period containing now began.
+func PeriodStart(period string, now time.Time) time.Time {
+	local := now.In(time.Local)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+	if period == CapWeekly {
+		daysSinceMonday := (int(midnight.Weekday()) + 6) % 7
+		return midnight.AddDate(0, 0, -daysSinceMonday)
+	}
+	return midnight
+}
+
+// Enabled reports whether riders of category have any cap.
+func (p *FareCapPolicy) Enabled(category FareCategory) bool {
+	return len(p.caps[category]) > 0
+}
+
+// Apply caps a fare given what the rider has already been charged in each
+// period. The tightest cap wins.
+func (p *FareCapPolicy) Apply(category FareCategory, fare domain.Money, spent map[string]domain.Money) FareCap {
+	result := FareCap{Charge: fare, FullFare: fare}
+	for _, period := range []string{CapDaily, CapWeekly} {
+		limit, ok := p.caps[category][period]
+		if !ok {
+			continue
+		}
+		remaining := domain.MaxMoney(limit-spent[period], 0)
+		if remaining < result.Charge {
+			result.Charge = remaining
+			result.Period = period
+		}
+	}
+	return result
+}
+
+// fareSums reads what riders were charged; a Tx, so a cap is worked out with
+// the rider locked and concurrent taps cannot both stay under it.
+type fareSums interface {
+	SumFares(userID int64, ticketType string, since time.Time, excludeTicketID int64) (domain.Money, error)
+}
+
+// capFare caps the fare of an RFID trip by what the rider has been charged
+// for RFID trips so far today and this week, not counting the ticket
+// excludeTicketID whose fare is being settled.
+func (s *service) capFare(sums fareSums, u *domain.User, fare domain.Money, now time.Time, excludeTicketID int64) (FareCap, error) {
+	category := FareAdult
+	if u.IsStudent {
+		category = FareStudent
+	}
+	if !s.fareCaps.Enabled(category) {
+		return FareCap{Charge: fare, FullFare: fare}, nil
+	}
+
+	spent := make(map[string]domain.Money)
+	for _, period := range []string{CapDaily, CapWeekly} {
+		total, err := sums.SumFares(u.Id, TypeRFID, PeriodStart(period, now), excludeTicketID)
+		if err != nil {
+			return FareCap{}, err
+		}
+		spent[period] = total
+	}
+	return s.fareCaps.Apply(category, fare, spent), nil
+}
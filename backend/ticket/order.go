@@ -0,0 +1,330 @@
+package ticket
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/ledger"
+	"swift_transit/model"
+)
+
+// OrderStatus is the state of a purchase as a whole. The tickets in it keep
+// their own states.
+type OrderStatus string
+
+const (
+	OrderPendingPayment     OrderStatus = "pending_payment"
+	OrderPaid               OrderStatus = "paid"
+	OrderFailed             OrderStatus = "failed" // Payment failed or was abandoned
+	OrderPartiallyCancelled OrderStatus = "partially_cancelled"
+	OrderCancelled          OrderStatus = "cancelled"
+)
+
+// Outcomes of a payment attempt
+const (
+	PaymentInitiated = "initiated"
+	PaymentPaid      = "paid"
+	PaymentFailed    = "failed"
+	PaymentCancelled = "cancelled"
+)
+
+// FareCategory decides what share of the full fare a passenger pays.
+type FareCategory string
+
+const (
+	FareAdult   FareCategory = "adult"
+	FareStudent FareCategory = "student"
+	FareChild   FareCategory = "child"
+)
+
+// fareShares is the percentage of the full fare each category pays.
+var fareShares = map[FareCategory]int64{
+	FareAdult:   100,
+	FareStudent: 50,
+	FareChild:   50,
+}
+
+// PassengerFare is the fare one passenger of a purchase pays, after the
+// share of a promo discount in Discount.
+type PassengerFare struct {
+	Category FareCategory `json:"category"`
+	Fare     domain.Money `json:"fare"`
+	Discount domain.Money `json:"discount,omitempty"`
+}
+
+// passengerFares prices each passenger of a purchase from the full fare.
+func passengerFares(fullFare domain.Money, categories []FareCategory) ([]PassengerFare, error) {
+	fares := make([]PassengerFare, 0, len(categories))
+	for _, category := range categories {
+		share, ok := fareShares[category]
+		if !ok {
+			return nil, fmt.Errorf("unknown fare category %q", category)
+		}
+		fares = append(fares, PassengerFare{Category: category, Fare: fullFare.MulRatio(share, 100)})
+	}
+	return fares, nil
+}
+
+// GetOrder returns an order owned by userID with its items and payment attempts.
+func (s *service) GetOrder(userID int64, orderID int64) (*domain.Order, error) {
+	order, err := s.orders.Get(orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("order not found")
+	} else if err != nil {
+		return nil, err
+	}
+	if order.UserId != userID {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	return order, nil
+}
+
+// HandlePaymentResult applies a failed or cancelled gateway result to the
+// order the payment attempt tranID was opened for, and returns the order.
+// Payments are only completed through CompletePayment, once the gateway
+// confirms them.
+func (s *service) HandlePaymentResult(tranID string, status string) (*domain.Order, error) {
+	if status == PaymentPaid {
+		return nil, fmt.Errorf("payments must be validated with the gateway")
+	}
+	attempt, err := s.orders.GetPaymentAttempt(tranID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payment not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := s.failOrderPayment(attempt, status); err != nil {
+		return nil, err
+	}
+	return s.orders.Get(attempt.OrderId)
+}
+
+// CompletePayment pays the order of attempt tranID once the gateway
+// confirms valID paid the attempt's amount, and returns the order.
+func (s *service) CompletePayment(tranID, valID string) (*domain.Order, error) {
+	attempt, err := s.orders.GetPaymentAttempt(tranID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payment not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateGatewayPayment(valID, tranID, attempt.Amount); err != nil {
+		return nil, err
+	}
+	if err := s.payOrder(attempt); err != nil {
+		return nil, err
+	}
+	return s.orders.Get(attempt.OrderId)
+}
+
+// validateGatewayPayment asks the gateway whether valID is a valid payment
+// of exactly amount for tranID.
+func (s *service) validateGatewayPayment(valID, tranID string, amount domain.Money) error {
+	resp, err := s.sslCommerz.ValidateTransaction(valID)
+	if err != nil {
+		return fmt.Errorf("validation api failed: %w", err)
+	}
+	if resp.Status != "VALID" && resp.Status != "VALIDATED" {
+		return fmt.Errorf("invalid transaction status: %s", resp.Status)
+	}
+	if resp.TranID != "" && resp.TranID != tranID {
+		return fmt.Errorf("transaction mismatch")
+	}
+
+	// Exactly to the poisha
+	paid, err := resp.PaidAmount()
+	if err != nil {
+		return err
+	}
+	if paid != amount {
+		return fmt.Errorf("amount mismatch: expected %s, got %s", amount, paid)
+	}
+	return nil
+}
+
+// payOrder marks an order paid through attempt, settling the attempt,
+// the tickets, the order and its statement entry in one transaction. Only the
+// first result of an attempt is applied, so repeated callbacks are harmless.
+// Tickets that expired while the payment was at the gateway are not issued;
+// what was paid for them is credited to the rider's wallet instead.
+func (s *service) payOrder(attempt *domain.PaymentAttempt) error {
+	order, err := s.orders.Get(attempt.OrderId)
+	if err != nil {
+		return err
+	}
+
+	settled := false
+	var moved []int64
+	var credit domain.Money
+	err = s.uow.Do(func(tx Tx) error {
+		var err error
+		settled, err = tx.SettlePaymentAttempt(attempt.TranID, PaymentPaid)
+		if err != nil || !settled {
+			return err
+		}
+
+		moved, err = tx.Transition(Transition{
+			OrderID: order.Id,
+			From:    []State{StatePendingPayment},
+			To:      StatePaid,
+			Actor:   ActorPaymentGateway,
+			Reason:  "payment " + attempt.TranID,
+		})
+		if err != nil {
+			return err
+		}
+		status := OrderPaid
+		credit = unissuedFares(order, moved)
+		if credit > 0 {
+			status = OrderPartiallyCancelled
+			if len(moved) == 0 {
+				status = OrderCancelled
+			}
+		}
+		if err := tx.UpdateOrderPaymentStatus(order.Id, "paid", true); err != nil {
+			return err
+		}
+		if err := tx.UpdateOrderStatus(order.Id, string(status)); err != nil {
+			return err
+		}
+		if err := tx.CreateTransaction(model.Transaction{
+			UserID:        int(order.UserId),
+			Amount:        order.TotalFare,
+			Type:          "purchase",
+			Description:   fmt.Sprintf("Ticket Purchase - %s (x%d)", order.BusName, len(order.Items)),
+			PaymentMethod: "Online",
+			CreatedAt:     time.Now(),
+		}); err != nil {
+			return err
+		}
+		if credit == 0 {
+			return nil
+		}
+
+		description := fmt.Sprintf("Ticket Refund - %s (expired before payment)", order.BusName)
+		if err := tx.CreditBalance(order.UserId, credit, domain.WalletPosting{
+			Account:     ledger.AccountGateway,
+			Kind:        ledger.KindRefund,
+			Description: description,
+			Reference:   attempt.TranID,
+		}); err != nil {
+			return err
+		}
+		return tx.CreateTransaction(model.Transaction{
+			UserID:        int(order.UserId),
+			Amount:        credit,
+			Type:          "refund",
+			Description:   description,
+			PaymentMethod: "Wallet",
+			CreatedAt:     time.Now(),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if !settled {
+		current, err := s.orders.GetPaymentAttempt(attempt.TranID)
+		if err != nil {
+			return err
+		}
+		if current.Status == PaymentPaid {
+			return nil
+		}
+		return fmt.Errorf("payment link already used")
+	}
+
+	if len(moved) == 0 {
+		// No ticket was issued, so the promo code is not used up
+		return s.promos.ReleaseOrder(order.Id)
+	}
+	for _, id := range moved {
+		if t, err := s.repo.Get(id); err == nil {
+			s.cacheTicket(t)
+		}
+	}
+	return nil
+}
+
+// unissuedFares is what was paid for the tickets of an order that are not
+// among the issued ones.
+func unissuedFares(order *domain.Order, issued []int64) domain.Money {
+	var total domain.Money
+	for _, item := range order.Items {
+		if !slices.Contains(issued, item.TicketId) {
+			total += item.Fare
+		}
+	}
+	return total
+}
+
+// failOrderPayment cancels the tickets of an order whose payment failed or
+// was abandoned.
+func (s *service) failOrderPayment(attempt *domain.PaymentAttempt, status string) error {
+	settled := false
+	err := s.uow.Do(func(tx Tx) error {
+		var err error
+		settled, err = tx.SettlePaymentAttempt(attempt.TranID, status)
+		if err != nil || !settled {
+			return err
+		}
+
+		if _, err := tx.Transition(Transition{
+			OrderID: attempt.OrderId,
+			To:      StateCancelled,
+			Actor:   ActorPaymentGateway,
+			Reason:  "payment " + status,
+		}); err != nil {
+			return err
+		}
+		if err := tx.UpdateOrderPaymentStatus(attempt.OrderId, status, true); err != nil {
+			return err
+		}
+		return tx.UpdateOrderStatus(attempt.OrderId, string(OrderFailed))
+	})
+	if err != nil || !settled {
+		return err
+	}
+	// The order never paid, so its promo code is not used up
+	return s.promos.ReleaseOrder(attempt.OrderId)
+}
+
+// refreshOrderStatus derives the status of a paid order from its tickets
+// after some of them were cancelled.
+func (s *service) refreshOrderStatus(orderID int64) {
+	order, err := s.orders.Get(orderID)
+	if err != nil {
+		log.Printf("failed to load order %d: %v", orderID, err)
+		return
+	}
+
+	cancelled := 0
+	for _, item := range order.Items {
+		switch State(item.TicketStatus) {
+		case StateCancelled, StateRefunded:
+			cancelled++
+		}
+	}
+
+	status := OrderPaid
+	if cancelled == len(order.Items) {
+		status = OrderCancelled
+	} else if cancelled > 0 {
+		status = OrderPartiallyCancelled
+	}
+	if err := s.orders.UpdateStatus(orderID, string(status)); err != nil {
+		log.Printf("failed to update order %d: %v", orderID, err)
+	}
+	// A cancelled order gives its promo code back
+	if status == OrderCancelled {
+		if err := s.promos.ReleaseOrder(orderID); err != nil {
+			log.Printf("failed to release promo code of order %d: %v", orderID, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package ticket
+
+import (
+	"testing"
+
+	"swift_transit/domain"
+)
+
+func TestPayOrderCreditsExpiredTickets(t *testing.T) {
+	tests := []struct {
+		name         string
+		paidTickets  []int64
+		wantStatus   OrderStatus
+		wantCredit   domain.Money
+		wantReleased bool
+	}{
+		{name: "all issued", paidTickets: []int64{11, 12}, wantStatus: OrderPaid},
+		{name: "some expired", paidTickets: []int64{11}, wantStatus: OrderPartiallyCancelled, wantCredit: 200},
+		{name: "all expired", paidTickets: nil, wantStatus: OrderCancelled, wantCredit: 500, wantReleased: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &domain.Order{
+				Id:        7,
+				UserId:    3,
+				BusName:   "Dhaka Metro 11",
+				TotalFare: 500,
+				Items: []domain.OrderItem{
+					{TicketId: 11, Fare: 300},
+					{TicketId: 12, Fare: 200},
+				},
+			}
+			attempt := &domain.PaymentAttempt{OrderId: 7, TranID: "TXN-7", Amount: 500}
+
+			tx := newFakeTx()
+			tx.users[3] = &domain.User{Id: 3, Balance: 1000}
+			tx.settle = true
+			tx.paidTickets = tt.paidTickets
+			promos := &fakePromos{}
+			s := &service{
+				repo:   &fakeTickets{},
+				orders: &fakeOrders{order: order, attempt: attempt},
+				uow:    &fakeUnitOfWork{tx: tx},
+				promos: promos,
+			}
+
+			if err := s.payOrder(attempt); err != nil {
+				t.Fatalf("payOrder returned %v", err)
+			}
+
+			if got := tx.orderStatus[7]; got != string(tt.wantStatus) {
+				t.Errorf("order status = %q, want %q", got, tt.wantStatus)
+			}
+			if got := tx.users[3].Balance - 1000; got != tt.wantCredit {
+				t.Errorf("credited %s, want %s", got, tt.wantCredit)
+			}
+			wantTransactions := 1
+			if tt.wantCredit > 0 {
+				wantTransactions = 2
+			}
+			if len(tx.transactions) != wantTransactions {
+				t.Errorf("wrote %d statement rows, want %d", len(tx.transactions), wantTransactions)
+			}
+			if released := len(promos.released) > 0; released != tt.wantReleased {
+				t.Errorf("promo released = %v, want %v", released, tt.wantReleased)
+			}
+		})
+	}
+}
+
+func TestPayOrderAppliesAttemptOnce(t *testing.T) {
+	order := &domain.Order{Id: 7, UserId: 3, TotalFare: 500, Items: []domain.OrderItem{{TicketId: 11, Fare: 500}}}
+	attempt := &domain.PaymentAttempt{OrderId: 7, TranID: "TXN-7", Amount: 500, Status: PaymentPaid}
+
+	tx := newFakeTx()
+	tx.users[3] = &domain.User{Id: 3, Balance: 1000}
+	s := &service{
+		repo:   &fakeTickets{},
+		orders: &fakeOrders{order: order, attempt: attempt},
+		uow:    &fakeUnitOfWork{tx: tx},
+		promos: &fakePromos{},
+	}
+
+	// The attempt was already settled as paid by an earlier callback
+	if err := s.payOrder(attempt); err != nil {
+		t.Fatalf("payOrder returned %v", err)
+	}
+	if tx.users[3].Balance != 1000 || len(tx.transactions) != 0 {
+		t.Errorf("a repeated callback changed the wallet or statement")
+	}
+}
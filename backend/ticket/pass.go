@@ -0,0 +1,67 @@
+package ticket
+
+import (
+	"time"
+
+	"swift_transit/pass"
+)
+
+// CheckedPass identifies the pass a check was made against.
+type CheckedPass struct {
+	ID         int64      `json:"id"`
+	ProductID  int64      `json:"product_id"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+var passCheckStatuses = map[pass.RideStatus]CheckStatus{
+	pass.RideValid:       CheckValid,
+	pass.RideRepeat:      CheckAlreadyUsed,
+	pass.RideInUse:       CheckAlreadyUsed,
+	pass.RideNotFound:    CheckNotFound,
+	pass.RideUnpaid:      CheckUnpaid,
+	pass.RideCancelled:   CheckCancelled,
+	pass.RideNotValidNow: CheckExpired,
+	pass.RideOutOfScope:  CheckInvalidRoute,
+}
+
+var passCheckMessages = map[CheckStatus]string{
+	CheckValid:        "Pass Valid",
+	CheckAlreadyUsed:  "Pass already used on this bus",
+	CheckNotFound:     "Pass not found",
+	CheckUnpaid:       "Pass is unpaid",
+	CheckCancelled:    "Pass has been cancelled",
+	CheckExpired:      "Pass is not valid today",
+	CheckInvalidRoute: "Pass is not valid on this bus",
+}
+
+// checkPass validates a scanned pass. Passes are not used up; each valid
+// scan records a ride.
+func (s *service) checkPass(req CheckTicketRequest) (*CheckTicketResult, error) {
+	ride, err := s.passes.Ride(pass.RideRequest{
+		QRCode:             req.QRCode,
+		RouteId:            req.RouteID,
+		RegistrationNumber: req.RegistrationNumber,
+		Source:             pass.SourceQR,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status := passCheckStatuses[ride.Status]
+	result := &CheckTicketResult{
+		Success: status == CheckValid,
+		Status:  status,
+		Message: passCheckMessages[status],
+	}
+	if ride.Status == pass.RideInUse {
+		result.Message = "Pass is in use on another bus"
+	}
+	if ride.Pass != nil {
+		result.Pass = &CheckedPass{
+			ID:         ride.Pass.Id,
+			ProductID:  ride.Pass.ProductId,
+			ValidUntil: ride.Pass.ValidUntil,
+		}
+	}
+	return result, nil
+}
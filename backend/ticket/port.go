@@ -5,6 +5,8 @@ import (
 
 	"swift_transit/domain"
 	"swift_transit/model"
+	"swift_transit/pass"
+	"swift_transit/promo"
 )
 
 type BuyTicketRequest struct {
@@ -15,24 +17,38 @@ type BuyTicketRequest struct {
 	EndDestination   string `json:"end_destination"`
 	PaymentMethod    string `json:"payment_method"` // "wallet" or "gateway"
 	Quantity         int    `json:"quantity"`
+
+	// Fare category of each passenger; when empty, Quantity adults
+	Passengers []FareCategory `json:"passengers,omitempty"`
+
+	PromoCode string `json:"promo_code,omitempty"`
 }
 
 type TicketRequestMessage struct {
-	UserId           int64   `json:"user_id"`
-	RouteId          int64   `json:"route_id"`
-	BusName          string  `json:"bus_name"`
-	StartDestination string  `json:"start_destination"`
-	EndDestination   string  `json:"end_destination"`
-	Fare             float64 `json:"fare"`
-	TotalFare        float64 `json:"total_fare"`
-	Quantity         int     `json:"quantity"`
-	BatchID          string  `json:"batch_id"`
-	PaymentMethod    string  `json:"payment_method"`
+	UserId           int64        `json:"user_id"`
+	RouteId          int64        `json:"route_id"`
+	BusName          string       `json:"bus_name"`
+	StartDestination string       `json:"start_destination"`
+	EndDestination   string       `json:"end_destination"`
+	Fare             domain.Money `json:"fare"`
+	TotalFare        domain.Money `json:"total_fare"`
+	Quantity         int          `json:"quantity"`
+	BatchID          string       `json:"batch_id"`
+	PaymentMethod    string       `json:"payment_method"`
+
+	Passengers []PassengerFare `json:"passengers,omitempty"`
+
+	// Set when a promo code was applied; TotalFare and the passenger fares
+	// are after Discount
+	PromoId   int64        `json:"promo_id,omitempty"`
+	PromoCode string       `json:"promo_code,omitempty"`
+	Discount  domain.Money `json:"discount,omitempty"`
 }
 
 type BuyTicketResponse struct {
 	Ticket      *domain.Ticket `json:"ticket,omitempty"`
 	TicketIDs   []int64        `json:"ticket_ids,omitempty"`
+	OrderID     int64          `json:"order_id,omitempty"`
 	PaymentURL  string         `json:"payment_url,omitempty"`
 	DownloadURL string         `json:"download_url,omitempty"`
 	Message     string         `json:"message"`
@@ -54,19 +70,30 @@ type CheckTicketRequest struct {
 
 type Service interface {
 	BuyTicket(req BuyTicketRequest) (*BuyTicketResponse, error)
-	UpdatePaymentStatus(id int64) error
-	HandlePaymentResult(id int64, status string) (bool, error)
+	HandlePaymentResult(tranID string, status string) (*domain.Order, error)
+	CompletePayment(tranID, valID string) (*domain.Order, error)
+	GetOrder(userID int64, orderID int64) (*domain.Order, error)
 	DownloadTicket(id int64) ([]byte, error)
 	GetTicketStatus(trackingID string) (*BuyTicketResponse, error)
-	ValidatePayment(valID string, tranID string, amount float64) (bool, error)
+	ValidatePayment(valID string, tranID string, amount domain.Money) (bool, error)
 	GetByUserID(userId int64, limit, offset int) ([]domain.Ticket, int, error)
 	ValidateTicket(id int64) error
+	GetHistory(userID int64, ticketID int64) ([]domain.TicketEvent, error)
 	GetPaymentStatus(ticketID int64) (string, error)
-	CancelTicket(userID int64, ticketID int64) (float64, error)
+	CancelTicket(userID int64, ticketID int64) (domain.Money, error)
 	CreateTransaction(t model.Transaction) error
-	CheckTicket(req CheckTicketRequest) (map[string]interface{}, error)
+	CheckTicket(req CheckTicketRequest) (*CheckTicketResult, error)
 	ProcessRFIDPayment(req RFIDPaymentRequest) (*RFIDPaymentResponse, error)
 	CreateOverTravelTicket(originalTicketID int64, currentStop string, paymentCollected bool) (*domain.Ticket, error)
+	ResolveQR(scanned string) (string, error)
+	PublicKeys() []PublicKey
+	RecordCheck(event CheckEvent) (*CheckConflict, error)
+	Manifest(routeID int64, since *time.Time) (*Manifest, error)
+	SyncScans(req ScanSyncRequest) (*ScanSyncResult, error)
+	ExpireTickets(now time.Time) (int, error)
+	TapOn(req RFIDTapRequest) (*RFIDPaymentResponse, error)
+	TapOff(req RFIDTapRequest) (*RFIDPaymentResponse, error)
+	ResolveRFIDTrips(now time.Time) (int, error)
 }
 
 type RFIDPaymentRequest struct {
@@ -75,29 +102,116 @@ type RFIDPaymentRequest struct {
 	BusName          string `json:"bus_name"`
 	StartDestination string `json:"start_destination"`
 	EndDestination   string `json:"end_destination"`
+
+	// Passengers boarding on this tap, the holder included. Readers set it
+	// when the rider chose a count; without it the tap pays for the holder
+	// and the card's default companions.
+	Passengers int `json:"passengers,omitempty"`
+
+	// Set when the rider asked to pay for more passengers after an earlier
+	// tap, so the tap is never taken for a repeat of it
+	AddPassengers bool `json:"add_passengers,omitempty"`
 }
 
 type RFIDPaymentResponse struct {
-	Success  bool    `json:"success"`
-	Status   string  `json:"status"` // SUCCESS, DUPLICATE, INACTIVE, INSUFFICIENT_BALANCE
-	Message  string  `json:"message"`
-	Balance  float64 `json:"balance"`
-	Fare     float64 `json:"fare"`
-	TicketID int64   `json:"ticket_id,omitempty"`
+	Success  bool         `json:"success"`
+	Status   string       `json:"status"` // SUCCESS, PASS, DUPLICATE, INACTIVE, INSUFFICIENT_BALANCE, TAPPED_ON, TAPPED_OFF, NO_TRIP
+	Message  string       `json:"message"`
+	Balance  domain.Money `json:"balance"`
+	Fare     domain.Money `json:"fare"`
+	TicketID int64        `json:"ticket_id,omitempty"`
+	PassID   int64        `json:"pass_id,omitempty"` // Set when the ride was taken on a pass
+
+	// Set when a tap paid for more than the holder; TicketID is the holder's
+	Passengers int     `json:"passengers,omitempty"`
+	TicketIDs  []int64 `json:"ticket_ids,omitempty"`
+
+	// Set when the rider's balance fell short and their guardian's wallet paid
+	PaidByGuardian bool `json:"paid_by_guardian,omitempty"`
+
+	// Set when a fare cap reduced Fare
+	FullFare domain.Money `json:"full_fare,omitempty"`
+	FareCap  string       `json:"fare_cap,omitempty"`
+
+	// Set for tap-on/tap-off trips
+	TripID        int64        `json:"trip_id,omitempty"`
+	BoardingStop  string       `json:"boarding_stop,omitempty"`
+	AlightingStop string       `json:"alighting_stop,omitempty"`
+	Refund        domain.Money `json:"refund,omitempty"`
 }
 
 type TicketRepo interface {
-	Create(ticket domain.Ticket) (*domain.Ticket, error)
-	UpdateStatus(id int64, status bool) error
+	Create(ticket domain.Ticket, actor, reason string) (*domain.Ticket, error)
 	Get(id int64) (*domain.Ticket, error)
-	CalculateFare(routeId int64, start, end string) (float64, error)
+	CalculateFare(routeId int64, start, end string) (domain.Money, error)
 	GetByUserID(userId int64, limit, offset int) ([]domain.Ticket, int, error)
-	ValidateTicket(id int64, busName string) error
 	CountActiveTicketsByRoute(userId int64, routeId int64) (int, error)
-	UpdateBatchPaymentStatus(batchID string, paid bool, status string, markUsed bool) error
-	CancelTicket(id int64, cancelledAt time.Time, status string) error
-	GetBatchCount(batchID string) (int, error)
+	UpdateOrderPaymentStatus(orderID int64, status string, markUsed bool) error
 	GetStop(routeId int64, stopName string) (*domain.Stop, error)
 	GetByQRCode(qrCode string) (*domain.Ticket, error)
 	GetLatestTicket(userId int64, routeId int64) (*domain.Ticket, error)
+	GetBatch(batchID string) ([]domain.Ticket, error)
+	GetCardCompanions(uid string) (int, error)
+	Transition(t Transition) ([]int64, error)
+	GetEvents(ticketID int64) ([]domain.TicketEvent, error)
+	IsCheckedBy(id int64, registrationNumber string, checkedAt time.Time) (bool, error)
+	GetRouteTicketChanges(routeID int64, since *time.Time) ([]domain.Ticket, time.Time, error)
+	GetExpiredTicketIDs(now time.Time, limit int) ([]int64, error)
+	GetUnpaidOrderIDs(ticketIDs []int64) ([]int64, error)
+	SumFares(userID int64, ticketType string, since time.Time, excludeTicketID int64) (domain.Money, error)
+}
+
+type RFIDTripRepo interface {
+	GetOpen(userID int64) (*domain.RFIDTrip, error)
+	Resolve(id int64, now time.Time) (int, error)
+	GetBusPosition(registrationNumber string, since time.Time) (float64, float64, error)
+	GetNearestStop(routeID int64, lon, lat float64) (*domain.Stop, error)
+	GetLastStop(routeID int64) (*domain.Stop, error)
+}
+
+type OrderRepo interface {
+	Get(id int64) (*domain.Order, error)
+	UpdateStatus(id int64, status string) error
+	CreatePaymentAttempt(attempt domain.PaymentAttempt) (*domain.PaymentAttempt, error)
+	GetPaymentAttempt(tranID string) (*domain.PaymentAttempt, error)
+	SettlePaymentAttempt(tranID, status string) (bool, error)
+}
+
+// UnitOfWork runs fn in one database transaction. Everything fn writes
+// through tx, the wallet debit, the tickets and the statement entry alike,
+// commits if fn returns nil and is rolled back otherwise.
+type UnitOfWork interface {
+	Do(fn func(tx Tx) error) error
+}
+
+// Tx holds the writes of the user, ticket, order, trip and transaction repos
+// that must commit together with a change to a wallet.
+type Tx interface {
+	LockUser(userID int64) (*domain.User, error)
+	SumFares(userID int64, ticketType string, since time.Time, excludeTicketID int64) (domain.Money, error)
+	DeductBalance(userID int64, amount domain.Money, posting domain.WalletPosting) error
+	CreditBalance(userID int64, amount domain.Money, posting domain.WalletPosting) error
+	CreateTicket(t *domain.Ticket, actor, reason string) error
+	CreateOrder(order *domain.Order, actor, reason string) error
+	CreateRFIDTrip(trip *domain.RFIDTrip, t *domain.Ticket, actor, reason string) error
+	CompleteRFIDTrip(trip domain.RFIDTrip, t domain.Ticket) (bool, error)
+	CreateTransaction(t model.Transaction) error
+	RedeemPromo(r *domain.PromoRedemption) error
+	Transition(t Transition) ([]int64, error)
+	SettlePaymentAttempt(tranID, status string) (bool, error)
+	UpdateOrderStatus(orderID int64, status string) error
+	UpdateOrderPaymentStatus(orderID int64, status string, markUsed bool) error
+	AddOrderRefund(orderID, ticketID int64, amount domain.Money) error
+}
+
+// PassService validates rides on passes, which are taken without a ticket.
+type PassService interface {
+	Ride(req pass.RideRequest) (*pass.RideResult, error)
+}
+
+// PromoService prices promo codes applied to purchases, and gives back the
+// codes of orders that were never paid or were cancelled.
+type PromoService interface {
+	Quote(req promo.QuoteRequest) (*promo.Quote, error)
+	ReleaseOrder(orderID int64) error
 }
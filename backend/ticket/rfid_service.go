@@ -1,49 +1,50 @@
 package ticket
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
-	"math"
+	"swift_transit/card"
 	"swift_transit/domain"
+	"swift_transit/ledger"
 	"swift_transit/model"
+	"swift_transit/pass"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 func (s *service) ProcessRFIDPayment(req RFIDPaymentRequest) (*RFIDPaymentResponse, error) {
-	// 1. Find User by RFID
-	user, err := s.userRepo.FindByRFID(req.RFID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid RFID card")
+	// Without a count chosen on the reader the tap pays for the card's
+	// default companions
+	passengers := req.Passengers
+	if passengers == 0 {
+		companions, err := s.repo.GetCardCompanions(req.RFID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read card companions: %w", err)
+		}
+		passengers = 1 + companions
 	}
-
-	// Check if RFID is active
-	if !user.IsRFIDActive {
-		return &RFIDPaymentResponse{
-			Success: false,
-			Status:  "INACTIVE",
-			Message: "RFID card is inactive",
-			Balance: float64(user.Balance),
-			Fare:    0,
-		}, nil
+	if passengers < 1 || passengers > 1+card.MaxCompanions {
+		return nil, fmt.Errorf("passengers must be between 1 and %d", 1+card.MaxCompanions)
 	}
 
-	// Check for double deduction (ticket within last 5 minutes)
-	latestTicket, err := s.repo.GetLatestTicket(user.Id, req.RouteID)
-	if err == nil && latestTicket != nil {
-		createdAt, parseErr := time.Parse(time.RFC3339, latestTicket.CreatedAt)
-		if parseErr == nil {
-			if time.Since(createdAt) < 5*time.Minute && latestTicket.BusName == req.BusName {
-				return &RFIDPaymentResponse{
-					Success:  true,
-					Status:   "DUPLICATE",
-					Message:  "Already paid (recent ticket)",
-					Balance:  float64(user.Balance),
-					Fare:     latestTicket.Fare,
-					TicketID: latestTicket.Id,
-				}, nil
-			}
+	// 1. Find User by RFID
+	user, settled, err := s.rfidRider(req.RFID, req.RouteID, req.BusName)
+	if err != nil {
+		return nil, err
+	}
+	// A pass covers its holder only, so companions still pay their fares
+	var covered *RFIDPaymentResponse
+	if settled != nil {
+		if settled.PassID == 0 || passengers == 1 {
+			return settled, nil
 		}
+		covered = settled
+	}
+	issued := passengers
+	if covered != nil {
+		issued--
 	}
 
 	// 2. Calculate Fare
@@ -51,65 +52,305 @@ func (s *service) ProcessRFIDPayment(req RFIDPaymentRequest) (*RFIDPaymentRespon
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate fare: %w", err)
 	}
-	fare = math.Ceil(fare) // Ensure whole number
+	fare = fare.CeilTaka() // Fares are charged in whole taka
+
+	// The rider stays locked from the duplicate check and working out the
+	// cap to the debit, so concurrent taps cannot both pay or both stay
+	// under it
+	var capped FareCap
+	var total domain.Money
+	var payer *domain.User
+	var dup *RFIDPaymentResponse
+	var tickets []domain.Ticket
+	err = s.uow.Do(func(tx Tx) error {
+		var err error
+		if user, err = tx.LockUser(user.Id); err != nil {
+			return err
+		}
+		if !req.AddPassengers {
+			if dup, err = s.recentRFIDTap(user, req, issued); err != nil || dup != nil {
+				return err
+			}
+		}
+		// Riders stop paying once they reach their daily or weekly cap; the cap
+		// covers the holder's own trips, so companions pay the full fare
+		if covered == nil {
+			capped, err = s.capFare(tx, user, fare, time.Now(), 0)
+			if err != nil {
+				return fmt.Errorf("failed to apply fare cap: %w", err)
+			}
+		}
+		total = capped.Charge + fare.Times(passengers-1)
+
+		// 3. Check Balance
+		payer, err = s.rfidPayer(tx, user, total)
+		if err != nil {
+			return fmt.Errorf("failed to check guardian wallet: %w", err)
+		}
+		if payer == nil {
+			return nil
+		}
+
+		// 4. Deduct Balance and create the tickets (paid and checked) together
+		batchID := uuid.New().String()
+		if covered == nil {
+			holder := rfidTicket(user.Id, req.RouteID, req.BusName, req.StartDestination, req.EndDestination, capped, s.validity)
+			holder.BatchID = batchID
+			tickets = append(tickets, holder)
+		}
+		for len(tickets) < issued {
+			companion := rfidTicket(user.Id, req.RouteID, req.BusName, req.StartDestination, req.EndDestination, FareCap{Charge: fare, FullFare: fare}, s.validity)
+			companion.BatchID = batchID
+			companion.TicketType = TypeRFIDCompanion
+			tickets = append(tickets, companion)
+		}
+		reason := "RFID tap"
+		description := fmt.Sprintf("RFID Trip - %s", req.BusName)
+		if covered != nil {
+			reason = fmt.Sprintf("RFID tap for %d companions of a pass holder", issued)
+			description = fmt.Sprintf("RFID Trip - %s (%d companions, holder on pass)", req.BusName, issued)
+		} else if passengers > 1 {
+			reason = fmt.Sprintf("RFID tap for %d passengers", passengers)
+			description = fmt.Sprintf("RFID Trip - %s (%d passengers)", req.BusName, passengers)
+		}
+		if capped.Period != "" {
+			description = fmt.Sprintf("%s (%s fare cap applied, full fare %s)", description, capped.Period, capped.FullFare)
+		}
+		if payer.Id != user.Id {
+			description = fmt.Sprintf("%s for %s", description, user.Name)
+		}
 
-	// 3. Check Balance
-	if float64(user.Balance) < fare {
-		return &RFIDPaymentResponse{
+		if total > 0 {
+			err := tx.DeductBalance(payer.Id, total, domain.WalletPosting{
+				Account:     ledger.AccountFares,
+				Kind:        ledger.KindFare,
+				Description: description,
+				Reference:   "batch:" + batchID,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to deduct balance: %w", err)
+			}
+		}
+		for i := range tickets {
+			if err := tx.CreateTicket(&tickets[i], ActorBus(req.BusName), reason); err != nil {
+				return fmt.Errorf("failed to create ticket: %w", err)
+			}
+		}
+		// 5. Create Transaction; capped trips are recorded even when free, so
+		// the statement shows the cap
+		return tx.CreateTransaction(model.Transaction{
+			UserID:        int(payer.Id),
+			Amount:        total,
+			Type:          "purchase",
+			Description:   description,
+			PaymentMethod: "RFID",
+			CreatedAt:     time.Now(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dup != nil {
+		if covered != nil {
+			dup.PassID = covered.PassID
+			dup.Passengers = passengers
+		}
+		return dup, nil
+	}
+	if payer == nil {
+		resp := &RFIDPaymentResponse{
 			Success: false,
 			Status:  "INSUFFICIENT_BALANCE",
 			Message: "Insufficient balance",
-			Balance: float64(user.Balance),
-			Fare:    fare,
+			Balance: user.Balance,
+			Fare:    total,
+		}
+		if covered != nil {
+			resp.Message = "Ride covered by pass, insufficient balance for companions"
+			resp.PassID = covered.PassID
+		}
+		return resp, nil
+	}
+
+	resp := &RFIDPaymentResponse{
+		Success:  true,
+		Status:   "SUCCESS",
+		Message:  "Payment successful",
+		Balance:  user.Balance,
+		Fare:     total,
+		TicketID: tickets[0].Id,
+	}
+	if payer.Id == user.Id {
+		resp.Balance -= total
+	} else {
+		resp.Message = "Payment successful from guardian's wallet"
+		resp.PaidByGuardian = true
+	}
+	if covered != nil {
+		resp.Message = fmt.Sprintf("Ride covered by pass. %s for %d companions", resp.Message, issued)
+		resp.PassID = covered.PassID
+		resp.Passengers = passengers
+		for _, t := range tickets {
+			resp.TicketIDs = append(resp.TicketIDs, t.Id)
+		}
+	} else if passengers > 1 {
+		resp.Message = fmt.Sprintf("%s for %d passengers", resp.Message, passengers)
+		resp.Passengers = passengers
+		for _, t := range tickets {
+			resp.TicketIDs = append(resp.TicketIDs, t.Id)
+		}
+	}
+	if capped.Period != "" {
+		resp.Message = fmt.Sprintf("%s, fare capped (%s)", resp.Message, capped.Period)
+		resp.FullFare = capped.FullFare + fare.Times(passengers-1)
+		resp.FareCap = capped.Period
+	}
+	return resp, nil
+}
+
+// recentRFIDTap returns the response to a tap repeating one made on the same
+// bus in the last few minutes, or nil if there was none. issued is the number
+// of tickets the tap would issue.
+func (s *service) recentRFIDTap(user *domain.User, req RFIDPaymentRequest, issued int) (*RFIDPaymentResponse, error) {
+	latest, err := s.repo.GetLatestTicket(user.Id, req.RouteID)
+	if err != nil || latest == nil || latest.BusName != req.BusName {
+		return nil, nil
+	}
+	createdAt, err := time.Parse(time.RFC3339, latest.CreatedAt)
+	if err != nil || time.Since(createdAt) >= tapDuplicateWindow {
+		return nil, nil
+	}
+
+	resp := &RFIDPaymentResponse{
+		Success:  true,
+		Status:   "DUPLICATE",
+		Message:  "Already paid (recent ticket)",
+		Balance:  user.Balance,
+		Fare:     latest.Fare,
+		TicketID: latest.Id,
+	}
+	batch := []domain.Ticket{*latest}
+	if latest.BatchID != "" {
+		if batch, err = s.repo.GetBatch(latest.BatchID); err != nil {
+			return nil, err
+		}
+	}
+	// A count chosen on the reader repeats the earlier tap only when it is
+	// the same count; a different one is a new choice by the rider
+	if req.Passengers != 0 && issued != len(batch) {
+		return nil, nil
+	}
+	if len(batch) > 1 {
+		resp.Fare = 0
+		resp.TicketID = batch[0].Id
+		resp.Passengers = len(batch)
+		for _, t := range batch {
+			resp.Fare += t.Fare
+			resp.TicketIDs = append(resp.TicketIDs, t.Id)
+		}
+	}
+	return resp, nil
+}
+
+// rfidRider finds the rider of a tapped card. When the tap needs no fare,
+// because the card is inactive or a pass covers the ride, it also returns
+// the response to send; a pass response has PassID set and covers the holder
+// alone.
+func (s *service) rfidRider(rfid string, routeID int64, busName string) (*domain.User, *RFIDPaymentResponse, error) {
+	user, err := s.userRepo.FindByRFID(rfid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid RFID card")
+	}
+
+	// Check if RFID is active
+	if !user.IsRFIDActive {
+		return user, &RFIDPaymentResponse{
+			Success: false,
+			Status:  "INACTIVE",
+			Message: "RFID card is inactive",
+			Balance: user.Balance,
+			Fare:    0,
+		}, nil
+	}
+
+	// Rides covered by a pass cost nothing
+	ride, err := s.passes.Ride(pass.RideRequest{
+		UserId:             user.Id,
+		RouteId:            routeID,
+		RegistrationNumber: busName,
+		Source:             pass.SourceRFID,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check passes: %w", err)
+	}
+	switch ride.Status {
+	case pass.RideValid:
+		return user, &RFIDPaymentResponse{
+			Success: true,
+			Status:  "PASS",
+			Message: "Ride covered by pass",
+			Balance: user.Balance,
+			PassID:  ride.Pass.Id,
+		}, nil
+	case pass.RideRepeat:
+		return user, &RFIDPaymentResponse{
+			Success: true,
+			Status:  "DUPLICATE",
+			Message: "Already recorded (recent pass ride)",
+			Balance: user.Balance,
+			PassID:  ride.Pass.Id,
 		}, nil
 	}
+	return user, nil, nil
+}
 
-	// 4. Deduct Balance
-	if err := s.userRepo.DeductBalance(user.Id, fare); err != nil {
-		return nil, fmt.Errorf("failed to deduct balance: %w", err)
+// rfidPayer returns the user whose wallet pays amount for a rider's tap: the
+// rider, or when their balance does not cover it, the guardian who shares
+// their wallet with them. It returns nil when neither wallet covers amount.
+// The guardian is locked in tx, so their balance holds until the debit.
+func (s *service) rfidPayer(tx Tx, rider *domain.User, amount domain.Money) (*domain.User, error) {
+	if rider.Balance >= amount {
+		return rider, nil
 	}
+	guardian, err := s.userRepo.GetSharedGuardian(rider.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if guardian, err = tx.LockUser(guardian.Id); err != nil {
+		return nil, err
+	}
+	if guardian.Balance < amount {
+		return nil, nil
+	}
+	return guardian, nil
+}
 
-	// 5. Create Ticket (Paid and Checked)
-	batchID := uuid.New().String()
+// rfidTicket builds the ticket of a trip paid by RFID card, which is used as
+// soon as it is issued.
+func rfidTicket(userID, routeID int64, busName, start, end string, capped FareCap, validity *ValidityPolicy) domain.Ticket {
 	ticket := domain.Ticket{
-		UserId:           user.Id,
-		RouteId:          req.RouteID,
-		BusName:          req.BusName,
-		StartDestination: req.StartDestination,
-		EndDestination:   req.EndDestination,
-		Fare:             fare,
+		UserId:           userID,
+		RouteId:          routeID,
+		BusName:          busName,
+		StartDestination: start,
+		EndDestination:   end,
+		Fare:             capped.Charge,
 		PaymentStatus:    "paid",
 		PaidStatus:       true,
 		PaymentMethod:    "RFID",
-		BatchID:          batchID,
+		BatchID:          uuid.New().String(),
 		QRCode:           fmt.Sprintf("TICKET-%d-%s", time.Now().UnixNano(), uuid.New().String()), // Temporary ID part
 		CreatedAt:        time.Now().Format(time.RFC3339),
 		Checked:          true, // Immediately marked as checked/used
+		Status:           string(StateChecked),
+		TicketType:       TypeRFID,
 	}
-
-	createdTicket, err := s.repo.Create(ticket)
-	if err != nil {
-		// Refund if ticket creation fails
-		s.userRepo.CreditBalance(user.Id, fare)
-		return nil, fmt.Errorf("failed to create ticket: %w", err)
-	}
-
-	// 6. Create Transaction
-	s.CreateTransaction(model.Transaction{
-		UserID:        int(user.Id),
-		Amount:        fare,
-		Type:          "purchase",
-		Description:   fmt.Sprintf("RFID Trip - %s", req.BusName),
-		PaymentMethod: "RFID",
-		CreatedAt:     time.Now(),
-	})
-
-	return &RFIDPaymentResponse{
-		Success:  true,
-		Status:   "SUCCESS",
-		Message:  "Payment successful",
-		Balance:  float64(user.Balance) - fare,
-		Fare:     fare,
-		TicketID: createdTicket.Id,
-	}, nil
+	ticket.ValidFrom, ticket.ValidUntil = validity.Window(TypeRFID, time.Now())
+	if capped.Period != "" {
+		ticket.FullFare = &capped.FullFare
+		ticket.FareCap = &capped.Period
+	}
+	return ticket
 }
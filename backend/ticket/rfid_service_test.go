@@ -0,0 +1,93 @@
+package ticket
+
+import (
+	"testing"
+
+	"swift_transit/domain"
+)
+
+func TestProcessRFIDPaymentPassCoversHolderOnly(t *testing.T) {
+	const fare domain.Money = 4000
+
+	tests := []struct {
+		name        string
+		passengers  int
+		balance     domain.Money
+		guardian    domain.Money // Balance of a guardian sharing their wallet, if any
+		onPass      bool
+		wantStatus  string
+		wantCharged domain.Money
+		wantTickets int
+	}{
+		{name: "pass holder alone", passengers: 1, balance: 10000, onPass: true, wantStatus: "PASS"},
+		{name: "pass holder with companions", passengers: 3, balance: 10000, onPass: true, wantStatus: "SUCCESS", wantCharged: 2 * fare, wantTickets: 2},
+		{name: "companions short of balance", passengers: 3, balance: fare, onPass: true, wantStatus: "INSUFFICIENT_BALANCE"},
+		{name: "guardian pays for companions", passengers: 2, balance: 0, guardian: 10000, onPass: true, wantStatus: "SUCCESS", wantCharged: fare, wantTickets: 1},
+		{name: "no pass", passengers: 3, balance: 20000, wantStatus: "SUCCESS", wantCharged: 3 * fare, wantTickets: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rider := &domain.User{Id: 3, Name: "Rafi", Balance: tt.balance, IsRFIDActive: true}
+			users := &fakeUsers{
+				riders:    map[string]*domain.User{"CARD-3": rider},
+				guardians: map[int64]*domain.User{},
+			}
+			tx := newFakeTx()
+			tx.users[3] = rider
+			if tt.guardian > 0 {
+				guardian := &domain.User{Id: 9, Name: "Nusrat", Balance: tt.guardian}
+				users.guardians[3] = guardian
+				tx.users[9] = guardian
+			}
+			passes := &fakePasses{holders: map[int64]*domain.Pass{}}
+			if tt.onPass {
+				passes.holders[3] = &domain.Pass{Id: 5, UserId: 3}
+			}
+			s := &service{
+				repo:     &fakeTickets{fare: fare},
+				userRepo: users,
+				uow:      &fakeUnitOfWork{tx: tx},
+				passes:   passes,
+				validity: &ValidityPolicy{},
+				fareCaps: &FareCapPolicy{},
+			}
+
+			resp, err := s.ProcessRFIDPayment(RFIDPaymentRequest{
+				RFID:             "CARD-3",
+				RouteID:          1,
+				BusName:          "Dhaka Metro 11",
+				StartDestination: "Farmgate",
+				EndDestination:   "Motijheel",
+				Passengers:       tt.passengers,
+			})
+			if err != nil {
+				t.Fatalf("ProcessRFIDPayment returned %v", err)
+			}
+
+			if resp.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			if tt.onPass && resp.PassID != 5 {
+				t.Errorf("pass id = %d, want 5", resp.PassID)
+			}
+			charged := tt.balance + tt.guardian - tx.users[3].Balance
+			if tt.guardian > 0 {
+				charged -= tx.users[9].Balance
+			}
+			if charged != tt.wantCharged {
+				t.Errorf("charged %s, want %s", charged, tt.wantCharged)
+			}
+			if len(tx.tickets) != tt.wantTickets {
+				t.Errorf("issued %d tickets, want %d", len(tx.tickets), tt.wantTickets)
+			}
+			if tt.onPass {
+				for _, tk := range tx.tickets {
+					if tk.TicketType != TypeRFIDCompanion || tk.Fare != fare {
+						t.Errorf("issued a %s ticket for %s on a pass ride, want companion tickets at the full fare", tk.TicketType, tk.Fare)
+					}
+				}
+			}
+		})
+	}
+}
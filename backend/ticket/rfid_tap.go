@@ -0,0 +1,331 @@
+package ticket
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/ledger"
+	"swift_transit/model"
+)
+
+// RFID trip states
+const (
+	TripOpen       = "open"
+	TripCompleted  = "completed"
+	TripUnresolved = "unresolved" // No tap-off; the reserved fare was kept
+)
+
+const (
+	// A tap-on repeated on the same bus within this window is the same tap
+	tapDuplicateWindow = 5 * time.Minute
+
+	// Bus positions older than this are too stale to place a tap at a stop
+	busPositionMaxAge = 2 * time.Minute
+)
+
+// RFIDTapRequest is a card tap at boarding or alighting. The bus and route
+// come from the reader's bus token, and the stop is found from the bus's last
+// reported position.
+type RFIDTapRequest struct {
+	RFID    string `json:"rfid"`
+	RouteID int64  `json:"-"`
+	BusName string `json:"-"`
+}
+
+// TapOn starts an RFID trip at the stop the bus is at, reserving the fare to
+// the end of the route. The difference is refunded at tap-off.
+func (s *service) TapOn(req RFIDTapRequest) (*RFIDPaymentResponse, error) {
+	user, settled, err := s.rfidRider(req.RFID, req.RouteID, req.BusName)
+	if err != nil || settled != nil {
+		return settled, err
+	}
+
+	now := time.Now()
+	open, err := s.trips.GetOpen(user.Id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if open != nil {
+		if open.BusName == req.BusName && now.Sub(open.TappedOnAt) < tapDuplicateWindow {
+			return &RFIDPaymentResponse{
+				Success:      true,
+				Status:       "DUPLICATE",
+				Message:      "Already tapped on",
+				Balance:      user.Balance,
+				Fare:         open.ReservedFare,
+				TicketID:     open.TicketId,
+				TripID:       open.Id,
+				BoardingStop: open.BoardingStop,
+			}, nil
+		}
+		// The rider never tapped off the previous trip, which keeps its reserved fare
+		if _, err := s.trips.Resolve(open.Id, now); err != nil {
+			return nil, err
+		}
+	}
+
+	boarding, err := s.tapStop(req.RouteID, req.BusName, now)
+	if err != nil {
+		return nil, err
+	}
+	last, err := s.trips.GetLastStop(req.RouteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find route end: %w", err)
+	}
+	maxFare, err := s.repo.CalculateFare(req.RouteID, boarding.Name, last.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate fare: %w", err)
+	}
+	maxFare = maxFare.CeilTaka()
+
+	// The rider stays locked from working out the cap to the debit, so
+	// concurrent taps cannot both stay under it
+	var capped FareCap
+	var payer *domain.User
+	trip := &domain.RFIDTrip{
+		UserId:       user.Id,
+		RouteId:      req.RouteID,
+		BusName:      req.BusName,
+		BoardingStop: boarding.Name,
+		Status:       TripOpen,
+		TappedOnAt:   now,
+	}
+	err = s.uow.Do(func(tx Tx) error {
+		var err error
+		if user, err = tx.LockUser(user.Id); err != nil {
+			return err
+		}
+		capped, err = s.capFare(tx, user, maxFare, now, 0)
+		if err != nil {
+			return fmt.Errorf("failed to apply fare cap: %w", err)
+		}
+		trip.ReservedFare = capped.Charge
+
+		payer, err = s.rfidPayer(tx, user, trip.ReservedFare)
+		if err != nil {
+			return fmt.Errorf("failed to check guardian wallet: %w", err)
+		}
+		if payer == nil {
+			return nil
+		}
+		description := fmt.Sprintf("RFID Tap-on - %s at %s (fare reserved to %s)", req.BusName, boarding.Name, last.Name)
+		if payer.Id != user.Id {
+			trip.PaidBy = &payer.Id
+			description = fmt.Sprintf("%s for %s", description, user.Name)
+		}
+		t := rfidTicket(user.Id, req.RouteID, req.BusName, boarding.Name, last.Name, capped, s.validity)
+
+		if trip.ReservedFare > 0 {
+			err := tx.DeductBalance(payer.Id, trip.ReservedFare, domain.WalletPosting{
+				Account:     ledger.AccountFares,
+				Kind:        ledger.KindFare,
+				Description: description,
+				Reference:   "batch:" + t.BatchID,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to deduct balance: %w", err)
+			}
+		}
+		if err := tx.CreateRFIDTrip(trip, &t, ActorBus(req.BusName), "RFID tap-on"); err != nil {
+			return fmt.Errorf("failed to start trip: %w", err)
+		}
+		return tx.CreateTransaction(model.Transaction{
+			UserID:        int(payer.Id),
+			Amount:        trip.ReservedFare,
+			Type:          "purchase",
+			Description:   description,
+			PaymentMethod: "RFID",
+			CreatedAt:     now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	reserved := trip.ReservedFare
+	if payer == nil {
+		return &RFIDPaymentResponse{
+			Success: false,
+			Status:  "INSUFFICIENT_BALANCE",
+			Message: "Insufficient balance",
+			Balance: user.Balance,
+			Fare:    reserved,
+		}, nil
+	}
+
+	resp := &RFIDPaymentResponse{
+		Success:      true,
+		Status:       "TAPPED_ON",
+		Message:      "Tapped on, tap off when leaving",
+		Balance:      user.Balance,
+		Fare:         reserved,
+		TicketID:     trip.TicketId,
+		TripID:       trip.Id,
+		BoardingStop: boarding.Name,
+	}
+	if trip.PaidBy == nil {
+		resp.Balance -= reserved
+	} else {
+		resp.Message = "Tapped on with guardian's wallet, tap off when leaving"
+		resp.PaidByGuardian = true
+	}
+	if capped.Period != "" {
+		resp.FullFare = capped.FullFare
+		resp.FareCap = capped.Period
+	}
+	return resp, nil
+}
+
+// TapOff ends the rider's open trip at the stop the bus is at, charging the
+// fare actually travelled and refunding the rest of the reservation.
+func (s *service) TapOff(req RFIDTapRequest) (*RFIDPaymentResponse, error) {
+	user, err := s.userRepo.FindByRFID(req.RFID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RFID card")
+	}
+
+	noTrip := &RFIDPaymentResponse{
+		Success: false,
+		Status:  "NO_TRIP",
+		Message: "No trip to end",
+		Balance: user.Balance,
+	}
+	trip, err := s.trips.GetOpen(user.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return noTrip, nil
+	} else if err != nil {
+		return nil, err
+	}
+	// Only the bus the trip started on can end it
+	if trip.BusName != req.BusName {
+		return noTrip, nil
+	}
+
+	now := time.Now()
+	alighting, err := s.tapStop(trip.RouteId, req.BusName, now)
+	if err != nil {
+		return nil, err
+	}
+	boarding, err := s.repo.GetStop(trip.RouteId, trip.BoardingStop)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find boarding stop: %w", err)
+	}
+	// A tap-off at or before the boarding stop pays the minimum fare
+	if alighting.Order < boarding.Order {
+		alighting = boarding
+	}
+
+	fare, err := s.repo.CalculateFare(trip.RouteId, boarding.Name, alighting.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate fare: %w", err)
+	}
+	fare = fare.CeilTaka()
+	// The refund goes back to the wallet the fare was reserved from
+	refundTo := user.Id
+	if trip.PaidBy != nil {
+		refundTo = *trip.PaidBy
+	}
+	trip.AlightingStop = &alighting.Name
+	trip.TappedOffAt = &now
+
+	// The rider stays locked from working out the cap to the settlement, so
+	// concurrent taps cannot both stay under it
+	var capped FareCap
+	var charge, refund domain.Money
+	var completed bool
+	err = s.uow.Do(func(tx Tx) error {
+		var err error
+		if user, err = tx.LockUser(user.Id); err != nil {
+			return err
+		}
+		capped, err = s.capFare(tx, user, fare, now, trip.TicketId)
+		if err != nil {
+			return fmt.Errorf("failed to apply fare cap: %w", err)
+		}
+		charge = domain.MinMoney(capped.Charge, trip.ReservedFare)
+		refund = trip.ReservedFare - charge
+
+		t := domain.Ticket{Id: trip.TicketId, EndDestination: alighting.Name, Fare: charge}
+		if capped.Period != "" {
+			t.FullFare = &capped.FullFare
+			t.FareCap = &capped.Period
+		}
+		trip.Fare = &charge
+
+		completed, err = tx.CompleteRFIDTrip(*trip, t)
+		if err != nil || !completed || refund <= 0 {
+			return err
+		}
+		err = tx.CreditBalance(refundTo, refund, domain.WalletPosting{
+			Account:     ledger.AccountFares,
+			Kind:        ledger.KindRefund,
+			Description: fmt.Sprintf("RFID Tap-off - %s at %s (unused reserved fare)", req.BusName, alighting.Name),
+			Reference:   fmt.Sprintf("rfid_trip:%d", trip.Id),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to refund reserved fare: %w", err)
+		}
+		return tx.CreateTransaction(model.Transaction{
+			UserID:        int(refundTo),
+			Amount:        refund,
+			Type:          "refund",
+			Description:   fmt.Sprintf("RFID Tap-off - %s at %s (unused reserved fare)", req.BusName, alighting.Name),
+			PaymentMethod: "RFID",
+			CreatedAt:     now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		// Settled by a concurrent tap-off, or resolved
+		return noTrip, nil
+	}
+
+	resp := &RFIDPaymentResponse{
+		Success:       true,
+		Status:        "TAPPED_OFF",
+		Message:       "Trip complete",
+		Balance:       user.Balance,
+		Fare:          charge,
+		TicketID:      trip.TicketId,
+		TripID:        trip.Id,
+		BoardingStop:  boarding.Name,
+		AlightingStop: alighting.Name,
+		Refund:        refund,
+	}
+	if trip.PaidBy == nil {
+		resp.Balance += refund
+	} else {
+		resp.PaidByGuardian = true
+	}
+	if capped.Period != "" {
+		resp.FullFare = capped.FullFare
+		resp.FareCap = capped.Period
+	}
+	return resp, nil
+}
+
+// ResolveRFIDTrips closes trips never tapped off once their ticket stops
+// being valid, keeping the reserved fare. It returns how many it closed.
+func (s *service) ResolveRFIDTrips(now time.Time) (int, error) {
+	return s.trips.Resolve(0, now)
+}
+
+// tapStop finds the stop of a route a tap was made at.
+func (s *service) tapStop(routeID int64, busName string, now time.Time) (*domain.Stop, error) {
+	lon, lat, err := s.trips.GetBusPosition(busName, now.Add(-busPositionMaxAge))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("bus location unknown")
+	} else if err != nil {
+		return nil, err
+	}
+
+	stop, err := s.trips.GetNearestStop(routeID, lon, lat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stop: %w", err)
+	}
+	return stop, nil
+}
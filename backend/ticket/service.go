@@ -5,13 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"math"
-	"strconv"
 	"strings"
 	"swift_transit/domain"
 	"swift_transit/infra/payment"
 	"swift_transit/infra/rabbitmq"
+	"swift_transit/ledger"
 	"swift_transit/model"
+	"swift_transit/promo"
 	"swift_transit/user"
 	"time"
 
@@ -28,25 +28,45 @@ type TransactionRepo interface {
 
 type service struct {
 	repo            TicketRepo
+	orders          OrderRepo
+	trips           RFIDTripRepo
 	userRepo        user.UserRepo
 	transactionRepo TransactionRepo
+	uow             UnitOfWork
 	redis           *redis.Client
 	sslCommerz      *payment.SSLCommerz
 	rabbitMQ        *rabbitmq.RabbitMQ
 	ctx             context.Context
 	publicBaseURL   string
+	keyring         *Keyring
+	dynamicQR       *DynamicQR
+	staticQR        bool
+	validity        *ValidityPolicy
+	fareCaps        *FareCapPolicy
+	passes          PassService
+	promos          PromoService
 }
 
-func NewService(repo TicketRepo, userRepo user.UserRepo, transactionRepo TransactionRepo, redis *redis.Client, sslCommerz *payment.SSLCommerz, rabbitMQ *rabbitmq.RabbitMQ, ctx context.Context, publicBaseURL string) Service {
+func NewService(repo TicketRepo, orders OrderRepo, trips RFIDTripRepo, userRepo user.UserRepo, transactionRepo TransactionRepo, uow UnitOfWork, redis *redis.Client, sslCommerz *payment.SSLCommerz, rabbitMQ *rabbitmq.RabbitMQ, ctx context.Context, publicBaseURL string, keyring *Keyring, dynamicQR *DynamicQR, staticQR bool, validity *ValidityPolicy, fareCaps *FareCapPolicy, passes PassService, promos PromoService) Service {
 	return &service{
 		repo:            repo,
+		orders:          orders,
+		trips:           trips,
 		userRepo:        userRepo,
 		transactionRepo: transactionRepo,
+		uow:             uow,
 		redis:           redis,
 		sslCommerz:      sslCommerz,
 		rabbitMQ:        rabbitMQ,
 		ctx:             ctx,
 		publicBaseURL:   strings.TrimRight(publicBaseURL, "/"),
+		keyring:         keyring,
+		dynamicQR:       dynamicQR,
+		staticQR:        staticQR,
+		validity:        validity,
+		fareCaps:        fareCaps,
+		passes:          passes,
+		promos:          promos,
 	}
 }
 
@@ -56,6 +76,9 @@ func (s *service) BuyTicket(req BuyTicketRequest) (*BuyTicketResponse, error) {
 		return nil, fmt.Errorf("invalid request")
 	}
 
+	if len(req.Passengers) > 0 {
+		req.Quantity = len(req.Passengers)
+	}
 	if req.Quantity == 0 {
 		req.Quantity = 1
 	}
@@ -69,6 +92,7 @@ func (s *service) BuyTicket(req BuyTicketRequest) (*BuyTicketResponse, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate fare: %w", err)
 	}
+	fare = fare.CeilTaka() // Fares are charged in whole taka
 
 	existing, err := s.repo.CountActiveTicketsByRoute(req.UserId, req.RouteId)
 	if err != nil {
@@ -84,8 +108,47 @@ func (s *service) BuyTicket(req BuyTicketRequest) (*BuyTicketResponse, error) {
 		return nil, fmt.Errorf("you already have %d active ticket(s) on this route. You can buy up to %d more for this route", existing, remaining)
 	}
 
+	categories := req.Passengers
+	if len(categories) == 0 {
+		for i := 0; i < req.Quantity; i++ {
+			categories = append(categories, FareAdult)
+		}
+	}
+	passengers, err := passengerFares(fare, categories)
+	if err != nil {
+		return nil, err
+	}
+
+	var quote *promo.Quote
+	if req.PromoCode != "" {
+		fares := make([]domain.Money, len(passengers))
+		for i, p := range passengers {
+			fares[i] = p.Fare
+		}
+		quote, err = s.promos.Quote(promo.QuoteRequest{
+			Code:    req.PromoCode,
+			UserId:  req.UserId,
+			RouteId: req.RouteId,
+			Fares:   fares,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range passengers {
+			passengers[i].Discount = quote.Discounts[i]
+			passengers[i].Fare -= quote.Discounts[i]
+		}
+	}
+
 	batchID := uuid.New().String()
-	totalFare := fare * float64(req.Quantity)
+	var totalFare domain.Money
+	for _, p := range passengers {
+		totalFare += p.Fare
+	}
+	// Nothing is left to pay at the gateway, and nothing is taken from the wallet
+	if totalFare == 0 {
+		req.PaymentMethod = "wallet"
+	}
 
 	// 3. Create a temporary ID or use a UUID for tracking the request
 	// For simplicity, we might need to generate an ID here or let the worker handle it.
@@ -106,9 +169,15 @@ func (s *service) BuyTicket(req BuyTicketRequest) (*BuyTicketResponse, error) {
 		Fare:             fare,
 		TotalFare:        totalFare,
 		Quantity:         req.Quantity,
+		Passengers:       passengers,
 		BatchID:          batchID,
 		PaymentMethod:    req.PaymentMethod,
 	}
+	if quote != nil {
+		msg.PromoId = quote.PromoId
+		msg.PromoCode = quote.Code
+		msg.Discount = quote.Discount
+	}
 	reqJSON, err := json.Marshal(msg)
 	if err != nil {
 		return nil, err
@@ -192,6 +261,9 @@ func (s *service) GetTicketStatus(trackingID string) (*BuyTicketResponse, error)
 		if len(ticketIDs) > 0 {
 			resp.TicketIDs = ticketIDs
 		}
+		if oid, ok := statusData["order_id"].(float64); ok {
+			resp.OrderID = int64(oid)
+		}
 
 		if status == "ready" {
 			resp.PaymentURL = url
@@ -225,188 +297,52 @@ func (s *service) GetTicketStatus(trackingID string) (*BuyTicketResponse, error)
 	}, nil
 }
 
+// GetPaymentStatus reports the payment of a ticket as pending, paid, failed,
+// cancelled, refunded or expired.
 func (s *service) GetPaymentStatus(ticketID int64) (string, error) {
 	ticket, err := s.repo.Get(ticketID)
 	if err != nil {
 		return "", err
 	}
-	if ticket.CancelledAt != nil {
-		return "cancelled", nil
-	}
-	if ticket.PaymentStatus != "" {
-		if ticket.PaymentStatus == "paid" {
-			return "paid", nil
-		}
-		if ticket.PaymentUsed && ticket.PaymentStatus != "paid" {
+	switch State(ticket.Status) {
+	case StatePendingPayment:
+		return "pending", nil
+	case StateCancelled:
+		// Only a payment that went through leaves the ticket paid_status
+		if !ticket.PaidStatus {
 			return "failed", nil
 		}
-		return ticket.PaymentStatus, nil
+		return "cancelled", nil
+	case StateRefunded:
+		return "refunded", nil
 	}
-	if ticket.PaidStatus {
-		return "paid", nil
+	// Unpaid tickets expire too, once their validity ends
+	if !ticket.PaidStatus {
+		return "expired", nil
 	}
-	return "unpaid", nil
+	return "paid", nil
 }
 
-func (s *service) ValidatePayment(valID string, tranID string, amount float64) (bool, error) {
-	// 1. Call SSLCommerz Validation API
-	resp, err := s.sslCommerz.ValidateTransaction(valID)
+// ValidatePayment completes the order of attempt tranID from an IPN, once
+// the gateway confirms valID paid amount, the attempt's amount.
+func (s *service) ValidatePayment(valID string, tranID string, amount domain.Money) (bool, error) {
+	attempt, err := s.orders.GetPaymentAttempt(tranID)
 	if err != nil {
-		return false, fmt.Errorf("validation api failed: %w", err)
-	}
-
-	// 2. Check status
-	if resp.Status != "VALID" && resp.Status != "VALIDATED" {
-		return false, fmt.Errorf("invalid transaction status: %s", resp.Status)
+		return false, fmt.Errorf("unknown tran_id %s: %w", tranID, err)
 	}
-
-	// 3. Verify Amount (Parse string to float)
-	respAmount, err := strconv.ParseFloat(resp.Amount, 64)
-	if err != nil {
-		return false, fmt.Errorf("invalid amount format from api: %w", err)
+	if amount != attempt.Amount {
+		return false, fmt.Errorf("amount mismatch: order expects %s, got %s", attempt.Amount, amount)
 	}
-
-	if respAmount != amount {
-		return false, fmt.Errorf("amount mismatch: expected %.2f, got %.2f", amount, respAmount)
-	}
-
-	// 4. Update Payment Status in DB
-	// Extract Ticket ID from tranID (Format: TICKET-{ID}-{UUID})
-	var ticketID int64
-	_, err = fmt.Sscanf(tranID, "TICKET-%d-", &ticketID)
-	if err != nil {
-		return false, fmt.Errorf("failed to extract ticket id from tran_id: %w", err)
+	if err := s.validateGatewayPayment(valID, tranID, attempt.Amount); err != nil {
+		return false, err
 	}
 
-	if err := s.UpdatePaymentStatus(ticketID); err != nil {
+	if err := s.payOrder(attempt); err != nil {
 		return false, fmt.Errorf("failed to update payment status in db: %w", err)
 	}
-
-	// 5. Store valid ticket in Redis for 4 hours
-	ticket, err := s.repo.Get(ticketID)
-	if err == nil {
-		validTicket := map[string]interface{}{
-			"ticket_id":         ticket.Id,
-			"route_id":          ticket.RouteId,
-			"start_destination": ticket.StartDestination,
-			"end_destination":   ticket.EndDestination,
-			"user_id":           ticket.UserId,
-			"created_at":        ticket.CreatedAt,
-			"checked":           false,
-		}
-		validTicketJSON, _ := json.Marshal(validTicket)
-		s.redis.Set(s.ctx, fmt.Sprintf("ticket_valid:%s", ticket.QRCode), validTicketJSON, 4*time.Hour)
-	}
-
 	return true, nil
 }
 
-func (s *service) CheckTicket(req CheckTicketRequest) (map[string]interface{}, error) {
-	// 1. Check Redis
-	val, err := s.redis.Get(s.ctx, fmt.Sprintf("ticket_valid:%s", req.QRCode)).Result()
-	if err == redis.Nil {
-		return map[string]interface{}{
-			"success": false,
-			"status":  "invalid",
-			"message": "Invalid or expired ticket",
-		}, nil
-	} else if err != nil {
-		return nil, err
-	}
-
-	var ticketData map[string]interface{}
-	if err := json.Unmarshal([]byte(val), &ticketData); err != nil {
-		return nil, fmt.Errorf("failed to parse ticket data")
-	}
-
-	// 2. Validate Route
-	tRouteID := int64(ticketData["route_id"].(float64))
-	if tRouteID != req.RouteID {
-		return map[string]interface{}{
-			"success": false,
-			"status":  "invalid_route",
-			"message": "Ticket is not for this route",
-		}, nil
-	}
-
-	// 3. Check if already checked
-	if checked, ok := ticketData["checked"].(bool); ok && checked {
-		return map[string]interface{}{
-			"success":   false,
-			"status":    "already_used",
-			"message":   "Ticket already used",
-			"ticket_id": ticketData["ticket_id"],
-		}, nil
-	}
-
-	// 4. Check for Over-travel (Extra Fare)
-	endDest, ok := ticketData["end_destination"].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid ticket data: missing end_destination")
-	}
-
-	destStop, err := s.repo.GetStop(req.RouteID, endDest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to verify destination stop: %v", err)
-	}
-
-	var response map[string]interface{}
-	if req.CurrentStoppage.Order > destStop.Order {
-		// Calculate Extra Fare
-		extraFare, err := s.repo.CalculateFare(req.RouteID, endDest, req.CurrentStoppage.Name)
-		if err != nil {
-			return nil, fmt.Errorf("failed to calculate extra fare: %v", err)
-		}
-
-		response = map[string]interface{}{
-			"success":          false, // Not fully successful until extra fare is handled
-			"status":           "over_travel",
-			"message":          fmt.Sprintf("Over-travel detected. Pay extra: %.2f", extraFare),
-			"extra_fare":       extraFare,
-			"current_stoppage": req.CurrentStoppage.Name,
-			"ticket_end":       endDest,
-			"ticket_id":        ticketData["ticket_id"],
-			"checked":          true,
-		}
-	} else {
-		response = ticketData
-		response["success"] = true
-		response["status"] = "valid"
-		response["message"] = "Ticket Valid"
-		response["checked"] = true
-	}
-
-	// 5. Mark as checked in Redis
-	ticketData["checked"] = true
-	updatedJSON, _ := json.Marshal(ticketData)
-	s.redis.Set(s.ctx, fmt.Sprintf("ticket_valid:%s", req.QRCode), updatedJSON, redis.KeepTTL)
-
-	// 6. Publish to RabbitMQ for async updates (DB update)
-	checkEvent := map[string]interface{}{
-		"ticket_id":        ticketData["ticket_id"],
-		"qr_code":          req.QRCode,
-		"current_stoppage": req.CurrentStoppage.Name,
-		"checked_at":       time.Now(),
-		"bus_name":         req.BusName,
-	}
-	eventJSON, _ := json.Marshal(checkEvent)
-
-	q, err := s.rabbitMQ.DeclareQueue("ticket_check_queue")
-	if err == nil {
-		s.rabbitMQ.Channel.Publish(
-			"",     // exchange
-			q.Name, // routing key
-			false,  // mandatory
-			false,  // immediate
-			amqp.Publishing{
-				ContentType: "application/json",
-				Body:        eventJSON,
-			})
-	}
-
-	return response, nil
-}
-
 func (s *service) CreateOverTravelTicket(originalTicketID int64, currentStop string, paymentCollected bool) (*domain.Ticket, error) {
 	originalTicket, err := s.repo.Get(originalTicketID)
 	if err != nil {
@@ -417,7 +353,7 @@ func (s *service) CreateOverTravelTicket(originalTicketID int64, currentStop str
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate fare: %w", err)
 	}
-	fare = math.Ceil(fare)
+	fare = fare.CeilTaka()
 
 	batchID := uuid.New().String()
 	newTicket := domain.Ticket{
@@ -429,24 +365,46 @@ func (s *service) CreateOverTravelTicket(originalTicketID int64, currentStop str
 		Fare:               fare,
 		PaymentStatus:      "unpaid",
 		PaidStatus:         false,
+		Status:             string(StatePendingPayment),
 		PaymentMethod:      "CASH", // Assumed cash for over-travel
 		BatchID:            batchID,
 		QRCode:             fmt.Sprintf("OT-%d-%s", time.Now().UnixNano(), uuid.New().String()),
 		CreatedAt:          time.Now().Format(time.RFC3339),
 		Checked:            true, // Auto-checked
 		RegistrationNumber: originalTicket.RegistrationNumber,
+		TicketType:         TypeOverTravel,
 	}
+	newTicket.ValidFrom, newTicket.ValidUntil = s.validity.Window(TypeOverTravel, time.Now())
 
 	if paymentCollected {
 		newTicket.PaymentStatus = "paid"
 		newTicket.PaidStatus = true
+		newTicket.Status = string(StateChecked)
 	}
 
-	createdTicket, err := s.repo.Create(newTicket)
+	actor := ActorSystem
+	if originalTicket.RegistrationNumber != nil {
+		actor = ActorBus(*originalTicket.RegistrationNumber)
+	}
+	reason := fmt.Sprintf("over-travel from %s on ticket %d", originalTicket.EndDestination, originalTicket.Id)
+	createdTicket, err := s.repo.Create(newTicket, actor, reason)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ticket: %w", err)
 	}
 
+	// The extra fare settles the original ticket
+	if paymentCollected {
+		if _, err := s.repo.Transition(Transition{
+			TicketIDs: []int64{originalTicket.Id},
+			From:      []State{StateOverTravelDue},
+			To:        StateChecked,
+			Actor:     actor,
+			Reason:    fmt.Sprintf("extra fare paid with ticket %d", createdTicket.Id),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to settle original ticket: %w", err)
+		}
+	}
+
 	// Create Transaction if paid
 	if paymentCollected {
 		s.CreateTransaction(model.Transaction{
@@ -467,73 +425,30 @@ func (s *service) ValidateTicket(id int64) error {
 	if err != nil {
 		return err
 	}
-	if ticket.CancelledAt != nil {
-		return fmt.Errorf("ticket has been cancelled")
-	}
-	// Service level validation doesn't have bus name usually, but this method seems unused or for manual validation?
-	// If used manually, we might need bus name.
-	// Let's pass empty string if not available or update signature if needed.
-	// Given the context, this might be used by other parts.
-	// Let's check usages. It's in the interface?
-	return s.repo.ValidateTicket(id, "")
-}
-
-func (s *service) CreateTransaction(t model.Transaction) error {
-	return s.transactionRepo.Create(t)
-}
-
-func (s *service) UpdatePaymentStatus(id int64) error {
-	ticket, err := s.repo.Get(id)
-	if err != nil {
-		return err
-	}
-	if ticket.PaymentUsed {
-		if ticket.PaidStatus {
-			return nil
-		}
-		return fmt.Errorf("payment link already used")
+	// Over-travel tickets are only settled by paying the extra fare
+	if State(ticket.Status) != StatePaid {
+		return fmt.Errorf("ticket cannot be validated while %s", ticket.Status)
 	}
 
-	if err := s.repo.UpdateBatchPaymentStatus(ticket.BatchID, true, "paid", true); err != nil {
-		return err
-	}
-
-	// Calculate total amount for the batch
-	count, err := s.repo.GetBatchCount(ticket.BatchID)
-	if err != nil {
-		// Fallback to 1 if count fails, though it shouldn't
-		count = 1
-	}
-
-	totalAmount := ticket.Fare * float64(count)
-
-	// Create Transaction
-	return s.CreateTransaction(model.Transaction{
-		UserID:        int(ticket.UserId),
-		Amount:        totalAmount,
-		Type:          "purchase",
-		Description:   fmt.Sprintf("Ticket Purchase - %s (x%d)", ticket.BusName, count),
-		PaymentMethod: "Online", // Or "Gateway"
-		CreatedAt:     time.Now(),
+	moved, err := s.repo.Transition(Transition{
+		TicketIDs: []int64{id},
+		From:      []State{StatePaid},
+		To:        StateChecked,
+		Actor:     ActorSystem,
+		Reason:    "validated manually",
+		CheckedAt: time.Now(),
 	})
-}
-
-func (s *service) HandlePaymentResult(id int64, status string) (bool, error) {
-	ticket, err := s.repo.Get(id)
 	if err != nil {
-		return false, err
-	}
-
-	if ticket.PaymentUsed {
-		return true, nil
+		return err
 	}
-
-	paid := status == "paid"
-	if err := s.repo.UpdateBatchPaymentStatus(ticket.BatchID, paid, status, true); err != nil {
-		return false, err
+	if len(moved) == 0 {
+		return fmt.Errorf("ticket was changed concurrently")
 	}
+	return nil
+}
 
-	return false, nil
+func (s *service) CreateTransaction(t model.Transaction) error {
+	return s.transactionRepo.Create(t)
 }
 
 func (s *service) DownloadTicket(id int64) ([]byte, error) {
@@ -551,8 +466,17 @@ func (s *service) DownloadTicket(id int64) ([]byte, error) {
 		return nil, fmt.Errorf("ticket is unpaid")
 	}
 
+	if !s.staticQR {
+		return nil, fmt.Errorf("printed tickets are disabled, show the ticket in the app")
+	}
+
+	token, err := s.signTicket(ticket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign ticket: %w", err)
+	}
+
 	// Generate QR Code
-	qrCode, err := qrcode.Encode(ticket.QRCode, qrcode.Medium, 256)
+	qrCode, err := qrcode.Encode(token, qrcode.Medium, 256)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate QR code: %w", err)
 	}
@@ -575,7 +499,7 @@ func (s *service) DownloadTicket(id int64) ([]byte, error) {
 	pdf.Ln(8)
 	pdf.Cell(40, 10, fmt.Sprintf("To: %s", ticket.EndDestination))
 	pdf.Ln(8)
-	pdf.Cell(40, 10, fmt.Sprintf("Fare: %.2f", ticket.Fare))
+	pdf.Cell(40, 10, fmt.Sprintf("Fare: %s", ticket.Fare))
 	pdf.Ln(8)
 	pdf.Cell(40, 10, fmt.Sprintf("Date: %s", ticket.CreatedAt))
 	pdf.Ln(20)
@@ -605,12 +529,20 @@ func (s *service) GetByUserID(userId int64, limit, offset int) ([]domain.Ticket,
 		return nil, 0, err
 	}
 	for i := range tickets {
-		tickets[i].Fare = math.Ceil(tickets[i].Fare)
+		// Only tickets that can still be used get a QR
+		if State(tickets[i].Status) == StatePaid {
+			tickets[i].DynamicQRSecret = s.dynamicQR.Secret(&tickets[i])
+			if s.staticQR {
+				if token, err := s.signTicket(&tickets[i]); err == nil {
+					tickets[i].QRToken = token
+				}
+			}
+		}
 	}
 	return tickets, total, nil
 }
 
-func (s *service) CancelTicket(userID int64, ticketID int64) (float64, error) {
+func (s *service) CancelTicket(userID int64, ticketID int64) (domain.Money, error) {
 	ticket, err := s.repo.Get(ticketID)
 	if err != nil {
 		return 0, err
@@ -620,16 +552,16 @@ func (s *service) CancelTicket(userID int64, ticketID int64) (float64, error) {
 		return 0, fmt.Errorf("unauthorized")
 	}
 
-	if ticket.CancelledAt != nil {
+	switch State(ticket.Status) {
+	case StatePaid:
+	case StateCancelled, StateRefunded:
 		return 0, fmt.Errorf("ticket already cancelled")
-	}
-
-	if ticket.Checked {
+	case StateChecked, StateOverTravelDue:
 		return 0, fmt.Errorf("ticket already used")
-	}
-
-	if !ticket.PaidStatus {
+	case StatePendingPayment:
 		return 0, fmt.Errorf("unpaid tickets cannot be cancelled")
+	default:
+		return 0, fmt.Errorf("ticket can no longer be cancelled")
 	}
 
 	parsedTime, err := time.Parse(time.RFC3339, ticket.CreatedAt)
@@ -643,30 +575,143 @@ func (s *service) CancelTicket(userID int64, ticketID int64) (float64, error) {
 		}
 	}
 
-	refundAmount := ticket.Fare * 0.75
+	refundAmount := ticket.Fare.MulRatio(3, 4) // 75%, to the nearest poisha
 
-	if err := s.repo.CancelTicket(ticketID, time.Now(), "cancelled"); err != nil {
-		return 0, err
-	}
-
-	if ticket.PaymentMethod == "wallet" {
-		if err := s.userRepo.CreditBalance(ticket.UserId, refundAmount); err != nil {
-			return 0, err
+	// The ticket is cancelled and its refund credited and written to the
+	// statement together, so a cancelled wallet ticket is never left without
+	// its refund
+	wallet := ticket.PaymentMethod == "wallet"
+	err = s.uow.Do(func(tx Tx) error {
+		moved, err := tx.Transition(Transition{
+			TicketIDs: []int64{ticketID},
+			To:        StateCancelled,
+			Actor:     ActorUser(userID),
+			Reason:    "cancelled by passenger",
+		})
+		if err != nil {
+			return err
+		}
+		if len(moved) == 0 {
+			return fmt.Errorf("ticket can no longer be cancelled")
+		}
+		if !wallet {
+			return nil
 		}
 
-		// Create Transaction for Refund
-		if err := s.CreateTransaction(model.Transaction{
+		err = tx.CreditBalance(ticket.UserId, refundAmount, domain.WalletPosting{
+			Account:     ledger.AccountFares,
+			Kind:        ledger.KindRefund,
+			Description: fmt.Sprintf("Ticket Refund - %s", ticket.BusName),
+			Reference:   fmt.Sprintf("ticket:%d", ticket.Id),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Transition(Transition{
+			TicketIDs: []int64{ticketID},
+			To:        StateRefunded,
+			Actor:     ActorSystem,
+			Reason:    fmt.Sprintf("refunded %s to wallet", refundAmount),
+		}); err != nil {
+			return err
+		}
+		if ticket.OrderID != nil {
+			if err := tx.AddOrderRefund(*ticket.OrderID, ticketID, refundAmount); err != nil {
+				return err
+			}
+		}
+		return tx.CreateTransaction(model.Transaction{
 			UserID:        int(ticket.UserId),
 			Amount:        refundAmount,
 			Type:          "refund",
 			Description:   fmt.Sprintf("Ticket Refund - %s", ticket.BusName),
 			PaymentMethod: "Wallet",
 			CreatedAt:     time.Now(),
-		}); err != nil {
-			// Log error but don't fail the request as refund is already processed
-			fmt.Printf("failed to create refund transaction: %v\n", err)
-		}
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.redis.Del(s.ctx, fmt.Sprintf("ticket_valid:%s", ticket.QRCode))
+
+	if ticket.OrderID != nil {
+		s.refreshOrderStatus(*ticket.OrderID)
 	}
 
 	return refundAmount, nil
 }
+
+// signTicket returns the signed QR token of a ticket.
+func (s *service) signTicket(t *domain.Ticket) (string, error) {
+	fromStop, err := s.repo.GetStop(t.RouteId, t.StartDestination)
+	if err != nil {
+		return "", fmt.Errorf("failed to find start stop: %w", err)
+	}
+	toStop, err := s.repo.GetStop(t.RouteId, t.EndDestination)
+	if err != nil {
+		return "", fmt.Errorf("failed to find destination stop: %w", err)
+	}
+
+	return s.keyring.Sign(TokenClaims{
+		TicketID:   t.Id,
+		RouteID:    t.RouteId,
+		FromStop:   fromStop.Order,
+		ToStop:     toStop.Order,
+		NotBefore:  t.ValidFrom.Unix(),
+		Expires:    t.ValidUntil.Unix(),
+		Passengers: 1,
+	})
+}
+
+// ResolveQR returns the ticket QR code a scanned value refers to. Dynamic
+// codes and signed tokens are verified and mapped to their ticket; legacy QR
+// codes are returned unchanged.
+func (s *service) ResolveQR(scanned string) (string, error) {
+	if IsDynamicQR(scanned) {
+		t, err := s.verifyDynamicQR(scanned, time.Now())
+		if err != nil {
+			return "", err
+		}
+		return t.QRCode, nil
+	}
+
+	if !s.staticQR {
+		return "", fmt.Errorf("static QR codes are not accepted, show the ticket in the app")
+	}
+
+	if !IsSignedToken(scanned) {
+		return scanned, nil
+	}
+
+	claims, err := s.keyring.Verify(scanned, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	t, err := s.repo.Get(claims.TicketID)
+	if err != nil {
+		return "", fmt.Errorf("ticket not found")
+	}
+	return t.QRCode, nil
+}
+
+// verifyDynamicQR checks a rotating in-app code as of at and returns its ticket.
+func (s *service) verifyDynamicQR(scanned string, at time.Time) (*domain.Ticket, error) {
+	ticketID, code, err := ParseDynamicQR(scanned)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.repo.Get(ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("ticket not found")
+	}
+	if !s.dynamicQR.Verify(t, code, at) {
+		return nil, fmt.Errorf("ticket code has expired, refresh the ticket in the app")
+	}
+	return t, nil
+}
+
+func (s *service) PublicKeys() []PublicKey {
+	return s.keyring.PublicKeys()
+}
@@ -0,0 +1,111 @@
+package ticket
+
+import (
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+)
+
+// State is the lifecycle state of a ticket, stored in tickets.status.
+type State string
+
+const (
+	StatePendingPayment State = "pending_payment"
+	StatePaid           State = "paid"
+	StateChecked        State = "checked"
+	StateOverTravelDue  State = "over_travel_due" // Used, but the passenger rode past their stop and owes extra fare
+	StateCancelled      State = "cancelled"       // Cancelled by the passenger, or its payment failed
+	StateRefunded       State = "refunded"
+	StateExpired        State = "expired"
+)
+
+// transitions lists the states a ticket may move to from each state. Every
+// state change goes through TicketRepo.Transition, which only applies it to
+// tickets in an allowed state.
+var transitions = map[State][]State{
+	StatePendingPayment: {StatePaid, StateCancelled, StateExpired},
+	StatePaid:           {StateChecked, StateOverTravelDue, StateCancelled, StateExpired},
+	StateOverTravelDue:  {StateChecked}, // Only when the extra fare is paid
+	StateCancelled:      {StateRefunded},
+}
+
+// CanTransition reports whether a ticket in state from may move to state to.
+func CanTransition(from, to State) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// MovableFrom returns the states t applies to: its From states that may move
+// to its To state, or all of those when From is empty.
+func (t Transition) MovableFrom() []State {
+	if len(t.From) == 0 {
+		return AllowedFrom(t.To)
+	}
+	var from []State
+	for _, state := range t.From {
+		if CanTransition(state, t.To) {
+			from = append(from, state)
+		}
+	}
+	return from
+}
+
+// AllowedFrom returns the states a ticket may move to state to from.
+func AllowedFrom(to State) []State {
+	var from []State
+	for state, next := range transitions {
+		for _, n := range next {
+			if n == to {
+				from = append(from, state)
+			}
+		}
+	}
+	return from
+}
+
+// Actors recorded in ticket events
+const (
+	ActorSystem         = "system"
+	ActorPaymentGateway = "payment_gateway"
+)
+
+func ActorUser(id int64) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+func ActorBus(registrationNumber string) string {
+	return "bus:" + registrationNumber
+}
+
+// Transition moves tickets, selected by ID or by order, to another state.
+// From narrows the states tickets are moved from; when empty, every state
+// allowed to move to To is.
+type Transition struct {
+	TicketIDs []int64
+	OrderID   int64
+	From      []State
+	To        State
+	Actor     string
+	Reason    string
+
+	// Set when a bus uses the ticket
+	RegistrationNumber string
+	CheckedAt          time.Time
+}
+
+// GetHistory returns the state changes of a ticket owned by userID, oldest first.
+func (s *service) GetHistory(userID int64, ticketID int64) ([]domain.TicketEvent, error) {
+	t, err := s.repo.Get(ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("ticket not found")
+	}
+	if t.UserId != userID {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	return s.repo.GetEvents(ticketID)
+}
@@ -0,0 +1,377 @@
+package ticket
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"swift_transit/domain"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Ticket states in a bus manifest
+const (
+	ManifestValid   = "valid"
+	ManifestUsed    = "used"
+	ManifestRevoked = "revoked"
+)
+
+// Reasons an offline scan could not be recorded
+const (
+	ConflictDoubleUse  = "double_use"
+	ConflictRevoked    = "revoked"
+	ConflictUnpaid     = "unpaid"
+	ConflictWrongRoute = "wrong_route"
+	ConflictInvalid    = "invalid"
+)
+
+const (
+	// Changes committed just before a cursor was issued may be sent again;
+	// applying a manifest entry twice is harmless
+	manifestOverlap = 5 * time.Second
+
+	// Device clocks may run slightly ahead of the server
+	maxScanClockSkew = time.Minute
+
+	// Oldest scan accepted from a device, and the oldest scan of a rotating
+	// code, which is only checked against the time the device claims. Bounding
+	// these limits how stale a code a wrong clock or a replay can get accepted.
+	maxScanAge        = 24 * time.Hour
+	maxDynamicScanAge = 6 * time.Hour
+)
+
+// ManifestEntry is the compact state of one ticket. Stops are identified by
+// their order on the route, as in signed QR tokens.
+type ManifestEntry struct {
+	TicketID int64  `json:"tid"`
+	Status   string `json:"status"`
+	FromStop int    `json:"from,omitempty"`
+	ToStop   int    `json:"to,omitempty"`
+	Expires  int64  `json:"exp"`
+}
+
+// Manifest lists the tickets a bus may see on its route. A full manifest
+// holds every valid ticket; a delta holds every ticket that changed since
+// the cursor it was requested with. Pass Cursor as since on the next sync.
+type Manifest struct {
+	RouteID int64           `json:"route_id"`
+	Full    bool            `json:"full"`
+	Cursor  string          `json:"cursor"`
+	Tickets []ManifestEntry `json:"tickets"`
+}
+
+// CheckEvent is a ticket check to record, published by live checks to
+// "ticket_check_queue" or built from an uploaded offline scan.
+type CheckEvent struct {
+	TicketID        int64     `json:"ticket_id"`
+	QRCode          string    `json:"qr_code"`
+	RouteID         int64     `json:"route_id,omitempty"`
+	CurrentStoppage string    `json:"current_stoppage"`
+	CheckedAt       time.Time `json:"checked_at"`
+	BusName         string    `json:"bus_name"`
+}
+
+// CheckConflict explains why a check was not recorded. For double use it
+// names the bus that used the ticket first.
+type CheckConflict struct {
+	Index     int    `json:"index"` // Position of the scan in the uploaded batch
+	TicketID  int64  `json:"ticket_id,omitempty"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+	CheckedBy string `json:"checked_by,omitempty"`
+	CheckedAt string `json:"checked_at,omitempty"`
+}
+
+type OfflineScan struct {
+	QRCode          string              `json:"qr_code"`
+	ScannedAt       time.Time           `json:"scanned_at"`
+	CurrentStoppage CheckTicketStoppage `json:"current_stoppage"`
+}
+
+type ScanSyncRequest struct {
+	RouteID int64         `json:"-"` // From the bus session
+	BusName string        `json:"-"` // From the bus session
+	Scans   []OfflineScan `json:"scans"`
+}
+
+type ScanSyncResult struct {
+	Accepted  int             `json:"accepted"`
+	Conflicts []CheckConflict `json:"conflicts"`
+}
+
+// RecordCheck marks a ticket as used in the database. Checks published by
+// live validation and scans uploaded by offline buses both go through here,
+// so a ticket used twice is reported the same way whichever came first.
+func (s *service) RecordCheck(event CheckEvent) (*CheckConflict, error) {
+	t, err := s.repo.Get(event.TicketID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &CheckConflict{TicketID: event.TicketID, Reason: ConflictInvalid, Message: "Ticket not found"}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if event.RouteID != 0 && t.RouteId != event.RouteID {
+		return &CheckConflict{TicketID: t.Id, Reason: ConflictWrongRoute, Message: "Ticket is not valid for this route"}, nil
+	}
+
+	checkedAt := event.CheckedAt
+	if checkedAt.IsZero() {
+		checkedAt = time.Now()
+	}
+	// A replay of the check that used the ticket, such as the event of a live
+	// check that left it over_travel_due, is not a conflict and changes nothing
+	same, err := s.repo.IsCheckedBy(t.Id, event.BusName, checkedAt)
+	if err != nil {
+		return nil, err
+	}
+	if same {
+		return nil, nil
+	}
+	if conflict := stateConflict(t); conflict != nil {
+		return usedConflict(t, conflict), nil
+	}
+
+	if checkedAt.Before(t.ValidFrom) || !checkedAt.Before(t.ValidUntil) {
+		return &CheckConflict{TicketID: t.Id, Reason: ConflictRevoked, Message: "Ticket was not valid at the time of the scan"}, nil
+	}
+	// Only unused tickets are checked; an over-travel ticket stays due until
+	// its extra fare is paid
+	moved, err := s.repo.Transition(Transition{
+		TicketIDs:          []int64{t.Id},
+		From:               []State{StatePaid},
+		To:                 StateChecked,
+		Actor:              ActorBus(event.BusName),
+		Reason:             "checked at " + event.CurrentStoppage,
+		RegistrationNumber: event.BusName,
+		CheckedAt:          checkedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(moved) == 0 {
+		// The ticket changed since it was read; report what it is now
+		conflict := &CheckConflict{TicketID: t.Id, Reason: ConflictDoubleUse, Message: "Ticket already used"}
+		if used, err := s.repo.Get(t.Id); err == nil {
+			if c := stateConflict(used); c != nil {
+				conflict = usedConflict(used, c)
+			}
+		}
+		return conflict, nil
+	}
+
+	s.markCheckedInCache(t.QRCode)
+	return nil, nil
+}
+
+// usedConflict names the bus and time that used a ticket in a double use
+// conflict.
+func usedConflict(t *domain.Ticket, conflict *CheckConflict) *CheckConflict {
+	if conflict.Reason != ConflictDoubleUse {
+		return conflict
+	}
+	if t.RegistrationNumber != nil {
+		conflict.CheckedBy = *t.RegistrationNumber
+	}
+	if t.CheckedAt != nil {
+		conflict.CheckedAt = *t.CheckedAt
+	}
+	return conflict
+}
+
+// Manifest returns the tickets of a route for offline validation. With since
+// nil it is a full manifest, otherwise the changes after since.
+func (s *service) Manifest(routeID int64, since *time.Time) (*Manifest, error) {
+	var from *time.Time
+	if since != nil {
+		t := since.Add(-manifestOverlap)
+		from = &t
+	}
+
+	tickets, asOf, err := s.repo.GetRouteTicketChanges(routeID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		RouteID: routeID,
+		Full:    since == nil,
+		Cursor:  asOf.Format(time.RFC3339Nano),
+		Tickets: []ManifestEntry{},
+	}
+
+	stopOrders := make(map[string]int)
+	stopOrder := func(name string) (int, error) {
+		if order, ok := stopOrders[name]; ok {
+			return order, nil
+		}
+		stop, err := s.repo.GetStop(routeID, name)
+		if err != nil {
+			return 0, err
+		}
+		stopOrders[name] = stop.Order
+		return stop.Order, nil
+	}
+
+	for i := range tickets {
+		t := &tickets[i]
+		status := manifestStatus(t)
+		if status == "" || (manifest.Full && status != ManifestValid) {
+			continue
+		}
+
+		entry := ManifestEntry{
+			TicketID: t.Id,
+			Status:   status,
+			Expires:  t.ValidUntil.Unix(),
+		}
+		if status == ManifestValid {
+			if entry.FromStop, err = stopOrder(t.StartDestination); err != nil {
+				return nil, fmt.Errorf("failed to find start stop: %w", err)
+			}
+			if entry.ToStop, err = stopOrder(t.EndDestination); err != nil {
+				return nil, fmt.Errorf("failed to find destination stop: %w", err)
+			}
+		}
+		manifest.Tickets = append(manifest.Tickets, entry)
+	}
+
+	return manifest, nil
+}
+
+// SyncScans records scans a bus made while offline, earliest first, and
+// reports the ones that could not be recorded.
+func (s *service) SyncScans(req ScanSyncRequest) (*ScanSyncResult, error) {
+	order := make([]int, len(req.Scans))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return req.Scans[order[a]].ScannedAt.Before(req.Scans[order[b]].ScannedAt)
+	})
+
+	result := &ScanSyncResult{Conflicts: []CheckConflict{}}
+	now := time.Now()
+	for _, i := range order {
+		scan := req.Scans[i]
+
+		conflict, err := s.syncScan(req, scan, now)
+		if err != nil {
+			return nil, err
+		}
+		if conflict != nil {
+			conflict.Index = i
+			result.Conflicts = append(result.Conflicts, *conflict)
+			continue
+		}
+		result.Accepted++
+	}
+
+	sort.Slice(result.Conflicts, func(a, b int) bool { return result.Conflicts[a].Index < result.Conflicts[b].Index })
+	return result, nil
+}
+
+func (s *service) syncScan(req ScanSyncRequest, scan OfflineScan, now time.Time) (*CheckConflict, error) {
+	if scan.QRCode == "" || scan.ScannedAt.IsZero() {
+		return &CheckConflict{Reason: ConflictInvalid, Message: "qr_code and scanned_at are required"}, nil
+	}
+	if scan.ScannedAt.After(now.Add(maxScanClockSkew)) {
+		return &CheckConflict{Reason: ConflictInvalid, Message: "scanned_at is in the future"}, nil
+	}
+	if now.Sub(scan.ScannedAt) > maxScanAge {
+		return &CheckConflict{Reason: ConflictInvalid, Message: "scanned_at is too old"}, nil
+	}
+
+	// Codes had to be valid when they were scanned, not now
+	var t *domain.Ticket
+	var err error
+	switch {
+	case IsDynamicQR(scan.QRCode):
+		if now.Sub(scan.ScannedAt) > maxDynamicScanAge {
+			return &CheckConflict{Reason: ConflictInvalid, Message: "Rotating QR code scans must be synced within 6 hours"}, nil
+		}
+		t, err = s.verifyDynamicQR(scan.QRCode, scan.ScannedAt)
+		if err != nil {
+			return &CheckConflict{Reason: ConflictInvalid, Message: err.Error()}, nil
+		}
+	case !s.staticQR:
+		return &CheckConflict{Reason: ConflictInvalid, Message: "Static QR codes are not accepted"}, nil
+	case IsSignedToken(scan.QRCode):
+		claims, verr := s.keyring.Verify(scan.QRCode, scan.ScannedAt)
+		if verr != nil {
+			return &CheckConflict{Reason: ConflictInvalid, Message: verr.Error()}, nil
+		}
+		t, err = s.repo.Get(claims.TicketID)
+	default:
+		t, err = s.repo.GetByQRCode(scan.QRCode)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return &CheckConflict{Reason: ConflictInvalid, Message: "Ticket not found"}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s.RecordCheck(CheckEvent{
+		TicketID:        t.Id,
+		QRCode:          t.QRCode,
+		RouteID:         req.RouteID,
+		CurrentStoppage: scan.CurrentStoppage.Name,
+		CheckedAt:       scan.ScannedAt,
+		BusName:         req.BusName,
+	})
+}
+
+// markCheckedInCache stops live checks from accepting a ticket recorded as used.
+func (s *service) markCheckedInCache(qrCode string) {
+	key := fmt.Sprintf("ticket_valid:%s", qrCode)
+	val, err := s.redis.Get(s.ctx, key).Result()
+	if err != nil {
+		return
+	}
+
+	var ticketData map[string]interface{}
+	if err := json.Unmarshal([]byte(val), &ticketData); err != nil {
+		return
+	}
+	if checked, ok := ticketData["checked"].(bool); ok && checked {
+		return
+	}
+	ticketData["checked"] = true
+	updatedJSON, _ := json.Marshal(ticketData)
+	s.redis.Set(s.ctx, key, updatedJSON, redis.KeepTTL)
+}
+
+// stateConflict returns why a ticket in its current state cannot be checked,
+// or nil if it can.
+func stateConflict(t *domain.Ticket) *CheckConflict {
+	switch State(t.Status) {
+	case StatePaid:
+		return nil
+	case StateCancelled, StateRefunded:
+		return &CheckConflict{TicketID: t.Id, Reason: ConflictRevoked, Message: "Ticket has been cancelled"}
+	case StateExpired:
+		return &CheckConflict{TicketID: t.Id, Reason: ConflictRevoked, Message: "Ticket has expired"}
+	case StatePendingPayment:
+		return &CheckConflict{TicketID: t.Id, Reason: ConflictUnpaid, Message: "Ticket is unpaid"}
+	default:
+		return &CheckConflict{TicketID: t.Id, Reason: ConflictDoubleUse, Message: "Ticket already used"}
+	}
+}
+
+// manifestStatus returns the manifest state of a ticket, or "" for tickets
+// that are still awaiting payment.
+func manifestStatus(t *domain.Ticket) string {
+	switch State(t.Status) {
+	case StatePendingPayment:
+		return ""
+	case StatePaid:
+		return ManifestValid
+	case StateChecked, StateOverTravelDue:
+		return ManifestUsed
+	default:
+		return ManifestRevoked
+	}
+}
@@ -0,0 +1,164 @@
+package ticket
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Prefix of signed ticket tokens. Anything else in a QR is a legacy ticket UUID.
+const tokenPrefix = "ST1"
+
+// TokenClaims is the signed content of a ticket QR. Stops are identified by
+// their order on the route so a bus can detect over-travel offline.
+type TokenClaims struct {
+	TicketID   int64 `json:"tid"`
+	RouteID    int64 `json:"rid"`
+	FromStop   int   `json:"from"`
+	ToStop     int   `json:"to"`
+	NotBefore  int64 `json:"nbf"`
+	Expires    int64 `json:"exp"`
+	Passengers int   `json:"pax"`
+}
+
+// PublicKey is a verification key published to bus devices.
+type PublicKey struct {
+	KID       string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Key       string `json:"public_key"` // base64url, unpadded
+	Active    bool   `json:"active"`
+}
+
+// Keyring holds the Ed25519 keys tickets are signed with, by key ID. New
+// tickets are signed with the active key; tokens signed with any key in the
+// ring still verify, so a key can be rotated by adding a new one, making it
+// active and removing the old one once its tickets have expired.
+type Keyring struct {
+	active string
+	keys   map[string]ed25519.PrivateKey
+}
+
+// NewKeyring parses keys given as comma separated "kid:seed" pairs, where
+// seed is a base64 encoded 32 byte Ed25519 seed. With no keys configured a
+// development key is derived from secret, but only when devKey is set, so a
+// missing key in production fails instead of signing with the app secret.
+func NewKeyring(spec, activeKID, secret string, devKey bool) (*Keyring, error) {
+	kr := &Keyring{keys: make(map[string]ed25519.PrivateKey)}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, encoded, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || strings.Contains(kid, ".") {
+			return nil, fmt.Errorf("invalid ticket signing key entry %q", kid)
+		}
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("ticket signing key %q must be a base64 encoded %d byte seed", kid, ed25519.SeedSize)
+		}
+		kr.keys[kid] = ed25519.NewKeyFromSeed(seed)
+	}
+
+	if len(kr.keys) == 0 {
+		if !devKey {
+			return nil, fmt.Errorf("no ticket signing keys are configured; set TICKET_SIGNING_KEYS, or TICKET_SIGNING_DEV_KEY=true in development")
+		}
+		seed := sha256.Sum256([]byte("ticket-signing:" + secret))
+		kr.keys["dev"] = ed25519.NewKeyFromSeed(seed[:])
+		activeKID = "dev"
+	}
+
+	if activeKID == "" && len(kr.keys) == 1 {
+		for kid := range kr.keys {
+			activeKID = kid
+		}
+	}
+	if _, ok := kr.keys[activeKID]; !ok {
+		return nil, fmt.Errorf("active ticket signing key %q is not configured", activeKID)
+	}
+	kr.active = activeKID
+
+	return kr, nil
+}
+
+// Sign returns the QR token for claims:
+//
+//	ST1.<kid>.<base64url(claims JSON)>.<base64url(signature)>
+//
+// The signature covers everything before the last dot.
+func (kr *Keyring) Sign(claims TokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := tokenPrefix + "." + kr.active + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig := ed25519.Sign(kr.keys[kr.active], []byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Verify checks a token's signature and validity window and returns its claims.
+func (kr *Keyring) Verify(token string, now time.Time) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] != tokenPrefix {
+		return nil, fmt.Errorf("malformed ticket token")
+	}
+
+	key, ok := kr.keys[parts[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown ticket signing key")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ticket token")
+	}
+	signed := token[:len(token)-len(parts[3])-1]
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), []byte(signed), sig) {
+		return nil, fmt.Errorf("invalid ticket signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ticket token")
+	}
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed ticket token")
+	}
+
+	if now.Unix() < claims.NotBefore {
+		return nil, fmt.Errorf("ticket is not valid yet")
+	}
+	if now.Unix() > claims.Expires {
+		return nil, fmt.Errorf("ticket has expired")
+	}
+
+	return &claims, nil
+}
+
+// PublicKeys lists the verification keys, sorted by key ID.
+func (kr *Keyring) PublicKeys() []PublicKey {
+	keys := make([]PublicKey, 0, len(kr.keys))
+	for kid, key := range kr.keys {
+		keys = append(keys, PublicKey{
+			KID:       kid,
+			Algorithm: "Ed25519",
+			Key:       base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			Active:    kid == kr.active,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KID < keys[j].KID })
+	return keys
+}
+
+// IsSignedToken reports whether a scanned QR holds a signed token rather than a legacy UUID.
+func IsSignedToken(qr string) bool {
+	return strings.HasPrefix(qr, tokenPrefix+".")
+}
@@ -0,0 +1,91 @@
+package ticket
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ticket types
+const (
+	TypeSingle        = "single"         // A trip bought in the app
+	TypeRFID          = "rfid"           // A trip paid by tapping an RFID card
+	TypeRFIDCompanion = "rfid_companion" // A companion's trip paid by the same tap; not counted towards fare caps
+	TypeOverTravel    = "over_travel"    // Extra fare for riding past the destination
+)
+
+// Validity of a ticket type with no configured rule
+const defaultTicketValidity = 4 * time.Hour
+
+// ValidityRule is how long a ticket can be used after it is issued: either
+// a fixed duration, or until the end of the service day it was issued on.
+type ValidityRule struct {
+	Duration   time.Duration
+	ServiceDay bool
+}
+
+// ValidityPolicy decides the validity window of new tickets by type.
+type ValidityPolicy struct {
+	rules         map[string]ValidityRule
+	serviceDayEnd time.Duration // Since local midnight
+}
+
+// NewValidityPolicy parses rules given as comma separated "type:rule" pairs,
+// where rule is a duration such as "90m" or "service_day". The service day
+// ends at serviceDayEnd ("HH:MM" local time, default 23:59); a value past
+// midnight such as "02:00" lets late tickets run into the next morning.
+func NewValidityPolicy(spec, serviceDayEnd string) (*ValidityPolicy, error) {
+	p := &ValidityPolicy{
+		rules:         make(map[string]ValidityRule),
+		serviceDayEnd: 23*time.Hour + 59*time.Minute,
+	}
+
+	if serviceDayEnd != "" {
+		end, err := time.Parse("15:04", serviceDayEnd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service day end %q, want HH:MM", serviceDayEnd)
+		}
+		p.serviceDayEnd = time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ticketType, value, ok := strings.Cut(entry, ":")
+		if !ok || ticketType == "" {
+			return nil, fmt.Errorf("invalid ticket validity entry %q", entry)
+		}
+		if value == "service_day" {
+			p.rules[ticketType] = ValidityRule{ServiceDay: true}
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid validity %q for ticket type %q", value, ticketType)
+		}
+		p.rules[ticketType] = ValidityRule{Duration: d}
+	}
+
+	return p, nil
+}
+
+// Window returns when a ticket of ticketType issued at from stops being valid.
+func (p *ValidityPolicy) Window(ticketType string, from time.Time) (time.Time, time.Time) {
+	rule, ok := p.rules[ticketType]
+	if !ok {
+		rule = ValidityRule{Duration: defaultTicketValidity}
+	}
+	if !rule.ServiceDay {
+		return from, from.Add(rule.Duration)
+	}
+
+	local := from.In(time.Local)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+	end := midnight.Add(p.serviceDayEnd)
+	if !end.After(local) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return from, end
+}
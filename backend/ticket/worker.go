@@ -8,6 +8,7 @@ import (
 
 	"swift_transit/domain"
 	"swift_transit/infra/rabbitmq"
+	"swift_transit/ledger"
 	"swift_transit/model"
 
 	"github.com/google/uuid"
@@ -109,6 +110,12 @@ func (w *TicketWorker) ProcessTicket(req TicketRequestMessage, trackingID string
 	if req.Quantity == 0 {
 		req.Quantity = 1
 	}
+	// Requests queued before fare categories existed are all adults
+	if len(req.Passengers) == 0 {
+		for i := 0; i < req.Quantity; i++ {
+			req.Passengers = append(req.Passengers, PassengerFare{Category: FareAdult, Fare: req.Fare})
+		}
+	}
 
 	batchID := req.BatchID
 	if batchID == "" {
@@ -116,118 +123,172 @@ func (w *TicketWorker) ProcessTicket(req TicketRequestMessage, trackingID string
 	}
 
 	paymentRef := fmt.Sprintf("TICKET-%s", uuid.New().String()[:8])
-	now := time.Now().Format(time.RFC3339)
+	issuedAt := time.Now()
+	now := issuedAt.Format(time.RFC3339)
+	validFrom, validUntil := s.validity.Window(TypeSingle, issuedAt)
 	paymentStatus := "pending"
 	paidStatus := false
 	paymentUsed := false
+	state := StatePendingPayment
+	orderStatus := OrderPendingPayment
 
-	if req.PaymentMethod == "wallet" {
-		// Deduct balance for all tickets together
-		err := s.userRepo.DeductBalance(req.UserId, req.TotalFare)
-		if err != nil {
-			log.Printf("Payment failed: %v", err)
-			statusData := map[string]interface{}{
-				"status": "failed",
-				"error":  "Insufficient balance",
-			}
-			statusJSON, _ := json.Marshal(statusData)
-			s.redis.Set(s.ctx, fmt.Sprintf("ticket_status:%s", trackingID), statusJSON, 1*time.Hour)
-			return
+	failed := func(msg string) {
+		statusData := map[string]interface{}{
+			"status": "failed",
+			"error":  msg,
 		}
+		statusJSON, _ := json.Marshal(statusData)
+		s.redis.Set(s.ctx, fmt.Sprintf("ticket_status:%s", trackingID), statusJSON, 1*time.Hour)
+	}
+
+	if req.PaymentMethod == "wallet" {
 		paidStatus = true
 		paymentStatus = "paid"
 		paymentUsed = true
+		state = StatePaid
+		orderStatus = OrderPaid
 	}
 
-	var ticketIDs []int64
-	var qrCodes []string
-	for i := 0; i < req.Quantity; i++ {
-		qrCode := uuid.New().String()
-		qrCodes = append(qrCodes, qrCode)
-		ticket := domain.Ticket{
-			UserId:           req.UserId,
-			RouteId:          req.RouteId,
-			BusName:          req.BusName,
-			StartDestination: req.StartDestination,
-			EndDestination:   req.EndDestination,
-			Fare:             req.Fare,
-			PaidStatus:       paidStatus,
-			Checked:          false,
-			QRCode:           qrCode,
-			CreatedAt:        now,
-			BatchID:          batchID,
-			PaymentMethod:    req.PaymentMethod,
-			PaymentReference: paymentRef,
-			PaymentStatus:    paymentStatus,
-			PaymentUsed:      paymentUsed,
-		}
+	order := domain.Order{
+		UserId:           req.UserId,
+		RouteId:          req.RouteId,
+		BusName:          req.BusName,
+		StartDestination: req.StartDestination,
+		EndDestination:   req.EndDestination,
+		PaymentMethod:    req.PaymentMethod,
+		TotalFare:        req.TotalFare,
+		Discount:         req.Discount,
+		Status:           string(orderStatus),
+		BatchID:          batchID,
+	}
+	for _, p := range req.Passengers {
+		order.Items = append(order.Items, domain.OrderItem{
+			FareCategory: string(p.Category),
+			Fare:         p.Fare,
+			Discount:     p.Discount,
+			Ticket: &domain.Ticket{
+				UserId:           req.UserId,
+				RouteId:          req.RouteId,
+				BusName:          req.BusName,
+				StartDestination: req.StartDestination,
+				EndDestination:   req.EndDestination,
+				Fare:             p.Fare,
+				PaidStatus:       paidStatus,
+				Checked:          false,
+				QRCode:           uuid.New().String(),
+				CreatedAt:        now,
+				BatchID:          batchID,
+				PaymentMethod:    req.PaymentMethod,
+				PaymentReference: paymentRef,
+				PaymentStatus:    paymentStatus,
+				PaymentUsed:      paymentUsed,
+				Status:           string(state),
+				TicketType:       TypeSingle,
+				ValidFrom:        validFrom,
+				ValidUntil:       validUntil,
+			},
+		})
+	}
 
-		createdTicket, err := s.repo.Create(ticket)
-		if err != nil {
-			log.Printf("Failed to create ticket: %v", err)
-			statusData := map[string]interface{}{
-				"status": "failed",
-				"error":  "Failed to create ticket",
+	// Wallet purchases debit the balance for all tickets together, in the
+	// same transaction as the order and its statement entry
+	failure := "Failed to create ticket"
+	description := fmt.Sprintf("Ticket Purchase - %s (x%d)", req.BusName, len(order.Items))
+	if req.PromoCode != "" {
+		description += fmt.Sprintf(" with promo %s", req.PromoCode)
+	}
+	// Orders a promo code made free have nothing to take from the wallet
+	walletDebit := req.PaymentMethod == "wallet" && req.TotalFare > 0
+	err := s.uow.Do(func(tx Tx) error {
+		if walletDebit {
+			err := tx.DeductBalance(req.UserId, req.TotalFare, domain.WalletPosting{
+				Account:     ledger.AccountFares,
+				Kind:        ledger.KindFare,
+				Description: description,
+				Reference:   "batch:" + batchID,
+			})
+			if err != nil {
+				failure = "Insufficient balance"
+				return err
 			}
-			statusJSON, _ := json.Marshal(statusData)
-			s.redis.Set(s.ctx, fmt.Sprintf("ticket_status:%s", trackingID), statusJSON, 1*time.Hour)
-			return
 		}
-		ticketIDs = append(ticketIDs, createdTicket.Id)
-	}
-
-	if req.PaymentMethod == "wallet" {
-		// Create Transaction
-		err := s.CreateTransaction(model.Transaction{
+		if err := tx.CreateOrder(&order, ActorUser(req.UserId), "purchased with "+req.PaymentMethod); err != nil {
+			return err
+		}
+		// The code is used up with the order, even while its payment is pending
+		if req.PromoId != 0 {
+			err := tx.RedeemPromo(&domain.PromoRedemption{
+				PromoId:  req.PromoId,
+				OrderId:  order.Id,
+				UserId:   req.UserId,
+				Discount: req.Discount,
+			})
+			if err != nil {
+				failure = err.Error()
+				return err
+			}
+		}
+		if !walletDebit {
+			return nil
+		}
+		return tx.CreateTransaction(model.Transaction{
 			UserID:        int(req.UserId),
 			Amount:        req.TotalFare,
 			Type:          "purchase",
-			Description:   fmt.Sprintf("Ticket Purchase - %s (x%d)", req.BusName, req.Quantity),
+			Description:   description,
 			PaymentMethod: "Swift Balance",
 			CreatedAt:     time.Now(),
 		})
-		if err != nil {
-			log.Printf("Failed to create transaction: %v", err)
-		}
+	})
+	if err != nil {
+		log.Printf("Failed to create order: %v", err)
+		failed(failure)
+		return
+	}
+	created := &order
 
+	var ticketIDs []int64
+	for _, item := range created.Items {
+		ticketIDs = append(ticketIDs, item.TicketId)
+	}
+
+	if req.PaymentMethod == "wallet" {
 		statusData := map[string]interface{}{
 			"status":     "paid",
 			"url":        fmt.Sprintf("/ticket/download?id=%d", ticketIDs[0]),
 			"ticket_id":  ticketIDs[0],
 			"ticket_ids": ticketIDs,
+			"order_id":   created.Id,
 		}
 		statusJSON, _ := json.Marshal(statusData)
 		s.redis.Set(s.ctx, fmt.Sprintf("ticket_status:%s", trackingID), statusJSON, 1*time.Hour)
 
-		// Store valid ticket in Redis for 4 hours
-		for i, tid := range ticketIDs {
-			validTicket := map[string]interface{}{
-				"ticket_id":         tid,
-				"route_id":          req.RouteId,
-				"start_destination": req.StartDestination,
-				"end_destination":   req.EndDestination,
-				"user_id":           req.UserId,
-				"created_at":        now,
-				"checked":           false,
-			}
-			validTicketJSON, _ := json.Marshal(validTicket)
-			s.redis.Set(s.ctx, fmt.Sprintf("ticket_valid:%s", qrCodes[i]), validTicketJSON, 4*time.Hour)
+		// Store valid tickets in Redis for live checks
+		for _, item := range created.Items {
+			s.cacheTicket(item.Ticket)
 		}
 	} else {
-		tranID := fmt.Sprintf("TICKET-%d-%s", ticketIDs[0], batchID[:8])
-		successUrl := fmt.Sprintf("%s/ticket/payment/success?id=%d", baseURL, ticketIDs[0])
-		failUrl := fmt.Sprintf("%s/ticket/payment/fail?id=%d", baseURL, ticketIDs[0])
-		cancelUrl := fmt.Sprintf("%s/ticket/payment/cancel?id=%d", baseURL, ticketIDs[0])
+		tranID := fmt.Sprintf("ORDER-%d-%s", created.Id, uuid.New().String()[:8])
+		if _, err := s.orders.CreatePaymentAttempt(domain.PaymentAttempt{
+			OrderId: created.Id,
+			TranID:  tranID,
+			Gateway: "sslcommerz",
+			Amount:  req.TotalFare,
+			Status:  PaymentInitiated,
+		}); err != nil {
+			log.Printf("Failed to record payment attempt: %v", err)
+			failed("Gateway init failed")
+			return
+		}
+
+		successUrl := fmt.Sprintf("%s/ticket/payment/success?tran_id=%s", baseURL, tranID)
+		failUrl := fmt.Sprintf("%s/ticket/payment/fail?tran_id=%s", baseURL, tranID)
+		cancelUrl := fmt.Sprintf("%s/ticket/payment/cancel?tran_id=%s", baseURL, tranID)
 
 		gatewayUrl, err := s.sslCommerz.InitPayment(req.TotalFare, tranID, successUrl, failUrl, cancelUrl)
 		if err != nil {
 			log.Printf("Gateway init failed: %v", err)
-			statusData := map[string]interface{}{
-				"status": "failed",
-				"error":  "Gateway init failed",
-			}
-			statusJSON, _ := json.Marshal(statusData)
-			s.redis.Set(s.ctx, fmt.Sprintf("ticket_status:%s", trackingID), statusJSON, 1*time.Hour)
+			failed("Gateway init failed")
 			return
 		}
 
@@ -236,6 +297,7 @@ func (w *TicketWorker) ProcessTicket(req TicketRequestMessage, trackingID string
 			"url":        gatewayUrl,
 			"ticket_id":  ticketIDs[0],
 			"ticket_ids": ticketIDs,
+			"order_id":   created.Id,
 		}
 		statusJSON, _ := json.Marshal(statusData)
 		s.redis.Set(s.ctx, fmt.Sprintf("ticket_status:%s", trackingID), statusJSON, 1*time.Hour)
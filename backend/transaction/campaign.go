@@ -0,0 +1,132 @@
+package transaction
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"swift_transit/domain"
+)
+
+// RechargeOffer is a recharge product with the bonus it earns now, before
+// per-user limits.
+type RechargeOffer struct {
+	domain.RechargeProduct
+	Bonus    domain.Money `json:"bonus"`
+	Campaign string       `json:"campaign,omitempty"`
+}
+
+// ListRechargeOffers returns the active recharge products with the largest
+// bonus a running campaign gives each.
+func (s *service) ListRechargeOffers() ([]RechargeOffer, error) {
+	products, err := s.repo.ListRechargeProducts(true)
+	if err != nil {
+		return nil, err
+	}
+	campaigns, err := s.repo.ActiveRechargeCampaigns(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	offers := make([]RechargeOffer, 0, len(products))
+	for _, p := range products {
+		offer := RechargeOffer{RechargeProduct: p}
+		// Campaigns come largest bonus first
+		for _, c := range campaigns {
+			if c.MinAmount <= p.Amount {
+				offer.Bonus = c.Bonus
+				offer.Campaign = c.Name
+				break
+			}
+		}
+		offers = append(offers, offer)
+	}
+	return offers, nil
+}
+
+func (s *service) ListRechargeProducts() ([]domain.RechargeProduct, error) {
+	return s.repo.ListRechargeProducts(false)
+}
+
+// CreateRechargeProduct lets wallets be recharged by amount, a whole number
+// of taka.
+func (s *service) CreateRechargeProduct(amount domain.Money) (*domain.RechargeProduct, error) {
+	if amount <= 0 || amount%domain.Taka != 0 {
+		return nil, fmt.Errorf("amount must be a positive whole number of taka")
+	}
+	limit, err := s.repo.GetDefaultRechargeLimit()
+	if err != nil {
+		return nil, err
+	}
+	if amount > limit {
+		return nil, fmt.Errorf("amount must be at most the daily recharge limit of %s", limit)
+	}
+	return s.repo.CreateRechargeProduct(amount)
+}
+
+func (s *service) SetRechargeProductActive(id int64, active bool) (*domain.RechargeProduct, error) {
+	product, err := s.repo.SetRechargeProductActive(id, active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("recharge product not found")
+	}
+	return product, err
+}
+
+func (s *service) ListRechargeLimits() ([]domain.RechargeLimit, error) {
+	return s.repo.ListRechargeLimits()
+}
+
+// SetRechargeLimit sets the most a user may recharge per day, or with a nil
+// user the default for everyone without their own limit.
+func (s *service) SetRechargeLimit(userID *int64, limit domain.Money) (*domain.RechargeLimit, error) {
+	if limit <= 0 || limit%domain.Taka != 0 {
+		return nil, fmt.Errorf("daily limit must be a positive whole number of taka")
+	}
+	set, err := s.repo.SetRechargeLimit(userID, limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user not found")
+	}
+	return set, err
+}
+
+// RemoveRechargeLimit puts a user back on the default daily recharge limit.
+func (s *service) RemoveRechargeLimit(userID int64) error {
+	err := s.repo.DeleteRechargeLimit(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user has no recharge limit of their own")
+	}
+	return err
+}
+
+func (s *service) ListCampaigns() ([]domain.RechargeCampaign, error) {
+	return s.repo.ListRechargeCampaigns()
+}
+
+func (s *service) CreateCampaign(c domain.RechargeCampaign) (*domain.RechargeCampaign, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	switch {
+	case c.Name == "":
+		return nil, fmt.Errorf("name is required")
+	case c.MinAmount <= 0 || c.Bonus <= 0:
+		return nil, fmt.Errorf("min_amount and bonus must be positive")
+	case c.StartsAt.IsZero() || !c.EndsAt.After(c.StartsAt):
+		return nil, fmt.Errorf("ends_at must be after starts_at")
+	case c.PerUserLimit != nil && *c.PerUserLimit < 1:
+		return nil, fmt.Errorf("per_user_limit must be at least 1")
+	case c.Budget != nil && *c.Budget < c.Bonus:
+		return nil, fmt.Errorf("budget must cover at least one bonus")
+	}
+	return s.repo.CreateRechargeCampaign(c)
+}
+
+// SetCampaignActive pauses or resumes a campaign. Bonuses already given
+// are kept.
+func (s *service) SetCampaignActive(id int64, active bool) (*domain.RechargeCampaign, error) {
+	campaign, err := s.repo.SetRechargeCampaignActive(id, active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("recharge campaign not found")
+	}
+	return campaign, err
+}
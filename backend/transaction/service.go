@@ -2,40 +2,50 @@ package transaction
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
-	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 
+	"swift_transit/domain"
 	"swift_transit/infra/payment"
 	"swift_transit/model"
 	"swift_transit/repo"
-	"swift_transit/user"
 )
 
 type Service interface {
 	GetTransactions(userID int) ([]model.Transaction, error)
-	InitRecharge(ctx context.Context, userID int64, amount float64) (gatewayURL string, tranID string, err error)
+	CheckRechargeAmount(amount domain.Money) error
+	InitRecharge(ctx context.Context, userID int64, amount domain.Money) (gatewayURL string, tranID string, err error)
 	CompleteRecharge(ctx context.Context, tranID, valID string) error
 	CancelRecharge(ctx context.Context, tranID string) error
+
+	ListRechargeOffers() ([]RechargeOffer, error)
+	ListRechargeProducts() ([]domain.RechargeProduct, error)
+	CreateRechargeProduct(amount domain.Money) (*domain.RechargeProduct, error)
+	SetRechargeProductActive(id int64, active bool) (*domain.RechargeProduct, error)
+	ListCampaigns() ([]domain.RechargeCampaign, error)
+	CreateCampaign(c domain.RechargeCampaign) (*domain.RechargeCampaign, error)
+	SetCampaignActive(id int64, active bool) (*domain.RechargeCampaign, error)
+	ListRechargeLimits() ([]domain.RechargeLimit, error)
+	SetRechargeLimit(userID *int64, limit domain.Money) (*domain.RechargeLimit, error)
+	RemoveRechargeLimit(userID int64) error
 }
 
 type service struct {
 	repo          *repo.TransactionRepo
-	userRepo      user.UserRepo
 	sslCommerz    *payment.SSLCommerz
 	redis         *redis.Client
 	publicBaseURL string
 }
 
-func NewService(repo *repo.TransactionRepo, userRepo user.UserRepo, sslCommerz *payment.SSLCommerz, redis *redis.Client, publicBaseURL string) Service {
+func NewService(repo *repo.TransactionRepo, sslCommerz *payment.SSLCommerz, redis *redis.Client, publicBaseURL string) Service {
 	return &service{
 		repo:          repo,
-		userRepo:      userRepo,
 		sslCommerz:    sslCommerz,
 		redis:         redis,
 		publicBaseURL: publicBaseURL,
@@ -43,54 +53,117 @@ func NewService(repo *repo.TransactionRepo, userRepo user.UserRepo, sslCommerz *
 }
 
 func (s *service) GetTransactions(userID int) ([]model.Transaction, error) {
-	trans, err := s.repo.GetByUserID(userID)
-	if err != nil {
-		return nil, err
-	}
-	for i := range trans {
-		trans[i].Amount = math.Round(trans[i].Amount*100) / 100
-	}
-	return trans, nil
+	return s.repo.GetByUserID(userID)
 }
 
+// How long a recharge waits for the gateway
+const rechargeSessionTTL = time.Hour
+
+// rechargeSession is a recharge waiting for the gateway, kept in Redis
+// under recharge:<tran_id>. StartedAt decides which campaigns it counts for.
 type rechargeSession struct {
-	UserID int64   `json:"user_id"`
-	Amount float64 `json:"amount"`
+	UserID    int64        `json:"user_id"`
+	Amount    domain.Money `json:"amount"`
+	StartedAt time.Time    `json:"started_at"`
 }
 
-var allowedRechargeAmounts = map[float64]bool{
-	50:  true,
-	100: true,
-	200: true,
-	300: true,
-	400: true,
-	500: true,
+// CheckRechargeAmount reports whether a wallet can be recharged by amount,
+// that is whether an active recharge product has it.
+func (s *service) CheckRechargeAmount(amount domain.Money) error {
+	_, err := s.repo.GetActiveRechargeProduct(amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("invalid amount: choose one of the recharge products")
+	}
+	return err
 }
 
-func (s *service) InitRecharge(ctx context.Context, userID int64, amount float64) (string, string, error) {
-	if !allowedRechargeAmounts[amount] {
-		return "", "", fmt.Errorf("invalid amount: choose between 50 and 500")
+func (s *service) InitRecharge(ctx context.Context, userID int64, amount domain.Money) (string, string, error) {
+	if err := s.CheckRechargeAmount(amount); err != nil {
+		return "", "", err
 	}
 
+	now := time.Now()
 	tranID := fmt.Sprintf("RECHARGE-%d-%s", userID, uuid.NewString()[:8])
+	if err := s.reserveRecharge(ctx, userID, tranID, amount, now); err != nil {
+		return "", "", err
+	}
+
 	successURL := fmt.Sprintf("%s/wallet/recharge/success?tran_id=%s", s.publicBaseURL, tranID)
 	failURL := fmt.Sprintf("%s/wallet/recharge/fail?tran_id=%s", s.publicBaseURL, tranID)
 	cancelURL := fmt.Sprintf("%s/wallet/recharge/cancel?tran_id=%s", s.publicBaseURL, tranID)
 
 	gatewayURL, err := s.sslCommerz.InitPayment(amount, tranID, successURL, failURL, cancelURL)
 	if err != nil {
+		s.redis.HDel(ctx, s.pendingKey(userID), tranID)
 		return "", "", err
 	}
 
-	payload := rechargeSession{UserID: userID, Amount: amount}
+	payload := rechargeSession{UserID: userID, Amount: amount, StartedAt: now}
 	data, _ := json.Marshal(payload)
-	if err := s.redis.Set(ctx, s.rechargeKey(tranID), data, time.Hour).Err(); err != nil {
+	if err := s.redis.Set(ctx, s.rechargeKey(tranID), data, rechargeSessionTTL).Err(); err != nil {
+		s.redis.HDel(ctx, s.pendingKey(userID), tranID)
 		return "", "", err
 	}
 
 	return gatewayURL, tranID, nil
 }
 
+// reserveRecharge counts amount against the user's daily limit until the
+// recharge tranID is paid, cancelled or expires. Recharges still at the
+// gateway count, so several started at once cannot together pass the limit.
+func (s *service) reserveRecharge(ctx context.Context, userID int64, tranID string, amount domain.Money, now time.Time) error {
+	key := s.pendingKey(userID)
+	reserve := func(tx *redis.Tx) error {
+		pending, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var reserved domain.Money
+		var expired []string
+		for id, val := range pending {
+			var held, expiresAt int64
+			if _, err := fmt.Sscanf(val, "%d:%d", &held, &expiresAt); err != nil || expiresAt <= now.Unix() {
+				expired = append(expired, id)
+				continue
+			}
+			reserved += domain.Money(held)
+		}
+
+		limit, err := s.repo.GetRechargeLimit(userID)
+		if err != nil {
+			return err
+		}
+		recharged, err := s.repo.SumRecharged(userID, dayStart(now))
+		if err != nil {
+			return err
+		}
+		if recharged+reserved+amount > limit {
+			return fmt.Errorf("daily recharge limit of %s reached, %s left today", limit, domain.MaxMoney(limit-recharged-reserved, 0))
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(expired) > 0 {
+				pipe.HDel(ctx, key, expired...)
+			}
+			pipe.HSet(ctx, key, tranID, fmt.Sprintf("%d:%d", int64(amount), now.Add(rechargeSessionTTL).Unix()))
+			pipe.Expire(ctx, key, rechargeSessionTTL)
+			return nil
+		})
+		return err
+	}
+
+	// Retry when another recharge of the user changed the reservations meanwhile
+	for i := 0; i < 3; i++ {
+		err := s.redis.Watch(ctx, reserve, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("another recharge is being started, try again")
+}
+
+// CompleteRecharge credits a recharge the gateway reports paid, with any
+// campaign bonus. A repeated callback for the same recharge credits nothing.
 func (s *service) CompleteRecharge(ctx context.Context, tranID, valID string) error {
 	session, err := s.loadSession(ctx, tranID)
 	if err != nil {
@@ -101,30 +174,29 @@ func (s *service) CompleteRecharge(ctx context.Context, tranID, valID string) er
 		return err
 	}
 
-	if err := s.userRepo.CreditBalance(session.UserID, session.Amount); err != nil {
-		return err
+	// Sessions started before campaigns existed have no start time
+	startedAt := session.StartedAt
+	if startedAt.IsZero() {
+		startedAt = time.Now()
 	}
-
-	if err := s.repo.Create(model.Transaction{
-		UserID:        int(session.UserID),
-		Amount:        session.Amount,
-		Type:          "credit",
-		Description:   "Wallet recharge",
-		PaymentMethod: "SSLCommerz",
-		CreatedAt:     time.Now(),
-	}); err != nil {
+	if _, _, err := s.repo.CompleteRecharge(session.UserID, tranID, session.Amount, startedAt); err != nil {
 		return err
 	}
 
+	// The recharge now counts towards the limit as recharged
 	s.redis.Del(ctx, s.rechargeKey(tranID))
+	s.redis.HDel(ctx, s.pendingKey(session.UserID), tranID)
 	return nil
 }
 
 func (s *service) CancelRecharge(ctx context.Context, tranID string) error {
+	if session, err := s.loadSession(ctx, tranID); err == nil {
+		s.redis.HDel(ctx, s.pendingKey(session.UserID), tranID)
+	}
 	return s.redis.Del(ctx, s.rechargeKey(tranID)).Err()
 }
 
-func (s *service) validateRecharge(valID, tranID string, expectedAmount float64) error {
+func (s *service) validateRecharge(valID, tranID string, expectedAmount domain.Money) error {
 	resp, err := s.sslCommerz.ValidateTransaction(valID)
 	if err != nil {
 		return fmt.Errorf("validation failed: %w", err)
@@ -138,13 +210,13 @@ func (s *service) validateRecharge(valID, tranID string, expectedAmount float64)
 		return fmt.Errorf("transaction mismatch")
 	}
 
-	amount, err := parseAmount(resp.Amount)
+	amount, err := resp.PaidAmount()
 	if err != nil {
 		return err
 	}
 
 	if amount != expectedAmount {
-		return fmt.Errorf("amount mismatch: expected %.2f, got %.2f", expectedAmount, amount)
+		return fmt.Errorf("amount mismatch: expected %s, got %s", expectedAmount, amount)
 	}
 
 	return nil
@@ -171,6 +243,14 @@ func (s *service) rechargeKey(tranID string) string {
 	return fmt.Sprintf("recharge:%s", tranID)
 }
 
-func parseAmount(amountStr string) (float64, error) {
-	return strconv.ParseFloat(amountStr, 64)
+// pendingKey holds the recharges of a user still at the gateway, as
+// tran_id → "<amount in poisha>:<expiry unix time>".
+func (s *service) pendingKey(userID int64) string {
+	return fmt.Sprintf("recharge_pending:%d", userID)
+}
+
+// dayStart returns local midnight of the day containing now.
+func dayStart(now time.Time) time.Time {
+	local := now.In(time.Local)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
 }
@@ -9,14 +9,13 @@ type Service interface {
 	Find(mobile, password string) (*domain.User, error)
 	Create(user domain.User) (*domain.User, error)
 	Info(ctx context.Context) (*domain.User, error)
-	DeductBalance(id int64, amount float64) error
-	CreditBalance(id int64, amount float64) error
+	DeductBalance(id int64, amount domain.Money, posting domain.WalletPosting) error
+	CreditBalance(id int64, amount domain.Money, posting domain.WalletPosting) error
 	UpdatePassword(email, newPassword string) error
 	FindByEmail(email string) (*domain.User, error)
 	UpdateProfile(id int64, name, email, mobile string) (*domain.User, error)
 	ChangePassword(id int64, currentPassword, newPassword string) error
 	GetWithPassword(id int64) (*domain.User, error)
-	ToggleRFIDStatus(userID int64, active bool) error
 }
 
 // UserRepo interface
@@ -24,13 +23,13 @@ type UserRepo interface {
 	Find(mobile, password string) (*domain.User, error) // login
 	Create(user domain.User) (*domain.User, error)      // create new user
 	Info(ctx context.Context) (*domain.User, error)
-	DeductBalance(id int64, amount float64) error
-	CreditBalance(id int64, amount float64) error
+	DeductBalance(id int64, amount domain.Money, posting domain.WalletPosting) error
+	CreditBalance(id int64, amount domain.Money, posting domain.WalletPosting) error
 	UpdatePassword(email, newPassword string) error
 	FindByEmail(email string) (*domain.User, error)
 	UpdateProfile(id int64, name, email, mobile string) (*domain.User, error)
 	GetWithPassword(id int64) (*domain.User, error)
 	UpdatePasswordByID(id int64, newPassword string) error
 	FindByRFID(rfid string) (*domain.User, error)
-	ToggleRFIDStatus(userID int64, active bool) error
+	GetSharedGuardian(dependentID int64) (*domain.User, error)
 }
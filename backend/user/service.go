@@ -3,7 +3,6 @@ package user
 import (
 	"context"
 	"fmt"
-	"math"
 	"swift_transit/domain"
 
 	"golang.org/x/crypto/bcrypt"
@@ -27,7 +26,6 @@ func (svc *service) Info(ctx context.Context) (*domain.User, error) {
 	if usr == nil {
 		return nil, nil
 	}
-	usr.Balance = float32(math.Round(float64(usr.Balance)*100) / 100)
 	return usr, nil
 }
 
@@ -52,12 +50,12 @@ func (svc *service) Find(mobile string, password string) (*domain.User, error) {
 	return usr, nil
 }
 
-func (svc *service) DeductBalance(id int64, amount float64) error {
-	return svc.userRepo.DeductBalance(id, amount)
+func (svc *service) DeductBalance(id int64, amount domain.Money, posting domain.WalletPosting) error {
+	return svc.userRepo.DeductBalance(id, amount, posting)
 }
 
-func (svc *service) CreditBalance(id int64, amount float64) error {
-	return svc.userRepo.CreditBalance(id, amount)
+func (svc *service) CreditBalance(id int64, amount domain.Money, posting domain.WalletPosting) error {
+	return svc.userRepo.CreditBalance(id, amount, posting)
 }
 
 func (svc *service) UpdatePassword(email, newPassword string) error {
@@ -88,7 +86,3 @@ func (svc *service) ChangePassword(id int64, currentPassword, newPassword string
 func (svc *service) GetWithPassword(id int64) (*domain.User, error) {
 	return svc.userRepo.GetWithPassword(id)
 }
-
-func (svc *service) ToggleRFIDStatus(userID int64, active bool) error {
-	return svc.userRepo.ToggleRFIDStatus(userID, active)
-}
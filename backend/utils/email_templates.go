@@ -4,7 +4,9 @@ import (
 	"fmt"
 )
 
-func GetOTPEmailBody(otp string) string {
+// emailLayout wraps the HTML of a message in the Swift Transit template.
+// footerNote is the last line of the footer.
+func emailLayout(content, footerNote string) string {
 	return fmt.Sprintf(`
 <!DOCTYPE html>
 <html>
@@ -102,7 +104,21 @@ func GetOTPEmailBody(otp string) string {
             <h1 class="title">Swift Transit</h1>
         </div>
 
-        <!-- Main Content -->
+%s
+        <!-- Footer -->
+        <div class="footer">
+            <p>&copy; 2025 Swift Transit. All rights reserved.</p>
+            <p>%s</p>
+        </div>
+
+    </div>
+</body>
+</html>
+`, content, footerNote)
+}
+
+func GetOTPEmailBody(otp string) string {
+	return emailLayout(fmt.Sprintf(`        <!-- Main Content -->
         <div class="content">
             <p>Hello,</p>
             <p>Please use the One-Time Password (OTP) provided below to complete your verification.</p>
@@ -110,16 +126,27 @@ func GetOTPEmailBody(otp string) string {
             <div class="otp-box">%s</div>
 
             <p class="note">This OTP is valid for 10 minutes. For your security, please do not share this code with anyone.</p>
-        </div>
+        </div>`, otp), "If you did not request this OTP, simply ignore this email.")
+}
 
-        <!-- Footer -->
-        <div class="footer">
-            <p>&copy; 2025 Swift Transit. All rights reserved.</p>
-            <p>If you did not request this OTP, simply ignore this email.</p>
-        </div>
+// GetLowBalanceEmailBody tells a user their wallet balance fell below their
+// alert threshold. With a topUpURL it also links the recharge started for
+// them.
+func GetLowBalanceEmailBody(name, balance, threshold, topUpAmount, topUpURL string) string {
+	topUp := `<p>Recharge your wallet from the app to keep tapping on without interruption.</p>`
+	if topUpURL != "" {
+		topUp = fmt.Sprintf(`<p>Your auto top-up of %s BDT is ready. Complete the payment to add it to your wallet:</p>
 
-    </div>
-</body>
-</html>
-`, otp)
+            <p><a href="%s">Pay %s BDT</a></p>
+
+            <p class="note">This payment link expires in one hour.</p>`, topUpAmount, topUpURL, topUpAmount)
+	}
+	return emailLayout(fmt.Sprintf(`        <!-- Main Content -->
+        <div class="content">
+            <p>Hello %s,</p>
+            <p>Your Swift Transit wallet balance is <strong>%s BDT</strong>, below your alert threshold of %s BDT.</p>
+
+            %s
+        </div>
+`, name, balance, threshold, topUp), "You can change or turn off balance alerts in the app.")
 }
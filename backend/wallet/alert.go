@@ -0,0 +1,126 @@
+package wallet
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/utils"
+)
+
+const (
+	alertInterval  = time.Minute
+	alertBatchSize = 200
+
+	// Highest threshold a user can set
+	maxAlertThreshold = 5000 * domain.Taka
+)
+
+// ErrNoBalanceAlert is returned for a user who has not set a low-balance
+// alert.
+var ErrNoBalanceAlert = errors.New("no balance alert is set")
+
+// GetBalanceAlert returns a user's low-balance alert.
+func (s *service) GetBalanceAlert(userID int64) (*domain.BalanceAlert, error) {
+	alert, err := s.repo.GetBalanceAlert(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoBalanceAlert
+	}
+	return alert, err
+}
+
+// SetBalanceAlert creates or replaces a user's low-balance alert. The auto
+// top-up amount must be one a wallet can be recharged by. Changing the alert
+// re-arms it, so it fires on the next check if the balance is already below
+// the new threshold.
+func (s *service) SetBalanceAlert(req BalanceAlertRequest) (*domain.BalanceAlert, error) {
+	if req.Threshold <= 0 || req.Threshold > maxAlertThreshold {
+		return nil, fmt.Errorf("threshold must be more than 0 and at most %s", maxAlertThreshold)
+	}
+	if req.AutoTopUpAmount != nil {
+		if err := s.recharger.CheckRechargeAmount(*req.AutoTopUpAmount); err != nil {
+			return nil, fmt.Errorf("auto top-up: %w", err)
+		}
+	}
+	return s.repo.UpsertBalanceAlert(req.UserId, req.Threshold, req.AutoTopUpAmount)
+}
+
+func (s *service) DeleteBalanceAlert(userID int64) error {
+	return s.repo.DeleteBalanceAlert(userID)
+}
+
+// SendBalanceAlerts notifies the users whose balance fell below their
+// threshold since the last run, starting their auto top-up if they have one,
+// and re-arms the alerts of users whose balance recovered. Each alert is
+// claimed before it is sent, so it fires once even with several instances
+// running. It returns how many alerts were sent.
+func (s *service) SendBalanceAlerts(now time.Time) (int, error) {
+	if _, err := s.repo.ResetBalanceAlerts(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for {
+		users, err := s.repo.ClaimLowBalances(now, alertBatchSize)
+		if err != nil {
+			return sent, err
+		}
+		for _, u := range users {
+			s.sendBalanceAlert(u)
+			sent++
+		}
+		if len(users) < alertBatchSize {
+			return sent, nil
+		}
+	}
+}
+
+// sendBalanceAlert emails a user whose balance is low. The gateway cannot
+// charge a saved card, so an auto top-up starts a recharge and the email
+// links its payment page. A failed recharge still sends a plain alert.
+func (s *service) sendBalanceAlert(u LowBalance) {
+	var topUpAmount, topUpURL string
+	if u.AutoTopUpAmount != nil {
+		gatewayURL, tranID, err := s.recharger.InitRecharge(s.ctx, u.UserId, *u.AutoTopUpAmount)
+		if err != nil {
+			log.Printf("Failed to start auto top-up for user %d: %v", u.UserId, err)
+		} else {
+			topUpAmount, topUpURL = u.AutoTopUpAmount.String(), gatewayURL
+			if err := s.repo.SetTopUpTranID(u.UserId, tranID); err != nil {
+				log.Printf("Failed to record auto top-up %s for user %d: %v", tranID, u.UserId, err)
+			}
+		}
+	}
+
+	body := utils.GetLowBalanceEmailBody(u.Name, u.Balance.String(), u.Threshold.String(), topUpAmount, topUpURL)
+	if err := utils.SendEmail(u.Email, "Swift Transit Low Balance", body); err != nil {
+		log.Printf("Failed to send low balance alert to user %d: %v", u.UserId, err)
+	}
+}
+
+// AlertWorker checks balances against low-balance alerts every minute.
+type AlertWorker struct {
+	svc Service
+}
+
+func NewAlertWorker(svc Service) *AlertWorker {
+	return &AlertWorker{svc: svc}
+}
+
+func (w *AlertWorker) Start() {
+	ticker := time.NewTicker(alertInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := w.svc.SendBalanceAlerts(time.Now())
+		if err != nil {
+			log.Printf("Failed to send balance alerts: %v", err)
+		} else if n > 0 {
+			log.Printf("Sent %d low balance alert(s)", n)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,175 @@
+package wallet
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"swift_transit/domain"
+	"swift_transit/model"
+)
+
+// GetFamily returns the guardians and dependents of a user, invited or active.
+func (s *service) GetFamily(userID int64) (*Family, error) {
+	members, err := s.repo.ListMembers(userID)
+	if err != nil {
+		return nil, err
+	}
+	family := &Family{Guardians: []domain.FamilyMember{}, Dependents: []domain.FamilyMember{}}
+	for _, m := range members {
+		if m.GuardianId == userID {
+			family.Dependents = append(family.Dependents, m)
+		} else {
+			family.Guardians = append(family.Guardians, m)
+		}
+	}
+	return family, nil
+}
+
+// Invite asks the user with a mobile number to become guardianID's
+// dependent. The dependent has to accept before the guardian sees anything.
+func (s *service) Invite(guardianID int64, mobile string) (*domain.FamilyMember, error) {
+	dependent, err := s.repo.FindUserByMobile(strings.TrimSpace(mobile))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no Swift Transit user has this mobile number")
+	} else if err != nil {
+		return nil, err
+	}
+	if dependent.Id == guardianID {
+		return nil, fmt.Errorf("you cannot add yourself to your family")
+	}
+
+	// Two users cannot be each other's guardian
+	if _, err := s.repo.GetActiveMember(dependent.Id, guardianID); err == nil {
+		return nil, fmt.Errorf("%s is already your guardian", dependent.Name)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	count, err := s.repo.CountDependents(guardianID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxDependents {
+		return nil, fmt.Errorf("a guardian can have at most %d dependents", MaxDependents)
+	}
+
+	member, err := s.repo.CreateMember(guardianID, dependent.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s is already in your family", dependent.Name)
+	}
+	return member, err
+}
+
+// Accept makes dependentID a dependent of the guardian who invited them.
+func (s *service) Accept(dependentID, memberID int64) (*domain.FamilyMember, error) {
+	member, err := s.repo.GetMember(memberID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && member.DependentId != dependentID) {
+		return nil, fmt.Errorf("invite not found")
+	} else if err != nil {
+		return nil, err
+	}
+	if member.Status == MemberActive {
+		return member, nil
+	}
+
+	activated, err := s.repo.ActivateMember(memberID)
+	if err != nil {
+		return nil, err
+	}
+	if !activated {
+		return nil, fmt.Errorf("you already have a guardian; leave that family first")
+	}
+	return s.repo.GetMember(memberID)
+}
+
+// Leave ends a family link or declines an invite. Either side can do it.
+func (s *service) Leave(userID, memberID int64) error {
+	member, err := s.repo.GetMember(memberID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && member.GuardianId != userID && member.DependentId != userID) {
+		return fmt.Errorf("family member not found")
+	} else if err != nil {
+		return err
+	}
+	return s.repo.DeleteMember(memberID)
+}
+
+// SetSharedWallet lets a dependent's RFID taps draw from the guardian's
+// wallet when their own balance does not cover the fare, or stops it.
+func (s *service) SetSharedWallet(guardianID, memberID int64, shared bool) (*domain.FamilyMember, error) {
+	member, err := s.repo.GetMember(memberID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && member.GuardianId != guardianID) {
+		return nil, fmt.Errorf("family member not found")
+	} else if err != nil {
+		return nil, err
+	}
+	if member.Status != MemberActive {
+		return nil, fmt.Errorf("%s has not accepted the invite yet", member.DependentName)
+	}
+	if err := s.repo.SetSharedWallet(memberID, shared); err != nil {
+		return nil, err
+	}
+	member.SharedWallet = shared
+	return member, nil
+}
+
+// GetDependentWallet returns the balance and statement of one of
+// guardianID's dependents.
+func (s *service) GetDependentWallet(guardianID, dependentID int64) (*DependentWallet, error) {
+	member, err := s.dependent(guardianID, dependentID)
+	if err != nil {
+		return nil, err
+	}
+	dependent, err := s.repo.GetUser(dependentID)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.statements.GetByUserID(int(dependentID))
+	if err != nil {
+		return nil, err
+	}
+	if transactions == nil {
+		transactions = []model.Transaction{}
+	}
+	return &DependentWallet{Member: *member, Balance: dependent.Balance, Transactions: transactions}, nil
+}
+
+// GetDependentTrips returns a page of a dependent's tickets, without what
+// would let the guardian ride on them.
+func (s *service) GetDependentTrips(guardianID, dependentID int64, limit, offset int) ([]domain.Ticket, int, error) {
+	if _, err := s.dependent(guardianID, dependentID); err != nil {
+		return nil, 0, err
+	}
+	tickets, total, err := s.trips.GetByUserID(dependentID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range tickets {
+		tickets[i].QRCode = ""
+	}
+	return tickets, total, nil
+}
+
+// FundDependent starts a transfer from a guardian to one of their
+// dependents. It is confirmed with an OTP like any other transfer.
+func (s *service) FundDependent(guardianID, dependentID int64, amount domain.Money, note string) (*PendingTransfer, error) {
+	if _, err := s.dependent(guardianID, dependentID); err != nil {
+		return nil, err
+	}
+	return s.InitTransfer(TransferRequest{
+		SenderId:    guardianID,
+		RecipientId: dependentID,
+		Amount:      amount,
+		Note:        note,
+	})
+}
+
+// dependent returns the active link between a guardian and a dependent.
+func (s *service) dependent(guardianID, dependentID int64) (*domain.FamilyMember, error) {
+	member, err := s.repo.GetActiveMember(guardianID, dependentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("not one of your dependents")
+	}
+	return member, err
+}
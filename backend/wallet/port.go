@@ -0,0 +1,120 @@
+package wallet
+
+import (
+	"context"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/model"
+)
+
+// TransferRequest asks to send money to another user, identified by mobile
+// number or, when funding a dependent, by ID.
+type TransferRequest struct {
+	SenderId    int64        `json:"-"`
+	Mobile      string       `json:"mobile"`
+	RecipientId int64        `json:"-"`
+	Amount      domain.Money `json:"amount"`
+	Note        string       `json:"note"`
+}
+
+// PendingTransfer is a transfer waiting for the sender to confirm it with
+// the OTP sent to their email.
+type PendingTransfer struct {
+	TransferID    string       `json:"transfer_id"`
+	RecipientName string       `json:"recipient_name"`
+	Amount        domain.Money `json:"amount"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+	Message       string       `json:"message"`
+}
+
+// Family is the family groups a user belongs to, from both sides.
+type Family struct {
+	Guardians  []domain.FamilyMember `json:"guardians"`
+	Dependents []domain.FamilyMember `json:"dependents"`
+}
+
+// DependentWallet is what a guardian sees of a dependent's wallet.
+type DependentWallet struct {
+	Member       domain.FamilyMember `json:"member"`
+	Balance      domain.Money        `json:"balance"`
+	Transactions []model.Transaction `json:"transactions"`
+}
+
+// BalanceAlertRequest sets a user's low-balance alert. AutoTopUpAmount is
+// optional.
+type BalanceAlertRequest struct {
+	UserId          int64         `json:"-"`
+	Threshold       domain.Money  `json:"threshold"`
+	AutoTopUpAmount *domain.Money `json:"auto_topup_amount"`
+}
+
+// LowBalance is a user whose balance fell below their alert threshold.
+type LowBalance struct {
+	UserId          int64         `db:"user_id"`
+	Name            string        `db:"name"`
+	Email           string        `db:"email"`
+	Balance         domain.Money  `db:"balance"`
+	Threshold       domain.Money  `db:"threshold"`
+	AutoTopUpAmount *domain.Money `db:"auto_topup_amount"`
+}
+
+type Service interface {
+	InitTransfer(req TransferRequest) (*PendingTransfer, error)
+	ConfirmTransfer(senderID int64, transferID, otp string) (*domain.WalletTransfer, error)
+	ListTransfers(userID int64, limit, offset int) ([]domain.WalletTransfer, int, error)
+
+	GetFamily(userID int64) (*Family, error)
+	Invite(guardianID int64, mobile string) (*domain.FamilyMember, error)
+	Accept(dependentID, memberID int64) (*domain.FamilyMember, error)
+	Leave(userID, memberID int64) error
+	SetSharedWallet(guardianID, memberID int64, shared bool) (*domain.FamilyMember, error)
+	GetDependentWallet(guardianID, dependentID int64) (*DependentWallet, error)
+	GetDependentTrips(guardianID, dependentID int64, limit, offset int) ([]domain.Ticket, int, error)
+	FundDependent(guardianID, dependentID int64, amount domain.Money, note string) (*PendingTransfer, error)
+
+	GetBalanceAlert(userID int64) (*domain.BalanceAlert, error)
+	SetBalanceAlert(req BalanceAlertRequest) (*domain.BalanceAlert, error)
+	DeleteBalanceAlert(userID int64) error
+	SendBalanceAlerts(now time.Time) (int, error)
+}
+
+type Repo interface {
+	GetUser(id int64) (*domain.User, error)
+	FindUserByMobile(mobile string) (*domain.User, error)
+	Transfer(t *domain.WalletTransfer, dailyLimit domain.Money, since time.Time) error
+	SumSent(senderID int64, since time.Time) (domain.Money, error)
+	ListTransfers(userID int64, limit, offset int) ([]domain.WalletTransfer, int, error)
+
+	CreateMember(guardianID, dependentID int64) (*domain.FamilyMember, error)
+	GetMember(id int64) (*domain.FamilyMember, error)
+	GetActiveMember(guardianID, dependentID int64) (*domain.FamilyMember, error)
+	ListMembers(userID int64) ([]domain.FamilyMember, error)
+	CountDependents(guardianID int64) (int, error)
+	ActivateMember(id int64) (bool, error)
+	DeleteMember(id int64) error
+	SetSharedWallet(id int64, shared bool) error
+
+	GetBalanceAlert(userID int64) (*domain.BalanceAlert, error)
+	UpsertBalanceAlert(userID int64, threshold domain.Money, autoTopUp *domain.Money) (*domain.BalanceAlert, error)
+	DeleteBalanceAlert(userID int64) error
+	ResetBalanceAlerts() (int, error)
+	ClaimLowBalances(now time.Time, limit int) ([]LowBalance, error)
+	SetTopUpTranID(userID int64, tranID string) error
+}
+
+// StatementRepo reads a user's wallet statement.
+type StatementRepo interface {
+	GetByUserID(userID int) ([]model.Transaction, error)
+}
+
+// TripRepo reads a user's tickets, newest first.
+type TripRepo interface {
+	GetByUserID(userId int64, limit, offset int) ([]domain.Ticket, int, error)
+}
+
+// Recharger starts gateway recharges of a user's wallet.
+type Recharger interface {
+	CheckRechargeAmount(amount domain.Money) error
+	InitRecharge(ctx context.Context, userID int64, amount domain.Money) (gatewayURL string, tranID string, err error)
+}
@@ -0,0 +1,78 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"swift_transit/domain"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MinTransfer is the smallest amount a transfer can move.
+const MinTransfer = 10 * domain.Taka
+
+// MaxDependents is how many dependents, invited or active, a guardian can have.
+const MaxDependents = 6
+
+// Family member states
+const (
+	MemberInvited = "invited" // Waiting for the dependent to accept
+	MemberActive  = "active"
+)
+
+// Limits bound what a user can send to other wallets.
+type Limits struct {
+	PerTransfer domain.Money // Most one transfer can move
+	Daily       domain.Money // Most a user can send per day, from local midnight
+}
+
+// NewLimits parses the per-transfer and daily limits, given in taka. Empty
+// limits default to 5000 per transfer and 10000 per day.
+func NewLimits(perTransfer, daily string) (Limits, error) {
+	limits := Limits{PerTransfer: 5000 * domain.Taka, Daily: 10000 * domain.Taka}
+	if perTransfer != "" {
+		amount, err := domain.ParseMoney(perTransfer)
+		if err != nil || amount < MinTransfer {
+			return Limits{}, fmt.Errorf("invalid per-transfer limit %q", perTransfer)
+		}
+		limits.PerTransfer = amount
+	}
+	if daily != "" {
+		amount, err := domain.ParseMoney(daily)
+		if err != nil || amount < limits.PerTransfer {
+			return Limits{}, fmt.Errorf("invalid daily transfer limit %q, it must be at least the per-transfer limit", daily)
+		}
+		limits.Daily = amount
+	}
+	return limits, nil
+}
+
+type service struct {
+	repo       Repo
+	statements StatementRepo
+	trips      TripRepo
+	recharger  Recharger
+	redis      *redis.Client
+	ctx        context.Context
+	limits     Limits
+}
+
+func NewService(repo Repo, statements StatementRepo, trips TripRepo, recharger Recharger, redis *redis.Client, ctx context.Context, limits Limits) Service {
+	return &service{
+		repo:       repo,
+		statements: statements,
+		trips:      trips,
+		recharger:  recharger,
+		redis:      redis,
+		ctx:        ctx,
+		limits:     limits,
+	}
+}
+
+// dayStart returns local midnight of the day containing now.
+func dayStart(now time.Time) time.Time {
+	local := now.In(time.Local)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,193 @@
+package wallet
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"swift_transit/domain"
+	"swift_transit/utils"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	// How long the sender has to confirm a transfer
+	transferOTPTTL = 5 * time.Minute
+
+	// Wrong codes after which a pending transfer is dropped
+	maxOTPAttempts = 5
+
+	maxNoteLength = 140
+)
+
+// transferSession is a pending transfer, kept in Redis under
+// wallet_transfer:<transfer id> until it is confirmed or expires. Codes tried
+// against it are counted under wallet_transfer_attempts:<transfer id>.
+type transferSession struct {
+	SenderId    int64        `json:"sender_id"`
+	RecipientId int64        `json:"recipient_id"`
+	Amount      domain.Money `json:"amount"`
+	Note        string       `json:"note"`
+	OTP         string       `json:"otp"`
+}
+
+// InitTransfer checks a transfer against the sender's balance and limits and
+// emails them an OTP to confirm it with. No money moves until then.
+func (s *service) InitTransfer(req TransferRequest) (*PendingTransfer, error) {
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxNoteLength {
+		return nil, fmt.Errorf("note must be at most %d characters", maxNoteLength)
+	}
+	if req.Amount < MinTransfer || req.Amount > s.limits.PerTransfer {
+		return nil, fmt.Errorf("amount must be between %s and %s", MinTransfer, s.limits.PerTransfer)
+	}
+
+	var recipient *domain.User
+	var err error
+	if req.RecipientId != 0 {
+		recipient, err = s.repo.GetUser(req.RecipientId)
+	} else {
+		recipient, err = s.repo.FindUserByMobile(strings.TrimSpace(req.Mobile))
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no Swift Transit user has this mobile number")
+	} else if err != nil {
+		return nil, err
+	}
+	if recipient.Id == req.SenderId {
+		return nil, fmt.Errorf("you cannot transfer to your own wallet")
+	}
+
+	sender, err := s.repo.GetUser(req.SenderId)
+	if err != nil {
+		return nil, err
+	}
+	if sender.Email == "" {
+		return nil, fmt.Errorf("add an email to your profile to confirm transfers")
+	}
+	if sender.Balance < req.Amount {
+		return nil, fmt.Errorf("insufficient balance")
+	}
+	if err := s.checkDailyLimit(sender.Id, req.Amount); err != nil {
+		return nil, err
+	}
+
+	transferID := uuid.NewString()
+	otp := utils.GenerateOTP(6)
+	session, _ := json.Marshal(transferSession{
+		SenderId:    sender.Id,
+		RecipientId: recipient.Id,
+		Amount:      req.Amount,
+		Note:        req.Note,
+		OTP:         otp,
+	})
+	if err := s.redis.Set(s.ctx, transferKey(transferID), session, transferOTPTTL).Err(); err != nil {
+		return nil, err
+	}
+	if err := utils.SendEmail(sender.Email, "Swift Transit Transfer OTP", utils.GetOTPEmailBody(otp)); err != nil {
+		s.redis.Del(s.ctx, transferKey(transferID))
+		return nil, fmt.Errorf("failed to send OTP")
+	}
+
+	return &PendingTransfer{
+		TransferID:    transferID,
+		RecipientName: recipient.Name,
+		Amount:        req.Amount,
+		ExpiresAt:     time.Now().Add(transferOTPTTL),
+		Message:       "OTP sent to your email. Confirm it to send the money.",
+	}, nil
+}
+
+// ConfirmTransfer moves the money of a pending transfer once the sender
+// gives the right OTP. A transfer is made at most once.
+func (s *service) ConfirmTransfer(senderID int64, transferID, otp string) (*domain.WalletTransfer, error) {
+	key := transferKey(transferID)
+	val, err := s.redis.Get(s.ctx, key).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("transfer expired or not found")
+	} else if err != nil {
+		return nil, err
+	}
+	var session transferSession
+	if err := json.Unmarshal([]byte(val), &session); err != nil || session.SenderId != senderID {
+		return nil, fmt.Errorf("transfer expired or not found")
+	}
+
+	// Every code tried is counted before it is compared, with INCR, so
+	// parallel guesses cannot share a count or get past the limit
+	attemptsKey := transferAttemptsKey(transferID)
+	var incr *redis.IntCmd
+	_, err = s.redis.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(s.ctx, attemptsKey)
+		pipe.Expire(s.ctx, attemptsKey, transferOTPTTL)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	attempts := incr.Val()
+	if attempts > maxOTPAttempts {
+		s.redis.Del(s.ctx, key)
+		return nil, fmt.Errorf("too many wrong codes, start the transfer again")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(session.OTP), []byte(otp)) != 1 {
+		if attempts == maxOTPAttempts {
+			s.redis.Del(s.ctx, key)
+			return nil, fmt.Errorf("too many wrong codes, start the transfer again")
+		}
+		return nil, fmt.Errorf("invalid OTP")
+	}
+
+	// Whoever deletes the session makes the transfer
+	deleted, err := s.redis.Del(s.ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, fmt.Errorf("transfer expired or not found")
+	}
+	s.redis.Del(s.ctx, attemptsKey)
+
+	t := &domain.WalletTransfer{
+		SenderId:    session.SenderId,
+		RecipientId: session.RecipientId,
+		Amount:      session.Amount,
+		Note:        session.Note,
+	}
+	if err := s.repo.Transfer(t, s.limits.Daily, dayStart(time.Now())); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *service) ListTransfers(userID int64, limit, offset int) ([]domain.WalletTransfer, int, error) {
+	return s.repo.ListTransfers(userID, limit, offset)
+}
+
+// checkDailyLimit fails when sending amount would take the sender past
+// their daily limit.
+func (s *service) checkDailyLimit(senderID int64, amount domain.Money) error {
+	sent, err := s.repo.SumSent(senderID, dayStart(time.Now()))
+	if err != nil {
+		return err
+	}
+	if sent+amount > s.limits.Daily {
+		return fmt.Errorf("daily transfer limit of %s reached, you can send %s more today", s.limits.Daily, domain.MaxMoney(s.limits.Daily-sent, 0))
+	}
+	return nil
+}
+
+func transferKey(transferID string) string {
+	return fmt.Sprintf("wallet_transfer:%s", transferID)
+}
+
+func transferAttemptsKey(transferID string) string {
+	return fmt.Sprintf("wallet_transfer_attempts:%s", transferID)
+}